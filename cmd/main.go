@@ -21,17 +21,31 @@ func main() {
 	cfg := config.MustLoad()
 
 	log := setupLogger(cfg.Env)
-	fmt.Println(cfg)
+	// The config holds secrets, such as the MFA encryption key, so only the
+	// environment is logged.
+	log.Info("starting application", slog.String("env", cfg.Env))
 	dbURL := DBUrlSetup(cfg)
-	application := app.New(log, cfg.GRPC.Port, dbURL, cfg.TokenTTL)
+	application := app.New(log, cfg, dbURL)
 
 	go application.GRPCServer.MustRun()
+	go application.HTTPServer.MustRun()
+	go application.KeyRotator.Run()
+	go application.Revocation.Run()
+	go application.Groups.Run()
+	go application.Throttle.Run()
+	go application.Purger.Run()
 
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, syscall.SIGTERM, syscall.SIGINT)
 
 	<-stop
 
+	application.Purger.Stop()
+	application.Throttle.Stop()
+	application.Groups.Stop()
+	application.Revocation.Stop()
+	application.KeyRotator.Stop()
+	application.HTTPServer.Stop()
 	application.GRPCServer.Stop()
 }
 
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/Novochenko/sso/internal/config"
+	"github.com/Novochenko/sso/internal/services/keys"
+	"github.com/Novochenko/sso/internal/storage/mysql"
+)
+
+// rotate_keys forces a signing key rotation outside of the regular schedule.
+// With --emergency the current keys are unpublished at once, which
+// invalidates every token they signed; use it when a key may be compromised.
+func main() {
+	var emergency bool
+
+	flag.BoolVar(&emergency, "emergency", false, "drop the current keys from the JWKS immediately")
+	// flag.Parse() is called by config.MustLoad
+	cfg := config.MustLoad()
+
+	log := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelInfo}))
+
+	dbURL := fmt.Sprintf("%s:%s@tcp(%s)/%s?parseTime=true",
+		cfg.StoragePath.User,
+		cfg.StoragePath.Password,
+		cfg.StoragePath.Host,
+		cfg.StoragePath.DBName)
+	storage, err := mysql.New(dbURL)
+	if err != nil {
+		panic(err)
+	}
+
+	keyService := keys.New(
+		log,
+		storage,
+		cfg.Signing.Algorithm,
+		cfg.Signing.RotationInterval,
+		cfg.Signing.RefreshInterval,
+		cfg.TokenTTL,
+	)
+
+	ctx := context.Background()
+	keyService.MustLoad(ctx)
+
+	if emergency {
+		err = keyService.EmergencyRotate(ctx)
+	} else {
+		err = keyService.Rotate(ctx)
+	}
+	if err != nil {
+		panic(err)
+	}
+
+	fmt.Println("signing keys rotated")
+}
@@ -4,4 +4,10 @@ type App struct {
 	ID     int
 	Name   string
 	Secret string
+	// RequireVerifiedEmail denies tokens to users who have not verified
+	// their email address yet.
+	RequireVerifiedEmail bool
+	// OrgID is the organization the app belongs to; only its members get
+	// tokens for the app. Zero for apps open to every user.
+	OrgID int64
 }
@@ -0,0 +1,22 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// AuthorizationCode is an OAuth2 authorization code issued by the
+// authorization endpoint. Only the hash of the code is stored.
+type AuthorizationCode struct {
+	CodeHash            string
+	AppID               int
+	UserID              uuid.UUID
+	RedirectURI         string
+	Scope               string
+	Nonce               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+	AuthTime            time.Time
+	ExpiresAt           time.Time
+}
@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+// ClientToken is a machine access token issued to an app by the client
+// credentials grant.
+type ClientToken struct {
+	AccessToken string
+	Scopes      []string
+	ExpiresIn   time.Duration
+}
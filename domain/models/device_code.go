@@ -0,0 +1,29 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	DeviceCodePending  = "pending"
+	DeviceCodeApproved = "approved"
+	DeviceCodeDenied   = "denied"
+	DeviceCodeConsumed = "consumed"
+)
+
+// DeviceCode is a pending RFC 8628 device authorization. Only the hash of the
+// device code is stored; the user code is short and typed in by the user.
+type DeviceCode struct {
+	DeviceCodeHash string
+	UserCode       string
+	AppID          int
+	Scope          string
+	// UserID is set once a user approves or denies the request.
+	UserID       uuid.UUID
+	Status       string
+	PollInterval time.Duration
+	LastPolledAt time.Time
+	ExpiresAt    time.Time
+}
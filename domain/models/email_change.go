@@ -0,0 +1,22 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// EmailChange is a request to change a user's email. It takes effect once
+// confirmed from the new address and can be undone from the old one. Only
+// the hashes of the confirm and undo tokens are stored.
+type EmailChange struct {
+	ID               uuid.UUID
+	UserID           uuid.UUID
+	OldEmail         string
+	NewEmail         string
+	ConfirmTokenHash string
+	UndoTokenHash    string
+	ConfirmExpiresAt time.Time
+	UndoExpiresAt    time.Time
+	ConfirmedAt      time.Time
+}
@@ -0,0 +1,38 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Group is a set of users and other groups. Roles granted to a group are
+// held by its members and by the members of its subgroups, at any depth.
+// OrgID is zero for groups outside of any organization.
+type Group struct {
+	ID          int64
+	OrgID       int64
+	Name        string
+	Description string
+	CreatedAt   time.Time
+}
+
+// Subgroup is an edge of the group graph: the members of ChildID are
+// members of ParentID too.
+type Subgroup struct {
+	ParentID int64
+	ChildID  int64
+}
+
+// GroupMembers are the users and groups placed directly in a group.
+type GroupMembers struct {
+	UserIDs     []uuid.UUID
+	SubgroupIDs []int64
+}
+
+// UserGroup is a group a user belongs to. Direct is false for groups the
+// user is only in through one of their subgroups.
+type UserGroup struct {
+	Group  Group
+	Direct bool
+}
@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+// LoginFailures counts the failed logins for a throttle key, an account or a
+// source address, since the count last started over.
+type LoginFailures struct {
+	Key           string
+	Failures      int
+	LastFailureAt time.Time
+}
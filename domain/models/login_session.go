@@ -0,0 +1,24 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// LoginSession is a device a user signed in on: everything issued from one
+// login, refreshed tokens included. ID is the family id of the session's
+// refresh tokens and the sid claim of its access tokens. UserAgent and IP
+// are those of the login.
+type LoginSession struct {
+	ID         uuid.UUID
+	UserID     uuid.UUID
+	AppID      int
+	OrgID      int64
+	UserAgent  string
+	IP         string
+	CreatedAt  time.Time
+	LastSeenAt time.Time
+	ExpiresAt  time.Time
+	RevokedAt  *time.Time
+}
@@ -0,0 +1,35 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// NoOrg stands for the organization of a caller who is in none, such as an
+// anonymous one: they only get to see users outside of every organization.
+const NoOrg int64 = -1
+
+// Organization is a tenant: a company whose users and apps are kept apart
+// from those of other organizations.
+type Organization struct {
+	ID        int64
+	Slug      string
+	Name      string
+	CreatedAt time.Time
+}
+
+// OrgMembership is a user's place in an organization. Role is one of
+// "owner", "admin" and "member".
+type OrgMembership struct {
+	OrgID     int64
+	UserID    uuid.UUID
+	Role      string
+	CreatedAt time.Time
+}
+
+// UserOrganization is an organization as seen by one of its members.
+type UserOrganization struct {
+	Organization Organization
+	Role         string
+}
@@ -0,0 +1,26 @@
+package models
+
+// Role is a named set of permissions. AppID is zero for roles that apply in
+// every app.
+type Role struct {
+	ID          int64
+	AppID       int64
+	Name        string
+	Description string
+}
+
+// Permission is something a role allows. AppID is zero for permissions that
+// exist in every app.
+type Permission struct {
+	ID          int64
+	AppID       int64
+	Name        string
+	Description string
+}
+
+// Authorization is what a user may do in an app: the names of their roles
+// there and of the permissions those roles grant.
+type Authorization struct {
+	Roles       []string
+	Permissions []string
+}
@@ -0,0 +1,33 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type RefreshToken struct {
+	ID        uuid.UUID
+	FamilyID  uuid.UUID
+	TokenHash string
+	UserID    uuid.UUID
+	AppID     int
+	OrgID     int64
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+	RevokedAt *time.Time
+}
+
+type TokenPair struct {
+	AccessToken  string
+	RefreshToken string
+}
+
+// LoginResult is the outcome of a password login: a token pair or, for users
+// with a second factor, the challenge to complete the login with and the
+// kinds of second factor that can complete it.
+type LoginResult struct {
+	Tokens     TokenPair
+	MFAToken   string
+	MFAMethods []string
+}
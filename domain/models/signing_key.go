@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+const (
+	SigningKeyNext    = "next"
+	SigningKeyActive  = "active"
+	SigningKeyRetired = "retired"
+)
+
+// SigningKey is a versioned token signing key. PrivateKey holds the PEM
+// encoded PKCS#8 key. Retired keys stay published until PublishUntil so
+// tokens they signed can still be verified.
+type SigningKey struct {
+	Version      int
+	ID           string
+	Algorithm    string
+	PrivateKey   []byte
+	Status       string
+	CreatedAt    time.Time
+	ActivatedAt  *time.Time
+	RetiredAt    *time.Time
+	PublishUntil *time.Time
+}
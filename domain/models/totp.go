@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// TOTP is a user's authenticator app enrollment. Secret is sealed; the
+// enrollment only counts once confirmed with a first code. LastUsedStep is
+// the time step of the last accepted code, which may not be used again.
+type TOTP struct {
+	UserID       uuid.UUID
+	Secret       []byte
+	ConfirmedAt  time.Time
+	LastUsedStep int64
+}
+
+func (t TOTP) Enabled() bool {
+	return !t.ConfirmedAt.IsZero()
+}
+
+// TOTPEnrollment is what a user needs to set up an authenticator app.
+type TOTPEnrollment struct {
+	Secret string
+	URI    string
+}
@@ -7,9 +7,13 @@ import (
 )
 
 type User struct {
-	ID           uuid.UUID
-	Email        string
-	HashPassword []byte
+	ID            uuid.UUID
+	Email         string
+	HashPassword  []byte
+	EmailVerified bool
+	// PasswordResetRequired is set when the password turned up in a breach;
+	// the user cannot log in until they choose a new one.
+	PasswordResetRequired bool
 }
 
 func (u User) ValidateRegister() error {
@@ -7,3 +7,10 @@ type UserAccount struct {
 	UserName           string
 	ProfilePicturePath string
 }
+
+// DeletedUser is a soft deleted user waiting to be purged.
+type DeletedUser struct {
+	ID                 uuid.UUID
+	Email              string
+	ProfilePicturePath string
+}
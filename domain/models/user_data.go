@@ -0,0 +1,32 @@
+package models
+
+import "time"
+
+// UserData is everything stored about a user, as handed out by data exports.
+type UserData struct {
+	User        User
+	Account     UserAccount
+	Sessions    []LoginSession
+	AuditEvents []AuditEvent
+	AppGrants   []AppGrant
+	Orgs        []UserOrganization
+	Groups      []Group
+}
+
+// AuditEvent is a security relevant event in the user's history, derived
+// from the records kept for tokens, password resets and email changes.
+// AppID is zero for events that are not tied to an app.
+type AuditEvent struct {
+	Type       string
+	AppID      int
+	Detail     string
+	OccurredAt time.Time
+}
+
+// AppGrant is an app the user has signed in to.
+type AppGrant struct {
+	AppID          int
+	AppName        string
+	FirstGrantedAt time.Time
+	LastGrantedAt  time.Time
+}
@@ -0,0 +1,29 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// WebAuthnCredential is a passkey registered by a user. PublicKey is COSE
+// encoded; SignCount is the last signature counter the authenticator
+// reported.
+type WebAuthnCredential struct {
+	ID                []byte
+	UserID            uuid.UUID
+	Name              string
+	PublicKey         []byte
+	SignCount         uint32
+	AAGUID            []byte
+	AttestationFormat string
+	CreatedAt         time.Time
+	LastUsedAt        *time.Time
+}
+
+// PasskeyChallenge is what a client passes to the browser to run a WebAuthn
+// ceremony. Session identifies the ceremony when the response is sent back.
+type PasskeyChallenge struct {
+	OptionsJSON []byte
+	Session     string
+}
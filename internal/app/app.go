@@ -1,23 +1,50 @@
 package app
 
 import (
+	"context"
 	"log/slog"
+	"net/http"
 	"time"
 
 	grpcapp "github.com/Novochenko/sso/internal/app/grpc"
+	httpapp "github.com/Novochenko/sso/internal/app/http"
+	"github.com/Novochenko/sso/internal/config"
+	oidchttp "github.com/Novochenko/sso/internal/http/oidc"
+	wellknownhttp "github.com/Novochenko/sso/internal/http/wellknown"
+	"github.com/Novochenko/sso/internal/lib/blob"
+	"github.com/Novochenko/sso/internal/lib/breach"
+	"github.com/Novochenko/sso/internal/lib/clientinfo"
+	"github.com/Novochenko/sso/internal/lib/encrypt"
+	"github.com/Novochenko/sso/internal/lib/mail"
+	"github.com/Novochenko/sso/internal/lib/password"
+	"github.com/Novochenko/sso/internal/lib/ratelimit"
+	"github.com/Novochenko/sso/internal/lib/webauthn"
 	"github.com/Novochenko/sso/internal/services/auth"
+	"github.com/Novochenko/sso/internal/services/deletion"
+	"github.com/Novochenko/sso/internal/services/groups"
+	"github.com/Novochenko/sso/internal/services/keys"
+	"github.com/Novochenko/sso/internal/services/oidc"
+	"github.com/Novochenko/sso/internal/services/revocation"
+	"github.com/Novochenko/sso/internal/services/throttle"
+	"github.com/Novochenko/sso/internal/storage/memory"
 	"github.com/Novochenko/sso/internal/storage/mysql"
+	"github.com/redis/go-redis/v9"
 )
 
 type App struct {
 	GRPCServer *grpcapp.App
+	HTTPServer *httpapp.App
+	KeyRotator *keys.Keys
+	Revocation *revocation.Revocation
+	Groups     *groups.Groups
+	Throttle   *throttle.Throttle
+	Purger     *deletion.Deletion
 }
 
 func New(
 	log *slog.Logger,
-	grpcPort int,
+	cfg *config.Config,
 	storagePath string,
-	tokenTTL time.Duration,
 ) *App {
 
 	storage, err := mysql.New(storagePath)
@@ -25,10 +52,240 @@ func New(
 		panic(err)
 	}
 
-	authService := auth.New(log, storage, storage, storage, storage, tokenTTL)
+	keyService := keys.New(
+		log,
+		storage,
+		cfg.Signing.Algorithm,
+		cfg.Signing.RotationInterval,
+		cfg.Signing.RefreshInterval,
+		cfg.MaxSignedTTL(),
+	)
+	keyService.MustLoad(context.Background())
+
+	revocationService := revocation.New(log, storage, cfg.TokenTTL, cfg.Revocation.RefreshInterval)
+	revocationService.MustLoad(context.Background())
+
+	groupService := groups.New(log, storage, cfg.Groups.RefreshInterval)
+	groupService.MustLoad(context.Background())
+
+	loginThrottle := throttle.New(
+		log,
+		newLoginFailureStore(cfg.LoginThrottle.Store, storage),
+		throttle.Policy(cfg.LoginThrottle.Account),
+		throttle.Policy(cfg.LoginThrottle.IP),
+		cfg.LoginThrottle.Window,
+	)
+
+	pictureStore := newPictureStore(cfg.Blob)
+
+	secretCipher, err := encrypt.New(cfg.MFA.EncryptionKey)
+	if err != nil {
+		panic(err)
+	}
+
+	authService := auth.New(
+		log,
+		storage,
+		storage,
+		storage,
+		storage,
+		storage,
+		keyService,
+		revocationService,
+		storage,
+		storage,
+		storage,
+		storage,
+		storage,
+		storage,
+		storage,
+		storage,
+		groupService,
+		loginThrottle,
+		newBreachChecker(log, cfg.Breached),
+		secretCipher,
+		newMailer(log, cfg.Mail),
+		pictureStore,
+		cfg.TokenTTL,
+		cfg.RefreshTokenTTL,
+		cfg.Mail.EmailVerificationTTL,
+		cfg.Mail.PasswordResetTTL,
+		cfg.Mail.EmailChangeUndoTTL,
+		cfg.MFA.ChallengeTTL,
+		cfg.WebAuthn.ChallengeTTL,
+		cfg.MFA.TOTPIssuer,
+		webauthn.RelyingParty{
+			ID:      cfg.WebAuthn.RPID,
+			Name:    cfg.WebAuthn.RPName,
+			Origins: cfg.WebAuthn.Origins,
+		},
+		auth.Links{
+			VerifyEmail:        cfg.Mail.VerifyEmailURL,
+			ResetPassword:      cfg.Mail.ResetPasswordURL,
+			ConfirmEmailChange: cfg.Mail.ConfirmEmailChangeURL,
+			UndoEmailChange:    cfg.Mail.UndoEmailChangeURL,
+		},
+		passwordPolicies(cfg.PasswordPolicy),
+	)
+
+	oidcService := oidc.New(
+		log,
+		authService,
+		storage,
+		storage,
+		storage,
+		storage,
+		storage,
+		keyService,
+		loginThrottle,
+		cfg.OIDC.Issuer,
+		cfg.OIDC.CodeTTL,
+		cfg.TokenTTL,
+		cfg.OIDC.SessionTTL,
+		cfg.OIDC.DeviceCodeTTL,
+		cfg.OIDC.DevicePollInterval,
+		cfg.OIDC.DeviceMaxAttempts,
+	)
+
+	purger := deletion.New(log, storage, pictureStore, loginThrottle, cfg.Deletion.GracePeriod, cfg.Deletion.PurgeInterval)
+
+	rateLimit := ratelimit.UnaryServerInterceptor(
+		log,
+		newRateLimiter(cfg.RateLimit),
+		rateLimitPolicy(cfg.RateLimit.Default),
+		rateLimitPolicies(cfg.RateLimit.Methods),
+	)
+	grpcApp := grpcapp.New(log, authService, keyService, rateLimit, cfg.GRPC.Port)
+
+	mux := http.NewServeMux()
+	wellknownhttp.Register(mux, log, keyService)
+	oidchttp.Register(mux, log, oidcService, cfg.OIDC.SecureCookies)
+	httpApp := httpapp.New(log, clientinfo.Middleware(mux), cfg.HTTP.Port, cfg.HTTP.Timeout)
 
-	grpcApp := grpcapp.New(log, authService, grpcPort)
 	return &App{
 		GRPCServer: grpcApp,
+		HTTPServer: httpApp,
+		KeyRotator: keyService,
+		Revocation: revocationService,
+		Groups:     groupService,
+		Throttle:   loginThrottle,
+		Purger:     purger,
+	}
+}
+
+func newMailer(log *slog.Logger, cfg config.MailConfig) auth.Mailer {
+	switch cfg.Driver {
+	case "smtp":
+		return mail.NewSMTP(cfg.SMTP.Host, cfg.SMTP.Port, cfg.SMTP.Username, cfg.SMTP.Password, cfg.From)
+	case "file":
+		return mail.NewFile(cfg.Dir, cfg.From)
+	case "log":
+		return mail.NewLog(log)
+	default:
+		panic("unknown mail driver " + cfg.Driver)
+	}
+}
+
+func newBreachChecker(log *slog.Logger, cfg config.BreachedConfig) breach.Checkers {
+	var checkers breach.Checkers
+	if cfg.CorpusPath != "" {
+		indexPath := cfg.IndexPath
+		if indexPath == "" {
+			indexPath = cfg.CorpusPath + ".idx"
+		}
+		index, err := breach.LoadIndex(cfg.CorpusPath, indexPath)
+		if err != nil {
+			panic(err)
+		}
+		log.Info("breached password index loaded", slog.Int("hashes", index.Len()))
+		checkers = append(checkers, index)
+	}
+	if cfg.RangeAPI != "" {
+		checkers = append(checkers, breach.NewRangeClient(cfg.RangeAPI, &http.Client{Timeout: cfg.Timeout}))
+	}
+
+	return checkers
+}
+
+func newLoginFailureStore(store string, storage *mysql.Storage) throttle.Storage {
+	switch store {
+	case "mysql":
+		return storage
+	case "memory":
+		return memory.NewLoginFailures()
+	default:
+		panic("unknown login throttle store " + store)
+	}
+}
+
+func newRateLimiter(cfg config.RateLimitConfig) ratelimit.Limiter {
+	switch cfg.Backend {
+	case "memory":
+		return ratelimit.NewMemory()
+	case "redis":
+		client := redis.NewClient(&redis.Options{
+			Addr:     cfg.Redis.Addr,
+			Password: cfg.Redis.Password,
+			DB:       cfg.Redis.DB,
+		})
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := client.Ping(ctx).Err(); err != nil {
+			panic(err)
+		}
+		return ratelimit.NewRedis(client)
+	default:
+		panic("unknown rate limit backend " + cfg.Backend)
+	}
+}
+
+func rateLimitPolicies(cfg map[string]config.RateLimitPolicy) map[string]ratelimit.Policy {
+	policies := make(map[string]ratelimit.Policy, len(cfg))
+	for method, policy := range cfg {
+		policies[method] = rateLimitPolicy(policy)
+	}
+
+	return policies
+}
+
+func rateLimitPolicy(cfg config.RateLimitPolicy) ratelimit.Policy {
+	return ratelimit.Policy{
+		Total: ratelimit.Limit(cfg.Total),
+		IP:    ratelimit.Limit(cfg.IP),
+		App:   ratelimit.Limit(cfg.App),
+	}
+}
+
+func passwordPolicies(cfg config.PasswordPolicyConfig) password.Policies {
+	policies := password.Policies{
+		Default: password.Policy(cfg.Default),
+		Apps:    make(map[int64]password.Policy, len(cfg.Apps)),
+	}
+	for appID, policy := range cfg.Apps {
+		policies.Apps[appID] = password.Policy(policy)
+	}
+
+	return policies
+}
+
+func newPictureStore(cfg config.BlobConfig) auth.PictureStore {
+	switch cfg.Driver {
+	case "fs":
+		return blob.NewFS(cfg.Dir)
+	case "s3":
+		store, err := blob.NewS3(
+			cfg.S3.Endpoint,
+			cfg.S3.Region,
+			cfg.S3.Bucket,
+			cfg.S3.AccessKeyID,
+			cfg.S3.SecretAccessKey,
+			cfg.S3.UseSSL,
+		)
+		if err != nil {
+			panic(err)
+		}
+		return store
+	default:
+		panic("unknown blob driver " + cfg.Driver)
 	}
 }
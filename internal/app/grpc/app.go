@@ -6,6 +6,7 @@ import (
 	"net"
 
 	authgrpc "github.com/Novochenko/sso/internal/grpc/auth"
+	"github.com/Novochenko/sso/internal/lib/clientinfo"
 	"google.golang.org/grpc"
 )
 
@@ -15,10 +16,17 @@ type App struct {
 	port       int
 }
 
-func New(log *slog.Logger, authService authgrpc.Auth, port int) *App {
+// New serves the auth API. rateLimit runs after the client info is known.
+func New(
+	log *slog.Logger,
+	authService authgrpc.Auth,
+	keys authgrpc.Keys,
+	rateLimit grpc.UnaryServerInterceptor,
+	port int,
+) *App {
 
-	gRPCServer := grpc.NewServer()
-	authgrpc.Register(gRPCServer, authService)
+	gRPCServer := grpc.NewServer(grpc.ChainUnaryInterceptor(clientinfo.UnaryServerInterceptor, rateLimit))
+	authgrpc.Register(gRPCServer, authService, keys)
 
 	return &App{
 		log:        log,
@@ -9,11 +9,26 @@ import (
 )
 
 type Config struct {
-	Env            string      `yaml:"env" env-default:"local"`
-	StoragePath    DatabaseURL `yaml:"database_url" env-required:"true"`
-	GRPC           GRPCConfig  `yaml:"grpc"`
-	MigrationsPath string
-	TokenTTL       time.Duration `yaml:"token_ttl" env-default:"1h"`
+	Env             string      `yaml:"env" env-default:"local"`
+	StoragePath     DatabaseURL `yaml:"database_url" env-required:"true"`
+	GRPC            GRPCConfig  `yaml:"grpc"`
+	HTTP            HTTPConfig  `yaml:"http"`
+	MigrationsPath  string
+	TokenTTL        time.Duration        `yaml:"token_ttl" env-default:"1h"`
+	RefreshTokenTTL time.Duration        `yaml:"refresh_token_ttl" env-default:"720h"`
+	Signing         SigningConfig        `yaml:"signing"`
+	Revocation      RevocationConfig     `yaml:"revocation"`
+	Groups          GroupsConfig         `yaml:"groups"`
+	OIDC            OIDCConfig           `yaml:"oidc"`
+	Mail            MailConfig           `yaml:"mail"`
+	Blob            BlobConfig           `yaml:"blob"`
+	Deletion        DeletionConfig       `yaml:"deletion"`
+	MFA             MFAConfig            `yaml:"mfa"`
+	WebAuthn        WebAuthnConfig       `yaml:"webauthn"`
+	LoginThrottle   LoginThrottleConfig  `yaml:"login_throttle"`
+	RateLimit       RateLimitConfig      `yaml:"rate_limit"`
+	PasswordPolicy  PasswordPolicyConfig `yaml:"password_policy"`
+	Breached        BreachedConfig       `yaml:"breached_passwords"`
 }
 
 type DatabaseURL struct {
@@ -30,6 +45,226 @@ type GRPCConfig struct {
 	Timeout time.Duration `yaml:"timeout"`
 }
 
+type HTTPConfig struct {
+	Port    int           `yaml:"port" env-default:"8080"`
+	Timeout time.Duration `yaml:"timeout" env-default:"10s"`
+}
+
+// SigningConfig selects the algorithm new signing keys are generated for and
+// how often they are rotated. RefreshInterval is how often every replica
+// reloads the key set and checks whether a rotation is due.
+type SigningConfig struct {
+	Algorithm        string        `yaml:"algorithm" env-default:"RS256"`
+	RotationInterval time.Duration `yaml:"rotation_interval" env-default:"720h"`
+	RefreshInterval  time.Duration `yaml:"refresh_interval" env-default:"1m"`
+}
+
+// RevocationConfig.RefreshInterval bounds how long a revocation made on one
+// replica takes to be seen by the others.
+type RevocationConfig struct {
+	RefreshInterval time.Duration `yaml:"refresh_interval" env-default:"30s"`
+}
+
+// GroupsConfig.RefreshInterval bounds how long a subgroup change made on one
+// replica takes to be seen by the others.
+type GroupsConfig struct {
+	RefreshInterval time.Duration `yaml:"refresh_interval" env-default:"30s"`
+}
+
+// OIDCConfig configures the OpenID Connect endpoints served over HTTP.
+// Issuer is the external base URL of the HTTP server.
+type OIDCConfig struct {
+	Issuer        string        `yaml:"issuer" env-default:"http://localhost:8080"`
+	CodeTTL       time.Duration `yaml:"code_ttl" env-default:"1m"`
+	SessionTTL    time.Duration `yaml:"session_ttl" env-default:"12h"`
+	SecureCookies bool          `yaml:"secure_cookies" env-default:"true"`
+	// DeviceCodeTTL and DevicePollInterval configure the device
+	// authorization grant. A user code is locked after DeviceMaxAttempts
+	// failed sign-ins to approve it.
+	DeviceCodeTTL      time.Duration `yaml:"device_code_ttl" env-default:"10m"`
+	DevicePollInterval time.Duration `yaml:"device_poll_interval" env-default:"5s"`
+	DeviceMaxAttempts  int           `yaml:"device_max_attempts" env-default:"5"`
+}
+
+// MailConfig selects how emails are delivered: "smtp" in production, "file"
+// (one file per message in Dir) for tests and "log" for local development.
+// The *URL fields are the pages that take the tokens of the emails sent for
+// verification, password resets and email changes.
+type MailConfig struct {
+	Driver                string        `yaml:"driver" env-default:"log"`
+	From                  string        `yaml:"from" env-default:"no-reply@localhost"`
+	Dir                   string        `yaml:"dir"`
+	SMTP                  SMTPConfig    `yaml:"smtp"`
+	VerifyEmailURL        string        `yaml:"verify_email_url" env-default:"http://localhost:3000/verify-email"`
+	EmailVerificationTTL  time.Duration `yaml:"email_verification_ttl" env-default:"24h"`
+	ResetPasswordURL      string        `yaml:"reset_password_url" env-default:"http://localhost:3000/reset-password"`
+	PasswordResetTTL      time.Duration `yaml:"password_reset_ttl" env-default:"30m"`
+	ConfirmEmailChangeURL string        `yaml:"confirm_email_change_url" env-default:"http://localhost:3000/confirm-email-change"`
+	UndoEmailChangeURL    string        `yaml:"undo_email_change_url" env-default:"http://localhost:3000/undo-email-change"`
+	EmailChangeUndoTTL    time.Duration `yaml:"email_change_undo_ttl" env-default:"168h"`
+}
+
+// BlobConfig selects where profile pictures are stored: "fs" keeps them
+// under Dir, "s3" in a bucket of an S3-compatible store.
+type BlobConfig struct {
+	Driver string   `yaml:"driver" env-default:"fs"`
+	Dir    string   `yaml:"dir" env-default:"/var/lib/sso/blobs"`
+	S3     S3Config `yaml:"s3"`
+}
+
+// S3Config describes the bucket. Endpoint is host[:port] without a scheme.
+type S3Config struct {
+	Endpoint        string `yaml:"endpoint"`
+	Region          string `yaml:"region" env-default:"us-east-1"`
+	Bucket          string `yaml:"bucket"`
+	AccessKeyID     string `yaml:"access_key_id"`
+	SecretAccessKey string `yaml:"secret_access_key"`
+	UseSSL          bool   `yaml:"use_ssl" env-default:"true"`
+}
+
+// DeletionConfig sets how long deleted accounts are kept before they are
+// purged, and how often the purger looks for them.
+type DeletionConfig struct {
+	GracePeriod   time.Duration `yaml:"grace_period" env-default:"720h"`
+	PurgeInterval time.Duration `yaml:"purge_interval" env-default:"1h"`
+}
+
+// MFAConfig configures second factors. EncryptionKey is the base64 encoded
+// 32 byte key TOTP secrets are sealed with; changing it invalidates every
+// enrollment. TOTPIssuer is the name authenticator apps show.
+type MFAConfig struct {
+	EncryptionKey string        `yaml:"encryption_key" env-required:"true"`
+	TOTPIssuer    string        `yaml:"totp_issuer" env-default:"sso"`
+	ChallengeTTL  time.Duration `yaml:"challenge_ttl" env-default:"5m"`
+}
+
+// WebAuthnConfig describes the relying party passkeys are registered with.
+// RPID is the domain passkeys are scoped to and must be a suffix of the host
+// of every origin in Origins, the pages that run the ceremonies.
+type WebAuthnConfig struct {
+	RPID         string        `yaml:"rp_id" env-default:"localhost"`
+	RPName       string        `yaml:"rp_name" env-default:"sso"`
+	Origins      []string      `yaml:"origins" env-default:"http://localhost:3000"`
+	ChallengeTTL time.Duration `yaml:"challenge_ttl" env-default:"5m"`
+}
+
+// LoginThrottleConfig slows down password guessing. Store is "mysql", where
+// the counts are shared by all replicas, or "memory" for a single node.
+// Failures are forgotten Window after the last one.
+type LoginThrottleConfig struct {
+	Store   string                `yaml:"store" env-default:"mysql"`
+	Window  time.Duration         `yaml:"window" env-default:"1h"`
+	Account AccountThrottleConfig `yaml:"account"`
+	IP      IPThrottleConfig      `yaml:"ip"`
+}
+
+// AccountThrottleConfig throttles logins to one account. After
+// FreeAttempts failures every further one doubles the wait, from BaseDelay
+// up to MaxDelay; from LockoutThreshold failures on the account is locked
+// for LockoutDuration.
+type AccountThrottleConfig struct {
+	FreeAttempts     int           `yaml:"free_attempts" env-default:"5"`
+	BaseDelay        time.Duration `yaml:"base_delay" env-default:"1s"`
+	MaxDelay         time.Duration `yaml:"max_delay" env-default:"1m"`
+	LockoutThreshold int           `yaml:"lockout_threshold" env-default:"20"`
+	LockoutDuration  time.Duration `yaml:"lockout_duration" env-default:"15m"`
+}
+
+// IPThrottleConfig throttles logins from one address, to any account. Many
+// users may share an address, so by default it backs off later and never
+// locks out; a zero LockoutThreshold disables the lockout.
+type IPThrottleConfig struct {
+	FreeAttempts     int           `yaml:"free_attempts" env-default:"50"`
+	BaseDelay        time.Duration `yaml:"base_delay" env-default:"1s"`
+	MaxDelay         time.Duration `yaml:"max_delay" env-default:"1m"`
+	LockoutThreshold int           `yaml:"lockout_threshold" env-default:"0"`
+	LockoutDuration  time.Duration `yaml:"lockout_duration" env-default:"15m"`
+}
+
+// RateLimitConfig limits how often the gRPC methods may be called. Methods
+// maps full method names, such as "/auth.Auth/Register", to their policy;
+// the other methods get Default. Backend is "memory", where every replica
+// counts on its own, or "redis" to share the counts.
+type RateLimitConfig struct {
+	Backend string                     `yaml:"backend" env-default:"memory"`
+	Redis   RedisConfig                `yaml:"redis"`
+	Default RateLimitPolicy            `yaml:"default"`
+	Methods map[string]RateLimitPolicy `yaml:"methods"`
+}
+
+// RateLimitPolicy limits the calls of a method in total, per client address
+// and per app_id of the request. Limits left out are not enforced.
+type RateLimitPolicy struct {
+	Total RateLimit `yaml:"total"`
+	IP    RateLimit `yaml:"ip"`
+	App   RateLimit `yaml:"app"`
+}
+
+// RateLimit allows Requests calls every Per on average, in bursts of up to
+// Burst calls, or Requests if Burst is zero.
+type RateLimit struct {
+	Requests int           `yaml:"requests"`
+	Per      time.Duration `yaml:"per"`
+	Burst    int           `yaml:"burst"`
+}
+
+type RedisConfig struct {
+	Addr     string `yaml:"addr" env-default:"localhost:6379"`
+	Password string `yaml:"password"`
+	DB       int    `yaml:"db"`
+}
+
+// PasswordPolicyConfig is what new passwords have to satisfy. Apps maps app
+// ids to policies that replace Default for passwords set through those
+// apps; their fields have no defaults.
+type PasswordPolicyConfig struct {
+	Default PasswordRulesConfig           `yaml:"default"`
+	Apps    map[int64]PasswordRulesConfig `yaml:"apps"`
+}
+
+// PasswordRulesConfig: MinCharClasses is how many of lowercase letters,
+// uppercase letters, digits and symbols a password mixes, MinStrength its
+// least zxcvbn-style score from 0 to 4. RejectPersonalInfo refuses
+// passwords containing the user's email or username.
+type PasswordRulesConfig struct {
+	MinLength          int  `yaml:"min_length" env-default:"8"`
+	MinCharClasses     int  `yaml:"min_char_classes" env-default:"1"`
+	MinStrength        int  `yaml:"min_strength" env-default:"2"`
+	RejectPersonalInfo bool `yaml:"reject_personal_info" env-default:"true"`
+}
+
+// BreachedConfig screens passwords against breach dumps. CorpusPath is a
+// Pwned Passwords file of "<SHA-1>:<count>" lines sorted by hash; it is
+// indexed into IndexPath, by default next to it, whenever it is newer than
+// the index. RangeAPI is a range API endpoint, such as
+// https://api.pwnedpasswords.com, asked about passwords the corpus does not
+// hold. Screening is off when both are empty.
+type BreachedConfig struct {
+	CorpusPath string        `yaml:"corpus_path"`
+	IndexPath  string        `yaml:"index_path"`
+	RangeAPI   string        `yaml:"range_api"`
+	Timeout    time.Duration `yaml:"timeout" env-default:"2s"`
+}
+
+type SMTPConfig struct {
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port" env-default:"587"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+}
+
+// MaxSignedTTL is the longest lifetime of anything signed with the token
+// signing keys, and so how long a retired key must stay published.
+func (c *Config) MaxSignedTTL() time.Duration {
+	return max(
+		c.TokenTTL,
+		c.OIDC.SessionTTL,
+		c.Mail.EmailVerificationTTL,
+		c.MFA.ChallengeTTL,
+		c.WebAuthn.ChallengeTTL,
+	)
+}
+
 func MustLoad() *Config {
 	configPath := fetchConfigPath()
 	if configPath == "" {
@@ -0,0 +1,119 @@
+package authgrpc
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/Novochenko/sso/domain/models"
+	"github.com/Novochenko/sso/internal/lib/jwt"
+	"github.com/Novochenko/sso/internal/services/auth"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	authorizationHeader = "authorization"
+	bearerPrefix        = "bearer "
+)
+
+// authenticate verifies the access token sent as
+// "authorization: Bearer <token>" metadata.
+func (s *serverAPI) authenticate(ctx context.Context) (jwt.Claims, error) {
+	token, ok := bearerToken(ctx)
+	if !ok {
+		return jwt.Claims{}, status.Error(codes.Unauthenticated, "access token is required")
+	}
+
+	claims, err := s.auth.Authenticate(ctx, token)
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidToken) {
+			return jwt.Claims{}, status.Error(codes.Unauthenticated, "invalid access token")
+		}
+		return jwt.Claims{}, status.Error(codes.Internal, "internal error")
+	}
+
+	return claims, nil
+}
+
+// authenticateUser authenticates the caller and rejects machine tokens.
+func (s *serverAPI) authenticateUser(ctx context.Context) (jwt.Claims, error) {
+	claims, err := s.authenticate(ctx)
+	if err != nil {
+		return jwt.Claims{}, err
+	}
+	if claims.IsClient() {
+		return jwt.Claims{}, status.Error(codes.PermissionDenied, "a user access token is required")
+	}
+
+	return claims, nil
+}
+
+// requirePermission authenticates the caller and checks that one of their
+// global roles grants the permission.
+func (s *serverAPI) requirePermission(ctx context.Context, permission string) (jwt.Claims, error) {
+	claims, err := s.authenticate(ctx)
+	if err != nil {
+		return jwt.Claims{}, err
+	}
+	if claims.IsClient() {
+		return jwt.Claims{}, status.Error(codes.PermissionDenied, "permission denied")
+	}
+
+	allowed, err := s.auth.CheckPermission(ctx, claims.UserID, 0, permission)
+	if err != nil {
+		return jwt.Claims{}, status.Error(codes.Internal, "internal error")
+	}
+	if !allowed {
+		return jwt.Claims{}, status.Error(codes.PermissionDenied, "permission denied")
+	}
+
+	return claims, nil
+}
+
+// callerOrg returns the organization whose users the caller may look up:
+// that of their access token. Callers without a token or whose token has no
+// organization get models.NoOrg, so that they cannot look into
+// organizations, unless a global role grants them PermissionReadUsers; then
+// it is 0, every user.
+func (s *serverAPI) callerOrg(ctx context.Context) (int64, error) {
+	if _, ok := bearerToken(ctx); !ok {
+		return models.NoOrg, nil
+	}
+	claims, err := s.authenticate(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if claims.OrgID != 0 {
+		return claims.OrgID, nil
+	}
+	if claims.IsClient() {
+		return models.NoOrg, nil
+	}
+
+	allowed, err := s.auth.CheckPermission(ctx, claims.UserID, 0, auth.PermissionReadUsers)
+	if err != nil {
+		return 0, status.Error(codes.Internal, "internal error")
+	}
+	if !allowed {
+		return models.NoOrg, nil
+	}
+
+	return 0, nil
+}
+
+func bearerToken(ctx context.Context) (string, bool) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return "", false
+	}
+
+	for _, value := range md.Get(authorizationHeader) {
+		if len(value) > len(bearerPrefix) && strings.EqualFold(value[:len(bearerPrefix)], bearerPrefix) {
+			return value[len(bearerPrefix):], true
+		}
+	}
+
+	return "", false
+}
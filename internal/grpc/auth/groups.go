@@ -0,0 +1,214 @@
+package authgrpc
+
+import (
+	"context"
+	"errors"
+
+	"github.com/Novochenko/protos/gen/go/sso"
+	"github.com/Novochenko/sso/domain/models"
+	"github.com/Novochenko/sso/internal/services/auth"
+	"github.com/Novochenko/sso/internal/storage"
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func (s *serverAPI) CreateGroup(ctx context.Context, req *sso.CreateGroupRequest) (*sso.CreateGroupResponse, error) {
+	if _, err := s.requirePermission(ctx, auth.PermissionManageRBAC); err != nil {
+		return nil, err
+	}
+	group, err := s.auth.CreateGroup(ctx, req.GetOrgId(), req.GetName(), req.GetDescription())
+	if err != nil {
+		return nil, groupError(err)
+	}
+
+	return &sso.CreateGroupResponse{Group: toGroup(group)}, nil
+}
+
+func (s *serverAPI) GetGroup(ctx context.Context, req *sso.GetGroupRequest) (*sso.GetGroupResponse, error) {
+	if _, err := s.requirePermission(ctx, auth.PermissionManageRBAC); err != nil {
+		return nil, err
+	}
+	group, members, err := s.auth.Group(ctx, req.GetGroupId())
+	if err != nil {
+		return nil, groupError(err)
+	}
+
+	resp := &sso.GetGroupResponse{
+		Group:       toGroup(group),
+		UserIds:     make([]string, 0, len(members.UserIDs)),
+		SubgroupIds: members.SubgroupIDs,
+	}
+	for _, userID := range members.UserIDs {
+		resp.UserIds = append(resp.UserIds, userID.String())
+	}
+
+	return resp, nil
+}
+
+func (s *serverAPI) UpdateGroup(ctx context.Context, req *sso.UpdateGroupRequest) (*sso.UpdateGroupResponse, error) {
+	if _, err := s.requirePermission(ctx, auth.PermissionManageRBAC); err != nil {
+		return nil, err
+	}
+	group, err := s.auth.UpdateGroup(ctx, req.GetGroupId(), req.GetName(), req.GetDescription())
+	if err != nil {
+		return nil, groupError(err)
+	}
+
+	return &sso.UpdateGroupResponse{Group: toGroup(group)}, nil
+}
+
+func (s *serverAPI) DeleteGroup(ctx context.Context, req *sso.DeleteGroupRequest) (*sso.DeleteGroupResponse, error) {
+	if _, err := s.requirePermission(ctx, auth.PermissionManageRBAC); err != nil {
+		return nil, err
+	}
+	if err := s.auth.DeleteGroup(ctx, req.GetGroupId()); err != nil {
+		return nil, groupError(err)
+	}
+
+	return &sso.DeleteGroupResponse{}, nil
+}
+
+func (s *serverAPI) AddGroupMember(ctx context.Context, req *sso.AddGroupMemberRequest) (*sso.AddGroupMemberResponse, error) {
+	if _, err := s.requirePermission(ctx, auth.PermissionManageRBAC); err != nil {
+		return nil, err
+	}
+	userID, err := uuid.Parse(req.GetUserId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid user_id")
+	}
+	if err := s.auth.AddGroupMember(ctx, req.GetGroupId(), userID); err != nil {
+		return nil, groupError(err)
+	}
+
+	return &sso.AddGroupMemberResponse{}, nil
+}
+
+func (s *serverAPI) RemoveGroupMember(ctx context.Context, req *sso.RemoveGroupMemberRequest) (*sso.RemoveGroupMemberResponse, error) {
+	if _, err := s.requirePermission(ctx, auth.PermissionManageRBAC); err != nil {
+		return nil, err
+	}
+	userID, err := uuid.Parse(req.GetUserId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid user_id")
+	}
+	if err := s.auth.RemoveGroupMember(ctx, req.GetGroupId(), userID); err != nil {
+		return nil, groupError(err)
+	}
+
+	return &sso.RemoveGroupMemberResponse{}, nil
+}
+
+func (s *serverAPI) AddSubgroup(ctx context.Context, req *sso.AddSubgroupRequest) (*sso.AddSubgroupResponse, error) {
+	if _, err := s.requirePermission(ctx, auth.PermissionManageRBAC); err != nil {
+		return nil, err
+	}
+	if err := s.auth.AddSubgroup(ctx, req.GetGroupId(), req.GetChildId()); err != nil {
+		return nil, groupError(err)
+	}
+
+	return &sso.AddSubgroupResponse{}, nil
+}
+
+func (s *serverAPI) RemoveSubgroup(ctx context.Context, req *sso.RemoveSubgroupRequest) (*sso.RemoveSubgroupResponse, error) {
+	if _, err := s.requirePermission(ctx, auth.PermissionManageRBAC); err != nil {
+		return nil, err
+	}
+	if err := s.auth.RemoveSubgroup(ctx, req.GetGroupId(), req.GetChildId()); err != nil {
+		return nil, groupError(err)
+	}
+
+	return &sso.RemoveSubgroupResponse{}, nil
+}
+
+func (s *serverAPI) GrantGroupRole(ctx context.Context, req *sso.GrantGroupRoleRequest) (*sso.GrantGroupRoleResponse, error) {
+	if _, err := s.requirePermission(ctx, auth.PermissionManageRBAC); err != nil {
+		return nil, err
+	}
+	if err := s.auth.GrantGroupRole(ctx, req.GetGroupId(), req.GetRoleId()); err != nil {
+		return nil, groupError(err)
+	}
+
+	return &sso.GrantGroupRoleResponse{}, nil
+}
+
+func (s *serverAPI) RevokeGroupRole(ctx context.Context, req *sso.RevokeGroupRoleRequest) (*sso.RevokeGroupRoleResponse, error) {
+	if _, err := s.requirePermission(ctx, auth.PermissionManageRBAC); err != nil {
+		return nil, err
+	}
+	if err := s.auth.RevokeGroupRole(ctx, req.GetGroupId(), req.GetRoleId()); err != nil {
+		return nil, groupError(err)
+	}
+
+	return &sso.RevokeGroupRoleResponse{}, nil
+}
+
+func (s *serverAPI) ListUserGroups(ctx context.Context, req *sso.ListUserGroupsRequest) (*sso.ListUserGroupsResponse, error) {
+	claims, err := s.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	userID, err := uuid.Parse(req.GetUserId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid user_id")
+	}
+	if claims.IsClient() || claims.UserID != userID {
+		if _, err := s.requirePermission(ctx, auth.PermissionManageRBAC); err != nil {
+			return nil, err
+		}
+	}
+
+	groups, err := s.auth.UserGroups(ctx, userID)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+
+	resp := &sso.ListUserGroupsResponse{Groups: make([]*sso.UserGroup, 0, len(groups))}
+	for _, group := range groups {
+		resp.Groups = append(resp.Groups, &sso.UserGroup{
+			Group:  toGroup(group.Group),
+			Direct: group.Direct,
+		})
+	}
+
+	return resp, nil
+}
+
+// groupError maps the errors of the group calls to statuses.
+func groupError(err error) error {
+	switch {
+	case errors.Is(err, auth.ErrInvalidGroupName):
+		return status.Error(codes.InvalidArgument, "invalid group name")
+	case errors.Is(err, auth.ErrInvalidDescription):
+		return status.Error(codes.InvalidArgument, "description is too long")
+	case errors.Is(err, auth.ErrGroupScope):
+		return status.Error(codes.FailedPrecondition, "belongs to another organization")
+	case errors.Is(err, auth.ErrNotOrgMember):
+		return status.Error(codes.FailedPrecondition, "user is not a member of the group's organization")
+	case errors.Is(err, storage.ErrGroupCycle):
+		return status.Error(codes.FailedPrecondition, "subgroup would create a cycle")
+	case errors.Is(err, storage.ErrGroupExists):
+		return status.Error(codes.AlreadyExists, "group already exists")
+	case errors.Is(err, storage.ErrGroupNotFound):
+		return status.Error(codes.NotFound, "group not found")
+	case errors.Is(err, storage.ErrRoleNotFound):
+		return status.Error(codes.NotFound, "role not found")
+	case errors.Is(err, storage.ErrUserNotFound):
+		return status.Error(codes.NotFound, "user not found")
+	case errors.Is(err, storage.ErrOrganizationNotFound):
+		return status.Error(codes.NotFound, "organization not found")
+	case errors.Is(err, storage.ErrAppNotFound):
+		return status.Error(codes.NotFound, "app not found")
+	default:
+		return status.Error(codes.Internal, "internal error")
+	}
+}
+
+func toGroup(group models.Group) *sso.Group {
+	return &sso.Group{
+		Id:          group.ID,
+		OrgId:       group.OrgID,
+		Name:        group.Name,
+		Description: group.Description,
+	}
+}
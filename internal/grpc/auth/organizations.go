@@ -0,0 +1,144 @@
+package authgrpc
+
+import (
+	"context"
+	"errors"
+
+	"github.com/Novochenko/protos/gen/go/sso"
+	"github.com/Novochenko/sso/domain/models"
+	"github.com/Novochenko/sso/internal/services/auth"
+	"github.com/Novochenko/sso/internal/storage"
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func (s *serverAPI) CreateOrganization(ctx context.Context, req *sso.CreateOrganizationRequest) (*sso.CreateOrganizationResponse, error) {
+	claims, err := s.authenticateUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	org, err := s.auth.CreateOrganization(ctx, claims, req.GetSlug(), req.GetName())
+	if err != nil {
+		return nil, orgError(err)
+	}
+
+	return &sso.CreateOrganizationResponse{Organization: toOrganization(org)}, nil
+}
+
+func (s *serverAPI) ListOrganizations(ctx context.Context, _ *sso.ListOrganizationsRequest) (*sso.ListOrganizationsResponse, error) {
+	claims, err := s.authenticateUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	orgs, err := s.auth.Organizations(ctx, claims)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+
+	resp := &sso.ListOrganizationsResponse{Organizations: make([]*sso.UserOrganization, 0, len(orgs))}
+	for _, org := range orgs {
+		resp.Organizations = append(resp.Organizations, &sso.UserOrganization{
+			Organization: toOrganization(org.Organization),
+			Role:         org.Role,
+		})
+	}
+
+	return resp, nil
+}
+
+func (s *serverAPI) ListOrganizationMembers(
+	ctx context.Context,
+	req *sso.ListOrganizationMembersRequest,
+) (*sso.ListOrganizationMembersResponse, error) {
+	claims, err := s.authenticateUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	members, err := s.auth.OrgMembers(ctx, claims, req.GetOrgId())
+	if err != nil {
+		return nil, orgError(err)
+	}
+
+	resp := &sso.ListOrganizationMembersResponse{Members: make([]*sso.OrganizationMember, 0, len(members))}
+	for _, member := range members {
+		resp.Members = append(resp.Members, &sso.OrganizationMember{
+			UserId: member.UserID.String(),
+			Role:   member.Role,
+		})
+	}
+
+	return resp, nil
+}
+
+func (s *serverAPI) SetOrganizationMember(
+	ctx context.Context,
+	req *sso.SetOrganizationMemberRequest,
+) (*sso.SetOrganizationMemberResponse, error) {
+	claims, err := s.authenticateUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	userID, err := uuid.Parse(req.GetUserId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid user_id")
+	}
+	if err := s.auth.SetOrgMember(ctx, claims, req.GetOrgId(), userID, req.GetRole()); err != nil {
+		return nil, orgError(err)
+	}
+
+	return &sso.SetOrganizationMemberResponse{}, nil
+}
+
+func (s *serverAPI) RemoveOrganizationMember(
+	ctx context.Context,
+	req *sso.RemoveOrganizationMemberRequest,
+) (*sso.RemoveOrganizationMemberResponse, error) {
+	claims, err := s.authenticateUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	userID, err := uuid.Parse(req.GetUserId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid user_id")
+	}
+	if err := s.auth.RemoveOrgMember(ctx, claims, req.GetOrgId(), userID); err != nil {
+		return nil, orgError(err)
+	}
+
+	return &sso.RemoveOrganizationMemberResponse{}, nil
+}
+
+// orgError maps the errors of the organization calls to statuses.
+func orgError(err error) error {
+	switch {
+	case errors.Is(err, auth.ErrInvalidOrgSlug):
+		return status.Error(codes.InvalidArgument, "slug must be 2 to 64 lowercase letters, digits or dashes")
+	case errors.Is(err, auth.ErrInvalidOrgName):
+		return status.Error(codes.InvalidArgument, "name must be 1 to 128 characters")
+	case errors.Is(err, auth.ErrInvalidOrgRole):
+		return status.Error(codes.InvalidArgument, "role must be owner, admin or member")
+	case errors.Is(err, auth.ErrNotOrgMember):
+		return status.Error(codes.PermissionDenied, "not a member of the organization")
+	case errors.Is(err, auth.ErrOrgForbidden):
+		return status.Error(codes.PermissionDenied, "permission denied")
+	case errors.Is(err, storage.ErrOrganizationExists):
+		return status.Error(codes.AlreadyExists, "slug is already taken")
+	case errors.Is(err, storage.ErrLastOrgOwner):
+		return status.Error(codes.FailedPrecondition, "the organization must keep an owner")
+	case errors.Is(err, storage.ErrUserNotFound):
+		return status.Error(codes.NotFound, "user not found")
+	case errors.Is(err, storage.ErrMembershipNotFound):
+		return status.Error(codes.NotFound, "user is not a member")
+	default:
+		return status.Error(codes.Internal, "internal error")
+	}
+}
+
+func toOrganization(org models.Organization) *sso.Organization {
+	return &sso.Organization{
+		Id:   org.ID,
+		Slug: org.Slug,
+		Name: org.Name,
+	}
+}
@@ -0,0 +1,44 @@
+package authgrpc
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/Novochenko/sso/internal/services/auth"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// weakPasswordError describes the rules the password in the given request
+// field breaks in the error details.
+func weakPasswordError(err error, field string) error {
+	st := status.New(codes.InvalidArgument, "password does not meet the policy")
+
+	var policyErr *auth.PasswordPolicyError
+	if !errors.As(err, &policyErr) {
+		return st.Err()
+	}
+
+	badRequest := &errdetails.BadRequest{}
+	rules := make([]string, 0, len(policyErr.Violations))
+	for _, v := range policyErr.Violations {
+		badRequest.FieldViolations = append(badRequest.FieldViolations, &errdetails.BadRequest_FieldViolation{
+			Field:       field,
+			Description: "password " + v.Message,
+		})
+		rules = append(rules, v.Rule)
+	}
+	info := &errdetails.ErrorInfo{
+		Reason:   "WEAK_PASSWORD",
+		Domain:   "sso",
+		Metadata: map[string]string{"rules": strings.Join(rules, ",")},
+	}
+
+	withDetails, detailsErr := st.WithDetails(badRequest, info)
+	if detailsErr != nil {
+		return st.Err()
+	}
+
+	return withDetails.Err()
+}
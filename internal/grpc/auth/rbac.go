@@ -0,0 +1,166 @@
+package authgrpc
+
+import (
+	"context"
+	"errors"
+
+	"github.com/Novochenko/protos/gen/go/sso"
+	"github.com/Novochenko/sso/domain/models"
+	"github.com/Novochenko/sso/internal/services/auth"
+	"github.com/Novochenko/sso/internal/storage"
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func (s *serverAPI) CheckPermission(ctx context.Context, req *sso.CheckPermissionRequest) (*sso.CheckPermissionResponse, error) {
+	claims, err := s.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	userID, err := uuid.Parse(req.GetUserId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid user_id")
+	}
+	if req.GetPermission() == "" {
+		return nil, status.Error(codes.InvalidArgument, "permission is required")
+	}
+
+	// Apps ask about their own users; users about themselves.
+	self := (claims.IsClient() && int64(claims.ClientID) == req.GetAppId()) ||
+		(!claims.IsClient() && claims.UserID == userID)
+	if !self {
+		if _, err := s.requirePermission(ctx, auth.PermissionManageRBAC); err != nil {
+			return nil, err
+		}
+	}
+
+	allowed, err := s.auth.CheckPermission(ctx, userID, req.GetAppId(), req.GetPermission())
+	if err != nil {
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+
+	return &sso.CheckPermissionResponse{Allowed: allowed}, nil
+}
+
+func (s *serverAPI) CreateRole(ctx context.Context, req *sso.CreateRoleRequest) (*sso.CreateRoleResponse, error) {
+	if _, err := s.requirePermission(ctx, auth.PermissionManageRBAC); err != nil {
+		return nil, err
+	}
+	role, err := s.auth.CreateRole(ctx, req.GetAppId(), req.GetName(), req.GetDescription())
+	if err != nil {
+		return nil, rbacError(err)
+	}
+
+	return &sso.CreateRoleResponse{Role: toRole(role)}, nil
+}
+
+func (s *serverAPI) CreatePermission(ctx context.Context, req *sso.CreatePermissionRequest) (*sso.CreatePermissionResponse, error) {
+	if _, err := s.requirePermission(ctx, auth.PermissionManageRBAC); err != nil {
+		return nil, err
+	}
+	permission, err := s.auth.CreatePermission(ctx, req.GetAppId(), req.GetName(), req.GetDescription())
+	if err != nil {
+		return nil, rbacError(err)
+	}
+
+	return &sso.CreatePermissionResponse{Permission: toPermission(permission)}, nil
+}
+
+func (s *serverAPI) GrantPermission(ctx context.Context, req *sso.GrantPermissionRequest) (*sso.GrantPermissionResponse, error) {
+	if _, err := s.requirePermission(ctx, auth.PermissionManageRBAC); err != nil {
+		return nil, err
+	}
+	if err := s.auth.GrantPermission(ctx, req.GetRoleId(), req.GetPermissionId()); err != nil {
+		return nil, rbacError(err)
+	}
+
+	return &sso.GrantPermissionResponse{}, nil
+}
+
+func (s *serverAPI) RevokePermission(ctx context.Context, req *sso.RevokePermissionRequest) (*sso.RevokePermissionResponse, error) {
+	if _, err := s.requirePermission(ctx, auth.PermissionManageRBAC); err != nil {
+		return nil, err
+	}
+	if err := s.auth.RevokePermission(ctx, req.GetRoleId(), req.GetPermissionId()); err != nil {
+		return nil, rbacError(err)
+	}
+
+	return &sso.RevokePermissionResponse{}, nil
+}
+
+func (s *serverAPI) AssignRole(ctx context.Context, req *sso.AssignRoleRequest) (*sso.AssignRoleResponse, error) {
+	if _, err := s.requirePermission(ctx, auth.PermissionManageRBAC); err != nil {
+		return nil, err
+	}
+	userID, err := uuid.Parse(req.GetUserId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid user_id")
+	}
+	if err := s.auth.AssignRole(ctx, userID, req.GetRoleId()); err != nil {
+		return nil, rbacError(err)
+	}
+
+	return &sso.AssignRoleResponse{}, nil
+}
+
+func (s *serverAPI) UnassignRole(ctx context.Context, req *sso.UnassignRoleRequest) (*sso.UnassignRoleResponse, error) {
+	if _, err := s.requirePermission(ctx, auth.PermissionManageRBAC); err != nil {
+		return nil, err
+	}
+	userID, err := uuid.Parse(req.GetUserId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid user_id")
+	}
+	if err := s.auth.UnassignRole(ctx, userID, req.GetRoleId()); err != nil {
+		return nil, rbacError(err)
+	}
+
+	return &sso.UnassignRoleResponse{}, nil
+}
+
+// rbacError maps the errors of the RBAC calls to statuses.
+func rbacError(err error) error {
+	switch {
+	case errors.Is(err, auth.ErrInvalidRoleName):
+		return status.Error(codes.InvalidArgument, "invalid role name")
+	case errors.Is(err, auth.ErrInvalidPermissionName):
+		return status.Error(codes.InvalidArgument, "invalid permission name")
+	case errors.Is(err, auth.ErrInvalidDescription):
+		return status.Error(codes.InvalidArgument, "description is too long")
+	case errors.Is(err, auth.ErrPermissionScope):
+		return status.Error(codes.FailedPrecondition, "permission belongs to another app")
+	case errors.Is(err, storage.ErrRoleExists):
+		return status.Error(codes.AlreadyExists, "role already exists")
+	case errors.Is(err, storage.ErrPermissionExists):
+		return status.Error(codes.AlreadyExists, "permission already exists")
+	case errors.Is(err, storage.ErrRoleNotFound):
+		return status.Error(codes.NotFound, "role not found")
+	case errors.Is(err, storage.ErrPermissionNotFound):
+		return status.Error(codes.NotFound, "permission not found")
+	case errors.Is(err, storage.ErrUserNotFound):
+		return status.Error(codes.NotFound, "user not found")
+	case errors.Is(err, storage.ErrAppNotFound):
+		return status.Error(codes.NotFound, "app not found")
+	default:
+		return status.Error(codes.Internal, "internal error")
+	}
+}
+
+func toRole(role models.Role) *sso.Role {
+	return &sso.Role{
+		Id:          role.ID,
+		AppId:       role.AppID,
+		Name:        role.Name,
+		Description: role.Description,
+	}
+}
+
+func toPermission(permission models.Permission) *sso.Permission {
+	return &sso.Permission{
+		Id:          permission.ID,
+		AppId:       permission.AppID,
+		Name:        permission.Name,
+		Description: permission.Description,
+	}
+}
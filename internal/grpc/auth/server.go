@@ -3,13 +3,17 @@ package authgrpc
 import (
 	"context"
 	"errors"
+	"io"
 
 	"github.com/Novochenko/protos/gen/go/sso"
 	"github.com/Novochenko/sso/domain/models"
+	"github.com/Novochenko/sso/internal/lib/jwt"
+	"github.com/Novochenko/sso/internal/lib/picture"
 	"github.com/Novochenko/sso/internal/services/auth"
 	"github.com/Novochenko/sso/internal/storage"
 	validation "github.com/go-ozzo/ozzo-validation"
 	"github.com/go-ozzo/ozzo-validation/is"
+	"github.com/google/uuid"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
@@ -21,42 +25,157 @@ type Auth interface {
 		email string,
 		password string,
 		appID int64,
-	) (token string, err error)
+		orgID int64,
+	) (result models.LoginResult, err error)
 	RegisterNewUser(
 		ctx context.Context,
 		email string,
 		password string,
+		appID int64,
 	) (userID string, err error)
 	IsAdmin(ctx context.Context, userID string) (bool, error)
-	FindUser(ctx context.Context, userID string) (models.UserAccount, error)
+	FindUser(ctx context.Context, userID string, orgID int64) (models.UserAccount, error)
+	Refresh(ctx context.Context, refreshToken string) (models.TokenPair, error)
+	Authenticate(ctx context.Context, token string) (jwt.Claims, error)
+	Logout(ctx context.Context, claims jwt.Claims, refreshToken string) error
+	RevokeTokens(ctx context.Context, userID string) error
+	Introspect(ctx context.Context, token string) (claims jwt.Claims, active bool, err error)
+	ClientCredentials(ctx context.Context, appID int64, secret string, scopes []string) (models.ClientToken, error)
+	VerifyEmail(ctx context.Context, token string) error
+	ResendVerification(ctx context.Context, email string) error
+	RequestPasswordReset(ctx context.Context, email string) error
+	ResetPassword(ctx context.Context, token, password string, appID int64) error
+	ChangePassword(ctx context.Context, claims jwt.Claims, currentPassword, newPassword string) (models.TokenPair, error)
+	ChangeEmail(ctx context.Context, claims jwt.Claims, password, newEmail string) error
+	ConfirmEmailChange(ctx context.Context, token string) error
+	UndoEmailChange(ctx context.Context, token string) error
+	UpdateProfile(ctx context.Context, claims jwt.Claims, username string) (models.UserAccount, error)
+	FindUserByUsername(ctx context.Context, username string, orgID int64) (models.UserAccount, error)
+	FindUsers(ctx context.Context, userIDs []string, orgID int64) ([]models.UserAccount, error)
+	UploadProfilePicture(ctx context.Context, claims jwt.Claims, data []byte) (models.UserAccount, error)
+	DeleteAccount(ctx context.Context, claims jwt.Claims, password string) error
+	ExportData(ctx context.Context, claims jwt.Claims) ([]byte, error)
+	EnrollTOTP(ctx context.Context, claims jwt.Claims) (models.TOTPEnrollment, error)
+	ConfirmTOTP(ctx context.Context, claims jwt.Claims, code string) error
+	VerifyMFA(ctx context.Context, mfaToken, code string) (models.TokenPair, error)
+	BeginPasskeyRegistration(ctx context.Context, claims jwt.Claims) (models.PasskeyChallenge, error)
+	FinishPasskeyRegistration(
+		ctx context.Context,
+		claims jwt.Claims,
+		session string,
+		clientDataJSON []byte,
+		attestationObject []byte,
+		name string,
+	) (models.WebAuthnCredential, error)
+	BeginPasskeyLogin(ctx context.Context, appID, orgID int64, mfaToken string) (models.PasskeyChallenge, error)
+	FinishPasskeyLogin(
+		ctx context.Context,
+		session string,
+		credentialID []byte,
+		clientDataJSON []byte,
+		authenticatorData []byte,
+		signature []byte,
+		userHandle []byte,
+	) (models.TokenPair, error)
+	GenerateBackupCodes(ctx context.Context, claims jwt.Claims, password string) ([]string, error)
+	RecoverAccount(ctx context.Context, email, code, newPassword string, appID int64) error
+	CheckPermission(ctx context.Context, userID uuid.UUID, appID int64, permission string) (bool, error)
+	CreateRole(ctx context.Context, appID int64, name, description string) (models.Role, error)
+	CreatePermission(ctx context.Context, appID int64, name, description string) (models.Permission, error)
+	GrantPermission(ctx context.Context, roleID, permissionID int64) error
+	RevokePermission(ctx context.Context, roleID, permissionID int64) error
+	AssignRole(ctx context.Context, userID uuid.UUID, roleID int64) error
+	UnassignRole(ctx context.Context, userID uuid.UUID, roleID int64) error
+	CreateOrganization(ctx context.Context, claims jwt.Claims, slug, name string) (models.Organization, error)
+	Organizations(ctx context.Context, claims jwt.Claims) ([]models.UserOrganization, error)
+	OrgMembers(ctx context.Context, claims jwt.Claims, orgID int64) ([]models.OrgMembership, error)
+	SetOrgMember(ctx context.Context, claims jwt.Claims, orgID int64, userID uuid.UUID, role string) error
+	RemoveOrgMember(ctx context.Context, claims jwt.Claims, orgID int64, userID uuid.UUID) error
+	CreateGroup(ctx context.Context, orgID int64, name, description string) (models.Group, error)
+	Group(ctx context.Context, id int64) (models.Group, models.GroupMembers, error)
+	UpdateGroup(ctx context.Context, id int64, name, description string) (models.Group, error)
+	DeleteGroup(ctx context.Context, id int64) error
+	AddGroupMember(ctx context.Context, groupID int64, userID uuid.UUID) error
+	RemoveGroupMember(ctx context.Context, groupID int64, userID uuid.UUID) error
+	AddSubgroup(ctx context.Context, parentID, childID int64) error
+	RemoveSubgroup(ctx context.Context, parentID, childID int64) error
+	GrantGroupRole(ctx context.Context, groupID, roleID int64) error
+	RevokeGroupRole(ctx context.Context, groupID, roleID int64) error
+	UserGroups(ctx context.Context, userID uuid.UUID) ([]models.UserGroup, error)
+	Sessions(ctx context.Context, userID uuid.UUID) ([]models.LoginSession, error)
+	RevokeSession(ctx context.Context, userID, sessionID uuid.UUID) error
+	UnlockAccount(ctx context.Context, userID uuid.UUID) error
+}
+
+type Keys interface {
+	JWKS(ctx context.Context) (jwt.JWKS, error)
 }
 
 type serverAPI struct {
 	sso.UnimplementedAuthServer
 	auth Auth
+	keys Keys
 }
 
 const (
 	emptyValue = 0
 )
 
-func Register(gRPC *grpc.Server, auth Auth) {
-	sso.RegisterAuthServer(gRPC, &serverAPI{auth: auth})
+func Register(gRPC *grpc.Server, auth Auth, keys Keys) {
+	sso.RegisterAuthServer(gRPC, &serverAPI{auth: auth, keys: keys})
 }
 
 func (s *serverAPI) Login(ctx context.Context, req *sso.LoginRequest) (*sso.LoginResponse, error) {
 	if err := validateLogin(req); err != nil {
 		return nil, err
 	}
-	token, err := s.auth.Login(ctx, req.GetEmail(), req.GetPassword(), req.GetAppId())
+	result, err := s.auth.Login(ctx, req.GetEmail(), req.GetPassword(), req.GetAppId(), req.GetOrgId())
 	if err != nil {
+		var throttled *auth.LoginThrottledError
+		if errors.As(err, &throttled) {
+			return nil, throttledError(ctx, throttled)
+		}
 		if errors.Is(err, auth.ErrInvalidCredentials) {
 			return nil, status.Error(codes.InvalidArgument, "invalid email or password")
 		}
+		if errors.Is(err, auth.ErrPasswordResetRequired) {
+			return nil, status.Error(codes.FailedPrecondition, "password must be reset")
+		}
+		if errors.Is(err, auth.ErrEmailNotVerified) {
+			return nil, status.Error(codes.FailedPrecondition, "email is not verified")
+		}
+		if errors.Is(err, auth.ErrNotOrgMember) {
+			return nil, status.Error(codes.PermissionDenied, "not a member of the organization")
+		}
 		return nil, status.Error(codes.Internal, "internal error")
 	}
+	if result.MFAToken != "" {
+		return &sso.LoginResponse{
+			MfaRequired: true,
+			MfaToken:    result.MFAToken,
+			MfaMethods:  result.MFAMethods,
+		}, nil
+	}
 	return &sso.LoginResponse{
-		Token: token,
+		Token:        result.Tokens.AccessToken,
+		RefreshToken: result.Tokens.RefreshToken,
+	}, nil
+}
+
+func (s *serverAPI) Refresh(ctx context.Context, req *sso.RefreshRequest) (*sso.RefreshResponse, error) {
+	if req.GetRefreshToken() == "" {
+		return nil, status.Error(codes.InvalidArgument, "refresh_token is required")
+	}
+	tokens, err := s.auth.Refresh(ctx, req.GetRefreshToken())
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidRefreshToken) || errors.Is(err, auth.ErrRefreshTokenReused) {
+			return nil, status.Error(codes.Unauthenticated, "invalid refresh token")
+		}
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+	return &sso.RefreshResponse{
+		Token:        tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
 	}, nil
 }
 
@@ -64,8 +183,11 @@ func (s *serverAPI) Register(ctx context.Context, req *sso.RegisterRequest) (*ss
 	if err := validateRegister(req); err != nil {
 		return nil, err
 	}
-	userID, err := s.auth.RegisterNewUser(ctx, req.GetEmail(), req.GetPassword())
+	userID, err := s.auth.RegisterNewUser(ctx, req.GetEmail(), req.GetPassword(), req.GetAppId())
 	if err != nil {
+		if errors.Is(err, auth.ErrWeakPassword) {
+			return nil, weakPasswordError(err, "password")
+		}
 		if errors.Is(err, storage.ErrUserExists) {
 			return nil, status.Error(codes.AlreadyExists, "user already exists")
 		}
@@ -80,7 +202,11 @@ func (s *serverAPI) Find(ctx context.Context, req *sso.FindRequest) (*sso.FindRe
 	if req.GetUserId() == "" {
 		return nil, status.Error(codes.InvalidArgument, "user_id is required")
 	}
-	userAccount, err := s.auth.FindUser(ctx, req.GetUserId())
+	orgID, err := s.callerOrg(ctx)
+	if err != nil {
+		return nil, err
+	}
+	userAccount, err := s.auth.FindUser(ctx, req.GetUserId(), orgID)
 	if err != nil {
 		if errors.Is(err, storage.ErrUserNotFound) {
 			return nil, status.Error(codes.NotFound, "user not found")
@@ -88,10 +214,349 @@ func (s *serverAPI) Find(ctx context.Context, req *sso.FindRequest) (*sso.FindRe
 		return nil, status.Error(codes.Internal, "internal error")
 	}
 
-	return &sso.FindResponse{UserAccount: &sso.UserAccount{
-		UserId:   userAccount.UserId.String(),
-		UserName: userAccount.UserName,
-	}}, nil
+	return &sso.FindResponse{UserAccount: toUserAccount(userAccount)}, nil
+}
+
+func (s *serverAPI) FindByUsername(ctx context.Context, req *sso.FindByUsernameRequest) (*sso.FindByUsernameResponse, error) {
+	if req.GetUserName() == "" {
+		return nil, status.Error(codes.InvalidArgument, "user_name is required")
+	}
+	orgID, err := s.callerOrg(ctx)
+	if err != nil {
+		return nil, err
+	}
+	userAccount, err := s.auth.FindUserByUsername(ctx, req.GetUserName(), orgID)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) || errors.Is(err, auth.ErrInvalidUsername) {
+			return nil, status.Error(codes.NotFound, "user not found")
+		}
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+
+	return &sso.FindByUsernameResponse{UserAccount: toUserAccount(userAccount)}, nil
+}
+
+func (s *serverAPI) FindMany(ctx context.Context, req *sso.FindManyRequest) (*sso.FindManyResponse, error) {
+	if len(req.GetUserIds()) > auth.MaxFindManyUsers {
+		return nil, status.Errorf(codes.InvalidArgument, "at most %d user_ids are allowed", auth.MaxFindManyUsers)
+	}
+	for _, userID := range req.GetUserIds() {
+		if _, err := uuid.Parse(userID); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid user_id %q", userID)
+		}
+	}
+	orgID, err := s.callerOrg(ctx)
+	if err != nil {
+		return nil, err
+	}
+	userAccounts, err := s.auth.FindUsers(ctx, req.GetUserIds(), orgID)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+
+	resp := &sso.FindManyResponse{UserAccounts: make([]*sso.UserAccount, 0, len(userAccounts))}
+	for _, userAccount := range userAccounts {
+		resp.UserAccounts = append(resp.UserAccounts, toUserAccount(userAccount))
+	}
+
+	return resp, nil
+}
+
+func (s *serverAPI) UpdateProfile(ctx context.Context, req *sso.UpdateProfileRequest) (*sso.UpdateProfileResponse, error) {
+	claims, err := s.authenticateUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	userAccount, err := s.auth.UpdateProfile(ctx, claims, req.GetUserName())
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidUsername) {
+			return nil, status.Error(codes.InvalidArgument, "user_name must be 3 to 30 letters, digits or underscores")
+		}
+		if errors.Is(err, storage.ErrUsernameTaken) {
+			return nil, status.Error(codes.AlreadyExists, "user_name is already taken")
+		}
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+
+	return &sso.UpdateProfileResponse{UserAccount: toUserAccount(userAccount)}, nil
+}
+
+func (s *serverAPI) UploadProfilePicture(stream grpc.ClientStreamingServer[sso.UploadProfilePictureRequest, sso.UploadProfilePictureResponse]) error {
+	ctx := stream.Context()
+	claims, err := s.authenticateUser(ctx)
+	if err != nil {
+		return err
+	}
+
+	var data []byte
+	for {
+		req, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if len(data)+len(req.GetChunk()) > auth.MaxProfilePictureBytes {
+			return status.Errorf(codes.InvalidArgument, "profile picture must not exceed %d bytes", auth.MaxProfilePictureBytes)
+		}
+		data = append(data, req.GetChunk()...)
+	}
+	if len(data) == 0 {
+		return status.Error(codes.InvalidArgument, "profile picture is empty")
+	}
+
+	userAccount, err := s.auth.UploadProfilePicture(ctx, claims, data)
+	if err != nil {
+		if errors.Is(err, picture.ErrUnsupportedType) {
+			return status.Error(codes.InvalidArgument, "profile picture must be a PNG, JPEG, GIF or WebP image")
+		}
+		if errors.Is(err, picture.ErrTooLarge) {
+			return status.Errorf(codes.InvalidArgument, "profile picture must not exceed %dx%d pixels", picture.MaxSourceDimension, picture.MaxSourceDimension)
+		}
+		if errors.Is(err, auth.ErrProfilePictureTooLarge) {
+			return status.Errorf(codes.InvalidArgument, "profile picture must not exceed %d bytes", auth.MaxProfilePictureBytes)
+		}
+		return status.Error(codes.Internal, "internal error")
+	}
+
+	return stream.SendAndClose(&sso.UploadProfilePictureResponse{UserAccount: toUserAccount(userAccount)})
+}
+
+func (s *serverAPI) DeleteAccount(ctx context.Context, req *sso.DeleteAccountRequest) (*sso.DeleteAccountResponse, error) {
+	claims, err := s.authenticateUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if req.GetPassword() == "" {
+		return nil, status.Error(codes.InvalidArgument, "password is required")
+	}
+	if err := s.auth.DeleteAccount(ctx, claims, req.GetPassword()); err != nil {
+		var throttled *auth.LoginThrottledError
+		if errors.As(err, &throttled) {
+			return nil, throttledError(ctx, throttled)
+		}
+		if errors.Is(err, auth.ErrInvalidCredentials) {
+			return nil, status.Error(codes.PermissionDenied, "invalid password")
+		}
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+
+	return &sso.DeleteAccountResponse{}, nil
+}
+
+func (s *serverAPI) ExportMyData(ctx context.Context, _ *sso.ExportMyDataRequest) (*sso.ExportMyDataResponse, error) {
+	claims, err := s.authenticateUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	archive, err := s.auth.ExportData(ctx, claims)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return nil, status.Error(codes.NotFound, "user not found")
+		}
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+
+	return &sso.ExportMyDataResponse{Archive: archive, ContentType: auth.ExportContentType}, nil
+}
+
+func (s *serverAPI) EnrollTOTP(ctx context.Context, _ *sso.EnrollTOTPRequest) (*sso.EnrollTOTPResponse, error) {
+	claims, err := s.authenticateUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	enrollment, err := s.auth.EnrollTOTP(ctx, claims)
+	if err != nil {
+		if errors.Is(err, auth.ErrTOTPEnabled) {
+			return nil, status.Error(codes.FailedPrecondition, "totp is already enabled")
+		}
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+
+	return &sso.EnrollTOTPResponse{Secret: enrollment.Secret, Uri: enrollment.URI}, nil
+}
+
+func (s *serverAPI) ConfirmTOTP(ctx context.Context, req *sso.ConfirmTOTPRequest) (*sso.ConfirmTOTPResponse, error) {
+	claims, err := s.authenticateUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if req.GetCode() == "" {
+		return nil, status.Error(codes.InvalidArgument, "code is required")
+	}
+	if err := s.auth.ConfirmTOTP(ctx, claims, req.GetCode()); err != nil {
+		if errors.Is(err, auth.ErrInvalidMFACode) {
+			return nil, status.Error(codes.InvalidArgument, "invalid code")
+		}
+		if errors.Is(err, auth.ErrTOTPEnabled) {
+			return nil, status.Error(codes.FailedPrecondition, "totp is already enabled")
+		}
+		if errors.Is(err, auth.ErrTOTPNotEnrolling) {
+			return nil, status.Error(codes.FailedPrecondition, "totp enrollment has not been started")
+		}
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+
+	return &sso.ConfirmTOTPResponse{}, nil
+}
+
+func (s *serverAPI) VerifyMFA(ctx context.Context, req *sso.VerifyMFARequest) (*sso.VerifyMFAResponse, error) {
+	if req.GetMfaToken() == "" {
+		return nil, status.Error(codes.InvalidArgument, "mfa_token is required")
+	}
+	if req.GetCode() == "" {
+		return nil, status.Error(codes.InvalidArgument, "code is required")
+	}
+	tokens, err := s.auth.VerifyMFA(ctx, req.GetMfaToken(), req.GetCode())
+	if err != nil {
+		var throttled *auth.LoginThrottledError
+		if errors.As(err, &throttled) {
+			return nil, throttledError(ctx, throttled)
+		}
+		if errors.Is(err, auth.ErrInvalidMFAToken) {
+			return nil, status.Error(codes.Unauthenticated, "invalid or expired mfa_token")
+		}
+		if errors.Is(err, auth.ErrInvalidMFACode) {
+			return nil, status.Error(codes.Unauthenticated, "invalid code")
+		}
+		if errors.Is(err, auth.ErrPasskeyRequired) {
+			return nil, status.Error(codes.FailedPrecondition, "second factor must be a passkey")
+		}
+		if errors.Is(err, auth.ErrEmailNotVerified) {
+			return nil, status.Error(codes.FailedPrecondition, "email is not verified")
+		}
+		if errors.Is(err, auth.ErrNotOrgMember) {
+			return nil, status.Error(codes.PermissionDenied, "not a member of the organization")
+		}
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+
+	return &sso.VerifyMFAResponse{Token: tokens.AccessToken, RefreshToken: tokens.RefreshToken}, nil
+}
+
+func (s *serverAPI) BeginPasskeyRegistration(
+	ctx context.Context,
+	_ *sso.BeginPasskeyRegistrationRequest,
+) (*sso.BeginPasskeyRegistrationResponse, error) {
+	claims, err := s.authenticateUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	challenge, err := s.auth.BeginPasskeyRegistration(ctx, claims)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+
+	return &sso.BeginPasskeyRegistrationResponse{
+		OptionsJson: string(challenge.OptionsJSON),
+		Session:     challenge.Session,
+	}, nil
+}
+
+func (s *serverAPI) FinishPasskeyRegistration(
+	ctx context.Context,
+	req *sso.FinishPasskeyRegistrationRequest,
+) (*sso.FinishPasskeyRegistrationResponse, error) {
+	claims, err := s.authenticateUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateFinishPasskeyRegistration(req); err != nil {
+		return nil, err
+	}
+	passkey, err := s.auth.FinishPasskeyRegistration(
+		ctx,
+		claims,
+		req.GetSession(),
+		req.GetClientDataJson(),
+		req.GetAttestationObject(),
+		req.GetName(),
+	)
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidPasskeySession) {
+			return nil, status.Error(codes.InvalidArgument, "invalid or expired session")
+		}
+		if errors.Is(err, auth.ErrInvalidPasskey) {
+			return nil, status.Error(codes.InvalidArgument, "invalid passkey")
+		}
+		if errors.Is(err, auth.ErrInvalidPasskeyName) {
+			return nil, status.Error(codes.InvalidArgument, "name is too long")
+		}
+		if errors.Is(err, auth.ErrPasskeyExists) {
+			return nil, status.Error(codes.AlreadyExists, "passkey already registered")
+		}
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+
+	return &sso.FinishPasskeyRegistrationResponse{CredentialId: passkey.ID}, nil
+}
+
+func (s *serverAPI) BeginPasskeyLogin(ctx context.Context, req *sso.BeginPasskeyLoginRequest) (*sso.BeginPasskeyLoginResponse, error) {
+	if req.GetMfaToken() == "" && req.GetAppId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "app_id is required")
+	}
+	challenge, err := s.auth.BeginPasskeyLogin(ctx, req.GetAppId(), req.GetOrgId(), req.GetMfaToken())
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidMFAToken) {
+			return nil, status.Error(codes.Unauthenticated, "invalid or expired mfa_token")
+		}
+		if errors.Is(err, auth.ErrInvalidPasskey) {
+			return nil, status.Error(codes.FailedPrecondition, "no passkey registered")
+		}
+		if errors.Is(err, storage.ErrAppNotFound) {
+			return nil, status.Error(codes.NotFound, "app not found")
+		}
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+
+	return &sso.BeginPasskeyLoginResponse{
+		OptionsJson: string(challenge.OptionsJSON),
+		Session:     challenge.Session,
+	}, nil
+}
+
+func (s *serverAPI) FinishPasskeyLogin(ctx context.Context, req *sso.FinishPasskeyLoginRequest) (*sso.FinishPasskeyLoginResponse, error) {
+	if err := validateFinishPasskeyLogin(req); err != nil {
+		return nil, err
+	}
+	tokens, err := s.auth.FinishPasskeyLogin(
+		ctx,
+		req.GetSession(),
+		req.GetCredentialId(),
+		req.GetClientDataJson(),
+		req.GetAuthenticatorData(),
+		req.GetSignature(),
+		req.GetUserHandle(),
+	)
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidPasskeySession) {
+			return nil, status.Error(codes.Unauthenticated, "invalid or expired session")
+		}
+		if errors.Is(err, auth.ErrInvalidMFAToken) {
+			return nil, status.Error(codes.Unauthenticated, "invalid or expired mfa_token")
+		}
+		if errors.Is(err, auth.ErrInvalidPasskey) {
+			return nil, status.Error(codes.Unauthenticated, "invalid passkey")
+		}
+		if errors.Is(err, auth.ErrEmailNotVerified) {
+			return nil, status.Error(codes.FailedPrecondition, "email is not verified")
+		}
+		if errors.Is(err, auth.ErrNotOrgMember) {
+			return nil, status.Error(codes.PermissionDenied, "not a member of the organization")
+		}
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+
+	return &sso.FinishPasskeyLoginResponse{Token: tokens.AccessToken, RefreshToken: tokens.RefreshToken}, nil
+}
+
+func toUserAccount(userAccount models.UserAccount) *sso.UserAccount {
+	return &sso.UserAccount{
+		UserId:             userAccount.UserId.String(),
+		UserName:           userAccount.UserName,
+		ProfilePicturePath: userAccount.ProfilePicturePath,
+	}
 }
 
 func (s *serverAPI) IsAdmin(ctx context.Context, req *sso.IsAdminRequest) (*sso.IsAdminResponse, error) {
@@ -106,6 +571,305 @@ func (s *serverAPI) IsAdmin(ctx context.Context, req *sso.IsAdminRequest) (*sso.
 		IsAdmin: isAdmin,
 	}, nil
 }
+func (s *serverAPI) JWKS(ctx context.Context, req *sso.JWKSRequest) (*sso.JWKSResponse, error) {
+	set, err := s.keys.JWKS(ctx)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+
+	keys := make([]*sso.JSONWebKey, 0, len(set.Keys))
+	for _, key := range set.Keys {
+		keys = append(keys, &sso.JSONWebKey{
+			Kty: key.KeyType,
+			Kid: key.KeyID,
+			Use: key.Use,
+			Alg: key.Algorithm,
+			N:   key.N,
+			E:   key.E,
+			Crv: key.Curve,
+			X:   key.X,
+		})
+	}
+
+	return &sso.JWKSResponse{
+		Keys: keys,
+	}, nil
+}
+
+func (s *serverAPI) Logout(ctx context.Context, req *sso.LogoutRequest) (*sso.LogoutResponse, error) {
+	claims, err := s.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.auth.Logout(ctx, claims, req.GetRefreshToken()); err != nil {
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+	return &sso.LogoutResponse{}, nil
+}
+
+func (s *serverAPI) RevokeTokens(ctx context.Context, req *sso.RevokeTokensRequest) (*sso.RevokeTokensResponse, error) {
+	if _, err := s.requirePermission(ctx, auth.PermissionRevokeTokens); err != nil {
+		return nil, err
+	}
+	if req.GetUserId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "user_id is required")
+	}
+	if err := s.auth.RevokeTokens(ctx, req.GetUserId()); err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return nil, status.Error(codes.NotFound, "user not found")
+		}
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+	return &sso.RevokeTokensResponse{}, nil
+}
+
+func (s *serverAPI) Introspect(ctx context.Context, req *sso.IntrospectRequest) (*sso.IntrospectResponse, error) {
+	if req.GetToken() == "" {
+		return nil, status.Error(codes.InvalidArgument, "token is required")
+	}
+	claims, active, err := s.auth.Introspect(ctx, req.GetToken())
+	if err != nil {
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+	if !active {
+		return &sso.IntrospectResponse{Active: false}, nil
+	}
+	resp := &sso.IntrospectResponse{
+		Active:      true,
+		Email:       claims.Email,
+		AppId:       int64(claims.AppID),
+		Exp:         claims.ExpiresAt.Unix(),
+		Iat:         claims.IssuedAt.Unix(),
+		Jti:         claims.TokenID,
+		Scopes:      claims.Scopes,
+		Roles:       claims.Roles,
+		Permissions: claims.Permissions,
+		OrgId:       claims.OrgID,
+		OrgRole:     claims.OrgRole,
+	}
+	if claims.IsClient() {
+		resp.ClientId = int64(claims.ClientID)
+	} else {
+		resp.UserId = claims.UserID.String()
+	}
+	if claims.SessionID != uuid.Nil {
+		resp.SessionId = claims.SessionID.String()
+	}
+	return resp, nil
+}
+
+func (s *serverAPI) ClientCredentials(ctx context.Context, req *sso.ClientCredentialsRequest) (*sso.ClientCredentialsResponse, error) {
+	if req.GetAppId() == emptyValue || req.GetClientSecret() == "" {
+		return nil, status.Error(codes.InvalidArgument, "app_id and client_secret are required")
+	}
+	token, err := s.auth.ClientCredentials(ctx, req.GetAppId(), req.GetClientSecret(), req.GetScopes())
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidClient) {
+			return nil, status.Error(codes.Unauthenticated, "invalid client credentials")
+		}
+		if errors.Is(err, auth.ErrInvalidScope) {
+			return nil, status.Error(codes.PermissionDenied, "scope not granted")
+		}
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+	return &sso.ClientCredentialsResponse{
+		Token:     token.AccessToken,
+		ExpiresIn: int64(token.ExpiresIn.Seconds()),
+		Scopes:    token.Scopes,
+	}, nil
+}
+
+func (s *serverAPI) VerifyEmail(ctx context.Context, req *sso.VerifyEmailRequest) (*sso.VerifyEmailResponse, error) {
+	if req.GetToken() == "" {
+		return nil, status.Error(codes.InvalidArgument, "token is required")
+	}
+	if err := s.auth.VerifyEmail(ctx, req.GetToken()); err != nil {
+		if errors.Is(err, auth.ErrInvalidVerificationToken) {
+			return nil, status.Error(codes.InvalidArgument, "invalid or expired verification token")
+		}
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+	return &sso.VerifyEmailResponse{}, nil
+}
+
+func (s *serverAPI) ResendVerification(ctx context.Context, req *sso.ResendVerificationRequest) (*sso.ResendVerificationResponse, error) {
+	if err := validation.Validate(req.GetEmail(), validation.Required, is.Email); err != nil {
+		return nil, status.Error(codes.InvalidArgument, "email is required")
+	}
+	if err := s.auth.ResendVerification(ctx, req.GetEmail()); err != nil {
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+	return &sso.ResendVerificationResponse{}, nil
+}
+
+func (s *serverAPI) RequestPasswordReset(ctx context.Context, req *sso.RequestPasswordResetRequest) (*sso.RequestPasswordResetResponse, error) {
+	if err := validation.Validate(req.GetEmail(), validation.Required, is.Email); err != nil {
+		return nil, status.Error(codes.InvalidArgument, "email is required")
+	}
+	if err := s.auth.RequestPasswordReset(ctx, req.GetEmail()); err != nil {
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+	return &sso.RequestPasswordResetResponse{}, nil
+}
+
+func (s *serverAPI) ResetPassword(ctx context.Context, req *sso.ResetPasswordRequest) (*sso.ResetPasswordResponse, error) {
+	if req.GetToken() == "" {
+		return nil, status.Error(codes.InvalidArgument, "token is required")
+	}
+	if req.GetNewPassword() == "" {
+		return nil, status.Error(codes.InvalidArgument, "new_password is required")
+	}
+	if err := s.auth.ResetPassword(ctx, req.GetToken(), req.GetNewPassword(), req.GetAppId()); err != nil {
+		if errors.Is(err, auth.ErrInvalidResetToken) {
+			return nil, status.Error(codes.InvalidArgument, "invalid or expired reset token")
+		}
+		if errors.Is(err, auth.ErrWeakPassword) {
+			return nil, weakPasswordError(err, "new_password")
+		}
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+	return &sso.ResetPasswordResponse{}, nil
+}
+
+func (s *serverAPI) GenerateBackupCodes(
+	ctx context.Context,
+	req *sso.GenerateBackupCodesRequest,
+) (*sso.GenerateBackupCodesResponse, error) {
+	claims, err := s.authenticateUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if req.GetPassword() == "" {
+		return nil, status.Error(codes.InvalidArgument, "password is required")
+	}
+	backupCodes, err := s.auth.GenerateBackupCodes(ctx, claims, req.GetPassword())
+	if err != nil {
+		var throttled *auth.LoginThrottledError
+		if errors.As(err, &throttled) {
+			return nil, throttledError(ctx, throttled)
+		}
+		if errors.Is(err, auth.ErrInvalidCredentials) {
+			return nil, status.Error(codes.PermissionDenied, "invalid password")
+		}
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+
+	return &sso.GenerateBackupCodesResponse{Codes: backupCodes}, nil
+}
+
+func (s *serverAPI) RecoverAccount(ctx context.Context, req *sso.RecoverAccountRequest) (*sso.RecoverAccountResponse, error) {
+	if req.GetEmail() == "" || req.GetBackupCode() == "" {
+		return nil, status.Error(codes.InvalidArgument, "email and backup_code are required")
+	}
+	if req.GetNewPassword() == "" {
+		return nil, status.Error(codes.InvalidArgument, "new_password is required")
+	}
+	if err := s.auth.RecoverAccount(ctx, req.GetEmail(), req.GetBackupCode(), req.GetNewPassword(), req.GetAppId()); err != nil {
+		if errors.Is(err, auth.ErrInvalidBackupCode) {
+			return nil, status.Error(codes.InvalidArgument, "invalid email or backup code")
+		}
+		if errors.Is(err, auth.ErrWeakPassword) {
+			return nil, weakPasswordError(err, "new_password")
+		}
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+
+	return &sso.RecoverAccountResponse{}, nil
+}
+
+func (s *serverAPI) ChangePassword(ctx context.Context, req *sso.ChangePasswordRequest) (*sso.ChangePasswordResponse, error) {
+	claims, err := s.authenticateUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if req.GetCurrentPassword() == "" || req.GetNewPassword() == "" {
+		return nil, status.Error(codes.InvalidArgument, "current_password and new_password are required")
+	}
+	tokens, err := s.auth.ChangePassword(ctx, claims, req.GetCurrentPassword(), req.GetNewPassword())
+	if err != nil {
+		var throttled *auth.LoginThrottledError
+		if errors.As(err, &throttled) {
+			return nil, throttledError(ctx, throttled)
+		}
+		if errors.Is(err, auth.ErrInvalidCredentials) {
+			return nil, status.Error(codes.PermissionDenied, "invalid password")
+		}
+		if errors.Is(err, auth.ErrWeakPassword) {
+			return nil, weakPasswordError(err, "new_password")
+		}
+		if errors.Is(err, auth.ErrNotOrgMember) {
+			return nil, status.Error(codes.PermissionDenied, "not a member of the organization")
+		}
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+	return &sso.ChangePasswordResponse{
+		Token:        tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+	}, nil
+}
+
+func (s *serverAPI) ChangeEmail(ctx context.Context, req *sso.ChangeEmailRequest) (*sso.ChangeEmailResponse, error) {
+	claims, err := s.authenticateUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if req.GetPassword() == "" {
+		return nil, status.Error(codes.InvalidArgument, "password is required")
+	}
+	if err := validation.Validate(req.GetNewEmail(), validation.Required, is.Email); err != nil {
+		return nil, status.Error(codes.InvalidArgument, "new_email must be a valid email")
+	}
+	if err := s.auth.ChangeEmail(ctx, claims, req.GetPassword(), req.GetNewEmail()); err != nil {
+		var throttled *auth.LoginThrottledError
+		if errors.As(err, &throttled) {
+			return nil, throttledError(ctx, throttled)
+		}
+		if errors.Is(err, auth.ErrInvalidCredentials) {
+			return nil, status.Error(codes.PermissionDenied, "invalid password")
+		}
+		if errors.Is(err, auth.ErrEmailUnchanged) {
+			return nil, status.Error(codes.InvalidArgument, "new_email is the current email")
+		}
+		if errors.Is(err, storage.ErrUserExists) {
+			return nil, status.Error(codes.AlreadyExists, "email is already taken")
+		}
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+	return &sso.ChangeEmailResponse{}, nil
+}
+
+func (s *serverAPI) ConfirmEmailChange(ctx context.Context, req *sso.ConfirmEmailChangeRequest) (*sso.ConfirmEmailChangeResponse, error) {
+	if req.GetToken() == "" {
+		return nil, status.Error(codes.InvalidArgument, "token is required")
+	}
+	if err := s.auth.ConfirmEmailChange(ctx, req.GetToken()); err != nil {
+		if errors.Is(err, auth.ErrInvalidEmailChangeToken) {
+			return nil, status.Error(codes.InvalidArgument, "invalid or expired token")
+		}
+		if errors.Is(err, storage.ErrUserExists) {
+			return nil, status.Error(codes.AlreadyExists, "email is already taken")
+		}
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+	return &sso.ConfirmEmailChangeResponse{}, nil
+}
+
+func (s *serverAPI) UndoEmailChange(ctx context.Context, req *sso.UndoEmailChangeRequest) (*sso.UndoEmailChangeResponse, error) {
+	if req.GetToken() == "" {
+		return nil, status.Error(codes.InvalidArgument, "token is required")
+	}
+	if err := s.auth.UndoEmailChange(ctx, req.GetToken()); err != nil {
+		if errors.Is(err, auth.ErrInvalidEmailChangeToken) {
+			return nil, status.Error(codes.InvalidArgument, "invalid or expired token")
+		}
+		if errors.Is(err, storage.ErrUserExists) {
+			return nil, status.Error(codes.AlreadyExists, "email is already taken")
+		}
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+	return &sso.UndoEmailChangeResponse{}, nil
+}
+
 func validateIsAdmin(req *sso.IsAdminRequest) error {
 	if req.UserId == "" {
 		return status.Error(codes.InvalidArgument, "user_id is required")
@@ -116,14 +880,14 @@ func validateIsAdmin(req *sso.IsAdminRequest) error {
 func validateRegister(req *sso.RegisterRequest) error {
 	err := validation.ValidateStruct(
 		req,
-		validation.Field(req.Email, validation.Required, is.Email),
+		validation.Field(&req.Email, validation.Required, is.Email),
 	)
 	if err != nil {
 		return status.Error(codes.InvalidArgument, "email is required")
 	}
 	err = validation.ValidateStruct(
 		req,
-		validation.Field(req.Password, validation.NilOrNotEmpty),
+		validation.Field(&req.Password, validation.Required),
 	)
 	if err != nil {
 		return status.Error(codes.InvalidArgument, "password is required")
@@ -144,3 +908,35 @@ func validateLogin(req *sso.LoginRequest) error {
 	}
 	return nil
 }
+
+func validateFinishPasskeyRegistration(req *sso.FinishPasskeyRegistrationRequest) error {
+	if req.GetSession() == "" {
+		return status.Error(codes.InvalidArgument, "session is required")
+	}
+	if len(req.GetClientDataJson()) == 0 {
+		return status.Error(codes.InvalidArgument, "client_data_json is required")
+	}
+	if len(req.GetAttestationObject()) == 0 {
+		return status.Error(codes.InvalidArgument, "attestation_object is required")
+	}
+	return nil
+}
+
+func validateFinishPasskeyLogin(req *sso.FinishPasskeyLoginRequest) error {
+	if req.GetSession() == "" {
+		return status.Error(codes.InvalidArgument, "session is required")
+	}
+	if len(req.GetCredentialId()) == 0 {
+		return status.Error(codes.InvalidArgument, "credential_id is required")
+	}
+	if len(req.GetClientDataJson()) == 0 {
+		return status.Error(codes.InvalidArgument, "client_data_json is required")
+	}
+	if len(req.GetAuthenticatorData()) == 0 {
+		return status.Error(codes.InvalidArgument, "authenticator_data is required")
+	}
+	if len(req.GetSignature()) == 0 {
+		return status.Error(codes.InvalidArgument, "signature is required")
+	}
+	return nil
+}
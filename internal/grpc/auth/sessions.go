@@ -0,0 +1,107 @@
+package authgrpc
+
+import (
+	"context"
+	"errors"
+
+	"github.com/Novochenko/protos/gen/go/sso"
+	"github.com/Novochenko/sso/domain/models"
+	"github.com/Novochenko/sso/internal/services/auth"
+	"github.com/Novochenko/sso/internal/storage"
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func (s *serverAPI) ListSessions(ctx context.Context, _ *sso.ListSessionsRequest) (*sso.ListSessionsResponse, error) {
+	claims, err := s.authenticateUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sessions, err := s.auth.Sessions(ctx, claims.UserID)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+
+	return &sso.ListSessionsResponse{Sessions: toSessions(sessions, claims.SessionID)}, nil
+}
+
+func (s *serverAPI) RevokeSession(ctx context.Context, req *sso.RevokeSessionRequest) (*sso.RevokeSessionResponse, error) {
+	claims, err := s.authenticateUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sessionID, err := uuid.Parse(req.GetSessionId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid session_id")
+	}
+	if err := s.auth.RevokeSession(ctx, claims.UserID, sessionID); err != nil {
+		return nil, sessionError(err)
+	}
+
+	return &sso.RevokeSessionResponse{}, nil
+}
+
+func (s *serverAPI) ListUserSessions(ctx context.Context, req *sso.ListUserSessionsRequest) (*sso.ListUserSessionsResponse, error) {
+	claims, err := s.requirePermission(ctx, auth.PermissionManageSessions)
+	if err != nil {
+		return nil, err
+	}
+	userID, err := uuid.Parse(req.GetUserId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid user_id")
+	}
+	sessions, err := s.auth.Sessions(ctx, userID)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+
+	return &sso.ListUserSessionsResponse{Sessions: toSessions(sessions, claims.SessionID)}, nil
+}
+
+func (s *serverAPI) RevokeUserSession(ctx context.Context, req *sso.RevokeUserSessionRequest) (*sso.RevokeUserSessionResponse, error) {
+	if _, err := s.requirePermission(ctx, auth.PermissionManageSessions); err != nil {
+		return nil, err
+	}
+	userID, err := uuid.Parse(req.GetUserId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid user_id")
+	}
+	sessionID, err := uuid.Parse(req.GetSessionId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid session_id")
+	}
+	if err := s.auth.RevokeSession(ctx, userID, sessionID); err != nil {
+		return nil, sessionError(err)
+	}
+
+	return &sso.RevokeUserSessionResponse{}, nil
+}
+
+func sessionError(err error) error {
+	if errors.Is(err, storage.ErrSessionNotFound) {
+		return status.Error(codes.NotFound, "session not found")
+	}
+
+	return status.Error(codes.Internal, "internal error")
+}
+
+// toSessions converts sessions, marking current as the caller's own.
+func toSessions(sessions []models.LoginSession, current uuid.UUID) []*sso.Session {
+	res := make([]*sso.Session, 0, len(sessions))
+	for _, session := range sessions {
+		res = append(res, &sso.Session{
+			SessionId:  session.ID.String(),
+			AppId:      int64(session.AppID),
+			OrgId:      session.OrgID,
+			UserAgent:  session.UserAgent,
+			Ip:         session.IP,
+			CreatedAt:  session.CreatedAt.Unix(),
+			LastSeenAt: session.LastSeenAt.Unix(),
+			ExpiresAt:  session.ExpiresAt.Unix(),
+			Current:    current != uuid.Nil && session.ID == current,
+		})
+	}
+
+	return res
+}
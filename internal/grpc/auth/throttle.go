@@ -0,0 +1,44 @@
+package authgrpc
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strconv"
+
+	"github.com/Novochenko/protos/gen/go/sso"
+	"github.com/Novochenko/sso/internal/services/auth"
+	"github.com/Novochenko/sso/internal/storage"
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func (s *serverAPI) UnlockAccount(ctx context.Context, req *sso.UnlockAccountRequest) (*sso.UnlockAccountResponse, error) {
+	if _, err := s.requirePermission(ctx, auth.PermissionUnlockAccounts); err != nil {
+		return nil, err
+	}
+	userID, err := uuid.Parse(req.GetUserId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid user_id")
+	}
+	if err := s.auth.UnlockAccount(ctx, userID); err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return nil, status.Error(codes.NotFound, "user not found")
+		}
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+
+	return &sso.UnlockAccountResponse{}, nil
+}
+
+// throttledError tells the client how many whole seconds to wait in the
+// retry-after header.
+func throttledError(ctx context.Context, err *auth.LoginThrottledError) error {
+	seconds := int64(math.Ceil(err.RetryAfter.Seconds()))
+	_ = grpc.SetHeader(ctx, metadata.Pairs("retry-after", strconv.FormatInt(seconds, 10)))
+
+	return status.Error(codes.ResourceExhausted, "too many failed login attempts, try again later")
+}
@@ -0,0 +1,200 @@
+package oidchttp
+
+import (
+	"errors"
+	"html/template"
+	"log/slog"
+	"net/http"
+
+	"github.com/Novochenko/sso/internal/lib/logger/sl"
+	"github.com/Novochenko/sso/internal/services/oidc"
+)
+
+func (h *handler) deviceAuthorization(w http.ResponseWriter, r *http.Request) {
+	const op = "http.oidc.deviceAuthorization"
+
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, http.StatusBadRequest, &oidc.Error{Code: oidc.ErrCodeInvalidRequest})
+		return
+	}
+
+	clientID, clientSecret := clientCredentials(r)
+	device, err := h.oidc.AuthorizeDevice(r.Context(), clientID, clientSecret, r.PostForm.Get("scope"))
+	if err != nil {
+		var oauthErr *oidc.Error
+		if errors.As(err, &oauthErr) {
+			code := http.StatusBadRequest
+			if oauthErr.Code == oidc.ErrCodeInvalidClient {
+				code = http.StatusUnauthorized
+			}
+			writeOAuthError(w, code, oauthErr)
+			return
+		}
+		h.log.Error("failed to authorize device", slog.String("op", op), sl.Err(err))
+		writeOAuthError(w, http.StatusInternalServerError, &oidc.Error{Code: "server_error"})
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, deviceAuthorizationResponse{
+		DeviceCode:              device.DeviceCode,
+		UserCode:                device.UserCode,
+		VerificationURI:         device.VerificationURI,
+		VerificationURIComplete: device.VerificationURIComplete,
+		ExpiresIn:               int64(device.ExpiresIn.Seconds()),
+		Interval:                int64(device.Interval.Seconds()),
+	})
+}
+
+// device is the verification page where a signed-in user enters the user
+// code shown by a device and approves or denies its request.
+func (h *handler) device(w http.ResponseWriter, r *http.Request) {
+	const op = "http.oidc.device"
+
+	log := h.log.With(slog.String("op", op))
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	page := devicePage{UserCode: r.Form.Get("user_code")}
+
+	session, err := h.session(r)
+	if err == nil {
+		page.Email = session.Email
+	}
+
+	if page.UserCode == "" {
+		h.renderDevice(w, page)
+		return
+	}
+
+	app, code, err := h.oidc.PendingDevice(r.Context(), page.UserCode)
+	if err != nil {
+		if errors.Is(err, oidc.ErrUnknownUserCode) {
+			page.Error = "The code is invalid or has expired."
+			w.WriteHeader(http.StatusNotFound)
+			h.renderDevice(w, page)
+			return
+		}
+		if writeThrottled(w, err) {
+			page.Error = "Too many attempts. Try again later."
+			h.renderDevice(w, page)
+			return
+		}
+		log.Error("failed to get device authorization", sl.Err(err))
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	page.AppName = app.Name
+	page.Scope = code.Scope
+	page.UserCode = oidc.FormatUserCode(code.UserCode)
+
+	if r.Method == http.MethodGet || r.PostForm.Get("action") == "" {
+		h.renderDevice(w, page)
+		return
+	}
+
+	// Denying needs a sign-in too, or anyone who learns a user code could
+	// cancel someone else's device login.
+	approve := r.PostForm.Get("action") == "allow"
+	if page.Email == "" {
+		token, err := h.oidc.DeviceLogin(r.Context(), page.UserCode, r.PostForm.Get("email"), r.PostForm.Get("password"), r.PostForm.Get("otp"))
+		if err != nil {
+			if errors.Is(err, oidc.ErrDeviceCodeLocked) {
+				page = devicePage{Error: "Too many failed sign-in attempts. The request was denied; start over on your device."}
+				w.WriteHeader(http.StatusForbidden)
+				h.renderDevice(w, page)
+				return
+			}
+			if msg, ok := writeLoginError(w, err); ok {
+				page.Error = msg
+				h.renderDevice(w, page)
+				return
+			}
+			log.Error("failed to log in", sl.Err(err))
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		session, err = h.oidc.Session(r.Context(), token)
+		if err != nil {
+			log.Error("failed to verify new session", sl.Err(err))
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		h.setSession(w, token)
+		page.Email = session.Email
+	}
+
+	if err := h.oidc.DecideDevice(r.Context(), page.UserCode, session, approve); err != nil {
+		if errors.Is(err, oidc.ErrUnknownUserCode) {
+			page.Error = "The code is invalid or has expired."
+			w.WriteHeader(http.StatusNotFound)
+			h.renderDevice(w, page)
+			return
+		}
+		log.Error("failed to decide device authorization", sl.Err(err))
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	page.Done = true
+	page.Approved = approve
+	h.renderDevice(w, page)
+}
+
+func (h *handler) renderDevice(w http.ResponseWriter, page devicePage) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("X-Frame-Options", "DENY")
+	if err := deviceTemplate.Execute(w, page); err != nil {
+		h.log.Error("failed to render device page", sl.Err(err))
+	}
+}
+
+type devicePage struct {
+	UserCode string
+	AppName  string
+	Scope    string
+	Email    string
+	Error    string
+	Done     bool
+	Approved bool
+}
+
+var deviceTemplate = template.Must(template.New("device").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Connect a device</title></head>
+<body>
+<h1>Connect a device</h1>
+{{if .Error}}<p style="color: red">{{.Error}}</p>{{end}}
+{{if .Done}}
+  {{if .Approved}}
+  <p>{{.AppName}} is now connected. You can return to your device.</p>
+  {{else}}
+  <p>The request was denied. You can close this page.</p>
+  {{end}}
+{{else if .AppName}}
+<form method="post" action="/device">
+  <input type="hidden" name="user_code" value="{{.UserCode}}">
+  {{if .Email}}
+  <p>Signed in as {{.Email}}.</p>
+  {{else}}
+  <p><label>Email <input type="email" name="email" required></label></p>
+  <p><label>Password <input type="password" name="password" required></label></p>
+  <p><label>One-time code <input type="text" name="otp" autocomplete="one-time-code"></label> from your authenticator app, or a backup code</p>
+  {{end}}
+  <p>{{.AppName}} with code <strong>{{.UserCode}}</strong> wants to access your account{{if .Scope}} ({{.Scope}}){{end}}.</p>
+  <button type="submit" name="action" value="allow">Allow</button>
+  <button type="submit" name="action" value="deny">Deny</button>
+</form>
+{{else}}
+<form method="get" action="/device">
+  <p><label>Enter the code shown on your device <input type="text" name="user_code" value="{{.UserCode}}" autocomplete="off" required></label></p>
+  <button type="submit">Continue</button>
+</form>
+{{end}}
+</body>
+</html>
+`))
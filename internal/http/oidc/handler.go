@@ -0,0 +1,454 @@
+package oidchttp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"log/slog"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Novochenko/sso/domain/models"
+	"github.com/Novochenko/sso/internal/lib/jwt"
+	"github.com/Novochenko/sso/internal/lib/logger/sl"
+	"github.com/Novochenko/sso/internal/services/auth"
+	"github.com/Novochenko/sso/internal/services/oidc"
+)
+
+const (
+	sessionCookie = "sso_session"
+
+	grantTypeAuthorizationCode = "authorization_code"
+	grantTypeRefreshToken      = "refresh_token"
+	grantTypeClientCredentials = "client_credentials"
+	grantTypeDeviceCode        = "urn:ietf:params:oauth:grant-type:device_code"
+)
+
+type OIDC interface {
+	Issuer() string
+	SessionTTL() time.Duration
+	ValidateRedirect(ctx context.Context, clientID, redirectURI string) (models.App, error)
+	ValidateAuthorizeRequest(req oidc.AuthorizeRequest) error
+	Login(ctx context.Context, email, password, code string) (string, error)
+	Session(ctx context.Context, session string) (jwt.Claims, error)
+	IssueCode(ctx context.Context, req oidc.AuthorizeRequest, session jwt.Claims) (string, error)
+	ExchangeCode(
+		ctx context.Context,
+		clientID string,
+		clientSecret string,
+		code string,
+		redirectURI string,
+		codeVerifier string,
+	) (oidc.Tokens, error)
+	RefreshTokens(ctx context.Context, clientID, clientSecret, refreshToken string) (oidc.Tokens, error)
+	ClientCredentials(ctx context.Context, clientID, clientSecret, scope string) (oidc.Tokens, error)
+	UserInfo(ctx context.Context, accessToken string) (oidc.UserInfo, error)
+	AuthorizeDevice(ctx context.Context, clientID, clientSecret, scope string) (oidc.DeviceAuthorization, error)
+	PendingDevice(ctx context.Context, userCode string) (models.App, models.DeviceCode, error)
+	DeviceLogin(ctx context.Context, userCode, email, password, otp string) (string, error)
+	DecideDevice(ctx context.Context, userCode string, session jwt.Claims, approve bool) error
+	PollDevice(ctx context.Context, clientID, clientSecret, deviceCode string) (oidc.Tokens, error)
+}
+
+type handler struct {
+	log           *slog.Logger
+	oidc          OIDC
+	secureCookies bool
+}
+
+func Register(mux *http.ServeMux, log *slog.Logger, oidc OIDC, secureCookies bool) {
+	h := &handler{log: log, oidc: oidc, secureCookies: secureCookies}
+
+	mux.HandleFunc("GET /authorize", h.authorize)
+	mux.HandleFunc("POST /authorize", h.authorize)
+	mux.HandleFunc("POST /token", h.token)
+	mux.HandleFunc("POST /device_authorization", h.deviceAuthorization)
+	mux.HandleFunc("GET /device", h.device)
+	mux.HandleFunc("POST /device", h.device)
+	mux.HandleFunc("GET /userinfo", h.userinfo)
+	mux.HandleFunc("POST /userinfo", h.userinfo)
+	mux.HandleFunc("GET /.well-known/openid-configuration", h.discovery)
+}
+
+func (h *handler) authorize(w http.ResponseWriter, r *http.Request) {
+	const op = "http.oidc.authorize"
+
+	log := h.log.With(slog.String("op", op))
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	req := oidc.AuthorizeRequest{
+		ResponseType:        r.Form.Get("response_type"),
+		ClientID:            r.Form.Get("client_id"),
+		RedirectURI:         r.Form.Get("redirect_uri"),
+		Scope:               r.Form.Get("scope"),
+		State:               r.Form.Get("state"),
+		Nonce:               r.Form.Get("nonce"),
+		CodeChallenge:       r.Form.Get("code_challenge"),
+		CodeChallengeMethod: r.Form.Get("code_challenge_method"),
+	}
+
+	// Never redirect to an unverified URI.
+	app, err := h.oidc.ValidateRedirect(r.Context(), req.ClientID, req.RedirectURI)
+	if err != nil {
+		var oauthErr *oidc.Error
+		if errors.As(err, &oauthErr) {
+			http.Error(w, oauthErr.Error(), http.StatusBadRequest)
+			return
+		}
+		log.Error("failed to validate redirect uri", sl.Err(err))
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := h.oidc.ValidateAuthorizeRequest(req); err != nil {
+		h.redirectError(w, r, req, err)
+		return
+	}
+
+	page := loginPage{
+		AppName: app.Name,
+		Request: req,
+	}
+
+	session, err := h.session(r)
+	if err == nil {
+		page.Email = session.Email
+	}
+
+	if r.Method == http.MethodGet {
+		h.renderLogin(w, page)
+		return
+	}
+
+	if r.PostForm.Get("action") != "allow" {
+		h.redirectError(w, r, req, &oidc.Error{Code: oidc.ErrCodeAccessDenied, Description: "the user denied the request"})
+		return
+	}
+
+	if page.Email == "" {
+		token, err := h.oidc.Login(r.Context(), r.PostForm.Get("email"), r.PostForm.Get("password"), r.PostForm.Get("otp"))
+		if err != nil {
+			if msg, ok := writeLoginError(w, err); ok {
+				page.Error = msg
+				h.renderLogin(w, page)
+				return
+			}
+			log.Error("failed to log in", sl.Err(err))
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		session, err = h.oidc.Session(r.Context(), token)
+		if err != nil {
+			log.Error("failed to verify new session", sl.Err(err))
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		h.setSession(w, token)
+	}
+
+	code, err := h.oidc.IssueCode(r.Context(), req, session)
+	if err != nil {
+		log.Error("failed to issue authorization code", sl.Err(err))
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	h.redirect(w, r, req, url.Values{"code": {code}})
+}
+
+func (h *handler) token(w http.ResponseWriter, r *http.Request) {
+	const op = "http.oidc.token"
+
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, http.StatusBadRequest, &oidc.Error{Code: oidc.ErrCodeInvalidRequest})
+		return
+	}
+
+	clientID, clientSecret := clientCredentials(r)
+
+	var tokens oidc.Tokens
+	var err error
+	switch r.PostForm.Get("grant_type") {
+	case grantTypeAuthorizationCode:
+		tokens, err = h.oidc.ExchangeCode(
+			r.Context(),
+			clientID,
+			clientSecret,
+			r.PostForm.Get("code"),
+			r.PostForm.Get("redirect_uri"),
+			r.PostForm.Get("code_verifier"),
+		)
+	case grantTypeRefreshToken:
+		tokens, err = h.oidc.RefreshTokens(r.Context(), clientID, clientSecret, r.PostForm.Get("refresh_token"))
+	case grantTypeClientCredentials:
+		tokens, err = h.oidc.ClientCredentials(r.Context(), clientID, clientSecret, r.PostForm.Get("scope"))
+	case grantTypeDeviceCode:
+		tokens, err = h.oidc.PollDevice(r.Context(), clientID, clientSecret, r.PostForm.Get("device_code"))
+	default:
+		err = &oidc.Error{Code: oidc.ErrCodeUnsupportedGrantType}
+	}
+	if err != nil {
+		var oauthErr *oidc.Error
+		if errors.As(err, &oauthErr) {
+			code := http.StatusBadRequest
+			if oauthErr.Code == oidc.ErrCodeInvalidClient {
+				code = http.StatusUnauthorized
+			}
+			writeOAuthError(w, code, oauthErr)
+			return
+		}
+		h.log.Error("failed to issue tokens", slog.String("op", op), sl.Err(err))
+		writeOAuthError(w, http.StatusInternalServerError, &oidc.Error{Code: "server_error"})
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, tokenResponse{
+		AccessToken:  tokens.AccessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(tokens.ExpiresIn.Seconds()),
+		RefreshToken: tokens.RefreshToken,
+		IDToken:      tokens.IDToken,
+		Scope:        tokens.Scope,
+	})
+}
+
+func (h *handler) userinfo(w http.ResponseWriter, r *http.Request) {
+	const op = "http.oidc.userinfo"
+
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		writeOAuthError(w, http.StatusUnauthorized, &oidc.Error{Code: oidc.ErrCodeInvalidToken})
+		return
+	}
+
+	info, err := h.oidc.UserInfo(r.Context(), token)
+	if err != nil {
+		var oauthErr *oidc.Error
+		if errors.As(err, &oauthErr) {
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			writeOAuthError(w, http.StatusUnauthorized, oauthErr)
+			return
+		}
+		h.log.Error("failed to get user info", slog.String("op", op), sl.Err(err))
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, userInfoResponse{
+		Subject:           info.Subject,
+		Email:             info.Email,
+		PreferredUsername: info.PreferredUsername,
+		Picture:           info.Picture,
+	})
+}
+
+func (h *handler) discovery(w http.ResponseWriter, r *http.Request) {
+	issuer := h.oidc.Issuer()
+
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	writeJSON(w, http.StatusOK, discoveryDocument{
+		Issuer:                      issuer,
+		AuthorizationEndpoint:       issuer + "/authorize",
+		DeviceAuthorizationEndpoint: issuer + "/device_authorization",
+		TokenEndpoint:               issuer + "/token",
+		UserinfoEndpoint:            issuer + "/userinfo",
+		JWKSURI:                     issuer + "/.well-known/jwks.json",
+		ScopesSupported:             oidc.SupportedScopes(),
+		ResponseTypesSupported:      []string{oidc.ResponseTypeCode},
+		GrantTypesSupported: []string{
+			grantTypeAuthorizationCode,
+			grantTypeRefreshToken,
+			grantTypeClientCredentials,
+			grantTypeDeviceCode,
+		},
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  []string{jwt.AlgRS256, jwt.AlgEdDSA},
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "none"},
+		CodeChallengeMethodsSupported:     []string{oidc.CodeChallengeS256},
+		ClaimsSupported:                   []string{"sub", "iss", "aud", "exp", "iat", "auth_time", "nonce", "email", "preferred_username", "picture"},
+	})
+}
+
+// clientCredentials returns the client authentication sent with the
+// client_secret_basic or client_secret_post method.
+func clientCredentials(r *http.Request) (clientID, clientSecret string) {
+	clientID, clientSecret, ok := r.BasicAuth()
+	if !ok {
+		clientID, clientSecret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+	return clientID, clientSecret
+}
+
+func (h *handler) session(r *http.Request) (jwt.Claims, error) {
+	cookie, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return jwt.Claims{}, err
+	}
+
+	return h.oidc.Session(r.Context(), cookie.Value)
+}
+
+func (h *handler) setSession(w http.ResponseWriter, token string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    token,
+		Path:     "/",
+		MaxAge:   int(h.oidc.SessionTTL().Seconds()),
+		HttpOnly: true,
+		Secure:   h.secureCookies,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func (h *handler) redirect(w http.ResponseWriter, r *http.Request, req oidc.AuthorizeRequest, params url.Values) {
+	target, err := url.Parse(req.RedirectURI)
+	if err != nil {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+
+	query := target.Query()
+	for key, values := range params {
+		for _, value := range values {
+			query.Add(key, value)
+		}
+	}
+	if req.State != "" {
+		query.Set("state", req.State)
+	}
+	target.RawQuery = query.Encode()
+
+	http.Redirect(w, r, target.String(), http.StatusFound)
+}
+
+func (h *handler) redirectError(w http.ResponseWriter, r *http.Request, req oidc.AuthorizeRequest, err error) {
+	var oauthErr *oidc.Error
+	if !errors.As(err, &oauthErr) {
+		oauthErr = &oidc.Error{Code: "server_error"}
+	}
+
+	params := url.Values{"error": {oauthErr.Code}}
+	if oauthErr.Description != "" {
+		params.Set("error_description", oauthErr.Description)
+	}
+
+	h.redirect(w, r, req, params)
+}
+
+// writeLoginError writes the status of a sign-in form that failed for a
+// reason the user can fix and returns what to tell them. Throttled logins
+// get 429 with the Retry-After header, the others 401.
+func writeLoginError(w http.ResponseWriter, err error) (string, bool) {
+	if writeThrottled(w, err) {
+		return "Too many failed sign-in attempts. Try again later.", true
+	}
+
+	msg, ok := loginErrorMessage(err)
+	if ok {
+		w.WriteHeader(http.StatusUnauthorized)
+	}
+
+	return msg, ok
+}
+
+// writeThrottled answers 429 with a Retry-After header if err is an
+// auth.LoginThrottledError, and reports whether it did.
+func writeThrottled(w http.ResponseWriter, err error) bool {
+	var throttled *auth.LoginThrottledError
+	if !errors.As(err, &throttled) {
+		return false
+	}
+	w.Header().Set("Retry-After", strconv.FormatInt(int64(math.Ceil(throttled.RetryAfter.Seconds())), 10))
+	w.WriteHeader(http.StatusTooManyRequests)
+
+	return true
+}
+
+// loginErrorMessage is what the sign-in forms tell the user when Login
+// fails for a reason they can fix.
+func loginErrorMessage(err error) (string, bool) {
+	switch {
+	case errors.Is(err, auth.ErrInvalidCredentials):
+		return "Invalid email or password.", true
+	case errors.Is(err, auth.ErrPasswordResetRequired):
+		return "Your password has appeared in a data breach. Check your email for a link to choose a new one.", true
+	case errors.Is(err, auth.ErrMFARequired):
+		return "Enter the one-time code from your authenticator app.", true
+	case errors.Is(err, auth.ErrInvalidMFACode):
+		return "Invalid one-time code.", true
+	case errors.Is(err, auth.ErrPasskeyRequired):
+		return "This account is protected by a passkey. Sign in with it in the app, or enter a backup code.", true
+	default:
+		return "", false
+	}
+}
+
+func (h *handler) renderLogin(w http.ResponseWriter, page loginPage) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("X-Frame-Options", "DENY")
+	if err := loginTemplate.Execute(w, page); err != nil {
+		h.log.Error("failed to render login page", sl.Err(err))
+	}
+}
+
+func writeOAuthError(w http.ResponseWriter, code int, err *oidc.Error) {
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, code, errorResponse{
+		Error:            err.Code,
+		ErrorDescription: err.Description,
+	})
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+type loginPage struct {
+	AppName string
+	Email   string
+	Error   string
+	Request oidc.AuthorizeRequest
+}
+
+var loginTemplate = template.Must(template.New("login").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Sign in</title></head>
+<body>
+<h1>Sign in to {{.AppName}}</h1>
+{{if .Error}}<p style="color: red">{{.Error}}</p>{{end}}
+<form method="post" action="/authorize">
+  <input type="hidden" name="response_type" value="{{.Request.ResponseType}}">
+  <input type="hidden" name="client_id" value="{{.Request.ClientID}}">
+  <input type="hidden" name="redirect_uri" value="{{.Request.RedirectURI}}">
+  <input type="hidden" name="scope" value="{{.Request.Scope}}">
+  <input type="hidden" name="state" value="{{.Request.State}}">
+  <input type="hidden" name="nonce" value="{{.Request.Nonce}}">
+  <input type="hidden" name="code_challenge" value="{{.Request.CodeChallenge}}">
+  <input type="hidden" name="code_challenge_method" value="{{.Request.CodeChallengeMethod}}">
+  {{if .Email}}
+  <p>Signed in as {{.Email}}.</p>
+  {{else}}
+  <p><label>Email <input type="email" name="email" required></label></p>
+  <p><label>Password <input type="password" name="password" required></label></p>
+  <p><label>One-time code <input type="text" name="otp" autocomplete="one-time-code"></label> from your authenticator app, or a backup code</p>
+  {{end}}
+  <p>{{.AppName}} wants to access your account ({{.Request.Scope}}).</p>
+  <button type="submit" name="action" value="allow">Allow</button>
+  <button type="submit" name="action" value="deny" formnovalidate>Deny</button>
+</form>
+</body>
+</html>
+`))
@@ -0,0 +1,46 @@
+package wellknownhttp
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/Novochenko/sso/internal/lib/jwt"
+	"github.com/Novochenko/sso/internal/lib/logger/sl"
+)
+
+type Keys interface {
+	JWKS(ctx context.Context) (jwt.JWKS, error)
+}
+
+type handler struct {
+	log  *slog.Logger
+	keys Keys
+}
+
+func Register(mux *http.ServeMux, log *slog.Logger, keys Keys) {
+	h := &handler{log: log, keys: keys}
+
+	mux.HandleFunc("GET /.well-known/jwks.json", h.jwks)
+}
+
+func (h *handler) jwks(w http.ResponseWriter, r *http.Request) {
+	const op = "http.wellknown.jwks"
+
+	set, err := h.keys.JWKS(r.Context())
+	if err != nil {
+		h.log.Error("failed to build JWKS", slog.String("op", op), sl.Err(err))
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	writeJSON(w, http.StatusOK, set)
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,69 @@
+// Package backupcode generates one-time backup codes: ten Crockford base32
+// characters, printed as two groups of five. Codes are compared in their
+// normalized form, so case, separators and the letters Crockford decodes as
+// digits (o, i, l) do not matter when they are typed back.
+package backupcode
+
+import (
+	"crypto/rand"
+	"strings"
+
+	"github.com/Novochenko/sso/internal/lib/opaque"
+)
+
+const (
+	alphabet = "0123456789abcdefghjkmnpqrstvwxyz"
+	length   = 10
+)
+
+var normalizer = strings.NewReplacer(
+	"-", "", " ", "",
+	"o", "0", "i", "1", "l", "1",
+)
+
+// Generate returns n new codes.
+func Generate(n int) ([]string, error) {
+	codes := make([]string, 0, n)
+	buf := make([]byte, length)
+	for range n {
+		if _, err := rand.Read(buf); err != nil {
+			return nil, err
+		}
+		var code strings.Builder
+		for i, b := range buf {
+			if i == length/2 {
+				code.WriteByte('-')
+			}
+			code.WriteByte(alphabet[b%32])
+		}
+		codes = append(codes, code.String())
+	}
+
+	return codes, nil
+}
+
+// Normalize returns the canonical form of code.
+func Normalize(code string) string {
+	return normalizer.Replace(strings.ToLower(strings.TrimSpace(code)))
+}
+
+// Valid reports whether code looks like a backup code. It tells backup codes
+// apart from the six digit codes of authenticator apps.
+func Valid(code string) bool {
+	code = Normalize(code)
+	if len(code) != length {
+		return false
+	}
+	for _, c := range code {
+		if !strings.ContainsRune(alphabet, c) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Hash returns what is stored for code.
+func Hash(code string) string {
+	return opaque.Hash(Normalize(code))
+}
@@ -0,0 +1,42 @@
+package backupcode
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerate(t *testing.T) {
+	codes, err := Generate(10)
+	require.NoError(t, err)
+	require.Len(t, codes, 10)
+
+	seen := make(map[string]bool)
+	for _, code := range codes {
+		assert.Len(t, code, 11)
+		assert.Equal(t, "-", code[5:6])
+		assert.True(t, Valid(code), code)
+		assert.False(t, seen[code])
+		seen[code] = true
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	codes, err := Generate(1)
+	require.NoError(t, err)
+	code := codes[0]
+
+	typed := " " + strings.ToUpper(strings.ReplaceAll(code, "-", " ")) + " "
+	assert.Equal(t, Hash(code), Hash(typed))
+
+	assert.Equal(t, "0110abcdef", Normalize("OIL0-ABCDEF"))
+}
+
+func TestValid(t *testing.T) {
+	assert.False(t, Valid("123456"))
+	assert.False(t, Valid("abcde-fghju-x"))
+	assert.False(t, Valid("abcde-fghu!"))
+	assert.True(t, Valid("abcde-fghjk"))
+}
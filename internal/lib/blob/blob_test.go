@@ -0,0 +1,133 @@
+package blob
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type store interface {
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+	Get(ctx context.Context, key string) ([]byte, error)
+	Delete(ctx context.Context, key string) error
+}
+
+func TestStores(t *testing.T) {
+	srv := httptest.NewServer(newFakeS3())
+	t.Cleanup(srv.Close)
+
+	s3, err := NewS3(strings.TrimPrefix(srv.URL, "http://"), "us-east-1", "test", "key", "secret", false)
+	require.NoError(t, err)
+
+	for name, s := range map[string]store{
+		"FS": NewFS(t.TempDir()),
+		"S3": s3,
+	} {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+
+			require.NoError(t, s.Put(ctx, "a/b.png", []byte("first"), "image/png"))
+			require.NoError(t, s.Put(ctx, "a/b.png", []byte("second"), "image/png"))
+
+			data, err := s.Get(ctx, "a/b.png")
+			require.NoError(t, err)
+			assert.Equal(t, "second", string(data))
+
+			require.NoError(t, s.Delete(ctx, "a/b.png"))
+			require.NoError(t, s.Delete(ctx, "a/b.png"))
+
+			_, err = s.Get(ctx, "a/b.png")
+			assert.ErrorIs(t, err, ErrNotFound)
+		})
+	}
+}
+
+func TestFS_RejectsEscapingKeys(t *testing.T) {
+	s := NewFS(t.TempDir())
+
+	for _, key := range []string{"../x", "/etc/passwd", "a/../../x", ""} {
+		assert.ErrorIs(t, s.Put(context.Background(), key, []byte("x"), ""), ErrInvalidKey, key)
+	}
+}
+
+// fakeS3 is an in-memory stand-in for the handful of path-style S3 calls the
+// store makes. Signatures are not checked.
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func newFakeS3() *fakeS3 {
+	return &fakeS3{objects: make(map[string][]byte)}
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	key := r.URL.Path
+	switch r.Method {
+	case http.MethodPut:
+		data, err := io.ReadAll(r.Body)
+		if err == nil && strings.HasPrefix(r.Header.Get("X-Amz-Content-Sha256"), "STREAMING-") {
+			data, err = decodeAWSChunked(data)
+		}
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		f.objects[key] = data
+		w.Header().Set("ETag", `"etag"`)
+	case http.MethodGet, http.MethodHead:
+		data, ok := f.objects[key]
+		if !ok {
+			w.Header().Set("Content-Type", "application/xml")
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, `<?xml version="1.0" encoding="UTF-8"?><Error><Code>NoSuchKey</Code><Message>The specified key does not exist.</Message></Error>`)
+			return
+		}
+		w.Header().Set("ETag", `"etag"`)
+		w.Header().Set("Last-Modified", "Mon, 02 Jan 2006 15:04:05 GMT")
+		w.Write(data)
+	case http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// decodeAWSChunked strips the framing of a streaming signed payload:
+// "<hex size>;chunk-signature=<sig>\r\n<data>\r\n", ending with a 0 sized chunk.
+func decodeAWSChunked(body []byte) ([]byte, error) {
+	var data []byte
+	for {
+		header, rest, ok := bytes.Cut(body, []byte("\r\n"))
+		if !ok {
+			return nil, errors.New("truncated chunk header")
+		}
+		sizeHex, _, _ := bytes.Cut(header, []byte(";"))
+		size, err := strconv.ParseInt(string(sizeHex), 16, 64)
+		if err != nil {
+			return nil, err
+		}
+		if size == 0 {
+			return data, nil
+		}
+		if int64(len(rest)) < size+2 {
+			return nil, errors.New("truncated chunk")
+		}
+		data = append(data, rest[:size]...)
+		body = rest[size+2:]
+	}
+}
@@ -0,0 +1,29 @@
+package bloom
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFilter(t *testing.T) {
+	const n = 1000
+
+	f := New(n, 0.01)
+	for i := 0; i < n; i++ {
+		f.Add("added-" + strconv.Itoa(i))
+	}
+
+	for i := 0; i < n; i++ {
+		assert.True(t, f.Test("added-"+strconv.Itoa(i)))
+	}
+
+	falsePositives := 0
+	for i := 0; i < n; i++ {
+		if f.Test("other-" + strconv.Itoa(i)) {
+			falsePositives++
+		}
+	}
+	assert.Less(t, falsePositives, n/20)
+}
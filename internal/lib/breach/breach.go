@@ -0,0 +1,38 @@
+// Package breach tells whether a password appears in known breach dumps.
+// Passwords are looked up by their SHA-1 as in the Have I Been Pwned
+// Pwned Passwords corpus: in a local Index built from a downloaded copy, or
+// k-anonymously through a RangeClient, which sends only the first five hex
+// digits of the hash.
+package breach
+
+import (
+	"context"
+	"crypto/sha1"
+)
+
+// Checker reports whether a password has been seen in a breach.
+type Checker interface {
+	Breached(ctx context.Context, password string) (bool, error)
+}
+
+// Checkers asks each checker in turn and reports a password as breached as
+// soon as one of them does.
+type Checkers []Checker
+
+func (c Checkers) Breached(ctx context.Context, password string) (bool, error) {
+	for _, checker := range c {
+		breached, err := checker.Breached(ctx, password)
+		if err != nil {
+			return false, err
+		}
+		if breached {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func hash(password string) [sha1.Size]byte {
+	return sha1.Sum([]byte(password))
+}
@@ -0,0 +1,159 @@
+package breach
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// corpus returns the lines of a corpus holding the passwords.
+func corpus(passwords ...string) string {
+	var lines []string
+	for i, password := range passwords {
+		sum := sha1.Sum([]byte(password))
+		lines = append(lines, fmt.Sprintf("%s:%d", strings.ToUpper(hex.EncodeToString(sum[:])), i+1))
+	}
+	sort.Strings(lines)
+
+	return strings.Join(lines, "\r\n") + "\r\n"
+}
+
+func TestIndex(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	corpusPath := filepath.Join(dir, "corpus.txt")
+	indexPath := filepath.Join(dir, "corpus.idx")
+
+	breached := []string{"password", "123456", "qwerty", "letmein", "Tr0ub4dor&3"}
+	// A padding line as the range API sends them.
+	padding := strings.Repeat("0", 40) + ":0\n"
+	require.NoError(t, os.WriteFile(corpusPath, []byte(padding+corpus(breached...)), 0o600))
+
+	index, err := LoadIndex(corpusPath, indexPath)
+	require.NoError(t, err)
+	assert.Equal(t, len(breached), index.Len())
+
+	for _, password := range breached {
+		got, err := index.Breached(ctx, password)
+		require.NoError(t, err)
+		assert.True(t, got, password)
+	}
+	for _, password := range []string{"correct horse battery staple", "Password", ""} {
+		got, err := index.Breached(ctx, password)
+		require.NoError(t, err)
+		assert.False(t, got, password)
+	}
+	require.NoError(t, index.Close())
+
+	// A newer corpus replaces the index.
+	require.NoError(t, os.WriteFile(corpusPath, []byte(corpus("hunter2")), 0o600))
+	later := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(corpusPath, later, later))
+
+	index, err = LoadIndex(corpusPath, indexPath)
+	require.NoError(t, err)
+	defer index.Close()
+	assert.Equal(t, 1, index.Len())
+	got, err := index.Breached(ctx, "hunter2")
+	require.NoError(t, err)
+	assert.True(t, got)
+	got, err = index.Breached(ctx, "password")
+	require.NoError(t, err)
+	assert.False(t, got)
+}
+
+func TestBuild_Fails(t *testing.T) {
+	var sb strings.Builder
+
+	_, err := Build(&sb, strings.NewReader(corpus("b")+"\n"+corpus("a")))
+	assert.ErrorIs(t, err, ErrUnsortedCorpus)
+
+	_, err = Build(&sb, strings.NewReader("not a hash:1\n"))
+	assert.Error(t, err)
+
+	_, err = Build(&sb, strings.NewReader(strings.Repeat("A", 40)+":lots\n"))
+	assert.Error(t, err)
+}
+
+func TestOpenIndex_Invalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "corpus.idx")
+	require.NoError(t, os.WriteFile(path, []byte(corpus("password")), 0o600))
+
+	_, err := OpenIndex(path)
+	assert.ErrorIs(t, err, ErrInvalidIndex)
+}
+
+func TestRangeClient(t *testing.T) {
+	ctx := context.Background()
+
+	var paths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		assert.Equal(t, "true", r.Header.Get("Add-Padding"))
+		switch r.URL.Path {
+		case "/range/5BAA6":
+			// SHA-1 of "password" is 5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8.
+			fmt.Fprint(w, "003D68EB55068C33ACE09247EE4C639306B:3\r\n"+
+				"1E4C9B93F3F0682250B6CF8331B7EE68FD8:9659365\r\n"+
+				"1E4C9B93F3F0682250B6CF8331B7EE68FD9:0\r\n")
+		case "/range/7C4A8":
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			fmt.Fprint(w, "003D68EB55068C33ACE09247EE4C639306B:3\r\n")
+		}
+	}))
+	defer srv.Close()
+
+	client := NewRangeClient(srv.URL+"/", srv.Client())
+
+	got, err := client.Breached(ctx, "password")
+	require.NoError(t, err)
+	assert.True(t, got)
+
+	got, err = client.Breached(ctx, "correct horse battery staple")
+	require.NoError(t, err)
+	assert.False(t, got)
+
+	// "123456" lands in the failing bucket.
+	_, err = client.Breached(ctx, "123456")
+	assert.Error(t, err)
+
+	// Only the prefix leaves the process.
+	for _, path := range paths {
+		assert.Len(t, strings.TrimPrefix(path, "/range/"), 5)
+	}
+}
+
+type fixed bool
+
+func (f fixed) Breached(context.Context, string) (bool, error) {
+	return bool(f), nil
+}
+
+func TestCheckers(t *testing.T) {
+	ctx := context.Background()
+
+	got, err := Checkers{fixed(false), fixed(true)}.Breached(ctx, "x")
+	require.NoError(t, err)
+	assert.True(t, got)
+
+	got, err = Checkers{fixed(false)}.Breached(ctx, "x")
+	require.NoError(t, err)
+	assert.False(t, got)
+
+	got, err = Checkers(nil).Breached(ctx, "x")
+	require.NoError(t, err)
+	assert.False(t, got)
+}
@@ -0,0 +1,70 @@
+package breach
+
+import (
+	"bufio"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// RangeClient asks a Pwned Passwords style range API, such as
+// https://api.pwnedpasswords.com, which answers GET <endpoint>/range/<prefix>
+// with a "<suffix>:<count>" line for every hash starting with the five hex
+// digit prefix.
+type RangeClient struct {
+	endpoint string
+	client   *http.Client
+}
+
+func NewRangeClient(endpoint string, client *http.Client) *RangeClient {
+	return &RangeClient{
+		endpoint: strings.TrimSuffix(endpoint, "/"),
+		client:   client,
+	}
+}
+
+func (c *RangeClient) Breached(ctx context.Context, password string) (bool, error) {
+	sum := hash(password)
+	hexHash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hexHash[:5], hexHash[5:]
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.endpoint+"/range/"+prefix, nil)
+	if err != nil {
+		return false, err
+	}
+	// Padding keeps the response size from telling which bucket was asked
+	// for.
+	req.Header.Set("Add-Padding", "true")
+	req.Header.Set("User-Agent", "sso")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("range api: unexpected status %s", resp.Status)
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		lineSuffix, count, ok := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if !ok || !strings.EqualFold(lineSuffix, suffix) {
+			continue
+		}
+		n, err := strconv.ParseUint(count, 10, 64)
+		if err != nil {
+			return false, fmt.Errorf("range api: %w", err)
+		}
+
+		return n > 0, nil
+	}
+	if err := scanner.Err(); err != nil {
+		return false, err
+	}
+
+	return false, nil
+}
@@ -0,0 +1,247 @@
+package breach
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+)
+
+// An index file holds the hashes of the corpus sorted, each cut to the
+// bytes after the first two, followed by a fan-out table: entry i is the
+// number of hashes whose first two bytes are below i. Lookups read the
+// table entries of the hash's bucket and binary search the bucket on disk.
+//
+// Ten bytes of a hash plus the two of the bucket leave 96 bits, far more
+// than enough to tell a billion hashes apart.
+const (
+	recordSize = 10
+	buckets    = 1 << 16
+	tableSize  = (buckets + 1) * 4
+)
+
+var indexMagic = []byte("SSOBRIX1")
+
+var (
+	ErrUnsortedCorpus = errors.New("corpus is not sorted by hash")
+	ErrInvalidIndex   = errors.New("invalid breach index")
+)
+
+// Index is a breach corpus indexed on disk. It is safe for concurrent use.
+type Index struct {
+	f     *os.File
+	table []uint32
+}
+
+// LoadIndex opens the index of the corpus at corpusPath, first building it
+// at indexPath if it is missing or older than the corpus.
+func LoadIndex(corpusPath, indexPath string) (*Index, error) {
+	corpus, err := os.Stat(corpusPath)
+	if err != nil {
+		return nil, err
+	}
+	index, err := os.Stat(indexPath)
+	if err != nil || index.ModTime().Before(corpus.ModTime()) {
+		if err := buildFile(corpusPath, indexPath); err != nil {
+			return nil, err
+		}
+	}
+
+	return OpenIndex(indexPath)
+}
+
+func buildFile(corpusPath, indexPath string) error {
+	corpus, err := os.Open(corpusPath)
+	if err != nil {
+		return err
+	}
+	defer corpus.Close()
+
+	// Build next to the index and rename, so a crash never leaves a
+	// truncated index that looks up to date.
+	tmp, err := os.CreateTemp(filepath.Dir(indexPath), filepath.Base(indexPath)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	w := bufio.NewWriterSize(tmp, 1<<20)
+	if _, err := Build(w, corpus); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), indexPath)
+}
+
+// Build writes the index of a corpus and returns how many hashes it holds.
+// The corpus has a "<SHA-1>:<count>" line per password, sorted by hash, as
+// the Pwned Passwords downloader writes it when it joins the range buckets
+// into one file. Hex digits may be of either case; padding lines with a
+// zero count are skipped.
+func Build(w io.Writer, corpus io.Reader) (int, error) {
+	var (
+		table [buckets + 1]uint32
+		prev  [sha1.Size]byte
+		sum   [sha1.Size]byte
+		n     int
+	)
+
+	scanner := bufio.NewScanner(corpus)
+	for line := 1; scanner.Scan(); line++ {
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+		hexHash, count, ok := bytes.Cut(text, []byte(":"))
+		if !ok || len(hexHash) != 2*sha1.Size {
+			return 0, fmt.Errorf("corpus line %d: malformed", line)
+		}
+		if _, err := hex.Decode(sum[:], hexHash); err != nil {
+			return 0, fmt.Errorf("corpus line %d: %w", line, err)
+		}
+		if c, err := strconv.ParseUint(string(count), 10, 64); err != nil {
+			return 0, fmt.Errorf("corpus line %d: %w", line, err)
+		} else if c == 0 {
+			continue
+		}
+
+		switch cmp := bytes.Compare(sum[:], prev[:]); {
+		case n > 0 && cmp < 0:
+			return 0, fmt.Errorf("corpus line %d: %w", line, ErrUnsortedCorpus)
+		case n > 0 && cmp == 0:
+			continue
+		}
+		prev = sum
+
+		if _, err := w.Write(sum[2 : 2+recordSize]); err != nil {
+			return 0, err
+		}
+		table[int(binary.BigEndian.Uint16(sum[:2]))+1]++
+		n++
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+
+	for i := 1; i <= buckets; i++ {
+		table[i] += table[i-1]
+	}
+	if err := binary.Write(w, binary.BigEndian, table); err != nil {
+		return 0, err
+	}
+	if _, err := w.Write(indexMagic); err != nil {
+		return 0, err
+	}
+
+	return n, nil
+}
+
+// OpenIndex opens an index written by Build. Only its fan-out table is read
+// into memory.
+func OpenIndex(path string) (*Index, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	index, err := openIndex(f)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return index, nil
+}
+
+func openIndex(f *os.File) (*Index, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := info.Size()
+	if size < tableSize+int64(len(indexMagic)) {
+		return nil, ErrInvalidIndex
+	}
+
+	magic := make([]byte, len(indexMagic))
+	if _, err := f.ReadAt(magic, size-int64(len(indexMagic))); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(magic, indexMagic) {
+		return nil, ErrInvalidIndex
+	}
+
+	tableAt := size - int64(len(indexMagic)) - tableSize
+	table := make([]uint32, buckets+1)
+	if err := binary.Read(io.NewSectionReader(f, tableAt, tableSize), binary.BigEndian, table); err != nil {
+		return nil, err
+	}
+	if int64(table[buckets])*recordSize != tableAt {
+		return nil, ErrInvalidIndex
+	}
+
+	return &Index{f: f, table: table}, nil
+}
+
+// Len is the number of hashes in the index.
+func (i *Index) Len() int {
+	return int(i.table[buckets])
+}
+
+func (i *Index) Breached(_ context.Context, password string) (bool, error) {
+	return i.Contains(hash(password))
+}
+
+// Contains reports whether the SHA-1 sum is in the index.
+func (i *Index) Contains(sum [sha1.Size]byte) (bool, error) {
+	bucket := binary.BigEndian.Uint16(sum[:2])
+	lo, hi := int(i.table[bucket]), int(i.table[bucket+1])
+	want := sum[2 : 2+recordSize]
+
+	var (
+		record  [recordSize]byte
+		readErr error
+	)
+	at := sort.Search(hi-lo, func(k int) bool {
+		if readErr != nil {
+			return true
+		}
+		if _, err := i.f.ReadAt(record[:], int64(lo+k)*recordSize); err != nil {
+			readErr = err
+			return true
+		}
+		return bytes.Compare(record[:], want) >= 0
+	})
+	if readErr != nil {
+		return false, readErr
+	}
+	if at == hi-lo {
+		return false, nil
+	}
+	if _, err := i.f.ReadAt(record[:], int64(lo+at)*recordSize); err != nil {
+		return false, err
+	}
+
+	return bytes.Equal(record[:], want), nil
+}
+
+func (i *Index) Close() error {
+	return i.f.Close()
+}
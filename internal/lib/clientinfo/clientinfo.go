@@ -0,0 +1,94 @@
+// Package clientinfo carries what is known about the device a request came
+// from through the request context, so services can record it without
+// depending on the transport.
+package clientinfo
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// maxUserAgentLen is as much of the user agent as is kept.
+const maxUserAgentLen = 255
+
+// Info describes the client of a request. IP is the address of the peer
+// connection; forwarding headers are not trusted.
+type Info struct {
+	UserAgent string
+	IP        string
+}
+
+type ctxKey struct{}
+
+func NewContext(ctx context.Context, info Info) context.Context {
+	return context.WithValue(ctx, ctxKey{}, info)
+}
+
+// FromContext returns the Info stored in ctx, or the zero value.
+func FromContext(ctx context.Context) Info {
+	info, _ := ctx.Value(ctxKey{}).(Info)
+	return info
+}
+
+// FromGRPC reads the user agent from the incoming metadata and the address
+// of the peer.
+func FromGRPC(ctx context.Context) Info {
+	var info Info
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get("user-agent"); len(values) > 0 {
+			info.UserAgent = truncate(values[0])
+		}
+	}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		info.IP = host(p.Addr.String())
+	}
+
+	return info
+}
+
+func FromHTTP(r *http.Request) Info {
+	return Info{
+		UserAgent: truncate(r.UserAgent()),
+		IP:        host(r.RemoteAddr),
+	}
+}
+
+// UnaryServerInterceptor stores the Info of every unary call in its context.
+func UnaryServerInterceptor(
+	ctx context.Context,
+	req any,
+	_ *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (any, error) {
+	return handler(NewContext(ctx, FromGRPC(ctx)), req)
+}
+
+// Middleware stores the Info of every request in its context.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), FromHTTP(r))))
+	})
+}
+
+func host(addr string) string {
+	if h, _, err := net.SplitHostPort(addr); err == nil {
+		return h
+	}
+
+	return addr
+}
+
+func truncate(userAgent string) string {
+	userAgent = strings.TrimSpace(userAgent)
+	if len(userAgent) > maxUserAgentLen {
+		return userAgent[:maxUserAgentLen]
+	}
+
+	return userAgent
+}
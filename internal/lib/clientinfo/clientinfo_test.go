@@ -0,0 +1,40 @@
+package clientinfo
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+func TestFromGRPC(t *testing.T) {
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("user-agent", "mobile-app/2.1 grpc-go/1.64.0"))
+	ctx = peer.NewContext(ctx, &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 51234}})
+
+	assert.Equal(t, Info{UserAgent: "mobile-app/2.1 grpc-go/1.64.0", IP: "2001:db8::1"}, FromGRPC(ctx))
+	assert.Equal(t, Info{}, FromGRPC(context.Background()))
+}
+
+func TestFromHTTP(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/authorize", nil)
+	r.RemoteAddr = "203.0.113.7:40000"
+	r.Header.Set("User-Agent", strings.Repeat("a", 300))
+	r.Header.Set("X-Forwarded-For", "198.51.100.1")
+
+	info := FromHTTP(r)
+	assert.Equal(t, "203.0.113.7", info.IP)
+	assert.Len(t, info.UserAgent, maxUserAgentLen)
+}
+
+func TestContext(t *testing.T) {
+	info := Info{UserAgent: "curl/8.0", IP: "127.0.0.1"}
+
+	assert.Equal(t, info, FromContext(NewContext(context.Background(), info)))
+	assert.Equal(t, Info{}, FromContext(context.Background()))
+}
@@ -0,0 +1,43 @@
+package encrypt
+
+import (
+	"bytes"
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSealOpen(t *testing.T) {
+	key := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{7}, KeySize))
+	c, err := New(key)
+	require.NoError(t, err)
+
+	sealed, err := c.Seal([]byte("secret"))
+	require.NoError(t, err)
+	assert.NotContains(t, string(sealed), "secret")
+
+	again, err := c.Seal([]byte("secret"))
+	require.NoError(t, err)
+	assert.NotEqual(t, sealed, again, "every seal uses a fresh nonce")
+
+	plaintext, err := c.Open(sealed)
+	require.NoError(t, err)
+	assert.Equal(t, "secret", string(plaintext))
+
+	sealed[len(sealed)-1] ^= 1
+	_, err = c.Open(sealed)
+	assert.ErrorIs(t, err, ErrInvalidCiphertext)
+
+	_, err = c.Open([]byte("short"))
+	assert.ErrorIs(t, err, ErrInvalidCiphertext)
+}
+
+func TestNew_RejectsBadKeys(t *testing.T) {
+	_, err := New("not base64!")
+	assert.Error(t, err)
+
+	_, err = New(base64.StdEncoding.EncodeToString([]byte("too short")))
+	assert.Error(t, err)
+}
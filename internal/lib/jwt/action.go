@@ -0,0 +1,162 @@
+package jwt
+
+import (
+	"encoding/base64"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+const (
+	PurposeVerifyEmail = "verify_email"
+	// PurposeMFA marks the challenge handed out by a login that still needs
+	// a second factor.
+	PurposeMFA = "mfa"
+	// PurposePasskeyRegistration and PurposePasskeyLogin mark the sessions
+	// of WebAuthn ceremonies, which carry the challenge sent to the browser.
+	PurposePasskeyRegistration = "passkey_registration"
+	PurposePasskeyLogin        = "passkey_login"
+	// PurposeLoginSession marks the login session cookie of the OIDC
+	// endpoints, which must not pass for an access token.
+	PurposeLoginSession = "login_session"
+)
+
+// ActionToken is a short-lived token mailed to a user to prove they control
+// an email address. Purpose binds the token to a single action. AppID is only
+// set on MFA challenges and passkey logins, which remember the app the login
+// is for, and OrgID the organization chosen for it, if any. Challenge is only
+// set on passkey sessions; MFAID is the MFA challenge a passkey login
+// completes, if any.
+type ActionToken struct {
+	ID        string
+	UserID    uuid.UUID
+	Email     string
+	AppID     int64
+	OrgID     int64
+	Purpose   string
+	Challenge []byte
+	MFAID     string
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+}
+
+func NewActionToken(userID uuid.UUID, email, purpose string, duration time.Duration, key SigningKey) (string, error) {
+	return newActionToken(userID, email, purpose, nil, duration, key)
+}
+
+// NewMFAToken returns the challenge a user trades, together with a second
+// factor, for tokens for the app and, if orgID is not zero, the organization.
+func NewMFAToken(userID uuid.UUID, email string, appID, orgID int64, duration time.Duration, key SigningKey) (string, error) {
+	extra := jwt.MapClaims{"app_id": appID}
+	if orgID != 0 {
+		extra["org_id"] = orgID
+	}
+
+	return newActionToken(userID, email, PurposeMFA, extra, duration, key)
+}
+
+// NewPasskeyToken returns the session of a WebAuthn ceremony for purpose.
+// userID is uuid.Nil for passwordless logins, where the user is only known
+// once the authenticator answers.
+func NewPasskeyToken(
+	userID uuid.UUID,
+	email string,
+	purpose string,
+	appID int64,
+	orgID int64,
+	challenge []byte,
+	mfaID string,
+	duration time.Duration,
+	key SigningKey,
+) (string, error) {
+	extra := jwt.MapClaims{"challenge": base64.RawURLEncoding.EncodeToString(challenge)}
+	if appID != 0 {
+		extra["app_id"] = appID
+	}
+	if orgID != 0 {
+		extra["org_id"] = orgID
+	}
+	if mfaID != "" {
+		extra["mfa_jti"] = mfaID
+	}
+
+	return newActionToken(userID, email, purpose, extra, duration, key)
+}
+
+func newActionToken(
+	userID uuid.UUID,
+	email string,
+	purpose string,
+	extra jwt.MapClaims,
+	duration time.Duration,
+	key SigningKey,
+) (string, error) {
+	method, err := key.method()
+	if err != nil {
+		return "", err
+	}
+
+	token := jwt.New(method)
+	token.Header["kid"] = key.ID
+
+	claims := token.Claims.(jwt.MapClaims)
+	now := time.Now()
+	claims["jti"] = uuid.NewString()
+	claims["uid"] = userID.String()
+	claims["email"] = email
+	claims["purpose"] = purpose
+	claims["iat"] = now.Unix()
+	claims["exp"] = now.Add(duration).Unix()
+	for k, v := range extra {
+		claims[k] = v
+	}
+
+	return token.SignedString(key.Private)
+}
+
+// ParseActionToken verifies a token issued by NewActionToken for purpose.
+func ParseActionToken(tokenString, purpose string, set JWKS) (ActionToken, error) {
+	token, err := jwt.Parse(tokenString, set.keyfunc,
+		jwt.WithValidMethods([]string{AlgRS256, AlgEdDSA}),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return ActionToken{}, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+
+	claims := token.Claims.(jwt.MapClaims)
+	if p, _ := claims["purpose"].(string); p != purpose {
+		return ActionToken{}, fmt.Errorf("%w: wrong purpose", ErrInvalidToken)
+	}
+
+	var action ActionToken
+	action.Purpose = purpose
+	action.ID, _ = claims["jti"].(string)
+	action.Email, _ = claims["email"].(string)
+	if appID, ok := claims["app_id"].(float64); ok {
+		action.AppID = int64(appID)
+	}
+	if orgID, ok := claims["org_id"].(float64); ok {
+		action.OrgID = int64(orgID)
+	}
+	action.MFAID, _ = claims["mfa_jti"].(string)
+	if challenge, ok := claims["challenge"].(string); ok {
+		if action.Challenge, err = base64.RawURLEncoding.DecodeString(challenge); err != nil {
+			return ActionToken{}, fmt.Errorf("%w: bad challenge claim", ErrInvalidToken)
+		}
+	}
+	uid, _ := claims["uid"].(string)
+	if action.UserID, err = uuid.Parse(uid); err != nil {
+		return ActionToken{}, fmt.Errorf("%w: bad uid claim", ErrInvalidToken)
+	}
+	if iat, err := claims.GetIssuedAt(); err == nil && iat != nil {
+		action.IssuedAt = iat.Time
+	}
+	if exp, err := claims.GetExpirationTime(); err == nil && exp != nil {
+		action.ExpiresAt = exp.Time
+	}
+
+	return action, nil
+}
@@ -1,26 +1,226 @@
 package jwt
 
 import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/Novochenko/sso/domain/models"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 )
 
-// напиши тесты
-func NewToken(user models.User, app models.App, duration time.Duration) (string, error) {
-	token := jwt.New(jwt.SigningMethodHS256)
+var (
+	ErrInvalidToken = errors.New("invalid token")
+)
+
+// Claims are the claims of an access token issued by NewToken or
+// NewClientToken. Client tokens have no user: UserID is uuid.Nil and ClientID
+// is the id of the app the token was issued to. OrgID is the organization
+// the token is for, zero outside of one; OrgRole is the user's role there.
+// SessionID is the login session the token belongs to, if any.
+type Claims struct {
+	TokenID     string
+	SessionID   uuid.UUID
+	UserID      uuid.UUID
+	ClientID    int
+	Email       string
+	AppID       int
+	OrgID       int64
+	OrgRole     string
+	IssuedAt    time.Time
+	ExpiresAt   time.Time
+	Scopes      []string
+	Roles       []string
+	Permissions []string
+}
+
+// IsClient reports whether the token was issued to an app rather than a user.
+func (c Claims) IsClient() bool {
+	return c.ClientID != 0
+}
+
+// NewToken issues an access token for the user in the app, within the
+// organization of membership unless it is the zero value, as part of the
+// login session sessionID unless it is uuid.Nil. The roles and
+// permissions of authz are embedded as they are at issue time; they are not
+// updated until the token is refreshed.
+func NewToken(
+	user models.User,
+	app models.App,
+	membership models.OrgMembership,
+	sessionID uuid.UUID,
+	authz models.Authorization,
+	duration time.Duration,
+	key SigningKey,
+) (string, error) {
+	method, err := key.method()
+	if err != nil {
+		return "", err
+	}
+
+	token := jwt.New(method)
+	token.Header["kid"] = key.ID
 
 	claims := token.Claims.(jwt.MapClaims)
+	now := time.Now()
+	claims["jti"] = uuid.NewString()
 	claims["uid"] = user.ID
 	claims["email"] = user.Email
-	claims["exp"] = time.Now().Add(duration).Unix()
+	// Revoking all of a user's tokens compares their issue time with a
+	// millisecond watermark, so iat keeps the milliseconds.
+	claims["iat"] = float64(now.UnixMilli()) / 1e3
+	claims["exp"] = now.Add(duration).Unix()
 	claims["app_id"] = app.ID
+	if sessionID != uuid.Nil {
+		claims["sid"] = sessionID.String()
+	}
+	if membership.OrgID != 0 {
+		claims["org_id"] = membership.OrgID
+		claims["org_role"] = membership.Role
+	}
+	if len(authz.Roles) > 0 {
+		claims["roles"] = authz.Roles
+	}
+	if len(authz.Permissions) > 0 {
+		claims["permissions"] = authz.Permissions
+	}
 
-	tokenString, err := token.SignedString([]byte(app.Secret))
+	tokenString, err := token.SignedString(key.Private)
 	if err != nil {
 		return "", err
 	}
 
 	return tokenString, nil
 }
+
+// NewClientToken issues a machine token whose subject is the app itself.
+func NewClientToken(app models.App, scopes []string, duration time.Duration, key SigningKey) (string, error) {
+	method, err := key.method()
+	if err != nil {
+		return "", err
+	}
+
+	token := jwt.New(method)
+	token.Header["kid"] = key.ID
+
+	claims := token.Claims.(jwt.MapClaims)
+	now := time.Now()
+	claims["jti"] = uuid.NewString()
+	claims["sub"] = strconv.Itoa(app.ID)
+	claims["client_id"] = app.ID
+	claims["app_id"] = app.ID
+	if app.OrgID != 0 {
+		claims["org_id"] = app.OrgID
+	}
+	claims["iat"] = now.Unix()
+	claims["exp"] = now.Add(duration).Unix()
+	if len(scopes) > 0 {
+		claims["scope"] = strings.Join(scopes, " ")
+	}
+
+	return token.SignedString(key.Private)
+}
+
+// IDToken holds the claims of an OpenID Connect ID token.
+type IDToken struct {
+	Issuer   string
+	Subject  string
+	Audience string
+	Email    string
+	Nonce    string
+	AuthTime time.Time
+}
+
+func NewIDToken(idToken IDToken, duration time.Duration, key SigningKey) (string, error) {
+	method, err := key.method()
+	if err != nil {
+		return "", err
+	}
+
+	token := jwt.New(method)
+	token.Header["kid"] = key.ID
+
+	now := time.Now()
+	claims := token.Claims.(jwt.MapClaims)
+	claims["iss"] = idToken.Issuer
+	claims["sub"] = idToken.Subject
+	claims["aud"] = idToken.Audience
+	claims["email"] = idToken.Email
+	claims["iat"] = now.Unix()
+	claims["exp"] = now.Add(duration).Unix()
+	claims["auth_time"] = idToken.AuthTime.Unix()
+	if idToken.Nonce != "" {
+		claims["nonce"] = idToken.Nonce
+	}
+
+	return token.SignedString(key.Private)
+}
+
+// Parse verifies the signature and expiry of a token issued by NewToken or
+// NewClientToken against the published keys and returns its claims.
+func Parse(tokenString string, set JWKS) (Claims, error) {
+	token, err := jwt.Parse(tokenString, set.keyfunc, jwt.WithValidMethods([]string{AlgRS256, AlgEdDSA}), jwt.WithExpirationRequired())
+	if err != nil {
+		return Claims{}, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+
+	mapClaims := token.Claims.(jwt.MapClaims)
+	// Action tokens are signed with the same keys but must never be
+	// accepted as access tokens.
+	if _, ok := mapClaims["purpose"]; ok {
+		return Claims{}, fmt.Errorf("%w: not an access token", ErrInvalidToken)
+	}
+
+	var claims Claims
+	claims.TokenID, _ = mapClaims["jti"].(string)
+	if sid, ok := mapClaims["sid"].(string); ok {
+		if claims.SessionID, err = uuid.Parse(sid); err != nil {
+			return Claims{}, fmt.Errorf("%w: bad sid claim", ErrInvalidToken)
+		}
+	}
+	claims.Email, _ = mapClaims["email"].(string)
+	if clientID, ok := mapClaims["client_id"].(float64); ok {
+		claims.ClientID = int(clientID)
+	} else {
+		uid, _ := mapClaims["uid"].(string)
+		if claims.UserID, err = uuid.Parse(uid); err != nil {
+			return Claims{}, fmt.Errorf("%w: bad uid claim", ErrInvalidToken)
+		}
+	}
+	appID, _ := mapClaims["app_id"].(float64)
+	claims.AppID = int(appID)
+	if orgID, ok := mapClaims["org_id"].(float64); ok {
+		claims.OrgID = int64(orgID)
+	}
+	claims.OrgRole, _ = mapClaims["org_role"].(string)
+	if scope, ok := mapClaims["scope"].(string); ok && scope != "" {
+		claims.Scopes = strings.Fields(scope)
+	}
+	claims.Roles = stringList(mapClaims["roles"])
+	claims.Permissions = stringList(mapClaims["permissions"])
+	// GetIssuedAt would truncate iat to the second.
+	if iat, ok := mapClaims["iat"].(float64); ok {
+		claims.IssuedAt = time.UnixMilli(int64(math.Round(iat * 1e3)))
+	}
+	if exp, err := mapClaims.GetExpirationTime(); err == nil && exp != nil {
+		claims.ExpiresAt = exp.Time
+	}
+
+	return claims, nil
+}
+
+func stringList(claim interface{}) []string {
+	values, _ := claim.([]interface{})
+	var list []string
+	for _, value := range values {
+		if value, ok := value.(string); ok {
+			list = append(list, value)
+		}
+	}
+
+	return list
+}
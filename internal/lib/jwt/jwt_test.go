@@ -0,0 +1,259 @@
+package jwt
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Novochenko/sso/domain/models"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewToken_VerifiesWithJWK(t *testing.T) {
+	for _, alg := range []string{AlgRS256, AlgEdDSA} {
+		t.Run(alg, func(t *testing.T) {
+			key, err := GenerateSigningKey(alg)
+			require.NoError(t, err)
+
+			user := models.User{ID: uuid.New(), Email: "user@example.com"}
+			app := models.App{ID: 1, Name: "test"}
+
+			token, err := NewToken(user, app, models.OrgMembership{}, uuid.Nil, models.Authorization{}, time.Hour, key)
+			require.NoError(t, err)
+
+			jwk, err := NewJWK(key.ID, key.Algorithm, key.Public())
+			require.NoError(t, err)
+			thumbprint, err := jwk.Thumbprint()
+			require.NoError(t, err)
+			assert.Equal(t, key.ID, thumbprint)
+
+			parsed, err := jwt.Parse(token, func(token *jwt.Token) (interface{}, error) {
+				assert.Equal(t, key.ID, token.Header["kid"])
+				return jwk.PublicKey()
+			}, jwt.WithValidMethods([]string{alg}))
+			require.NoError(t, err)
+
+			claims := parsed.Claims.(jwt.MapClaims)
+			assert.Equal(t, user.ID.String(), claims["uid"])
+			assert.Equal(t, user.Email, claims["email"])
+
+			verified, err := Parse(token, JWKS{Keys: []JWK{jwk}})
+			require.NoError(t, err)
+			assert.Equal(t, user.ID, verified.UserID)
+			assert.Equal(t, app.ID, verified.AppID)
+			assert.NotEmpty(t, verified.TokenID)
+		})
+	}
+}
+
+func TestNewToken_Authorization(t *testing.T) {
+	key, err := GenerateSigningKey(AlgEdDSA)
+	require.NoError(t, err)
+	jwk, err := NewJWK(key.ID, key.Algorithm, key.Public())
+	require.NoError(t, err)
+
+	authz := models.Authorization{Roles: []string{"admin"}, Permissions: []string{"sso.rbac.manage", "sso.tokens.revoke"}}
+	token, err := NewToken(models.User{ID: uuid.New()}, models.App{ID: 1}, models.OrgMembership{}, uuid.Nil, authz, time.Hour, key)
+	require.NoError(t, err)
+
+	claims, err := Parse(token, JWKS{Keys: []JWK{jwk}})
+	require.NoError(t, err)
+	assert.Equal(t, authz.Roles, claims.Roles)
+	assert.Equal(t, authz.Permissions, claims.Permissions)
+
+	token, err = NewToken(models.User{ID: uuid.New()}, models.App{ID: 1}, models.OrgMembership{}, uuid.Nil, models.Authorization{}, time.Hour, key)
+	require.NoError(t, err)
+	claims, err = Parse(token, JWKS{Keys: []JWK{jwk}})
+	require.NoError(t, err)
+	assert.Empty(t, claims.Roles)
+	assert.Empty(t, claims.Permissions)
+}
+
+func TestNewToken_Organization(t *testing.T) {
+	key, err := GenerateSigningKey(AlgEdDSA)
+	require.NoError(t, err)
+	jwk, err := NewJWK(key.ID, key.Algorithm, key.Public())
+	require.NoError(t, err)
+	set := JWKS{Keys: []JWK{jwk}}
+
+	membership := models.OrgMembership{OrgID: 3, Role: "admin"}
+	token, err := NewToken(models.User{ID: uuid.New()}, models.App{ID: 1}, membership, uuid.Nil, models.Authorization{}, time.Hour, key)
+	require.NoError(t, err)
+	claims, err := Parse(token, set)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), claims.OrgID)
+	assert.Equal(t, "admin", claims.OrgRole)
+
+	token, err = NewClientToken(models.App{ID: 5, OrgID: 3}, nil, time.Hour, key)
+	require.NoError(t, err)
+	claims, err = Parse(token, set)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), claims.OrgID)
+	assert.Empty(t, claims.OrgRole)
+}
+
+func TestNewToken_Session(t *testing.T) {
+	key, err := GenerateSigningKey(AlgEdDSA)
+	require.NoError(t, err)
+	jwk, err := NewJWK(key.ID, key.Algorithm, key.Public())
+	require.NoError(t, err)
+	set := JWKS{Keys: []JWK{jwk}}
+
+	sessionID := uuid.New()
+	token, err := NewToken(models.User{ID: uuid.New()}, models.App{ID: 1}, models.OrgMembership{}, sessionID, models.Authorization{}, time.Hour, key)
+	require.NoError(t, err)
+	claims, err := Parse(token, set)
+	require.NoError(t, err)
+	assert.Equal(t, sessionID, claims.SessionID)
+
+	token, err = NewToken(models.User{ID: uuid.New()}, models.App{ID: 1}, models.OrgMembership{}, uuid.Nil, models.Authorization{}, time.Hour, key)
+	require.NoError(t, err)
+	claims, err = Parse(token, set)
+	require.NoError(t, err)
+	assert.Equal(t, uuid.Nil, claims.SessionID)
+}
+
+func TestNewToken_IssuedAtMilliseconds(t *testing.T) {
+	key, err := GenerateSigningKey(AlgEdDSA)
+	require.NoError(t, err)
+	jwk, err := NewJWK(key.ID, key.Algorithm, key.Public())
+	require.NoError(t, err)
+
+	before := time.Now().Truncate(time.Millisecond)
+	token, err := NewToken(models.User{ID: uuid.New()}, models.App{ID: 1}, models.OrgMembership{}, uuid.Nil, models.Authorization{}, time.Hour, key)
+	require.NoError(t, err)
+	after := time.Now()
+
+	claims, err := Parse(token, JWKS{Keys: []JWK{jwk}})
+	require.NoError(t, err)
+	assert.False(t, claims.IssuedAt.Before(before))
+	assert.False(t, claims.IssuedAt.After(after))
+	assert.Equal(t, claims.IssuedAt, claims.IssuedAt.Truncate(time.Millisecond))
+}
+
+func TestNewClientToken(t *testing.T) {
+	key, err := GenerateSigningKey(AlgEdDSA)
+	require.NoError(t, err)
+	jwk, err := NewJWK(key.ID, key.Algorithm, key.Public())
+	require.NoError(t, err)
+
+	token, err := NewClientToken(models.App{ID: 7}, []string{"users.read", "users.write"}, time.Hour, key)
+	require.NoError(t, err)
+
+	claims, err := Parse(token, JWKS{Keys: []JWK{jwk}})
+	require.NoError(t, err)
+	assert.True(t, claims.IsClient())
+	assert.Equal(t, 7, claims.ClientID)
+	assert.Equal(t, 7, claims.AppID)
+	assert.Equal(t, uuid.Nil, claims.UserID)
+	assert.Equal(t, []string{"users.read", "users.write"}, claims.Scopes)
+}
+
+func TestParse_RejectsUnknownKey(t *testing.T) {
+	key, err := GenerateSigningKey(AlgEdDSA)
+	require.NoError(t, err)
+	other, err := GenerateSigningKey(AlgEdDSA)
+	require.NoError(t, err)
+
+	token, err := NewToken(models.User{ID: uuid.New()}, models.App{ID: 1}, models.OrgMembership{}, uuid.Nil, models.Authorization{}, time.Hour, key)
+	require.NoError(t, err)
+
+	jwk, err := NewJWK(other.ID, other.Algorithm, other.Public())
+	require.NoError(t, err)
+
+	_, err = Parse(token, JWKS{Keys: []JWK{jwk}})
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestParseSigningKey(t *testing.T) {
+	key, err := GenerateSigningKey(AlgEdDSA)
+	require.NoError(t, err)
+	data, err := MarshalSigningKey(key)
+	require.NoError(t, err)
+
+	parsed, err := ParseSigningKey(AlgEdDSA, data)
+	require.NoError(t, err)
+	assert.Equal(t, key.ID, parsed.ID)
+
+	_, err = ParseSigningKey(AlgRS256, data)
+	assert.ErrorIs(t, err, ErrInvalidKey)
+
+	_, err = ParseSigningKey(AlgEdDSA, []byte("not a pem"))
+	assert.ErrorIs(t, err, ErrInvalidKey)
+}
+
+func TestActionToken(t *testing.T) {
+	key, err := GenerateSigningKey(AlgEdDSA)
+	require.NoError(t, err)
+	jwk, err := NewJWK(key.ID, key.Algorithm, key.Public())
+	require.NoError(t, err)
+	set := JWKS{Keys: []JWK{jwk}}
+
+	userID := uuid.New()
+	token, err := NewActionToken(userID, "user@example.com", PurposeVerifyEmail, time.Hour, key)
+	require.NoError(t, err)
+
+	action, err := ParseActionToken(token, PurposeVerifyEmail, set)
+	require.NoError(t, err)
+	assert.Equal(t, userID, action.UserID)
+	assert.Equal(t, "user@example.com", action.Email)
+	assert.NotEmpty(t, action.ID)
+	assert.WithinDuration(t, time.Now(), action.IssuedAt, 2*time.Second)
+
+	_, err = ParseActionToken(token, "other", set)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	// Action tokens are not access tokens.
+	_, err = Parse(token, set)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	access, err := NewToken(models.User{ID: userID}, models.App{ID: 1}, models.OrgMembership{}, uuid.Nil, models.Authorization{}, time.Hour, key)
+	require.NoError(t, err)
+	_, err = ParseActionToken(access, PurposeVerifyEmail, set)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestMFAToken(t *testing.T) {
+	key, err := GenerateSigningKey(AlgEdDSA)
+	require.NoError(t, err)
+	jwk, err := NewJWK(key.ID, key.Algorithm, key.Public())
+	require.NoError(t, err)
+	set := JWKS{Keys: []JWK{jwk}}
+
+	userID := uuid.New()
+	token, err := NewMFAToken(userID, "user@example.com", 42, 7, time.Minute, key)
+	require.NoError(t, err)
+
+	action, err := ParseActionToken(token, PurposeMFA, set)
+	require.NoError(t, err)
+	assert.Equal(t, userID, action.UserID)
+	assert.Equal(t, int64(42), action.AppID)
+	assert.Equal(t, int64(7), action.OrgID)
+
+	_, err = Parse(token, set)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestPasskeyToken(t *testing.T) {
+	key, err := GenerateSigningKey(AlgEdDSA)
+	require.NoError(t, err)
+	jwk, err := NewJWK(key.ID, key.Algorithm, key.Public())
+	require.NoError(t, err)
+	set := JWKS{Keys: []JWK{jwk}}
+
+	challenge := []byte{0, 1, 2, 254, 255}
+	token, err := NewPasskeyToken(uuid.Nil, "", PurposePasskeyLogin, 42, 0, challenge, "mfa-id", time.Minute, key)
+	require.NoError(t, err)
+
+	action, err := ParseActionToken(token, PurposePasskeyLogin, set)
+	require.NoError(t, err)
+	assert.Equal(t, uuid.Nil, action.UserID)
+	assert.Equal(t, int64(42), action.AppID)
+	assert.Equal(t, challenge, action.Challenge)
+	assert.Equal(t, "mfa-id", action.MFAID)
+
+	_, err = ParseActionToken(token, PurposePasskeyRegistration, set)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
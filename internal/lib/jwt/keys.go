@@ -0,0 +1,257 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	AlgRS256 = "RS256"
+	AlgEdDSA = "EdDSA"
+
+	rsaKeyBits = 2048
+)
+
+var (
+	ErrUnsupportedAlgorithm = errors.New("unsupported signing algorithm")
+	ErrInvalidKey           = errors.New("invalid signing key")
+)
+
+// SigningKey is a private key used to sign tokens. ID is published as the
+// "kid" header of every token signed with the key.
+type SigningKey struct {
+	ID        string
+	Algorithm string
+	Private   crypto.Signer
+}
+
+func (k SigningKey) Public() crypto.PublicKey {
+	return k.Private.Public()
+}
+
+func (k SigningKey) method() (jwt.SigningMethod, error) {
+	switch k.Algorithm {
+	case AlgRS256:
+		return jwt.SigningMethodRS256, nil
+	case AlgEdDSA:
+		return jwt.SigningMethodEdDSA, nil
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedAlgorithm, k.Algorithm)
+	}
+}
+
+// GenerateSigningKey creates a new random key for the given algorithm.
+func GenerateSigningKey(alg string) (SigningKey, error) {
+	var private crypto.Signer
+
+	switch alg {
+	case AlgRS256:
+		key, err := rsa.GenerateKey(rand.Reader, rsaKeyBits)
+		if err != nil {
+			return SigningKey{}, err
+		}
+		private = key
+	case AlgEdDSA:
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return SigningKey{}, err
+		}
+		private = key
+	default:
+		return SigningKey{}, fmt.Errorf("%w: %q", ErrUnsupportedAlgorithm, alg)
+	}
+
+	return NewSigningKey(alg, private)
+}
+
+// NewSigningKey wraps private into a SigningKey whose ID is the RFC 7638
+// thumbprint of its public part.
+func NewSigningKey(alg string, private crypto.Signer) (SigningKey, error) {
+	jwk, err := NewJWK("", alg, private.Public())
+	if err != nil {
+		return SigningKey{}, err
+	}
+	kid, err := jwk.Thumbprint()
+	if err != nil {
+		return SigningKey{}, err
+	}
+
+	return SigningKey{
+		ID:        kid,
+		Algorithm: alg,
+		Private:   private,
+	}, nil
+}
+
+// ParseSigningKey reads a PEM encoded PKCS#8 (or PKCS#1 for RSA) private key.
+func ParseSigningKey(alg string, data []byte) (SigningKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return SigningKey{}, fmt.Errorf("%w: no PEM block found", ErrInvalidKey)
+	}
+
+	var parsed any
+	var err error
+	if block.Type == "RSA PRIVATE KEY" {
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	} else {
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return SigningKey{}, fmt.Errorf("%w: %w", ErrInvalidKey, err)
+	}
+
+	switch key := parsed.(type) {
+	case *rsa.PrivateKey:
+		if alg != AlgRS256 {
+			return SigningKey{}, fmt.Errorf("%w: RSA key used for %s", ErrInvalidKey, alg)
+		}
+		return NewSigningKey(alg, key)
+	case ed25519.PrivateKey:
+		if alg != AlgEdDSA {
+			return SigningKey{}, fmt.Errorf("%w: Ed25519 key used for %s", ErrInvalidKey, alg)
+		}
+		return NewSigningKey(alg, key)
+	default:
+		return SigningKey{}, fmt.Errorf("%w: unsupported key type %T", ErrInvalidKey, parsed)
+	}
+}
+
+// MarshalSigningKey encodes the private key as a PEM PKCS#8 block, the
+// format read back by ParseSigningKey.
+func MarshalSigningKey(key SigningKey) ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key.Private)
+	if err != nil {
+		return nil, err
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
+
+// JWK is the public part of a signing key as described in RFC 7517.
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid,omitempty"`
+	Use       string `json:"use,omitempty"`
+	Algorithm string `json:"alg,omitempty"`
+
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+
+	// OKP
+	Curve string `json:"crv,omitempty"`
+	X     string `json:"x,omitempty"`
+}
+
+// JWKS is a JSON Web Key Set.
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+func NewJWK(kid, alg string, public crypto.PublicKey) (JWK, error) {
+	switch key := public.(type) {
+	case *rsa.PublicKey:
+		return JWK{
+			KeyType:   "RSA",
+			KeyID:     kid,
+			Use:       "sig",
+			Algorithm: alg,
+			N:         base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			E:         base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}, nil
+	case ed25519.PublicKey:
+		return JWK{
+			KeyType:   "OKP",
+			KeyID:     kid,
+			Use:       "sig",
+			Algorithm: alg,
+			Curve:     "Ed25519",
+			X:         base64.RawURLEncoding.EncodeToString(key),
+		}, nil
+	default:
+		return JWK{}, fmt.Errorf("%w: unsupported key type %T", ErrInvalidKey, public)
+	}
+}
+
+// PublicKey converts the JWK back into a crypto.PublicKey.
+func (k JWK) PublicKey() (crypto.PublicKey, error) {
+	switch k.KeyType {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidKey, err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidKey, err)
+		}
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}, nil
+	case "OKP":
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidKey, err)
+		}
+		if k.Curve != "Ed25519" || len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("%w: bad Ed25519 key", ErrInvalidKey)
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, fmt.Errorf("%w: unsupported key type %q", ErrInvalidKey, k.KeyType)
+	}
+}
+
+// Thumbprint returns the RFC 7638 SHA-256 thumbprint of the key.
+func (k JWK) Thumbprint() (string, error) {
+	var members any
+	switch k.KeyType {
+	case "RSA":
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{k.E, k.KeyType, k.N}
+	case "OKP":
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{k.Curve, k.KeyType, k.X}
+	default:
+		return "", fmt.Errorf("%w: unsupported key type %q", ErrInvalidKey, k.KeyType)
+	}
+
+	b, err := json.Marshal(members)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+
+	return base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+// keyfunc finds the published key a token was signed with.
+func (s JWKS) keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	for _, key := range s.Keys {
+		if key.KeyID == kid && key.Algorithm == token.Method.Alg() {
+			return key.PublicKey()
+		}
+	}
+	return nil, fmt.Errorf("unknown key %q", kid)
+}
@@ -0,0 +1,29 @@
+package password
+
+// commonPasswords are among the most used passwords and words in them, most
+// common first.
+var commonPasswords = []string{
+	"password", "123456", "123456789", "12345678", "12345", "qwerty", "abc123",
+	"football", "monkey", "letmein", "111111", "1234567", "dragon", "baseball",
+	"sunshine", "iloveyou", "trustno1", "princess", "adobe123", "123123",
+	"welcome", "login", "admin", "solo", "1234567890", "master", "photoshop",
+	"1qaz2wsx", "qwertyuiop", "ashley", "mustang", "121212", "starwars",
+	"654321", "bailey", "access", "flower", "passw0rd", "shadow", "michael",
+	"superman", "696969", "123qwe", "batman", "hello", "charlie", "donald",
+	"freedom", "whatever", "qazwsx", "killer", "jordan", "jennifer", "hunter",
+	"buster", "soccer", "harley", "ranger", "thomas", "tigger", "robert",
+	"daniel", "hockey", "george", "computer", "michelle", "jessica", "pepper",
+	"zxcvbn", "zxcvbnm", "asdfgh", "555555", "131313", "secret", "summer",
+	"winter", "spring", "autumn", "internet", "cookie", "maggie", "ginger",
+	"joshua", "cheese", "amanda", "love", "lovely", "matrix", "corvette",
+	"taylor", "martin", "chelsea", "biteme", "andrew", "orange", "merlin",
+	"yankees", "dallas", "austin", "thunder", "matthew", "silver", "golden",
+	"diamond", "samsung", "apple", "google", "yellow", "purple", "chocolate",
+	"banana", "pokemon", "naruto", "minecraft", "family", "friends", "forever",
+	"angel", "blink182", "nicole", "hannah", "anthony", "liverpool", "arsenal",
+	"chicken", "fuckyou", "asshole", "pussy", "jesus", "heaven", "blessed",
+	"hello123", "changeme", "default", "guest", "test", "testing", "qwe123",
+	"zaq12wsx", "qazxsw", "monkey123", "dragon123", "admin123", "root", "toor",
+	"oracle", "server", "system", "manager", "office", "business", "company",
+	"secure", "security", "pass", "user", "username", "sso",
+}
@@ -0,0 +1,139 @@
+// Package password checks new passwords against a policy.
+package password
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// MaxBytes is as much of a password as bcrypt looks at; longer passwords
+// are rejected rather than silently cut.
+const MaxBytes = 72
+
+// Rules a password can break, as reported in Violation.Rule.
+const (
+	RuleMinLength    = "min_length"
+	RuleMaxLength    = "max_length"
+	RuleCharClasses  = "char_classes"
+	RulePersonalInfo = "personal_info"
+	RuleStrength     = "strength"
+	// RuleBreached is not checked by Policy but by whoever screens passwords
+	// against breach corpora.
+	RuleBreached = "breached"
+)
+
+// Policy is what a new password has to satisfy. MinLength counts
+// characters. MinCharClasses is how many of lowercase letters, uppercase
+// letters, digits and other characters it must mix. MinStrength is the
+// least Strength it must have. RejectPersonalInfo refuses passwords that
+// contain the user's email, the part of it before the @ or their username.
+type Policy struct {
+	MinLength          int
+	MinCharClasses     int
+	MinStrength        int
+	RejectPersonalInfo bool
+}
+
+// Violation is a rule the password breaks, with a message for the user.
+type Violation struct {
+	Rule    string
+	Message string
+}
+
+// Policies holds the default policy and the policies of apps that override
+// it.
+type Policies struct {
+	Default Policy
+	Apps    map[int64]Policy
+}
+
+// For returns the policy of the app, or the default one if the app does not
+// have its own.
+func (p Policies) For(appID int64) Policy {
+	if policy, ok := p.Apps[appID]; ok {
+		return policy
+	}
+	return p.Default
+}
+
+// Check returns the rules of the policy the password breaks, none if it
+// satisfies the policy. personalInfo is what is known about the user, such
+// as their email and username; empty values are ignored.
+func (p Policy) Check(password string, personalInfo ...string) []Violation {
+	var violations []Violation
+
+	if n := utf8.RuneCountInString(password); n < p.MinLength {
+		violations = append(violations, Violation{
+			Rule:    RuleMinLength,
+			Message: fmt.Sprintf("must be at least %d characters long", p.MinLength),
+		})
+	}
+	if len(password) > MaxBytes {
+		violations = append(violations, Violation{
+			Rule:    RuleMaxLength,
+			Message: fmt.Sprintf("must be at most %d bytes long", MaxBytes),
+		})
+	}
+	if charClasses(password) < p.MinCharClasses {
+		violations = append(violations, Violation{
+			Rule: RuleCharClasses,
+			Message: fmt.Sprintf(
+				"must mix at least %d of lowercase letters, uppercase letters, digits and symbols",
+				p.MinCharClasses,
+			),
+		})
+	}
+	if p.RejectPersonalInfo && containsPersonalInfo(password, personalInfo) {
+		violations = append(violations, Violation{
+			Rule:    RulePersonalInfo,
+			Message: "must not contain your email or username",
+		})
+	}
+	if p.MinStrength > 0 && Strength(password, personalInfo...) < p.MinStrength {
+		violations = append(violations, Violation{
+			Rule:    RuleStrength,
+			Message: "is too easy to guess",
+		})
+	}
+
+	return violations
+}
+
+func charClasses(password string) int {
+	var lower, upper, digit, other int
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = 1
+		case unicode.IsUpper(r):
+			upper = 1
+		case unicode.IsDigit(r):
+			digit = 1
+		default:
+			other = 1
+		}
+	}
+	return lower + upper + digit + other
+}
+
+// containsPersonalInfo looks for each value, and for the local part of
+// emails, ignoring case. Parts shorter than minPatternLen are too likely to
+// turn up by chance.
+func containsPersonalInfo(password string, personalInfo []string) bool {
+	password = strings.ToLower(password)
+	for _, info := range personalInfo {
+		info = strings.ToLower(strings.TrimSpace(info))
+		candidates := []string{info}
+		if local, _, ok := strings.Cut(info, "@"); ok {
+			candidates = append(candidates, local)
+		}
+		for _, candidate := range candidates {
+			if utf8.RuneCountInString(candidate) >= minPatternLen && strings.Contains(password, candidate) {
+				return true
+			}
+		}
+	}
+	return false
+}
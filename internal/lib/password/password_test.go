@@ -0,0 +1,87 @@
+package password
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func rules(violations []Violation) []string {
+	var res []string
+	for _, v := range violations {
+		res = append(res, v.Rule)
+	}
+	return res
+}
+
+func TestPolicy_Check(t *testing.T) {
+	policy := Policy{
+		MinLength:          10,
+		MinCharClasses:     3,
+		MinStrength:        3,
+		RejectPersonalInfo: true,
+	}
+
+	tests := []struct {
+		name     string
+		password string
+		want     []string
+	}{
+		{name: "ok", password: "v+r77L=uGhq", want: nil},
+		{name: "short", password: "4x9#kLq2", want: []string{RuleMinLength}},
+		{name: "too long for bcrypt", password: strings.Repeat("aB3$", 19), want: []string{RuleMaxLength}},
+		{name: "one class", password: "vqmzjrtkwlxh", want: []string{RuleCharClasses}},
+		{name: "email", password: "Jane.Doe@Example.com1", want: []string{RulePersonalInfo, RuleStrength}},
+		{name: "local part", password: "x!JANE.DOE!9Qw", want: []string{RulePersonalInfo}},
+		{name: "username", password: "Qx7!janedoe42", want: []string{RulePersonalInfo}},
+		{name: "guessable", password: "P@ssw0rd1234", want: []string{RuleStrength}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			violations := policy.Check(tt.password, "jane.doe@example.com", "janedoe", "")
+			assert.Equal(t, tt.want, rules(violations))
+			for _, v := range violations {
+				assert.NotEmpty(t, v.Message)
+			}
+		})
+	}
+
+	assert.Empty(t, Policy{}.Check("x"))
+}
+
+func TestPolicies_For(t *testing.T) {
+	policies := Policies{
+		Default: Policy{MinLength: 8},
+		Apps:    map[int64]Policy{2: {MinLength: 12}},
+	}
+
+	assert.Equal(t, 8, policies.For(1).MinLength)
+	assert.Equal(t, 12, policies.For(2).MinLength)
+	assert.Equal(t, 8, Policies{Default: Policy{MinLength: 8}}.For(2).MinLength)
+}
+
+func TestStrength(t *testing.T) {
+	tests := []struct {
+		password string
+		want     int
+	}{
+		{password: "", want: 0},
+		{password: "password", want: 0},
+		{password: "P@ssw0rd1", want: 0},
+		{password: "aaaaaaaaaaaa", want: 0},
+		{password: "qwerty123", want: 1},
+		{password: "zxcvbnm,./", want: 1},
+		{password: "dragon1999", want: 1},
+		{password: "abcdefgh12345678", want: 1},
+		{password: "Tr0ub4dor&3", want: 4},
+		{password: "correcthorsebatterystaple", want: 4},
+		{password: "4x9#kLq2", want: 4},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, Strength(tt.password), "password: %q", tt.password)
+	}
+
+	assert.Equal(t, 4, Strength("jsmith1987"+"Qz"))
+	assert.Less(t, Strength("jsmith1987", "jsmith@example.com"), Strength("jsmith1987"))
+}
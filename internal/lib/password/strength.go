@@ -0,0 +1,272 @@
+package password
+
+import (
+	"math"
+	"strings"
+	"unicode"
+)
+
+// Strength estimates, in the manner of zxcvbn, how hard the password is to
+// guess: 0 is too guessable, 4 very unguessable. The password is split into
+// the patterns an attacker tries first (common passwords, the user's own
+// data, repeats, sequences, keyboard walks and years) and characters that
+// have to be brute forced; the guesses needed for each part are multiplied.
+// userInputs are words about the user, such as their email.
+func Strength(password string, userInputs ...string) int {
+	guesses := estimateGuesses(password, userInputs)
+
+	switch {
+	case guesses < 1e3:
+		return 0
+	case guesses < 1e6:
+		return 1
+	case guesses < 1e8:
+		return 2
+	case guesses < 1e10:
+		return 3
+	default:
+		return 4
+	}
+}
+
+// minPatternLen is the shortest run that counts as a pattern.
+const minPatternLen = 3
+
+var keyboardRows = []string{
+	"`1234567890-=",
+	"qwertyuiop[]\\",
+	"asdfghjkl;'",
+	"zxcvbnm,./",
+}
+
+var leet = strings.NewReplacer(
+	"@", "a", "4", "a", "8", "b", "(", "c", "3", "e", "6", "g",
+	"1", "i", "!", "i", "|", "l", "0", "o", "$", "s", "5", "s",
+	"7", "t", "+", "t", "2", "z",
+)
+
+func estimateGuesses(password string, userInputs []string) float64 {
+	runes := []rune(password)
+	if len(runes) == 0 {
+		return 1
+	}
+
+	lower := []rune(strings.ToLower(password))
+	plain := []rune(leet.Replace(strings.ToLower(password)))
+	words := dictionary(userInputs)
+	cardinality := bruteForceCardinality(runes)
+
+	// Patterns other than the first one cost a little extra: the attacker
+	// has to guess how they are combined.
+	log10 := 0.0
+	patterns := 0
+	for i := 0; i < len(runes); {
+		n, guesses := longestPattern(lower, plain, i, words)
+		if n == 0 {
+			n, guesses = 1, cardinality
+		} else {
+			patterns++
+		}
+		log10 += math.Log10(guesses)
+		i += n
+	}
+	if patterns > 1 {
+		log10 += math.Log10(float64(patterns))
+	}
+
+	return math.Pow(10, log10)
+}
+
+// longestPattern returns the length of the longest pattern starting at i
+// and the guesses it takes; zero if none starts there.
+func longestPattern(lower, plain []rune, i int, words map[string]int) (int, float64) {
+	best, guesses := 0, 0.0
+	try := func(n int, g float64) {
+		if n > best || (n == best && g < guesses) {
+			best, guesses = n, g
+		}
+	}
+
+	for word, rank := range words {
+		w := []rune(word)
+		if hasPrefix(lower[i:], w) {
+			try(len(w), float64(rank))
+		} else if w := []rune(leet.Replace(word)); hasPrefix(plain[i:], w) {
+			// Substitutions such as 0 for o are among the first tried.
+			try(len(w), float64(2*rank))
+		}
+	}
+	if n := repeatLen(lower, i); n >= minPatternLen {
+		try(n, float64(10*n))
+	}
+	if n := sequenceLen(lower, i); n >= minPatternLen {
+		try(n, float64(50*n))
+	}
+	if n := keyboardLen(lower, i); n >= minPatternLen+1 {
+		try(n, float64(200*n))
+	}
+	if n := yearLen(lower, i); n > 0 {
+		try(n, 200)
+	}
+
+	return best, guesses
+}
+
+func hasPrefix(s, prefix []rune) bool {
+	if len(prefix) > len(s) {
+		return false
+	}
+	for i := range prefix {
+		if s[i] != prefix[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// repeatLen is the length of the run of the same character at i.
+func repeatLen(s []rune, i int) int {
+	n := 1
+	for i+n < len(s) && s[i+n] == s[i] {
+		n++
+	}
+	return n
+}
+
+// sequenceLen is the length of the run at i whose characters go up or down
+// one at a time, such as "abc" or "987".
+func sequenceLen(s []rune, i int) int {
+	if i+1 >= len(s) {
+		return 1
+	}
+	step := s[i+1] - s[i]
+	if step != 1 && step != -1 {
+		return 1
+	}
+	n := 2
+	for i+n < len(s) && s[i+n]-s[i+n-1] == step {
+		n++
+	}
+	return n
+}
+
+// keyboardLen is the length of the run at i of neighbouring keys of one
+// row, in either direction.
+func keyboardLen(s []rune, i int) int {
+	best := 1
+	for _, row := range keyboardRows {
+		keys := []rune(row)
+		for _, dir := range []int{1, -1} {
+			pos := indexRune(keys, s[i])
+			n := 1
+			for pos >= 0 && i+n < len(s) {
+				pos += dir
+				if pos < 0 || pos >= len(keys) || keys[pos] != s[i+n] {
+					break
+				}
+				n++
+			}
+			best = max(best, n)
+		}
+	}
+	return best
+}
+
+func indexRune(s []rune, r rune) int {
+	for i := range s {
+		if s[i] == r {
+			return i
+		}
+	}
+	return -1
+}
+
+// yearLen is 4 if a year between 1900 and 2099 starts at i.
+func yearLen(s []rune, i int) int {
+	if i+4 > len(s) {
+		return 0
+	}
+	year := string(s[i : i+4])
+	for _, r := range year {
+		if !unicode.IsDigit(r) {
+			return 0
+		}
+	}
+	if strings.HasPrefix(year, "19") || strings.HasPrefix(year, "20") {
+		return 4
+	}
+	return 0
+}
+
+// bruteForceCardinality is the number of characters to try for each
+// character that is not part of a pattern.
+func bruteForceCardinality(password []rune) float64 {
+	var lower, upper, digit, symbol, other bool
+	for _, r := range password {
+		switch {
+		case r >= 'a' && r <= 'z':
+			lower = true
+		case r >= 'A' && r <= 'Z':
+			upper = true
+		case r >= '0' && r <= '9':
+			digit = true
+		case r < unicode.MaxASCII:
+			symbol = true
+		default:
+			other = true
+		}
+	}
+
+	cardinality := 0.0
+	if lower {
+		cardinality += 26
+	}
+	if upper {
+		cardinality += 26
+	}
+	if digit {
+		cardinality += 10
+	}
+	if symbol {
+		cardinality += 33
+	}
+	if other {
+		cardinality += 100
+	}
+	return cardinality
+}
+
+// dictionary ranks the common passwords by how early they are tried, with
+// the user's own words first.
+func dictionary(userInputs []string) map[string]int {
+	words := make(map[string]int, len(commonPasswords)+len(userInputs))
+	for rank, word := range commonPasswords {
+		words[word] = rank + 1
+	}
+	for _, input := range userInputs {
+		for _, word := range inputWords(input) {
+			words[word] = 1
+		}
+	}
+	return words
+}
+
+// inputWords splits a user input such as an email into the words worth
+// trying on their own.
+func inputWords(input string) []string {
+	input = strings.ToLower(strings.TrimSpace(input))
+	parts := strings.FieldsFunc(input, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	words := make([]string, 0, len(parts)+1)
+	if len([]rune(input)) >= minPatternLen {
+		words = append(words, input)
+	}
+	for _, part := range parts {
+		if len([]rune(part)) >= minPatternLen {
+			words = append(words, part)
+		}
+	}
+	return words
+}
@@ -0,0 +1,130 @@
+// Package picture validates uploaded images and re-encodes them, so nothing
+// but pixels from the upload (no metadata, no trailing bytes) is ever stored.
+package picture
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	"image/png"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+const (
+	// ContentType is the type of every encoded variant.
+	ContentType = "image/png"
+
+	// MaxSourceDimension bounds the width and height of uploads so a small
+	// file cannot decode into an enormous bitmap.
+	MaxSourceDimension = 4096
+)
+
+var (
+	ErrUnsupportedType = errors.New("unsupported image type")
+	ErrTooLarge        = errors.New("image dimensions are too large")
+)
+
+// Sizes lists the side lengths of the variants Process produces: the picture
+// itself first, then its thumbnails.
+var Sizes = []int{512, 128, 32}
+
+var supportedTypes = map[string]bool{
+	"image/png":  true,
+	"image/jpeg": true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+// Variant is a square PNG of Size by Size pixels, or smaller when the source
+// is.
+type Variant struct {
+	Size int
+	Data []byte
+}
+
+// Process decodes a PNG, JPEG, GIF (first frame) or WebP image, crops it to a
+// centred square and encodes it at every size in Sizes.
+func Process(data []byte) ([]Variant, error) {
+	const op = "picture.Process"
+
+	if !supportedTypes[http.DetectContentType(data)] {
+		return nil, fmt.Errorf("%s: %w", op, ErrUnsupportedType)
+	}
+
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, ErrUnsupportedType)
+	}
+	if cfg.Width > MaxSourceDimension || cfg.Height > MaxSourceDimension {
+		return nil, fmt.Errorf("%s: %w", op, ErrTooLarge)
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, ErrUnsupportedType)
+	}
+	src = cropSquare(src)
+
+	variants := make([]Variant, 0, len(Sizes))
+	for _, size := range Sizes {
+		encoded, err := encode(src, size)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		variants = append(variants, Variant{Size: size, Data: encoded})
+	}
+
+	return variants, nil
+}
+
+func cropSquare(img image.Image) image.Image {
+	b := img.Bounds()
+	side := min(b.Dx(), b.Dy())
+	x := b.Min.X + (b.Dx()-side)/2
+	y := b.Min.Y + (b.Dy()-side)/2
+
+	dst := image.NewRGBA(image.Rect(0, 0, side, side))
+	draw.Draw(dst, dst.Bounds(), img, image.Pt(x, y), draw.Src)
+
+	return dst
+}
+
+// encode scales the square img down to size; smaller images are not scaled
+// up.
+func encode(img image.Image, size int) ([]byte, error) {
+	side := min(img.Bounds().Dx(), size)
+
+	dst := image.NewRGBA(image.Rect(0, 0, side, side))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, img.Bounds(), draw.Src, nil)
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, dst); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// ThumbnailPath derives the key of the size thumbnail from the key of the
+// picture: "a/b.png" becomes "a/b_128.png".
+func ThumbnailPath(path string, size int) string {
+	return strings.TrimSuffix(path, ".png") + "_" + strconv.Itoa(size) + ".png"
+}
+
+// Paths lists the keys of a stored picture and all its thumbnails.
+func Paths(path string) []string {
+	paths := []string{path}
+	for _, size := range Sizes[1:] {
+		paths = append(paths, ThumbnailPath(path, size))
+	}
+
+	return paths
+}
@@ -0,0 +1,78 @@
+package picture
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProcess(t *testing.T) {
+	// A wide JPEG: red on the left, blue in the middle, red on the right.
+	src := image.NewRGBA(image.Rect(0, 0, 900, 600))
+	for x := 0; x < 900; x++ {
+		c := color.RGBA{R: 255, A: 255}
+		if x >= 150 && x < 750 {
+			c = color.RGBA{B: 255, A: 255}
+		}
+		for y := 0; y < 600; y++ {
+			src.Set(x, y, c)
+		}
+	}
+	var buf bytes.Buffer
+	require.NoError(t, jpeg.Encode(&buf, src, nil))
+
+	variants, err := Process(buf.Bytes())
+	require.NoError(t, err)
+	require.Len(t, variants, len(Sizes))
+
+	for i, v := range variants {
+		assert.Equal(t, Sizes[i], v.Size)
+
+		img, err := png.Decode(bytes.NewReader(v.Data))
+		require.NoError(t, err)
+		assert.Equal(t, image.Rect(0, 0, v.Size, v.Size), img.Bounds())
+
+		// The centred square crop leaves only blue.
+		r, _, b, _ := img.At(0, v.Size/2).RGBA()
+		assert.Less(t, r, b)
+	}
+}
+
+func TestProcess_DoesNotUpscale(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, image.NewGray(image.Rect(0, 0, 40, 60))))
+
+	variants, err := Process(buf.Bytes())
+	require.NoError(t, err)
+
+	for _, v := range variants {
+		img, err := png.Decode(bytes.NewReader(v.Data))
+		require.NoError(t, err)
+		assert.Equal(t, min(40, v.Size), img.Bounds().Dx())
+	}
+}
+
+func TestProcess_Rejects(t *testing.T) {
+	_, err := Process([]byte("<svg xmlns=\"http://www.w3.org/2000/svg\"></svg>"))
+	assert.ErrorIs(t, err, ErrUnsupportedType)
+
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, image.NewGray(image.Rect(0, 0, 40, 60))))
+	_, err = Process(buf.Bytes()[:buf.Len()/2])
+	assert.ErrorIs(t, err, ErrUnsupportedType)
+
+	buf.Reset()
+	require.NoError(t, png.Encode(&buf, image.NewGray(image.Rect(0, 0, MaxSourceDimension+1, 1))))
+	_, err = Process(buf.Bytes())
+	assert.ErrorIs(t, err, ErrTooLarge)
+}
+
+func TestPaths(t *testing.T) {
+	assert.Equal(t, []string{"a/b.png", "a/b_128.png", "a/b_32.png"}, Paths("a/b.png"))
+}
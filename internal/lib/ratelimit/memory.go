@@ -0,0 +1,87 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often full buckets are dropped from a Memory
+// limiter; a full bucket is the same as none.
+const sweepInterval = time.Minute
+
+// Memory keeps the buckets in process, so each replica enforces the limits
+// on its own.
+type Memory struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+type bucket struct {
+	tokens float64
+	at     time.Time
+	limit  Limit
+}
+
+func NewMemory() *Memory {
+	return &Memory{
+		buckets:   make(map[string]*bucket),
+		lastSweep: time.Now(),
+		now:       time.Now,
+	}
+}
+
+func (m *Memory) Take(_ context.Context, buckets map[string]Limit) (time.Duration, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	if now.Sub(m.lastSweep) >= sweepInterval {
+		m.sweep(now)
+	}
+
+	taken := make([]*bucket, 0, len(buckets))
+	var wait time.Duration
+	for key, limit := range buckets {
+		b, ok := m.buckets[key]
+		if !ok {
+			b = &bucket{tokens: limit.capacity(), at: now}
+			m.buckets[key] = b
+		}
+		b.limit = limit
+		b.refill(now)
+
+		if b.tokens < 1 {
+			wait = max(wait, time.Duration(math.Ceil((1-b.tokens)/limit.rate()))*time.Millisecond)
+		}
+		taken = append(taken, b)
+	}
+	if wait > 0 {
+		return wait, nil
+	}
+
+	for _, b := range taken {
+		b.tokens--
+	}
+
+	return 0, nil
+}
+
+func (b *bucket) refill(now time.Time) {
+	elapsed := float64(max(now.Sub(b.at), 0).Milliseconds())
+	b.tokens = min(b.limit.capacity(), b.tokens+elapsed*b.limit.rate())
+	b.at = now
+}
+
+func (m *Memory) sweep(now time.Time) {
+	for key, b := range m.buckets {
+		b.refill(now)
+		if b.tokens >= b.limit.capacity() {
+			delete(m.buckets, key)
+		}
+	}
+	m.lastSweep = now
+}
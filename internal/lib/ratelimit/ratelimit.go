@@ -0,0 +1,130 @@
+// Package ratelimit limits how often gRPC methods may be called, with token
+// buckets kept in memory or, to share them between replicas, in Redis.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/Novochenko/sso/internal/lib/clientinfo"
+	"github.com/Novochenko/sso/internal/lib/logger/sl"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Limit allows Requests calls every Per on average, in bursts of up to
+// Burst calls; a zero Burst means Requests. The zero Limit allows any
+// number of calls.
+type Limit struct {
+	Requests int
+	Per      time.Duration
+	Burst    int
+}
+
+func (l Limit) unlimited() bool {
+	return l.Requests <= 0 || l.Per <= 0
+}
+
+// rate is the number of tokens added to the bucket per millisecond. It is
+// worked out from the whole of Per, which may be less than a millisecond.
+func (l Limit) rate() float64 {
+	return float64(l.Requests) / (float64(l.Per) / float64(time.Millisecond))
+}
+
+func (l Limit) capacity() float64 {
+	if l.Burst > 0 {
+		return float64(l.Burst)
+	}
+	return float64(l.Requests)
+}
+
+// Policy limits the calls of a method in total, per client address and per
+// app. The app of a call is the app_id field of its request; calls without
+// one are only held to the other limits.
+type Policy struct {
+	Total Limit
+	IP    Limit
+	App   Limit
+}
+
+// Limiter takes a token from each of the buckets, keyed by name, and returns
+// zero if every one of them had a token. Otherwise it takes none and returns
+// how long until they all do.
+type Limiter interface {
+	Take(ctx context.Context, buckets map[string]Limit) (time.Duration, error)
+}
+
+// UnaryServerInterceptor holds every call to the policy of its method, or
+// to the default policy for methods without one. Calls over a limit fail
+// with ResourceExhausted and the number of seconds to wait in the
+// retry-after header. If the limiter fails the call is let through.
+func UnaryServerInterceptor(
+	log *slog.Logger,
+	limiter Limiter,
+	defaultPolicy Policy,
+	policies map[string]Policy,
+) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		policy, ok := policies[info.FullMethod]
+		if !ok {
+			policy = defaultPolicy
+		}
+
+		wait, err := take(ctx, limiter, info.FullMethod, policy, req)
+		if err != nil {
+			log.Error("failed to apply rate limit",
+				slog.String("method", info.FullMethod),
+				sl.Err(err),
+			)
+			return handler(ctx, req)
+		}
+		if wait > 0 {
+			seconds := int64(math.Ceil(wait.Seconds()))
+			_ = grpc.SetHeader(ctx, metadata.Pairs("retry-after", strconv.FormatInt(seconds, 10)))
+
+			return nil, status.Error(codes.ResourceExhausted, "rate limit exceeded, try again later")
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+type appRequest interface {
+	GetAppId() int64
+}
+
+// take checks the limits of the policy that apply to the call and returns
+// the longest wait among those that are exceeded. Tokens are only taken when
+// the call is allowed, so that a client held back by its own limit does not
+// use up the limits it shares with everyone else.
+func take(ctx context.Context, limiter Limiter, method string, policy Policy, req any) (time.Duration, error) {
+	buckets := make(map[string]Limit, 3)
+	add := func(key string, limit Limit) {
+		if !limit.unlimited() {
+			buckets[key] = limit
+		}
+	}
+	add(method, policy.Total)
+	if ip := clientinfo.FromContext(ctx).IP; ip != "" {
+		add(method+":ip:"+ip, policy.IP)
+	}
+	if r, ok := req.(appRequest); ok && r.GetAppId() != 0 {
+		add(method+":app:"+strconv.FormatInt(r.GetAppId(), 10), policy.App)
+	}
+	if len(buckets) == 0 {
+		return 0, nil
+	}
+
+	wait, err := limiter.Take(ctx, buckets)
+	if err != nil {
+		return 0, fmt.Errorf("ratelimit: %s: %w", method, err)
+	}
+
+	return wait, nil
+}
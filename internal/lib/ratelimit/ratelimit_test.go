@@ -0,0 +1,163 @@
+package ratelimit
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/Novochenko/protos/gen/go/sso"
+	"github.com/Novochenko/sso/internal/lib/clientinfo"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestMemory_Take(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	limiter := NewMemory()
+	limiter.now = func() time.Time { return now }
+	limit := Limit{Requests: 2, Per: time.Second, Burst: 3}
+
+	for range 3 {
+		wait, err := limiter.Take(ctx, map[string]Limit{"k": limit})
+		require.NoError(t, err)
+		assert.Zero(t, wait)
+	}
+	wait, err := limiter.Take(ctx, map[string]Limit{"k": limit})
+	require.NoError(t, err)
+	assert.Equal(t, 500*time.Millisecond, wait)
+
+	wait, err = limiter.Take(ctx, map[string]Limit{"other": limit})
+	require.NoError(t, err)
+	assert.Zero(t, wait)
+
+	now = now.Add(500 * time.Millisecond)
+	wait, err = limiter.Take(ctx, map[string]Limit{"k": limit})
+	require.NoError(t, err)
+	assert.Zero(t, wait)
+
+	// Buckets that have filled up again are dropped.
+	now = now.Add(sweepInterval)
+	_, err = limiter.Take(ctx, map[string]Limit{"k": limit})
+	require.NoError(t, err)
+	assert.Len(t, limiter.buckets, 1)
+}
+
+func TestMemory_TakeSubMillisecond(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	limiter := NewMemory()
+	limiter.now = func() time.Time { return now }
+	limit := Limit{Requests: 1, Per: 100 * time.Microsecond, Burst: 2}
+
+	for range 2 {
+		wait, err := limiter.Take(ctx, map[string]Limit{"k": limit})
+		require.NoError(t, err)
+		assert.Zero(t, wait)
+	}
+	wait, err := limiter.Take(ctx, map[string]Limit{"k": limit})
+	require.NoError(t, err)
+	assert.Equal(t, time.Millisecond, wait)
+
+	// Ten tokens a millisecond refill the bucket.
+	now = now.Add(time.Millisecond)
+	for range 2 {
+		wait, err := limiter.Take(ctx, map[string]Limit{"k": limit})
+		require.NoError(t, err)
+		assert.Zero(t, wait)
+	}
+}
+
+func TestRedis_Take(t *testing.T) {
+	ctx := context.Background()
+	server := miniredis.RunT(t)
+	limiter := NewRedis(redis.NewClient(&redis.Options{Addr: server.Addr()}))
+	limit := Limit{Requests: 1, Per: time.Hour, Burst: 2}
+
+	for range 2 {
+		wait, err := limiter.Take(ctx, map[string]Limit{"k": limit})
+		require.NoError(t, err)
+		assert.Zero(t, wait)
+	}
+	wait, err := limiter.Take(ctx, map[string]Limit{"k": limit})
+	require.NoError(t, err)
+	assert.InDelta(t, time.Hour, wait, float64(time.Second))
+
+	wait, err = limiter.Take(ctx, map[string]Limit{"other": limit})
+	require.NoError(t, err)
+	assert.Zero(t, wait)
+
+	// A call refused by one bucket takes nothing from the others.
+	wait, err = limiter.Take(ctx, map[string]Limit{"k": limit, "other": limit})
+	require.NoError(t, err)
+	assert.Positive(t, wait)
+	wait, err = limiter.Take(ctx, map[string]Limit{"other": limit})
+	require.NoError(t, err)
+	assert.Zero(t, wait)
+
+	assert.True(t, server.Exists("ratelimit:k"))
+	server.FastForward(2*time.Hour + time.Second)
+	assert.False(t, server.Exists("ratelimit:k"))
+
+	server.Close()
+	_, err = limiter.Take(ctx, map[string]Limit{"k": limit})
+	assert.Error(t, err)
+}
+
+type failingLimiter struct{}
+
+func (failingLimiter) Take(context.Context, map[string]Limit) (time.Duration, error) {
+	return 0, assert.AnError
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	handler := func(context.Context, any) (any, error) { return "ok", nil }
+	call := func(interceptor grpc.UnaryServerInterceptor, ip, method string, req any) error {
+		ctx := clientinfo.NewContext(context.Background(), clientinfo.Info{IP: ip})
+		_, err := interceptor(ctx, req, &grpc.UnaryServerInfo{FullMethod: method}, handler)
+		return err
+	}
+
+	interceptor := UnaryServerInterceptor(log, NewMemory(),
+		Policy{IP: Limit{Requests: 100, Per: time.Minute}},
+		map[string]Policy{
+			"/auth.Auth/Register": {IP: Limit{Requests: 1, Per: time.Minute}},
+			"/auth.Auth/Login":    {App: Limit{Requests: 1, Per: time.Minute}},
+		},
+	)
+
+	require.NoError(t, call(interceptor, "192.0.2.1", "/auth.Auth/Register", &sso.RegisterRequest{}))
+	err := call(interceptor, "192.0.2.1", "/auth.Auth/Register", &sso.RegisterRequest{})
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	require.NoError(t, call(interceptor, "192.0.2.2", "/auth.Auth/Register", &sso.RegisterRequest{}))
+	require.NoError(t, call(interceptor, "192.0.2.1", "/auth.Auth/Refresh", &sso.RefreshRequest{}))
+
+	require.NoError(t, call(interceptor, "192.0.2.1", "/auth.Auth/Login", &sso.LoginRequest{AppId: 1}))
+	err = call(interceptor, "192.0.2.2", "/auth.Auth/Login", &sso.LoginRequest{AppId: 1})
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	require.NoError(t, call(interceptor, "192.0.2.1", "/auth.Auth/Login", &sso.LoginRequest{AppId: 2}))
+
+	// A client held back by its own limit does not use up the shared one.
+	interceptor = UnaryServerInterceptor(log, NewMemory(),
+		Policy{Total: Limit{Requests: 3, Per: time.Minute}, IP: Limit{Requests: 1, Per: time.Minute}}, nil)
+	require.NoError(t, call(interceptor, "192.0.2.1", "/auth.Auth/Login", &sso.LoginRequest{}))
+	for range 5 {
+		err = call(interceptor, "192.0.2.1", "/auth.Auth/Login", &sso.LoginRequest{})
+		assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	}
+	require.NoError(t, call(interceptor, "192.0.2.2", "/auth.Auth/Login", &sso.LoginRequest{}))
+	require.NoError(t, call(interceptor, "192.0.2.3", "/auth.Auth/Login", &sso.LoginRequest{}))
+
+	// A broken limiter lets calls through.
+	interceptor = UnaryServerInterceptor(log, failingLimiter{},
+		Policy{Total: Limit{Requests: 1, Per: time.Minute}}, nil)
+	require.NoError(t, call(interceptor, "192.0.2.1", "/auth.Auth/Login", &sso.LoginRequest{}))
+}
@@ -0,0 +1,78 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// takeScript refills the buckets in KEYS and takes a token from each of
+// them if they all have one. ARGV holds the current time in milliseconds and
+// then, for every key, the capacity and the rate in tokens per millisecond.
+// It returns how many milliseconds to wait, zero if the tokens were taken.
+// Buckets expire once they would be full again.
+var takeScript = redis.NewScript(`
+local now = tonumber(ARGV[1])
+
+local tokens = {}
+local wait = 0
+for i, key in ipairs(KEYS) do
+	local capacity = tonumber(ARGV[2 * i])
+	local rate = tonumber(ARGV[2 * i + 1])
+
+	local state = redis.call('HMGET', key, 'tokens', 'at')
+	local t = tonumber(state[1])
+	local at = tonumber(state[2])
+	if t == nil or at == nil then
+		t = capacity
+		at = now
+	end
+	t = math.min(capacity, t + math.max(0, now - at) * rate)
+	if t < 1 then
+		wait = math.max(wait, math.ceil((1 - t) / rate))
+	end
+	tokens[i] = t
+end
+
+for i, key in ipairs(KEYS) do
+	local capacity = tonumber(ARGV[2 * i])
+	local rate = tonumber(ARGV[2 * i + 1])
+	local t = tokens[i]
+	if wait == 0 then
+		t = t - 1
+	end
+
+	redis.call('HSET', key, 'tokens', tostring(t), 'at', tostring(now))
+	redis.call('PEXPIRE', key, math.ceil((capacity - t) / rate) + 1)
+end
+
+return wait
+`)
+
+// Redis keeps the buckets in Redis, so the limits hold across replicas.
+// Keys are prefixed with "ratelimit:".
+type Redis struct {
+	client redis.Scripter
+}
+
+func NewRedis(client redis.Scripter) *Redis {
+	return &Redis{client: client}
+}
+
+func (r *Redis) Take(ctx context.Context, buckets map[string]Limit) (time.Duration, error) {
+	keys := make([]string, 0, len(buckets))
+	args := make([]any, 0, 1+2*len(buckets))
+	args = append(args, time.Now().UnixMilli())
+	for key, limit := range buckets {
+		keys = append(keys, "ratelimit:"+key)
+		args = append(args, limit.capacity(), limit.rate())
+	}
+
+	wait, err := takeScript.Run(ctx, r.client, keys, args...).Int64()
+	if err != nil {
+		return 0, err
+	}
+
+	return time.Duration(wait) * time.Millisecond, nil
+}
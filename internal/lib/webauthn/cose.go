@@ -0,0 +1,130 @@
+package webauthn
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"errors"
+	"math/big"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+// COSE algorithm identifiers, RFC 9053.
+const (
+	AlgES256 = -7
+	AlgEdDSA = -8
+	AlgRS256 = -257
+)
+
+// SupportedAlgorithms are offered to authenticators in order of preference.
+var SupportedAlgorithms = []int{AlgES256, AlgEdDSA, AlgRS256}
+
+// COSE key parameters, RFC 9052 section 7 and RFC 9053 section 7.
+const (
+	coseKty = 1
+	coseAlg = 3
+
+	coseCrv = -1
+	coseX   = -2
+	coseY   = -3
+	coseN   = -1
+	coseE   = -2
+
+	ktyOKP = 1
+	ktyEC2 = 2
+	ktyRSA = 3
+
+	crvP256    = 1
+	crvEd25519 = 6
+)
+
+var ErrUnsupportedKey = errors.New("unsupported credential public key")
+
+// publicKey is a decoded COSE_Key.
+type publicKey struct {
+	alg int
+	key crypto.PublicKey
+}
+
+func parsePublicKey(data []byte) (publicKey, error) {
+	var raw map[int]cbor.RawMessage
+	if err := cbor.Unmarshal(data, &raw); err != nil {
+		return publicKey{}, ErrUnsupportedKey
+	}
+
+	var kty, alg int
+	if cbor.Unmarshal(raw[coseKty], &kty) != nil || cbor.Unmarshal(raw[coseAlg], &alg) != nil {
+		return publicKey{}, ErrUnsupportedKey
+	}
+
+	switch {
+	case kty == ktyEC2 && alg == AlgES256:
+		var crv int
+		var x, y []byte
+		if cbor.Unmarshal(raw[coseCrv], &crv) != nil || crv != crvP256 ||
+			cbor.Unmarshal(raw[coseX], &x) != nil || cbor.Unmarshal(raw[coseY], &y) != nil {
+			return publicKey{}, ErrUnsupportedKey
+		}
+		key := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !key.Curve.IsOnCurve(key.X, key.Y) {
+			return publicKey{}, ErrUnsupportedKey
+		}
+		return publicKey{alg: alg, key: key}, nil
+
+	case kty == ktyOKP && alg == AlgEdDSA:
+		var crv int
+		var x []byte
+		if cbor.Unmarshal(raw[coseCrv], &crv) != nil || crv != crvEd25519 ||
+			cbor.Unmarshal(raw[coseX], &x) != nil || len(x) != ed25519.PublicKeySize {
+			return publicKey{}, ErrUnsupportedKey
+		}
+		return publicKey{alg: alg, key: ed25519.PublicKey(x)}, nil
+
+	case kty == ktyRSA && alg == AlgRS256:
+		var n, e []byte
+		if cbor.Unmarshal(raw[coseN], &n) != nil || cbor.Unmarshal(raw[coseE], &e) != nil {
+			return publicKey{}, ErrUnsupportedKey
+		}
+		exp := new(big.Int).SetBytes(e)
+		if !exp.IsInt64() || exp.Int64() < 3 || exp.Int64() > 1<<31-1 {
+			return publicKey{}, ErrUnsupportedKey
+		}
+		return publicKey{alg: alg, key: &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exp.Int64())}}, nil
+
+	default:
+		return publicKey{}, ErrUnsupportedKey
+	}
+}
+
+// verifySignature checks sig over data with key, which must be of the kind
+// alg names.
+func verifySignature(alg int, key crypto.PublicKey, data, sig []byte) bool {
+	switch alg {
+	case AlgES256:
+		k, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return false
+		}
+		digest := sha256.Sum256(data)
+		return ecdsa.VerifyASN1(k, digest[:], sig)
+	case AlgEdDSA:
+		k, ok := key.(ed25519.PublicKey)
+		if !ok {
+			return false
+		}
+		return ed25519.Verify(k, data, sig)
+	case AlgRS256:
+		k, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return false
+		}
+		digest := sha256.Sum256(data)
+		return rsa.VerifyPKCS1v15(k, crypto.SHA256, digest[:], sig) == nil
+	default:
+		return false
+	}
+}
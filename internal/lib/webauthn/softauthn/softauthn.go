@@ -0,0 +1,210 @@
+// Package softauthn is a software WebAuthn authenticator with ES256 keys. It
+// stands in for a browser and a security key in tests and command line
+// clients; it keeps its keys in memory and offers no protection for them.
+package softauthn
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"slices"
+
+	"github.com/Novochenko/sso/internal/lib/webauthn"
+	"github.com/fxamacker/cbor/v2"
+)
+
+const (
+	flagUserPresent        = 0x01
+	flagUserVerified       = 0x04
+	flagAttestedCredential = 0x40
+)
+
+var ErrNoCredential = errors.New("no matching credential")
+
+// Authenticator holds credentials for any number of relying parties.
+// UserVerification controls whether it claims to have verified the user,
+// as a fingerprint reader or PIN would.
+type Authenticator struct {
+	AAGUID           [16]byte
+	UserVerification bool
+
+	credentials []*credential
+}
+
+type credential struct {
+	id         []byte
+	rpID       string
+	userHandle []byte
+	key        *ecdsa.PrivateKey
+	signCount  uint32
+}
+
+// Attestation is the response to navigator.credentials.create().
+type Attestation struct {
+	CredentialID      []byte
+	ClientDataJSON    []byte
+	AttestationObject []byte
+}
+
+// Assertion is the response to navigator.credentials.get().
+type Assertion struct {
+	CredentialID      []byte
+	ClientDataJSON    []byte
+	AuthenticatorData []byte
+	Signature         []byte
+	UserHandle        []byte
+}
+
+func New() *Authenticator {
+	return &Authenticator{UserVerification: true}
+}
+
+// Create registers a new credential with options, attested in format, which
+// is "none" or "packed" (self attestation).
+func (a *Authenticator) Create(origin string, options webauthn.CreationOptions, format string) (Attestation, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return Attestation{}, err
+	}
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return Attestation{}, err
+	}
+
+	cred := &credential{
+		id:         id,
+		rpID:       options.RP.ID,
+		userHandle: options.User.ID,
+		key:        key,
+	}
+
+	clientData, err := clientDataJSON("webauthn.create", options.Challenge, origin)
+	if err != nil {
+		return Attestation{}, err
+	}
+
+	publicKey, err := cbor.Marshal(map[int]any{
+		1:  2,  // kty: EC2
+		3:  -7, // alg: ES256
+		-1: 1,  // crv: P-256
+		-2: key.PublicKey.X.FillBytes(make([]byte, 32)),
+		-3: key.PublicKey.Y.FillBytes(make([]byte, 32)),
+	})
+	if err != nil {
+		return Attestation{}, err
+	}
+
+	authData := a.authData(cred, flagAttestedCredential)
+	authData = append(authData, a.AAGUID[:]...)
+	authData = binary.BigEndian.AppendUint16(authData, uint16(len(id)))
+	authData = append(authData, id...)
+	authData = append(authData, publicKey...)
+
+	stmt := map[string]any{}
+	switch format {
+	case "none":
+	case "packed":
+		sig, err := sign(key, authData, clientData)
+		if err != nil {
+			return Attestation{}, err
+		}
+		stmt = map[string]any{"alg": -7, "sig": sig}
+	default:
+		return Attestation{}, errors.New("unsupported attestation format")
+	}
+
+	object, err := cbor.Marshal(map[string]any{
+		"fmt":      format,
+		"attStmt":  stmt,
+		"authData": authData,
+	})
+	if err != nil {
+		return Attestation{}, err
+	}
+
+	a.credentials = append(a.credentials, cred)
+
+	return Attestation{
+		CredentialID:      id,
+		ClientDataJSON:    clientData,
+		AttestationObject: object,
+	}, nil
+}
+
+// Get signs an assertion with the first credential for the relying party
+// that options allow.
+func (a *Authenticator) Get(origin string, options webauthn.RequestOptions) (Assertion, error) {
+	cred := a.find(options)
+	if cred == nil {
+		return Assertion{}, ErrNoCredential
+	}
+
+	clientData, err := clientDataJSON("webauthn.get", options.Challenge, origin)
+	if err != nil {
+		return Assertion{}, err
+	}
+
+	cred.signCount++
+	authData := a.authData(cred, 0)
+	sig, err := sign(cred.key, authData, clientData)
+	if err != nil {
+		return Assertion{}, err
+	}
+
+	return Assertion{
+		CredentialID:      cred.id,
+		ClientDataJSON:    clientData,
+		AuthenticatorData: authData,
+		Signature:         sig,
+		UserHandle:        cred.userHandle,
+	}, nil
+}
+
+func (a *Authenticator) find(options webauthn.RequestOptions) *credential {
+	for _, cred := range a.credentials {
+		if cred.rpID != options.RPID {
+			continue
+		}
+		if len(options.AllowCredentials) == 0 {
+			return cred
+		}
+		for _, allowed := range options.AllowCredentials {
+			if slices.Equal(allowed.ID, cred.id) {
+				return cred
+			}
+		}
+	}
+
+	return nil
+}
+
+func (a *Authenticator) authData(cred *credential, flags byte) []byte {
+	flags |= flagUserPresent
+	if a.UserVerification {
+		flags |= flagUserVerified
+	}
+
+	rpIDHash := sha256.Sum256([]byte(cred.rpID))
+	data := append(rpIDHash[:], flags)
+
+	return binary.BigEndian.AppendUint32(data, cred.signCount)
+}
+
+func clientDataJSON(typ string, challenge []byte, origin string) ([]byte, error) {
+	return json.Marshal(map[string]any{
+		"type":      typ,
+		"challenge": webauthn.Encoding.EncodeToString(challenge),
+		"origin":    origin,
+	})
+}
+
+func sign(key *ecdsa.PrivateKey, authData, clientData []byte) ([]byte, error) {
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(slices.Clone(authData), clientDataHash[:]...))
+
+	return ecdsa.SignASN1(rand.Reader, key, digest[:])
+}
@@ -0,0 +1,307 @@
+// Package webauthn implements the relying party side of the WebAuthn
+// registration and authentication ceremonies (W3C Web Authentication Level
+// 2, sections 7.1 and 7.2). Attestation formats "none" and "packed" are
+// verified; attestation certificates are checked for well-formedness but not
+// chained to any root, so attestation proves nothing about the authenticator
+// model.
+package webauthn
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+const (
+	challengeSize = 32
+
+	flagUserPresent        = 0x01
+	flagUserVerified       = 0x04
+	flagAttestedCredential = 0x40
+	flagExtensions         = 0x80
+
+	typeCreate = "webauthn.create"
+	typeGet    = "webauthn.get"
+)
+
+var (
+	ErrInvalidClientData  = errors.New("invalid client data")
+	ErrInvalidAuthData    = errors.New("invalid authenticator data")
+	ErrInvalidAttestation = errors.New("invalid attestation")
+	ErrInvalidSignature   = errors.New("invalid assertion signature")
+	ErrUserNotPresent     = errors.New("user presence not asserted")
+	ErrUserNotVerified    = errors.New("user verification required")
+	// ErrSignCountRegressed means the authenticator's counter went backwards,
+	// which happens when a credential has been cloned.
+	ErrSignCountRegressed = errors.New("signature counter did not increase")
+)
+
+// Encoding is the base64url without padding used for binary values in
+// client data and in the options passed to browsers.
+var Encoding = base64.RawURLEncoding
+
+// RelyingParty is the site credentials are scoped to. ID is its domain;
+// Origins are the origins ceremonies may run on.
+type RelyingParty struct {
+	ID      string
+	Name    string
+	Origins []string
+}
+
+// Credential is a registered public key credential. PublicKey is the COSE
+// encoded key as received from the authenticator.
+type Credential struct {
+	ID                []byte
+	PublicKey         []byte
+	SignCount         uint32
+	AAGUID            []byte
+	AttestationFormat string
+}
+
+func NewChallenge() ([]byte, error) {
+	challenge := make([]byte, challengeSize)
+	if _, err := rand.Read(challenge); err != nil {
+		return nil, err
+	}
+
+	return challenge, nil
+}
+
+// VerifyRegistration runs the registration ceremony checks on the response
+// to a navigator.credentials.create() call made with challenge.
+func (rp RelyingParty) VerifyRegistration(challenge, clientDataJSON, attestationObject []byte, requireUV bool) (Credential, error) {
+	const op = "webauthn.VerifyRegistration"
+
+	if err := rp.verifyClientData(clientDataJSON, typeCreate, challenge); err != nil {
+		return Credential{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var att struct {
+		Format   string          `cbor:"fmt"`
+		AttStmt  cbor.RawMessage `cbor:"attStmt"`
+		AuthData []byte          `cbor:"authData"`
+	}
+	if err := cbor.Unmarshal(attestationObject, &att); err != nil {
+		return Credential{}, fmt.Errorf("%s: %w", op, ErrInvalidAttestation)
+	}
+
+	authData, err := rp.parseAuthData(att.AuthData, requireUV)
+	if err != nil {
+		return Credential{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if authData.credential == nil {
+		return Credential{}, fmt.Errorf("%s: %w: no attested credential", op, ErrInvalidAuthData)
+	}
+	key, err := parsePublicKey(authData.credential.PublicKey)
+	if err != nil {
+		return Credential{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if !slices.Contains(SupportedAlgorithms, key.alg) {
+		return Credential{}, fmt.Errorf("%s: %w", op, ErrUnsupportedKey)
+	}
+
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	signed := append(slices.Clone(att.AuthData), clientDataHash[:]...)
+
+	switch att.Format {
+	case "none":
+		// Nothing to verify; browsers send this unless attestation was asked for.
+	case "packed":
+		if err := verifyPacked(att.AttStmt, signed, key, authData.credential.AAGUID); err != nil {
+			return Credential{}, fmt.Errorf("%s: %w", op, err)
+		}
+	default:
+		return Credential{}, fmt.Errorf("%s: %w: unsupported format %q", op, ErrInvalidAttestation, att.Format)
+	}
+
+	credential := *authData.credential
+	credential.SignCount = authData.signCount
+	credential.AttestationFormat = att.Format
+
+	return credential, nil
+}
+
+// VerifyAssertion runs the authentication ceremony checks on the response to
+// a navigator.credentials.get() call made with challenge, for the stored
+// credential. It returns the authenticator's new signature counter.
+func (rp RelyingParty) VerifyAssertion(
+	challenge []byte,
+	credential Credential,
+	clientDataJSON []byte,
+	authenticatorData []byte,
+	signature []byte,
+	requireUV bool,
+) (uint32, error) {
+	const op = "webauthn.VerifyAssertion"
+
+	if err := rp.verifyClientData(clientDataJSON, typeGet, challenge); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	authData, err := rp.parseAuthData(authenticatorData, requireUV)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	key, err := parsePublicKey(credential.PublicKey)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	signed := append(slices.Clone(authenticatorData), clientDataHash[:]...)
+	if !verifySignature(key.alg, key.key, signed, signature) {
+		return 0, fmt.Errorf("%s: %w", op, ErrInvalidSignature)
+	}
+
+	// Authenticators without a counter always report zero.
+	if (authData.signCount != 0 || credential.SignCount != 0) && authData.signCount <= credential.SignCount {
+		return 0, fmt.Errorf("%s: %w", op, ErrSignCountRegressed)
+	}
+
+	return authData.signCount, nil
+}
+
+func (rp RelyingParty) verifyClientData(clientDataJSON []byte, typ string, challenge []byte) error {
+	var clientData struct {
+		Type      string `json:"type"`
+		Challenge string `json:"challenge"`
+		Origin    string `json:"origin"`
+	}
+	if err := json.Unmarshal(clientDataJSON, &clientData); err != nil {
+		return ErrInvalidClientData
+	}
+	if clientData.Type != typ {
+		return fmt.Errorf("%w: type %q", ErrInvalidClientData, clientData.Type)
+	}
+	got, err := Encoding.DecodeString(clientData.Challenge)
+	if err != nil || subtle.ConstantTimeCompare(got, challenge) != 1 {
+		return fmt.Errorf("%w: challenge mismatch", ErrInvalidClientData)
+	}
+	if !slices.Contains(rp.Origins, clientData.Origin) {
+		return fmt.Errorf("%w: origin %q", ErrInvalidClientData, clientData.Origin)
+	}
+
+	return nil
+}
+
+type authData struct {
+	flags      byte
+	signCount  uint32
+	credential *Credential
+}
+
+// parseAuthData decodes authenticator data (section 6.1) and checks the RP ID
+// hash and user flags.
+func (rp RelyingParty) parseAuthData(data []byte, requireUV bool) (authData, error) {
+	const headerSize = 32 + 1 + 4
+
+	if len(data) < headerSize {
+		return authData{}, ErrInvalidAuthData
+	}
+
+	rpIDHash := sha256.Sum256([]byte(rp.ID))
+	if !bytes.Equal(data[:32], rpIDHash[:]) {
+		return authData{}, fmt.Errorf("%w: rp id mismatch", ErrInvalidAuthData)
+	}
+
+	ad := authData{
+		flags:     data[32],
+		signCount: binary.BigEndian.Uint32(data[33:37]),
+	}
+	if ad.flags&flagUserPresent == 0 {
+		return authData{}, ErrUserNotPresent
+	}
+	if requireUV && ad.flags&flagUserVerified == 0 {
+		return authData{}, ErrUserNotVerified
+	}
+
+	rest := data[headerSize:]
+	if ad.flags&flagAttestedCredential != 0 {
+		if len(rest) < 18 {
+			return authData{}, ErrInvalidAuthData
+		}
+		aaguid := rest[:16]
+		idLen := int(binary.BigEndian.Uint16(rest[16:18]))
+		rest = rest[18:]
+		if len(rest) < idLen {
+			return authData{}, ErrInvalidAuthData
+		}
+		id := rest[:idLen]
+		rest = rest[idLen:]
+
+		// The key is followed by extensions, if any, so decode just one item.
+		var key cbor.RawMessage
+		rest, err := cbor.UnmarshalFirst(rest, &key)
+		if err != nil {
+			return authData{}, ErrInvalidAuthData
+		}
+		if ad.flags&flagExtensions == 0 && len(rest) > 0 {
+			return authData{}, fmt.Errorf("%w: trailing bytes", ErrInvalidAuthData)
+		}
+
+		ad.credential = &Credential{
+			ID:        slices.Clone(id),
+			PublicKey: slices.Clone([]byte(key)),
+			AAGUID:    slices.Clone(aaguid),
+		}
+	}
+
+	return ad, nil
+}
+
+// idFidoGenCeAAGUID is the certificate extension carrying the AAGUID of the
+// authenticator model.
+var idFidoGenCeAAGUID = []int{1, 3, 6, 1, 4, 1, 45724, 1, 1, 4}
+
+// verifyPacked checks a "packed" attestation statement (section 8.2), either
+// self attestation signed by the credential key or full attestation signed by
+// the certificate in x5c.
+func verifyPacked(stmt cbor.RawMessage, signed []byte, credentialKey publicKey, aaguid []byte) error {
+	var att struct {
+		Alg int      `cbor:"alg"`
+		Sig []byte   `cbor:"sig"`
+		X5C [][]byte `cbor:"x5c"`
+	}
+	if err := cbor.Unmarshal(stmt, &att); err != nil {
+		return ErrInvalidAttestation
+	}
+
+	if len(att.X5C) == 0 {
+		if att.Alg != credentialKey.alg || !verifySignature(att.Alg, credentialKey.key, signed, att.Sig) {
+			return fmt.Errorf("%w: bad self attestation", ErrInvalidAttestation)
+		}
+		return nil
+	}
+
+	cert, err := x509.ParseCertificate(att.X5C[0])
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidAttestation, err)
+	}
+	if cert.Version != 3 || cert.IsCA || !slices.Contains(cert.Subject.OrganizationalUnit, "Authenticator Attestation") {
+		return fmt.Errorf("%w: attestation certificate requirements not met", ErrInvalidAttestation)
+	}
+	for _, ext := range cert.Extensions {
+		if !ext.Id.Equal(idFidoGenCeAAGUID) {
+			continue
+		}
+		// The extension value is an OCTET STRING wrapping the 16 byte AAGUID.
+		if len(ext.Value) != 18 || !bytes.Equal(ext.Value[2:], aaguid) {
+			return fmt.Errorf("%w: aaguid mismatch", ErrInvalidAttestation)
+		}
+	}
+	if !verifySignature(att.Alg, cert.PublicKey, signed, att.Sig) {
+		return fmt.Errorf("%w: bad attestation signature", ErrInvalidAttestation)
+	}
+
+	return nil
+}
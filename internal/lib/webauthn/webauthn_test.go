@@ -0,0 +1,116 @@
+package webauthn_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Novochenko/sso/internal/lib/webauthn"
+	"github.com/Novochenko/sso/internal/lib/webauthn/softauthn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const origin = "https://sso.example.com"
+
+var rp = webauthn.RelyingParty{ID: "sso.example.com", Name: "sso", Origins: []string{origin}}
+
+func register(t *testing.T, authenticator *softauthn.Authenticator, format string) webauthn.Credential {
+	t.Helper()
+
+	challenge, err := webauthn.NewChallenge()
+	require.NoError(t, err)
+	options := rp.CreationOptions(challenge, webauthn.UserEntity{ID: []byte("user-1"), Name: "user@example.com"}, nil, time.Minute)
+
+	att, err := authenticator.Create(origin, options, format)
+	require.NoError(t, err)
+
+	cred, err := rp.VerifyRegistration(challenge, att.ClientDataJSON, att.AttestationObject, true)
+	require.NoError(t, err)
+	assert.Equal(t, att.CredentialID, cred.ID)
+	assert.Equal(t, format, cred.AttestationFormat)
+
+	return cred
+}
+
+func TestRegisterAndAssert(t *testing.T) {
+	for _, format := range []string{"none", "packed"} {
+		t.Run(format, func(t *testing.T) {
+			authenticator := softauthn.New()
+			cred := register(t, authenticator, format)
+
+			for i := 0; i < 2; i++ {
+				challenge, err := webauthn.NewChallenge()
+				require.NoError(t, err)
+				options := rp.RequestOptions(challenge, [][]byte{cred.ID}, webauthn.UserVerificationRequired, time.Minute)
+
+				assertion, err := authenticator.Get(origin, options)
+				require.NoError(t, err)
+				assert.Equal(t, []byte("user-1"), assertion.UserHandle)
+
+				count, err := rp.VerifyAssertion(challenge, cred, assertion.ClientDataJSON, assertion.AuthenticatorData, assertion.Signature, true)
+				require.NoError(t, err)
+				assert.Greater(t, count, cred.SignCount)
+				cred.SignCount = count
+			}
+		})
+	}
+}
+
+func TestVerifyRegistration_Rejects(t *testing.T) {
+	authenticator := softauthn.New()
+	challenge, err := webauthn.NewChallenge()
+	require.NoError(t, err)
+	options := rp.CreationOptions(challenge, webauthn.UserEntity{ID: []byte("user-1")}, nil, time.Minute)
+
+	att, err := authenticator.Create(origin, options, "packed")
+	require.NoError(t, err)
+
+	other, err := webauthn.NewChallenge()
+	require.NoError(t, err)
+	_, err = rp.VerifyRegistration(other, att.ClientDataJSON, att.AttestationObject, false)
+	assert.ErrorIs(t, err, webauthn.ErrInvalidClientData)
+
+	elsewhere := rp
+	elsewhere.Origins = []string{"https://evil.example.com"}
+	_, err = elsewhere.VerifyRegistration(challenge, att.ClientDataJSON, att.AttestationObject, false)
+	assert.ErrorIs(t, err, webauthn.ErrInvalidClientData)
+
+	otherRP := rp
+	otherRP.ID = "example.org"
+	_, err = otherRP.VerifyRegistration(challenge, att.ClientDataJSON, att.AttestationObject, false)
+	assert.ErrorIs(t, err, webauthn.ErrInvalidAuthData)
+
+	authenticator.UserVerification = false
+	att, err = authenticator.Create(origin, options, "none")
+	require.NoError(t, err)
+	_, err = rp.VerifyRegistration(challenge, att.ClientDataJSON, att.AttestationObject, true)
+	assert.ErrorIs(t, err, webauthn.ErrUserNotVerified)
+}
+
+func TestVerifyAssertion_Rejects(t *testing.T) {
+	authenticator := softauthn.New()
+	cred := register(t, authenticator, "none")
+
+	challenge, err := webauthn.NewChallenge()
+	require.NoError(t, err)
+	options := rp.RequestOptions(challenge, nil, webauthn.UserVerificationPreferred, time.Minute)
+	assertion, err := authenticator.Get(origin, options)
+	require.NoError(t, err)
+
+	signature := append([]byte(nil), assertion.Signature...)
+	signature[len(signature)-1] ^= 0xff
+	_, err = rp.VerifyAssertion(challenge, cred, assertion.ClientDataJSON, assertion.AuthenticatorData, signature, false)
+	assert.ErrorIs(t, err, webauthn.ErrInvalidSignature)
+
+	// A clone of the authenticator would present an older counter.
+	cloned := cred
+	cloned.SignCount = 5
+	_, err = rp.VerifyAssertion(challenge, cloned, assertion.ClientDataJSON, assertion.AuthenticatorData, assertion.Signature, false)
+	assert.ErrorIs(t, err, webauthn.ErrSignCountRegressed)
+
+	// Assertions are for webauthn.get only.
+	att, err := authenticator.Create(origin, rp.CreationOptions(challenge, webauthn.UserEntity{ID: []byte("u")}, nil, time.Minute), "none")
+	require.NoError(t, err)
+	_, err = rp.VerifyAssertion(challenge, cred, att.ClientDataJSON, assertion.AuthenticatorData, assertion.Signature, false)
+	assert.ErrorIs(t, err, webauthn.ErrInvalidClientData)
+}
@@ -0,0 +1,221 @@
+package auth
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/Novochenko/sso/internal/lib/jwt"
+	"github.com/Novochenko/sso/internal/lib/logger/sl"
+)
+
+// ExportContentType is the media type of the archives ExportData returns.
+const ExportContentType = "application/zip"
+
+// DeleteAccount soft deletes the user after checking their password. Every
+// session is revoked at once; the data itself is purged once the grace
+// period has passed.
+func (a *Auth) DeleteAccount(ctx context.Context, claims jwt.Claims, password string) error {
+	const op = "auth.DeleteAccount"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.String("user_id", claims.UserID.String()),
+	)
+
+	if _, err := a.reauthenticate(ctx, claims.UserID, password); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	// Revoke first: if marking fails the user is merely logged out.
+	if err := a.tokenRevoker.RevokeUser(ctx, claims.UserID); err != nil {
+		log.Error("failed to revoke user tokens", sl.Err(err))
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := a.accountManager.MarkUserDeleted(ctx, claims.UserID, time.Now()); err != nil {
+		log.Error("failed to mark user deleted", sl.Err(err))
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("account scheduled for deletion")
+
+	return nil
+}
+
+type exportedAccount struct {
+	ID                 string `json:"id"`
+	Email              string `json:"email"`
+	EmailVerified      bool   `json:"email_verified"`
+	Username           string `json:"username,omitempty"`
+	ProfilePicturePath string `json:"profile_picture_path,omitempty"`
+}
+
+type exportedSession struct {
+	ID         string     `json:"id"`
+	AppID      int        `json:"app_id"`
+	OrgID      int64      `json:"org_id,omitempty"`
+	UserAgent  string     `json:"user_agent"`
+	IP         string     `json:"ip"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastSeenAt time.Time  `json:"last_seen_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+type exportedAuditEvent struct {
+	Type       string    `json:"type"`
+	AppID      int       `json:"app_id,omitempty"`
+	Detail     string    `json:"detail,omitempty"`
+	OccurredAt time.Time `json:"occurred_at"`
+}
+
+type exportedAppGrant struct {
+	AppID          int       `json:"app_id"`
+	AppName        string    `json:"app_name"`
+	FirstGrantedAt time.Time `json:"first_granted_at"`
+	LastGrantedAt  time.Time `json:"last_granted_at"`
+}
+
+type exportedOrganization struct {
+	ID   int64  `json:"id"`
+	Slug string `json:"slug"`
+	Name string `json:"name"`
+	Role string `json:"role"`
+}
+
+type exportedGroup struct {
+	ID          int64  `json:"id"`
+	OrgID       int64  `json:"org_id,omitempty"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+}
+
+// ExportData returns a zip archive of everything stored about the user: one
+// JSON file per kind of record and the profile picture, if there is one.
+// Password and token hashes are left out.
+func (a *Auth) ExportData(ctx context.Context, claims jwt.Claims) ([]byte, error) {
+	const op = "auth.ExportData"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.String("user_id", claims.UserID.String()),
+	)
+
+	data, err := a.accountManager.UserData(ctx, claims.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	sessions := make([]exportedSession, 0, len(data.Sessions))
+	for _, s := range data.Sessions {
+		sessions = append(sessions, exportedSession{
+			ID:         s.ID.String(),
+			AppID:      s.AppID,
+			OrgID:      s.OrgID,
+			UserAgent:  s.UserAgent,
+			IP:         s.IP,
+			CreatedAt:  s.CreatedAt,
+			LastSeenAt: s.LastSeenAt,
+			ExpiresAt:  s.ExpiresAt,
+			RevokedAt:  s.RevokedAt,
+		})
+	}
+	events := make([]exportedAuditEvent, 0, len(data.AuditEvents))
+	for _, e := range data.AuditEvents {
+		events = append(events, exportedAuditEvent(e))
+	}
+	grants := make([]exportedAppGrant, 0, len(data.AppGrants))
+	for _, g := range data.AppGrants {
+		grants = append(grants, exportedAppGrant(g))
+	}
+	orgs := make([]exportedOrganization, 0, len(data.Orgs))
+	for _, o := range data.Orgs {
+		orgs = append(orgs, exportedOrganization{
+			ID:   o.Organization.ID,
+			Slug: o.Organization.Slug,
+			Name: o.Organization.Name,
+			Role: o.Role,
+		})
+	}
+	groups := make([]exportedGroup, 0, len(data.Groups))
+	for _, g := range data.Groups {
+		groups = append(groups, exportedGroup{
+			ID:          g.ID,
+			OrgID:       g.OrgID,
+			Name:        g.Name,
+			Description: g.Description,
+		})
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+
+	files := []struct {
+		name string
+		v    any
+	}{
+		{"account.json", exportedAccount{
+			ID:                 data.User.ID.String(),
+			Email:              data.User.Email,
+			EmailVerified:      data.User.EmailVerified,
+			Username:           data.Account.UserName,
+			ProfilePicturePath: data.Account.ProfilePicturePath,
+		}},
+		{"sessions.json", sessions},
+		{"audit_events.json", events},
+		{"app_grants.json", grants},
+		{"organizations.json", orgs},
+		{"groups.json", groups},
+	}
+	for _, f := range files {
+		if err := writeJSON(zw, f.name, f.v); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	if path := data.Account.ProfilePicturePath; path != "" {
+		if err := a.exportPicture(ctx, zw, path); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("user data exported")
+
+	return buf.Bytes(), nil
+}
+
+func (a *Auth) exportPicture(ctx context.Context, zw *zip.Writer, path string) error {
+	picture, err := a.pictureStore.Get(ctx, path)
+	if err != nil {
+		return err
+	}
+	w, err := zw.Create("profile_picture.png")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(picture)
+
+	return err
+}
+
+func writeJSON(zw *zip.Writer, name string, v any) error {
+	w, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(v)
+}
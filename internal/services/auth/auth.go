@@ -8,8 +8,12 @@ import (
 	"time"
 
 	"github.com/Novochenko/sso/domain/models"
+	"github.com/Novochenko/sso/internal/lib/clientinfo"
 	"github.com/Novochenko/sso/internal/lib/jwt"
 	"github.com/Novochenko/sso/internal/lib/logger/sl"
+	"github.com/Novochenko/sso/internal/lib/mail"
+	"github.com/Novochenko/sso/internal/lib/password"
+	"github.com/Novochenko/sso/internal/lib/webauthn"
 	"github.com/Novochenko/sso/internal/storage"
 	mysqlDriver "github.com/go-sql-driver/mysql"
 	"github.com/google/uuid"
@@ -21,12 +25,48 @@ var (
 )
 
 type Auth struct {
-	log          *slog.Logger
-	userSaver    UserSaver
-	userProvider UserProvider
-	appProvider  AppProvider
-	userFinder   UserFinder
-	tokenTTL     time.Duration
+	log                  *slog.Logger
+	userSaver            UserSaver
+	userProvider         UserProvider
+	appProvider          AppProvider
+	userFinder           UserFinder
+	refreshTokenProvider RefreshTokenProvider
+	keyProvider          KeyProvider
+	tokenRevoker         TokenRevoker
+	emailVerifier        EmailVerifier
+	passwordResetter     PasswordResetter
+	credentialChanger    CredentialChanger
+	accountManager       AccountManager
+	mfaStorage           MFAStorage
+	roleStorage          RoleStorage
+	orgStorage           OrgStorage
+	groupStorage         GroupStorage
+	groupResolver        GroupResolver
+	loginThrottler       LoginThrottler
+	breachChecker        BreachChecker
+	secretCipher         SecretCipher
+	mailer               Mailer
+	pictureStore         PictureStore
+	tokenTTL             time.Duration
+	refreshTokenTTL      time.Duration
+	emailVerificationTTL time.Duration
+	passwordResetTTL     time.Duration
+	emailChangeUndoTTL   time.Duration
+	mfaChallengeTTL      time.Duration
+	passkeyChallengeTTL  time.Duration
+	totpIssuer           string
+	relyingParty         webauthn.RelyingParty
+	links                Links
+	passwordPolicies     password.Policies
+}
+
+// Links are the pages that take the tokens mailed to users. The token is
+// appended as the "token" query parameter.
+type Links struct {
+	VerifyEmail        string
+	ResetPassword      string
+	ConfirmEmailChange string
+	UndoEmailChange    string
 }
 
 type UserSaver interface {
@@ -34,16 +74,146 @@ type UserSaver interface {
 }
 
 type UserFinder interface {
-	UserAccountById(ctx context.Context, userID uuid.UUID) (models.UserAccount, error)
+	UserAccountById(ctx context.Context, userID uuid.UUID, orgID int64) (models.UserAccount, error)
+	UserAccountByUsername(ctx context.Context, username string, orgID int64) (models.UserAccount, error)
+	UserAccountsByIDs(ctx context.Context, userIDs []uuid.UUID, orgID int64) ([]models.UserAccount, error)
+	UpdateUsername(ctx context.Context, userID uuid.UUID, username string) error
+	SetProfilePicturePath(ctx context.Context, userID uuid.UUID, path string) (oldPath string, err error)
 }
 
 type UserProvider interface {
 	User(ctx context.Context, email string) (models.User, error)
+	UserByID(ctx context.Context, userID uuid.UUID) (models.User, error)
 	IsAdmin(ctx context.Context, userID string) (bool, error)
 }
 
 type AppProvider interface {
 	App(ctx context.Context, appID int64) (models.App, error)
+	AppScopes(ctx context.Context, appID int64) ([]string, error)
+}
+
+type KeyProvider interface {
+	SigningKey(ctx context.Context) (jwt.SigningKey, error)
+	ParseToken(ctx context.Context, token string) (jwt.Claims, error)
+	JWKS(ctx context.Context) (jwt.JWKS, error)
+}
+
+type TokenRevoker interface {
+	RevokeToken(ctx context.Context, claims jwt.Claims) error
+	RevokeUser(ctx context.Context, userID uuid.UUID) error
+	RevokeSession(ctx context.Context, sessionID uuid.UUID) error
+	IsRevoked(ctx context.Context, claims jwt.Claims) (bool, error)
+}
+
+type EmailVerifier interface {
+	UseActionToken(ctx context.Context, jti string, userID uuid.UUID, purpose string, expiresAt time.Time) error
+	ActionTokenUsed(ctx context.Context, jti string) (bool, error)
+	SetEmailVerified(ctx context.Context, userID uuid.UUID, email string) error
+}
+
+type PasswordResetter interface {
+	SavePasswordResetToken(ctx context.Context, tokenHash string, userID uuid.UUID, expiresAt time.Time) error
+	PasswordResetUser(ctx context.Context, tokenHash string) (uuid.UUID, error)
+	ResetPassword(ctx context.Context, tokenHash string, passHash []byte) (uuid.UUID, error)
+	RequirePasswordReset(ctx context.Context, userID uuid.UUID) error
+}
+
+type CredentialChanger interface {
+	UpdatePassword(ctx context.Context, userID uuid.UUID, passHash []byte) error
+	SaveEmailChange(ctx context.Context, change models.EmailChange) error
+	ConfirmEmailChange(ctx context.Context, confirmTokenHash string) (models.EmailChange, error)
+	UndoEmailChange(ctx context.Context, undoTokenHash string) (models.EmailChange, error)
+}
+
+type AccountManager interface {
+	MarkUserDeleted(ctx context.Context, userID uuid.UUID, at time.Time) error
+	UserData(ctx context.Context, userID uuid.UUID) (models.UserData, error)
+}
+
+type MFAStorage interface {
+	SaveTOTP(ctx context.Context, userID uuid.UUID, secret []byte) error
+	TOTP(ctx context.Context, userID uuid.UUID) (models.TOTP, error)
+	ConfirmTOTP(ctx context.Context, userID uuid.UUID, step int64) error
+	UseTOTPStep(ctx context.Context, userID uuid.UUID, step int64) error
+	SaveWebAuthnCredential(ctx context.Context, cred models.WebAuthnCredential) error
+	WebAuthnCredential(ctx context.Context, id []byte) (models.WebAuthnCredential, error)
+	WebAuthnCredentials(ctx context.Context, userID uuid.UUID) ([]models.WebAuthnCredential, error)
+	UpdateWebAuthnSignCount(ctx context.Context, id []byte, signCount uint32, usedAt time.Time) error
+	ReplaceBackupCodes(ctx context.Context, userID uuid.UUID, codeHashes []string, at time.Time) error
+	UseBackupCode(ctx context.Context, userID uuid.UUID, codeHash string, at time.Time) (remaining int, err error)
+	BackupCodesRemaining(ctx context.Context, userID uuid.UUID) (int, error)
+}
+
+type RoleStorage interface {
+	SaveRole(ctx context.Context, role models.Role) (int64, error)
+	Role(ctx context.Context, id int64) (models.Role, error)
+	SavePermission(ctx context.Context, permission models.Permission) (int64, error)
+	Permission(ctx context.Context, id int64) (models.Permission, error)
+	AddRolePermission(ctx context.Context, roleID, permissionID int64) error
+	RemoveRolePermission(ctx context.Context, roleID, permissionID int64) error
+	AssignRole(ctx context.Context, userID uuid.UUID, roleID int64) error
+	UnassignRole(ctx context.Context, userID uuid.UUID, roleID int64) error
+	UserAuthorization(ctx context.Context, userID uuid.UUID, groupIDs []int64, appID int64) (models.Authorization, error)
+}
+
+type OrgStorage interface {
+	SaveOrganization(ctx context.Context, org models.Organization, owner uuid.UUID) (int64, error)
+	Organization(ctx context.Context, id int64) (models.Organization, error)
+	OrgMembership(ctx context.Context, orgID int64, userID uuid.UUID) (models.OrgMembership, error)
+	SaveOrgMembership(ctx context.Context, membership models.OrgMembership) error
+	DeleteOrgMembership(ctx context.Context, orgID int64, userID uuid.UUID) error
+	UserOrganizations(ctx context.Context, userID uuid.UUID) ([]models.UserOrganization, error)
+	OrgMembers(ctx context.Context, orgID int64) ([]models.OrgMembership, error)
+}
+
+type GroupStorage interface {
+	SaveGroup(ctx context.Context, group models.Group) (int64, error)
+	Group(ctx context.Context, id int64) (models.Group, error)
+	GroupsByIDs(ctx context.Context, ids []int64) ([]models.Group, error)
+	UpdateGroup(ctx context.Context, group models.Group) error
+	AddGroupMember(ctx context.Context, groupID int64, userID uuid.UUID) error
+	RemoveGroupMember(ctx context.Context, groupID int64, userID uuid.UUID) error
+	GroupMembers(ctx context.Context, groupID int64) (models.GroupMembers, error)
+	UserGroupIDs(ctx context.Context, userID uuid.UUID) ([]int64, error)
+	AssignGroupRole(ctx context.Context, groupID, roleID int64) error
+	UnassignGroupRole(ctx context.Context, groupID, roleID int64) error
+}
+
+// GroupResolver owns the graph of subgroups and finds every group a group
+// is nested in.
+type GroupResolver interface {
+	Ancestors(groupIDs []int64) []int64
+	AddSubgroup(ctx context.Context, parentID, childID int64) error
+	RemoveSubgroup(ctx context.Context, parentID, childID int64) error
+	DeleteGroup(ctx context.Context, id int64) error
+}
+
+// SecretCipher seals secrets that are stored but must be read back, such as
+// TOTP seeds.
+type SecretCipher interface {
+	Seal(plaintext []byte) ([]byte, error)
+	Open(sealed []byte) ([]byte, error)
+}
+
+type Mailer interface {
+	Send(ctx context.Context, msg mail.Message) error
+}
+
+// PictureStore keeps profile pictures and their thumbnails.
+type PictureStore interface {
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+	Get(ctx context.Context, key string) ([]byte, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// RefreshTokenProvider stores refresh tokens and the login sessions their
+// families belong to.
+type RefreshTokenProvider interface {
+	SaveSession(ctx context.Context, session models.LoginSession, token models.RefreshToken) error
+	Session(ctx context.Context, id uuid.UUID) (models.LoginSession, error)
+	ActiveSessions(ctx context.Context, userID uuid.UUID) ([]models.LoginSession, error)
+	RefreshToken(ctx context.Context, tokenHash string) (models.RefreshToken, error)
+	RotateRefreshToken(ctx context.Context, usedID uuid.UUID, next models.RefreshToken) error
 }
 
 func New(
@@ -52,63 +222,202 @@ func New(
 	userProvider UserProvider,
 	appProvider AppProvider,
 	userFinder UserFinder,
+	refreshTokenProvider RefreshTokenProvider,
+	keyProvider KeyProvider,
+	tokenRevoker TokenRevoker,
+	emailVerifier EmailVerifier,
+	passwordResetter PasswordResetter,
+	credentialChanger CredentialChanger,
+	accountManager AccountManager,
+	mfaStorage MFAStorage,
+	roleStorage RoleStorage,
+	orgStorage OrgStorage,
+	groupStorage GroupStorage,
+	groupResolver GroupResolver,
+	loginThrottler LoginThrottler,
+	breachChecker BreachChecker,
+	secretCipher SecretCipher,
+	mailer Mailer,
+	pictureStore PictureStore,
 	tokenTTL time.Duration,
+	refreshTokenTTL time.Duration,
+	emailVerificationTTL time.Duration,
+	passwordResetTTL time.Duration,
+	emailChangeUndoTTL time.Duration,
+	mfaChallengeTTL time.Duration,
+	passkeyChallengeTTL time.Duration,
+	totpIssuer string,
+	relyingParty webauthn.RelyingParty,
+	links Links,
+	passwordPolicies password.Policies,
 ) *Auth {
 	return &Auth{
-		userSaver:    userSaver,
-		userProvider: userProvider,
-		appProvider:  appProvider,
-		userFinder:   userFinder,
-		log:          log,
-		tokenTTL:     tokenTTL,
+		userSaver:            userSaver,
+		userProvider:         userProvider,
+		appProvider:          appProvider,
+		userFinder:           userFinder,
+		refreshTokenProvider: refreshTokenProvider,
+		keyProvider:          keyProvider,
+		tokenRevoker:         tokenRevoker,
+		emailVerifier:        emailVerifier,
+		passwordResetter:     passwordResetter,
+		credentialChanger:    credentialChanger,
+		accountManager:       accountManager,
+		mfaStorage:           mfaStorage,
+		roleStorage:          roleStorage,
+		orgStorage:           orgStorage,
+		groupStorage:         groupStorage,
+		groupResolver:        groupResolver,
+		loginThrottler:       loginThrottler,
+		breachChecker:        breachChecker,
+		secretCipher:         secretCipher,
+		mailer:               mailer,
+		pictureStore:         pictureStore,
+		log:                  log,
+		tokenTTL:             tokenTTL,
+		refreshTokenTTL:      refreshTokenTTL,
+		emailVerificationTTL: emailVerificationTTL,
+		passwordResetTTL:     passwordResetTTL,
+		emailChangeUndoTTL:   emailChangeUndoTTL,
+		mfaChallengeTTL:      mfaChallengeTTL,
+		passkeyChallengeTTL:  passkeyChallengeTTL,
+		totpIssuer:           totpIssuer,
+		relyingParty:         relyingParty,
+		links:                links,
+		passwordPolicies:     passwordPolicies,
 	}
 }
 
-func (a *Auth) Login(ctx context.Context, email, password string, appID int64) (string, error) {
+// Login checks the user's password. Users with a second factor get an MFA
+// challenge to pass to VerifyMFA instead of tokens. A non-zero orgID signs
+// the user in to that organization, which they must be a member of.
+func (a *Auth) Login(ctx context.Context, email, password string, appID, orgID int64) (models.LoginResult, error) {
 	const op = "auth.Login"
 	log := a.log.With(
 		slog.String("op", op),
 		slog.String("email", email),
 	)
 	log.Info("attempting new user")
+	user, err := a.VerifyCredentials(ctx, email, password)
+	if err != nil {
+		return models.LoginResult{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	methods, err := a.mfaMethods(ctx, user.ID)
+	if err != nil {
+		return models.LoginResult{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if len(methods) > 0 {
+		challenge, err := a.newMFAChallenge(ctx, user, appID, orgID)
+		if err != nil {
+			return models.LoginResult{}, fmt.Errorf("%s: %w", op, err)
+		}
+		log.Info("second factor required")
+
+		return models.LoginResult{MFAToken: challenge, MFAMethods: methods}, nil
+	}
+
+	tokens, err := a.IssueTokens(ctx, user, appID, orgID)
+	if err != nil {
+		return models.LoginResult{}, fmt.Errorf("%s: %w", op, err)
+	}
+	log.Info("user logged in successfully")
+
+	return models.LoginResult{Tokens: tokens}, nil
+}
+
+// VerifyCredentials returns the user with the given email if the password
+// matches, and ErrInvalidCredentials otherwise. After too many failures for
+// the account or from the client's address it returns a
+// *LoginThrottledError without checking the password. Users whose password
+// has turned up in a breach get ErrPasswordResetRequired.
+func (a *Auth) VerifyCredentials(ctx context.Context, email, password string) (models.User, error) {
+	const op = "auth.VerifyCredentials"
+
+	ip := clientinfo.FromContext(ctx).IP
+	wait, err := a.loginThrottler.Wait(ctx, email, ip)
+	if err != nil {
+		return models.User{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if wait > 0 {
+		a.log.Warn("login throttled", slog.String("email", email), slog.String("ip", ip), slog.Duration("retry_after", wait))
+		return models.User{}, fmt.Errorf("%s: %w", op, &LoginThrottledError{RetryAfter: wait})
+	}
+
 	user, err := a.userProvider.User(ctx, email)
 	if err != nil {
 		if errors.Is(err, storage.ErrUserNotFound) {
 			a.log.Warn("user not found", sl.Err(err))
-			return "", fmt.Errorf("%s: %w", op, ErrInvalidCredentials)
+			a.loginFailed(ctx, email, ip)
+			return models.User{}, fmt.Errorf("%s: %w", op, ErrInvalidCredentials)
 		}
 		a.log.Error("failed to get user:", sl.Err(err))
 
-		return "", fmt.Errorf("%s: %w", op, err)
+		return models.User{}, fmt.Errorf("%s: %w", op, err)
 	}
 	if err := bcrypt.CompareHashAndPassword(user.HashPassword, []byte(password)); err != nil {
 		a.log.Info("invalid credentials", sl.Err(err))
-		return "", fmt.Errorf("%s: %w", op, ErrInvalidCredentials)
+		a.loginFailed(ctx, email, ip)
+		return models.User{}, fmt.Errorf("%s: %w", op, ErrInvalidCredentials)
 	}
+
+	if err := a.loginThrottler.Reset(ctx, email); err != nil {
+		a.log.Error("failed to reset login failures", sl.Err(err))
+	}
+	if err := a.checkPasswordReset(ctx, user, password); err != nil {
+		return models.User{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return user, nil
+}
+
+// IssueTokens starts a new login session for the user in the app and
+// returns its first access/refresh token pair. Apps that require a verified
+// email get ErrEmailNotVerified for unverified users. The tokens are for the
+// app's organization or else for orgID, if not zero; users who are not
+// members get ErrNotOrgMember.
+func (a *Auth) IssueTokens(ctx context.Context, user models.User, appID, orgID int64) (models.TokenPair, error) {
+	const op = "auth.IssueTokens"
+
 	app, err := a.appProvider.App(ctx, appID)
 	if err != nil {
-		return "", fmt.Errorf("%s: %w", op, err)
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if app.RequireVerifiedEmail && !user.EmailVerified {
+		a.log.Info("unverified user denied tokens", slog.String("user_id", user.ID.String()), slog.Int("app_id", app.ID))
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, ErrEmailNotVerified)
+	}
+	membership, err := a.orgFor(ctx, user.ID, app, orgID)
+	if err != nil {
+		if errors.Is(err, ErrNotOrgMember) {
+			a.log.Info("non-member denied tokens", slog.String("user_id", user.ID.String()), slog.Int("app_id", app.ID))
+		}
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, err)
 	}
-	log.Info("user logged in successfully")
 
-	token, err := jwt.NewToken(user, app, a.tokenTTL)
+	tokens, err := a.issueTokens(ctx, user, app, membership)
 	if err != nil {
-		a.log.Error("failed to generate token", sl.Err(err))
+		a.log.Error("failed to generate tokens", sl.Err(err))
 
-		return "", fmt.Errorf("%s: %w", op, err)
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, err)
 	}
 
-	return token, nil
-
+	return tokens, nil
 }
 
-func (a *Auth) RegisterNewUser(ctx context.Context, email, password string) (string, error) {
+// RegisterNewUser creates an account. The password has to satisfy the
+// password policy of the app the user registers through, or the default
+// policy if appID is zero.
+func (a *Auth) RegisterNewUser(ctx context.Context, email, password string, appID int64) (string, error) {
 	const op = "auth.RegisterNewUser"
 	log := a.log.With(
 		slog.String("op", op),
 		slog.String("email", email),
 	)
 	log.Info("registerin new user")
+	if err := a.validatePassword(ctx, appID, password, email); err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
 	hashedPass, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
 		log.Error("failed to generate password hash")
@@ -125,6 +434,16 @@ func (a *Auth) RegisterNewUser(ctx context.Context, email, password string) (str
 	}
 	log.Info("user registered")
 
+	uid, err := uuid.Parse(id)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+	// The account exists now; a lost email can be sent again with
+	// ResendVerification.
+	if err := a.sendVerification(ctx, uid, email); err != nil {
+		log.Error("failed to send verification email", sl.Err(err))
+	}
+
 	return id, nil
 }
 
@@ -148,7 +467,9 @@ func (a *Auth) IsAdmin(ctx context.Context, userID string) (bool, error) {
 	return isAdmin, nil
 }
 
-func (a *Auth) FindUser(ctx context.Context, userID string) (models.UserAccount, error) {
+// FindUser looks a user up by id. A non-zero orgID only finds members of
+// that organization.
+func (a *Auth) FindUser(ctx context.Context, userID string, orgID int64) (models.UserAccount, error) {
 	const op = "Auth.Find"
 
 	log := a.log.With(
@@ -161,7 +482,7 @@ func (a *Auth) FindUser(ctx context.Context, userID string) (models.UserAccount,
 	if err != nil {
 		return models.UserAccount{}, fmt.Errorf("%s: %w", op, err)
 	}
-	userAccount, err := a.userFinder.UserAccountById(ctx, uuID)
+	userAccount, err := a.userFinder.UserAccountById(ctx, uuID, orgID)
 	if err != nil {
 		return models.UserAccount{}, fmt.Errorf("%s: %w", op, err)
 	}
@@ -0,0 +1,153 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/Novochenko/sso/internal/lib/backupcode"
+	"github.com/Novochenko/sso/internal/lib/jwt"
+	"github.com/Novochenko/sso/internal/lib/logger/sl"
+	"github.com/Novochenko/sso/internal/lib/mail"
+	"github.com/Novochenko/sso/internal/storage"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const backupCodeCount = 10
+
+var ErrInvalidBackupCode = errors.New("invalid backup code")
+
+// GenerateBackupCodes replaces the user's backup codes with a new set after
+// checking their password. The codes are only ever returned here.
+func (a *Auth) GenerateBackupCodes(ctx context.Context, claims jwt.Claims, password string) ([]string, error) {
+	const op = "auth.GenerateBackupCodes"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.String("user_id", claims.UserID.String()),
+	)
+
+	user, err := a.reauthenticate(ctx, claims.UserID, password)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	codes, err := backupcode.Generate(backupCodeCount)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	hashes := make([]string, 0, len(codes))
+	for _, code := range codes {
+		hashes = append(hashes, backupcode.Hash(code))
+	}
+
+	if err := a.mfaStorage.ReplaceBackupCodes(ctx, user.ID, hashes, time.Now()); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("backup codes generated")
+
+	return codes, nil
+}
+
+// RecoverAccount lets a user who lost their password back in: a backup code
+// stands in for the password reset email. Every session of the user is
+// revoked, as with ResetPassword.
+func (a *Auth) RecoverAccount(ctx context.Context, email, code, newPassword string, appID int64) error {
+	const op = "auth.RecoverAccount"
+
+	log := a.log.With(slog.String("op", op))
+
+	// Only the email is checked, so that the policy does not tell whether
+	// the account exists.
+	if err := a.validatePassword(ctx, appID, newPassword, email); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if !backupcode.Valid(code) {
+		return fmt.Errorf("%s: %w", op, ErrInvalidBackupCode)
+	}
+
+	user, err := a.userProvider.User(ctx, email)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			log.Info("account recovery for unknown email")
+			return fmt.Errorf("%s: %w", op, ErrInvalidBackupCode)
+		}
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log = log.With(slog.String("user_id", user.ID.String()))
+
+	if err := a.useBackupCode(ctx, user.ID, code); err != nil {
+		if errors.Is(err, ErrInvalidMFACode) {
+			return fmt.Errorf("%s: %w", op, ErrInvalidBackupCode)
+		}
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	passHash, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	if err != nil {
+		log.Error("failed to generate password hash", sl.Err(err))
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if err := a.credentialChanger.UpdatePassword(ctx, user.ID, passHash); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := a.tokenRevoker.RevokeUser(ctx, user.ID); err != nil {
+		log.Error("failed to revoke sessions after account recovery", sl.Err(err))
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("account recovered with backup code")
+
+	return nil
+}
+
+// useBackupCode consumes code and tells the user about it by email, so a
+// stolen code does not go unnoticed. Unknown and spent codes are
+// ErrInvalidMFACode.
+func (a *Auth) useBackupCode(ctx context.Context, userID uuid.UUID, code string) error {
+	remaining, err := a.mfaStorage.UseBackupCode(ctx, userID, backupcode.Hash(code), time.Now())
+	if err != nil {
+		if errors.Is(err, storage.ErrBackupCodeNotFound) {
+			a.log.Info("invalid backup code", slog.String("user_id", userID.String()))
+			return ErrInvalidMFACode
+		}
+
+		return err
+	}
+
+	a.log.Info("backup code used", slog.String("user_id", userID.String()), slog.Int("remaining", remaining))
+
+	go func() {
+		ctx := context.WithoutCancel(ctx)
+		if err := a.sendBackupCodeUsed(ctx, userID, remaining); err != nil {
+			a.log.Error("failed to send backup code notification", slog.String("user_id", userID.String()), sl.Err(err))
+		}
+	}()
+
+	return nil
+}
+
+func (a *Auth) sendBackupCodeUsed(ctx context.Context, userID uuid.UUID, remaining int) error {
+	user, err := a.userProvider.UserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	return a.mailer.Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "A backup code was used",
+		Body: "One of the backup codes of your account was just used to sign in.\n\n" +
+			fmt.Sprintf("You have %d unused backup codes left. ", remaining) +
+			"If it was not you, change your password and generate new backup codes right away.\n",
+	})
+}
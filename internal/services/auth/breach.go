@@ -0,0 +1,88 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/Novochenko/sso/domain/models"
+	"github.com/Novochenko/sso/internal/lib/logger/sl"
+	"github.com/Novochenko/sso/internal/lib/mail"
+	"github.com/Novochenko/sso/internal/lib/password"
+)
+
+var (
+	ErrPasswordResetRequired = errors.New("password must be reset")
+)
+
+// BreachChecker tells whether a password appears in known breach dumps.
+type BreachChecker interface {
+	Breached(ctx context.Context, password string) (bool, error)
+}
+
+var breachedViolation = password.Violation{
+	Rule:    password.RuleBreached,
+	Message: "has appeared in a data breach",
+}
+
+// breached reports whether the password is known from a breach. Lookup
+// errors count as not breached, so that an unreachable range API does not
+// keep users out.
+func (a *Auth) breached(ctx context.Context, password string) bool {
+	breached, err := a.breachChecker.Breached(ctx, password)
+	if err != nil {
+		a.log.Error("failed to check password against breaches", sl.Err(err))
+		return false
+	}
+
+	return breached
+}
+
+// checkPasswordReset runs once the user's password has been verified. If the
+// password turned up in a breach the account is flagged, its sessions are
+// revoked and the user is mailed a reset link; until they pick a new
+// password they get ErrPasswordResetRequired.
+func (a *Auth) checkPasswordReset(ctx context.Context, user models.User, password string) error {
+	if user.PasswordResetRequired {
+		return ErrPasswordResetRequired
+	}
+	if !a.breached(ctx, password) {
+		return nil
+	}
+
+	log := a.log.With(slog.String("user_id", user.ID.String()))
+
+	if err := a.passwordResetter.RequirePasswordReset(ctx, user.ID); err != nil {
+		return err
+	}
+	if err := a.tokenRevoker.RevokeUser(ctx, user.ID); err != nil {
+		log.Error("failed to revoke sessions of breached account", sl.Err(err))
+	}
+	log.Warn("breached password, reset required")
+
+	go func() {
+		ctx := context.WithoutCancel(ctx)
+		if err := a.sendBreachedPasswordReset(ctx, user); err != nil {
+			log.Error("failed to send breached password email", sl.Err(err))
+		}
+	}()
+
+	return ErrPasswordResetRequired
+}
+
+func (a *Auth) sendBreachedPasswordReset(ctx context.Context, user models.User) error {
+	link, err := a.passwordResetLink(ctx, user)
+	if err != nil {
+		return err
+	}
+
+	return a.mailer.Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "Choose a new password",
+		Body: "The password of your account has appeared in a data breach on another site, so it can no longer be used to sign in. " +
+			"To choose a new password, open the link below.\n\n" +
+			link + "\n\n" +
+			fmt.Sprintf("The link expires in %s. You can ask for a new one from the sign-in page.\n", a.passwordResetTTL),
+	})
+}
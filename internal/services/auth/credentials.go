@@ -0,0 +1,235 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"time"
+
+	"github.com/Novochenko/sso/domain/models"
+	"github.com/Novochenko/sso/internal/lib/clientinfo"
+	"github.com/Novochenko/sso/internal/lib/jwt"
+	"github.com/Novochenko/sso/internal/lib/logger/sl"
+	"github.com/Novochenko/sso/internal/lib/mail"
+	"github.com/Novochenko/sso/internal/lib/opaque"
+	"github.com/Novochenko/sso/internal/storage"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrEmailUnchanged          = errors.New("new email is the current email")
+	ErrInvalidEmailChangeToken = errors.New("invalid email change token")
+)
+
+// ChangePassword sets a new password after checking the current one. Every
+// session of the user is revoked and a fresh token pair is returned for the
+// session the change was made from.
+func (a *Auth) ChangePassword(ctx context.Context, claims jwt.Claims, currentPassword, newPassword string) (models.TokenPair, error) {
+	const op = "auth.ChangePassword"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.String("user_id", claims.UserID.String()),
+	)
+
+	user, err := a.reauthenticate(ctx, claims.UserID, currentPassword)
+	if err != nil {
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, err)
+	}
+	personalInfo, err := a.personalInfo(ctx, user)
+	if err != nil {
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if err := a.validatePassword(ctx, int64(claims.AppID), newPassword, personalInfo...); err != nil {
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	passHash, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	if err != nil {
+		log.Error("failed to generate password hash", sl.Err(err))
+
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if err := a.credentialChanger.UpdatePassword(ctx, user.ID, passHash); err != nil {
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := a.tokenRevoker.RevokeUser(ctx, user.ID); err != nil {
+		log.Error("failed to revoke sessions after password change", sl.Err(err))
+
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	tokens, err := a.IssueTokens(ctx, user, int64(claims.AppID), claims.OrgID)
+	if err != nil {
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("password changed")
+
+	return tokens, nil
+}
+
+// ChangeEmail starts an email change after checking the password. The new
+// address gets a confirmation link; the old one is told about the change and
+// gets a link to undo it.
+func (a *Auth) ChangeEmail(ctx context.Context, claims jwt.Claims, password, newEmail string) error {
+	const op = "auth.ChangeEmail"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.String("user_id", claims.UserID.String()),
+	)
+
+	user, err := a.reauthenticate(ctx, claims.UserID, password)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if newEmail == user.Email {
+		return fmt.Errorf("%s: %w", op, ErrEmailUnchanged)
+	}
+	if _, err := a.userProvider.User(ctx, newEmail); err == nil {
+		return fmt.Errorf("%s: %w", op, storage.ErrUserExists)
+	} else if !errors.Is(err, storage.ErrUserNotFound) {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	confirmToken, err := opaque.New()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	undoToken, err := opaque.New()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	now := time.Now()
+	err = a.credentialChanger.SaveEmailChange(ctx, models.EmailChange{
+		ID:               uuid.New(),
+		UserID:           user.ID,
+		OldEmail:         user.Email,
+		NewEmail:         newEmail,
+		ConfirmTokenHash: opaque.Hash(confirmToken),
+		UndoTokenHash:    opaque.Hash(undoToken),
+		ConfirmExpiresAt: now.Add(a.emailVerificationTTL),
+		UndoExpiresAt:    now.Add(a.emailChangeUndoTTL),
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = a.mailer.Send(ctx, mail.Message{
+		To:      newEmail,
+		Subject: "Confirm your new email address",
+		Body: "Please confirm your new email address by opening the link below.\n\n" +
+			a.links.ConfirmEmailChange + "?" + url.Values{"token": {confirmToken}}.Encode() + "\n\n" +
+			"If you did not ask for this change, you can ignore this email.\n",
+	})
+	if err != nil {
+		log.Error("failed to send email change confirmation", sl.Err(err))
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = a.mailer.Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "Your email address is being changed",
+		Body: fmt.Sprintf("Someone asked to change the email address of your account to %s.\n\n", newEmail) +
+			"If this was not you, open the link below to keep your current address and sign out everywhere.\n\n" +
+			a.links.UndoEmailChange + "?" + url.Values{"token": {undoToken}}.Encode() + "\n",
+	})
+	if err != nil {
+		log.Error("failed to send email change notification", sl.Err(err))
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("email change requested")
+
+	return nil
+}
+
+// ConfirmEmailChange applies an email change with the token mailed to the
+// new address.
+func (a *Auth) ConfirmEmailChange(ctx context.Context, token string) error {
+	const op = "auth.ConfirmEmailChange"
+
+	change, err := a.credentialChanger.ConfirmEmailChange(ctx, opaque.Hash(token))
+	if err != nil {
+		if errors.Is(err, storage.ErrEmailChangeNotFound) {
+			return fmt.Errorf("%s: %w", op, ErrInvalidEmailChangeToken)
+		}
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	a.log.Info("email changed", slog.String("op", op), slog.String("user_id", change.UserID.String()))
+
+	return nil
+}
+
+// UndoEmailChange cancels an email change with the token mailed to the old
+// address and, since the account may be compromised, revokes every session.
+func (a *Auth) UndoEmailChange(ctx context.Context, token string) error {
+	const op = "auth.UndoEmailChange"
+
+	log := a.log.With(slog.String("op", op))
+
+	change, err := a.credentialChanger.UndoEmailChange(ctx, opaque.Hash(token))
+	if err != nil {
+		if errors.Is(err, storage.ErrEmailChangeNotFound) {
+			return fmt.Errorf("%s: %w", op, ErrInvalidEmailChangeToken)
+		}
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log = log.With(slog.String("user_id", change.UserID.String()))
+
+	if err := a.tokenRevoker.RevokeUser(ctx, change.UserID); err != nil {
+		log.Error("failed to revoke sessions after undoing email change", sl.Err(err))
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("email change undone")
+
+	return nil
+}
+
+// reauthenticate checks the password of a signed-in user before a
+// sensitive change. Wrong passwords count towards the same backoff and
+// lockout as failed logins.
+func (a *Auth) reauthenticate(ctx context.Context, userID uuid.UUID, password string) (models.User, error) {
+	user, err := a.userProvider.UserByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return models.User{}, ErrInvalidCredentials
+		}
+
+		return models.User{}, err
+	}
+
+	ip := clientinfo.FromContext(ctx).IP
+	wait, err := a.loginThrottler.Wait(ctx, user.Email, ip)
+	if err != nil {
+		return models.User{}, err
+	}
+	if wait > 0 {
+		a.log.Warn("re-authentication throttled", slog.String("user_id", userID.String()), slog.String("ip", ip), slog.Duration("retry_after", wait))
+		return models.User{}, &LoginThrottledError{RetryAfter: wait}
+	}
+	if err := bcrypt.CompareHashAndPassword(user.HashPassword, []byte(password)); err != nil {
+		a.log.Info("re-authentication failed", slog.String("user_id", userID.String()))
+		a.loginFailed(ctx, user.Email, ip)
+		return models.User{}, ErrInvalidCredentials
+	}
+	if err := a.loginThrottler.Reset(ctx, user.Email); err != nil {
+		a.log.Error("failed to reset login failures", sl.Err(err))
+	}
+
+	return user, nil
+}
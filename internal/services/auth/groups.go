@@ -0,0 +1,274 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+
+	"github.com/Novochenko/sso/domain/models"
+	"github.com/Novochenko/sso/internal/storage"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrInvalidGroupName = errors.New("invalid group name")
+	// ErrGroupScope means a group was linked to a group, user or role of
+	// another organization.
+	ErrGroupScope = errors.New("belongs to another organization")
+)
+
+var groupNameRe = regexp.MustCompile(`^[a-z0-9][a-z0-9_.-]{0,63}$`)
+
+// CreateGroup adds a group to the organization, or one outside of any
+// organization for orgID 0.
+func (a *Auth) CreateGroup(ctx context.Context, orgID int64, name, description string) (models.Group, error) {
+	const op = "auth.CreateGroup"
+
+	if err := validateGroup(name, description); err != nil {
+		return models.Group{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if orgID != 0 {
+		if _, err := a.orgStorage.Organization(ctx, orgID); err != nil {
+			return models.Group{}, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	id, err := a.groupStorage.SaveGroup(ctx, models.Group{OrgID: orgID, Name: name, Description: description})
+	if err != nil {
+		return models.Group{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	a.log.Info("group created", slog.String("op", op), slog.Int64("group_id", id), slog.Int64("org_id", orgID))
+
+	return a.groupStorage.Group(ctx, id)
+}
+
+// Group returns the group and its direct members.
+func (a *Auth) Group(ctx context.Context, id int64) (models.Group, models.GroupMembers, error) {
+	const op = "auth.Group"
+
+	group, err := a.groupStorage.Group(ctx, id)
+	if err != nil {
+		return models.Group{}, models.GroupMembers{}, fmt.Errorf("%s: %w", op, err)
+	}
+	members, err := a.groupStorage.GroupMembers(ctx, id)
+	if err != nil {
+		return models.Group{}, models.GroupMembers{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return group, members, nil
+}
+
+// UpdateGroup renames the group and replaces its description.
+func (a *Auth) UpdateGroup(ctx context.Context, id int64, name, description string) (models.Group, error) {
+	const op = "auth.UpdateGroup"
+
+	if err := validateGroup(name, description); err != nil {
+		return models.Group{}, fmt.Errorf("%s: %w", op, err)
+	}
+	group, err := a.groupStorage.Group(ctx, id)
+	if err != nil {
+		return models.Group{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	group.Name, group.Description = name, description
+	if err := a.groupStorage.UpdateGroup(ctx, group); err != nil {
+		return models.Group{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return group, nil
+}
+
+// DeleteGroup removes the group. Its members lose the roles they held
+// through it at their next token refresh.
+func (a *Auth) DeleteGroup(ctx context.Context, id int64) error {
+	const op = "auth.DeleteGroup"
+
+	if err := a.groupResolver.DeleteGroup(ctx, id); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	a.log.Info("group deleted", slog.String("op", op), slog.Int64("group_id", id))
+
+	return nil
+}
+
+// AddGroupMember puts the user in the group. Groups of an organization only
+// take its members.
+func (a *Auth) AddGroupMember(ctx context.Context, groupID int64, userID uuid.UUID) error {
+	const op = "auth.AddGroupMember"
+
+	group, err := a.groupStorage.Group(ctx, groupID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if _, err := a.userProvider.UserByID(ctx, userID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if group.OrgID != 0 {
+		if _, err := a.orgStorage.OrgMembership(ctx, group.OrgID, userID); err != nil {
+			if errors.Is(err, storage.ErrMembershipNotFound) {
+				return fmt.Errorf("%s: %w", op, ErrNotOrgMember)
+			}
+
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	if err := a.groupStorage.AddGroupMember(ctx, groupID, userID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	a.log.Info("group member added",
+		slog.String("op", op),
+		slog.Int64("group_id", groupID),
+		slog.String("user_id", userID.String()),
+	)
+
+	return nil
+}
+
+func (a *Auth) RemoveGroupMember(ctx context.Context, groupID int64, userID uuid.UUID) error {
+	const op = "auth.RemoveGroupMember"
+
+	if err := a.groupStorage.RemoveGroupMember(ctx, groupID, userID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	a.log.Info("group member removed",
+		slog.String("op", op),
+		slog.Int64("group_id", groupID),
+		slog.String("user_id", userID.String()),
+	)
+
+	return nil
+}
+
+// AddSubgroup makes the members of childID members of parentID, at any
+// depth. Both groups must be in the same organization, and the edge may not
+// close a cycle.
+func (a *Auth) AddSubgroup(ctx context.Context, parentID, childID int64) error {
+	const op = "auth.AddSubgroup"
+
+	parent, err := a.groupStorage.Group(ctx, parentID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	child, err := a.groupStorage.Group(ctx, childID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if parent.OrgID != child.OrgID {
+		return fmt.Errorf("%s: %w", op, ErrGroupScope)
+	}
+
+	if err := a.groupResolver.AddSubgroup(ctx, parentID, childID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	a.log.Info("subgroup added", slog.String("op", op), slog.Int64("group_id", parentID), slog.Int64("child_id", childID))
+
+	return nil
+}
+
+func (a *Auth) RemoveSubgroup(ctx context.Context, parentID, childID int64) error {
+	const op = "auth.RemoveSubgroup"
+
+	if err := a.groupResolver.RemoveSubgroup(ctx, parentID, childID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	a.log.Info("subgroup removed", slog.String("op", op), slog.Int64("group_id", parentID), slog.Int64("child_id", childID))
+
+	return nil
+}
+
+// GrantGroupRole gives the role to the group and so to all of its members,
+// those of its subgroups included. Groups of an organization may hold global
+// roles and those of apps open to every user or of their own organization.
+func (a *Auth) GrantGroupRole(ctx context.Context, groupID, roleID int64) error {
+	const op = "auth.GrantGroupRole"
+
+	group, err := a.groupStorage.Group(ctx, groupID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	role, err := a.roleStorage.Role(ctx, roleID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if role.AppID != 0 {
+		app, err := a.appProvider.App(ctx, role.AppID)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		if app.OrgID != 0 && app.OrgID != group.OrgID {
+			return fmt.Errorf("%s: %w", op, ErrGroupScope)
+		}
+	}
+
+	if err := a.groupStorage.AssignGroupRole(ctx, group.ID, role.ID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	a.log.Info("group role granted", slog.String("op", op), slog.Int64("group_id", groupID), slog.String("role", role.Name))
+
+	return nil
+}
+
+func (a *Auth) RevokeGroupRole(ctx context.Context, groupID, roleID int64) error {
+	const op = "auth.RevokeGroupRole"
+
+	if err := a.groupStorage.UnassignGroupRole(ctx, groupID, roleID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	a.log.Info("group role revoked", slog.String("op", op), slog.Int64("group_id", groupID), slog.Int64("role_id", roleID))
+
+	return nil
+}
+
+// UserGroups lists every group the user belongs to, directly or through
+// subgroups, ordered by name.
+func (a *Auth) UserGroups(ctx context.Context, userID uuid.UUID) ([]models.UserGroup, error) {
+	const op = "auth.UserGroups"
+
+	direct, err := a.groupStorage.UserGroupIDs(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	groups, err := a.groupStorage.GroupsByIDs(ctx, a.groupResolver.Ancestors(direct))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return userGroups(groups, direct), nil
+}
+
+// userGroups marks the groups whose id is in direct as direct ones.
+func userGroups(groups []models.Group, direct []int64) []models.UserGroup {
+	isDirect := make(map[int64]bool, len(direct))
+	for _, id := range direct {
+		isDirect[id] = true
+	}
+
+	res := make([]models.UserGroup, 0, len(groups))
+	for _, group := range groups {
+		res = append(res, models.UserGroup{Group: group, Direct: isDirect[group.ID]})
+	}
+
+	return res
+}
+
+func validateGroup(name, description string) error {
+	if !groupNameRe.MatchString(name) {
+		return ErrInvalidGroupName
+	}
+	if len(description) > maxDescriptionLen {
+		return ErrInvalidDescription
+	}
+
+	return nil
+}
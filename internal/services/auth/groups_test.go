@@ -0,0 +1,30 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Novochenko/sso/domain/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateGroup(t *testing.T) {
+	assert.NoError(t, validateGroup("night-shift", ""))
+	assert.NoError(t, validateGroup("building.7", strings.Repeat("d", maxDescriptionLen)))
+
+	for _, name := range []string{"", "Night shift", "-staff", strings.Repeat("g", 65)} {
+		assert.ErrorIs(t, validateGroup(name, ""), ErrInvalidGroupName, name)
+	}
+	assert.ErrorIs(t, validateGroup("staff", strings.Repeat("d", maxDescriptionLen+1)), ErrInvalidDescription)
+}
+
+func TestUserGroups(t *testing.T) {
+	groups := []models.Group{{ID: 3, Name: "building"}, {ID: 1, Name: "night-shift"}, {ID: 2, Name: "staff"}}
+
+	assert.Equal(t, []models.UserGroup{
+		{Group: groups[0], Direct: false},
+		{Group: groups[1], Direct: true},
+		{Group: groups[2], Direct: false},
+	}, userGroups(groups, []int64{1}))
+	assert.Empty(t, userGroups(nil, nil))
+}
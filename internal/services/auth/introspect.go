@@ -0,0 +1,52 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/Novochenko/sso/internal/lib/jwt"
+	"github.com/Novochenko/sso/internal/storage"
+)
+
+// Introspect reports whether the token is currently active, following
+// RFC 7662: a token is inactive if it is malformed, expired, revoked or if
+// its user or app no longer exist. Errors are only returned when the answer
+// cannot be determined.
+func (a *Auth) Introspect(ctx context.Context, token string) (jwt.Claims, bool, error) {
+	const op = "auth.Introspect"
+
+	log := a.log.With(slog.String("op", op))
+
+	claims, err := a.Authenticate(ctx, token)
+	if err != nil {
+		if errors.Is(err, ErrInvalidToken) {
+			return jwt.Claims{}, false, nil
+		}
+
+		return jwt.Claims{}, false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if !claims.IsClient() {
+		if _, err := a.userProvider.UserByID(ctx, claims.UserID); err != nil {
+			if errors.Is(err, storage.ErrUserNotFound) {
+				log.Info("token of deleted user introspected", slog.String("user_id", claims.UserID.String()))
+				return jwt.Claims{}, false, nil
+			}
+
+			return jwt.Claims{}, false, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	if _, err := a.appProvider.App(ctx, int64(claims.AppID)); err != nil {
+		if errors.Is(err, storage.ErrAppNotFound) {
+			log.Info("token of deleted app introspected", slog.Int("app_id", claims.AppID))
+			return jwt.Claims{}, false, nil
+		}
+
+		return jwt.Claims{}, false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return claims, true, nil
+}
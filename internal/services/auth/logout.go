@@ -0,0 +1,148 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/Novochenko/sso/internal/lib/jwt"
+	"github.com/Novochenko/sso/internal/lib/logger/sl"
+	"github.com/Novochenko/sso/internal/lib/opaque"
+	"github.com/Novochenko/sso/internal/storage"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrInvalidToken = errors.New("invalid token")
+)
+
+// Authenticate verifies an access token and checks that it has not been
+// revoked.
+func (a *Auth) Authenticate(ctx context.Context, token string) (jwt.Claims, error) {
+	const op = "auth.Authenticate"
+
+	claims, err := a.keyProvider.ParseToken(ctx, token)
+	if err != nil {
+		if errors.Is(err, jwt.ErrInvalidToken) {
+			return jwt.Claims{}, fmt.Errorf("%s: %w", op, ErrInvalidToken)
+		}
+
+		return jwt.Claims{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	revoked, err := a.tokenRevoker.IsRevoked(ctx, claims)
+	if err != nil {
+		return jwt.Claims{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if revoked {
+		return jwt.Claims{}, fmt.Errorf("%s: %w", op, ErrInvalidToken)
+	}
+
+	return claims, nil
+}
+
+// AuthenticateSession verifies the token of a browser login session, issued
+// with jwt.PurposeLoginSession, and checks that the user's tokens have not
+// been revoked since. The claims hold only the user and the issue time.
+func (a *Auth) AuthenticateSession(ctx context.Context, token string) (jwt.Claims, error) {
+	const op = "auth.AuthenticateSession"
+
+	jwks, err := a.keyProvider.JWKS(ctx)
+	if err != nil {
+		return jwt.Claims{}, fmt.Errorf("%s: %w", op, err)
+	}
+	session, err := jwt.ParseActionToken(token, jwt.PurposeLoginSession, jwks)
+	if err != nil {
+		return jwt.Claims{}, fmt.Errorf("%s: %w", op, ErrInvalidToken)
+	}
+
+	claims := jwt.Claims{
+		TokenID:   session.ID,
+		UserID:    session.UserID,
+		Email:     session.Email,
+		IssuedAt:  session.IssuedAt,
+		ExpiresAt: session.ExpiresAt,
+	}
+	revoked, err := a.tokenRevoker.IsRevoked(ctx, claims)
+	if err != nil {
+		return jwt.Claims{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if revoked {
+		return jwt.Claims{}, fmt.Errorf("%s: %w", op, ErrInvalidToken)
+	}
+
+	return claims, nil
+}
+
+// Logout revokes the access token and ends its login session. A refresh
+// token, if given, has its session ended too, which also covers tokens
+// issued before sessions were recorded.
+func (a *Auth) Logout(ctx context.Context, claims jwt.Claims, refreshToken string) error {
+	const op = "auth.Logout"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.String("user_id", claims.UserID.String()),
+	)
+
+	if err := a.tokenRevoker.RevokeToken(ctx, claims); err != nil {
+		log.Error("failed to revoke access token", sl.Err(err))
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	sessionID := claims.SessionID
+	if refreshToken != "" {
+		current, err := a.refreshTokenProvider.RefreshToken(ctx, opaque.Hash(refreshToken))
+		if err != nil && !errors.Is(err, storage.ErrRefreshTokenNotFound) {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		// Never let a user revoke someone else's refresh tokens.
+		if err == nil && current.UserID == claims.UserID && current.FamilyID != sessionID {
+			if err := a.tokenRevoker.RevokeSession(ctx, current.FamilyID); err != nil {
+				log.Error("failed to revoke refresh token family", sl.Err(err))
+
+				return fmt.Errorf("%s: %w", op, err)
+			}
+		}
+	}
+	if sessionID != uuid.Nil {
+		if err := a.tokenRevoker.RevokeSession(ctx, sessionID); err != nil {
+			log.Error("failed to revoke session", sl.Err(err))
+
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	log.Info("user logged out")
+
+	return nil
+}
+
+// RevokeTokens invalidates every access and refresh token of the user.
+func (a *Auth) RevokeTokens(ctx context.Context, userID string) error {
+	const op = "auth.RevokeTokens"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.String("user_id", userID),
+	)
+
+	uid, err := uuid.Parse(userID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+	}
+
+	if err := a.tokenRevoker.RevokeUser(ctx, uid); err != nil {
+		if !errors.Is(err, storage.ErrUserNotFound) {
+			log.Error("failed to revoke user tokens", sl.Err(err))
+		}
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("all user tokens revoked")
+
+	return nil
+}
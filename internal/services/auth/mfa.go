@@ -0,0 +1,349 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/Novochenko/sso/domain/models"
+	"github.com/Novochenko/sso/internal/lib/backupcode"
+	"github.com/Novochenko/sso/internal/lib/jwt"
+	"github.com/Novochenko/sso/internal/lib/logger/sl"
+	"github.com/Novochenko/sso/internal/lib/totp"
+	"github.com/Novochenko/sso/internal/storage"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrMFARequired      = errors.New("second factor required")
+	ErrInvalidMFACode   = errors.New("invalid one-time code")
+	ErrInvalidMFAToken  = errors.New("invalid mfa token")
+	ErrTOTPEnabled      = errors.New("totp is already enabled")
+	ErrTOTPNotEnrolling = errors.New("totp enrollment has not been started")
+	ErrPasskeyRequired  = errors.New("second factor must be a passkey")
+)
+
+// maxMFAAttempts is how many wrong codes in a row burn the MFA challenge
+// they were sent with, so that the login has to start over.
+const maxMFAAttempts = 3
+
+// Second factor kinds, as listed in LoginResult.MFAMethods.
+const (
+	MFAMethodTOTP       = "totp"
+	MFAMethodWebAuthn   = "webauthn"
+	MFAMethodBackupCode = "backup_code"
+)
+
+// EnrollTOTP starts setting up an authenticator app for the user. The
+// enrollment takes effect once confirmed with ConfirmTOTP; starting over
+// replaces an unconfirmed secret.
+func (a *Auth) EnrollTOTP(ctx context.Context, claims jwt.Claims) (models.TOTPEnrollment, error) {
+	const op = "auth.EnrollTOTP"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.String("user_id", claims.UserID.String()),
+	)
+
+	user, err := a.userProvider.UserByID(ctx, claims.UserID)
+	if err != nil {
+		return models.TOTPEnrollment{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	secret, err := totp.NewSecret()
+	if err != nil {
+		return models.TOTPEnrollment{}, fmt.Errorf("%s: %w", op, err)
+	}
+	sealed, err := a.secretCipher.Seal([]byte(secret))
+	if err != nil {
+		return models.TOTPEnrollment{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := a.mfaStorage.SaveTOTP(ctx, user.ID, sealed); err != nil {
+		if errors.Is(err, storage.ErrTOTPAlreadyEnabled) {
+			return models.TOTPEnrollment{}, fmt.Errorf("%s: %w", op, ErrTOTPEnabled)
+		}
+
+		return models.TOTPEnrollment{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("totp enrollment started")
+
+	return models.TOTPEnrollment{
+		Secret: secret,
+		URI:    totp.URI(a.totpIssuer, user.Email, secret),
+	}, nil
+}
+
+// ConfirmTOTP enables the pending enrollment once the user proves their app
+// produces the right codes.
+func (a *Auth) ConfirmTOTP(ctx context.Context, claims jwt.Claims, code string) error {
+	const op = "auth.ConfirmTOTP"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.String("user_id", claims.UserID.String()),
+	)
+
+	enrollment, err := a.mfaStorage.TOTP(ctx, claims.UserID)
+	if err != nil {
+		if errors.Is(err, storage.ErrTOTPNotFound) {
+			return fmt.Errorf("%s: %w", op, ErrTOTPNotEnrolling)
+		}
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if enrollment.Enabled() {
+		return fmt.Errorf("%s: %w", op, ErrTOTPEnabled)
+	}
+
+	step, err := a.validateTOTP(enrollment, code)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := a.mfaStorage.ConfirmTOTP(ctx, claims.UserID, step); err != nil {
+		if errors.Is(err, storage.ErrTOTPNotFound) {
+			return fmt.Errorf("%s: %w", op, ErrTOTPEnabled)
+		}
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("totp enabled")
+
+	return nil
+}
+
+// VerifyMFA completes a login that returned an MFA challenge. Each challenge
+// can be completed once, and is burned by maxMFAAttempts wrong codes in a
+// row.
+func (a *Auth) VerifyMFA(ctx context.Context, mfaToken, code string) (models.TokenPair, error) {
+	const op = "auth.VerifyMFA"
+
+	log := a.log.With(slog.String("op", op))
+
+	jwks, err := a.keyProvider.JWKS(ctx)
+	if err != nil {
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, err)
+	}
+	challenge, err := jwt.ParseActionToken(mfaToken, jwt.PurposeMFA, jwks)
+	if err != nil {
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, ErrInvalidMFAToken)
+	}
+
+	log = log.With(slog.String("user_id", challenge.UserID.String()))
+
+	user, err := a.userProvider.UserByID(ctx, challenge.UserID)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return models.TokenPair{}, fmt.Errorf("%s: %w", op, ErrInvalidMFAToken)
+		}
+
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	// A challenge that was completed or burned must not get as far as the
+	// code: checking it uses up the backup code or TOTP step and moves the
+	// failure count.
+	used, err := a.emailVerifier.ActionTokenUsed(ctx, challenge.ID)
+	if err != nil {
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if used {
+		log.Info("mfa challenge reused")
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, ErrInvalidMFAToken)
+	}
+
+	if failures, err := a.verifySecondFactor(ctx, user.ID, code); err != nil {
+		if failures >= maxMFAAttempts {
+			burnErr := a.emailVerifier.UseActionToken(ctx, challenge.ID, challenge.UserID, challenge.Purpose, challenge.ExpiresAt)
+			if burnErr != nil && !errors.Is(burnErr, storage.ErrActionTokenUsed) {
+				log.Error("failed to burn mfa challenge", sl.Err(burnErr))
+			}
+			log.Warn("mfa challenge burned after too many wrong codes", slog.Int("failures", failures))
+		}
+
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = a.emailVerifier.UseActionToken(ctx, challenge.ID, challenge.UserID, challenge.Purpose, challenge.ExpiresAt)
+	if err != nil {
+		if errors.Is(err, storage.ErrActionTokenUsed) {
+			log.Info("mfa challenge reused")
+			return models.TokenPair{}, fmt.Errorf("%s: %w", op, ErrInvalidMFAToken)
+		}
+
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	tokens, err := a.IssueTokens(ctx, user, challenge.AppID, challenge.OrgID)
+	if err != nil {
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("user logged in with second factor")
+
+	return tokens, nil
+}
+
+// VerifySecondFactor checks code against the user's authenticator app or
+// backup codes. Users without a second factor pass; users with an app get
+// ErrMFARequired when code is empty. Users whose only second factor is a
+// passkey get ErrPasskeyRequired unless code is a backup code: they finish
+// with FinishPasskeyLogin instead. After too many wrong codes it returns a
+// *LoginThrottledError without checking the code.
+func (a *Auth) VerifySecondFactor(ctx context.Context, userID uuid.UUID, code string) error {
+	const op = "auth.VerifySecondFactor"
+
+	if _, err := a.verifySecondFactor(ctx, userID, code); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// verifySecondFactor is VerifySecondFactor that also returns how many wrong
+// codes in a row the user has entered when code is wrong.
+func (a *Auth) verifySecondFactor(ctx context.Context, userID uuid.UUID, code string) (int, error) {
+	enrollment, err := a.mfaStorage.TOTP(ctx, userID)
+	if err != nil && !errors.Is(err, storage.ErrTOTPNotFound) {
+		return 0, err
+	}
+	if !enrollment.Enabled() {
+		passkeys, err := a.mfaStorage.WebAuthnCredentials(ctx, userID)
+		if err != nil {
+			return 0, err
+		}
+		if len(passkeys) == 0 {
+			return 0, nil
+		}
+		if !backupcode.Valid(code) {
+			return 0, ErrPasskeyRequired
+		}
+	}
+	if code == "" {
+		return 0, ErrMFARequired
+	}
+
+	wait, err := a.loginThrottler.SecondFactorWait(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+	if wait > 0 {
+		a.log.Warn("second factor throttled", slog.String("user_id", userID.String()), slog.Duration("retry_after", wait))
+		return 0, &LoginThrottledError{RetryAfter: wait}
+	}
+
+	if err := a.checkSecondFactor(ctx, enrollment, userID, code); err != nil {
+		if !errors.Is(err, ErrInvalidMFACode) {
+			return 0, err
+		}
+		failures, countErr := a.loginThrottler.SecondFactorFailure(ctx, userID)
+		if countErr != nil {
+			a.log.Error("failed to count second factor failure", sl.Err(countErr))
+		}
+
+		return failures, err
+	}
+
+	if err := a.loginThrottler.SecondFactorReset(ctx, userID); err != nil {
+		a.log.Error("failed to reset second factor failures", sl.Err(err))
+	}
+
+	return 0, nil
+}
+
+// checkSecondFactor checks code as a backup code or against the user's
+// authenticator app. Wrong codes are ErrInvalidMFACode.
+func (a *Auth) checkSecondFactor(ctx context.Context, enrollment models.TOTP, userID uuid.UUID, code string) error {
+	if backupcode.Valid(code) {
+		return a.useBackupCode(ctx, userID, code)
+	}
+
+	step, err := a.validateTOTP(enrollment, code)
+	if err != nil {
+		return err
+	}
+	if err := a.mfaStorage.UseTOTPStep(ctx, userID, step); err != nil {
+		if errors.Is(err, storage.ErrTOTPStepUsed) {
+			return ErrInvalidMFACode
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+func (a *Auth) validateTOTP(enrollment models.TOTP, code string) (int64, error) {
+	secret, err := a.secretCipher.Open(enrollment.Secret)
+	if err != nil {
+		a.log.Error("failed to open totp secret", slog.String("user_id", enrollment.UserID.String()), sl.Err(err))
+		return 0, err
+	}
+
+	step, ok := totp.Validate(string(secret), code, time.Now())
+	if !ok {
+		return 0, ErrInvalidMFACode
+	}
+
+	return step, nil
+}
+
+// mfaMethods lists the second factors the user has set up.
+func (a *Auth) mfaMethods(ctx context.Context, userID uuid.UUID) ([]string, error) {
+	var methods []string
+
+	enrollment, err := a.mfaStorage.TOTP(ctx, userID)
+	if err != nil && !errors.Is(err, storage.ErrTOTPNotFound) {
+		return nil, err
+	}
+	if enrollment.Enabled() {
+		methods = append(methods, MFAMethodTOTP)
+	}
+
+	passkeys, err := a.mfaStorage.WebAuthnCredentials(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(passkeys) > 0 {
+		methods = append(methods, MFAMethodWebAuthn)
+	}
+
+	// Backup codes stand in for the other factors but do not turn MFA on.
+	if len(methods) > 0 {
+		remaining, err := a.mfaStorage.BackupCodesRemaining(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+		if remaining > 0 {
+			methods = append(methods, MFAMethodBackupCode)
+		}
+	}
+
+	return methods, nil
+}
+
+// newMFAChallenge checks the app and organization up front, so a login for
+// an unknown app or by a non-member fails before the user is asked for a
+// code.
+func (a *Auth) newMFAChallenge(ctx context.Context, user models.User, appID, orgID int64) (string, error) {
+	app, err := a.appProvider.App(ctx, appID)
+	if err != nil {
+		return "", err
+	}
+	membership, err := a.orgFor(ctx, user.ID, app, orgID)
+	if err != nil {
+		return "", err
+	}
+
+	key, err := a.keyProvider.SigningKey(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	return jwt.NewMFAToken(user.ID, user.Email, appID, membership.OrgID, a.mfaChallengeTTL, key)
+}
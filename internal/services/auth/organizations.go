@@ -0,0 +1,223 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+
+	"github.com/Novochenko/sso/domain/models"
+	"github.com/Novochenko/sso/internal/lib/jwt"
+	"github.com/Novochenko/sso/internal/storage"
+	"github.com/google/uuid"
+)
+
+// Roles of organization members. Owners manage everything, admins manage
+// the members below owner, members only belong.
+const (
+	OrgRoleOwner  = "owner"
+	OrgRoleAdmin  = "admin"
+	OrgRoleMember = "member"
+)
+
+const maxOrgNameLen = 128
+
+var (
+	ErrInvalidOrgSlug = errors.New("invalid organization slug")
+	ErrInvalidOrgName = errors.New("invalid organization name")
+	ErrInvalidOrgRole = errors.New("invalid organization role")
+	// ErrNotOrgMember means the user asked for an organization, or an app of
+	// one, they do not belong to.
+	ErrNotOrgMember = errors.New("not a member of the organization")
+	// ErrOrgForbidden means the caller's role in the organization does not
+	// allow the change.
+	ErrOrgForbidden = errors.New("not allowed in the organization")
+)
+
+var orgSlugRe = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{1,63}$`)
+
+// orgFor returns the user's membership in the organization a login for the
+// app is in: the app's own organization or, for apps open to every user,
+// orgID. It is the zero value for logins outside of any organization.
+func (a *Auth) orgFor(ctx context.Context, userID uuid.UUID, app models.App, orgID int64) (models.OrgMembership, error) {
+	if app.OrgID != 0 {
+		if orgID != 0 && orgID != app.OrgID {
+			return models.OrgMembership{}, ErrNotOrgMember
+		}
+		orgID = app.OrgID
+	}
+	if orgID == 0 {
+		return models.OrgMembership{}, nil
+	}
+
+	membership, err := a.orgStorage.OrgMembership(ctx, orgID, userID)
+	if err != nil {
+		if errors.Is(err, storage.ErrMembershipNotFound) {
+			return models.OrgMembership{}, ErrNotOrgMember
+		}
+
+		return models.OrgMembership{}, err
+	}
+
+	return membership, nil
+}
+
+// CreateOrganization creates an organization owned by the caller.
+func (a *Auth) CreateOrganization(ctx context.Context, claims jwt.Claims, slug, name string) (models.Organization, error) {
+	const op = "auth.CreateOrganization"
+
+	name = strings.TrimSpace(name)
+	if !orgSlugRe.MatchString(slug) {
+		return models.Organization{}, fmt.Errorf("%s: %w", op, ErrInvalidOrgSlug)
+	}
+	if name == "" || len(name) > maxOrgNameLen {
+		return models.Organization{}, fmt.Errorf("%s: %w", op, ErrInvalidOrgName)
+	}
+
+	org := models.Organization{Slug: slug, Name: name}
+	id, err := a.orgStorage.SaveOrganization(ctx, org, claims.UserID)
+	if err != nil {
+		return models.Organization{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	a.log.Info("organization created",
+		slog.String("op", op),
+		slog.Int64("org_id", id),
+		slog.String("user_id", claims.UserID.String()),
+	)
+
+	return a.orgStorage.Organization(ctx, id)
+}
+
+// Organizations lists the organizations the caller belongs to.
+func (a *Auth) Organizations(ctx context.Context, claims jwt.Claims) ([]models.UserOrganization, error) {
+	const op = "auth.Organizations"
+
+	orgs, err := a.orgStorage.UserOrganizations(ctx, claims.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return orgs, nil
+}
+
+// OrgMembers lists the members of an organization the caller belongs to.
+func (a *Auth) OrgMembers(ctx context.Context, claims jwt.Claims, orgID int64) ([]models.OrgMembership, error) {
+	const op = "auth.OrgMembers"
+
+	if _, err := a.callerMembership(ctx, claims, orgID); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	members, err := a.orgStorage.OrgMembers(ctx, orgID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return members, nil
+}
+
+// SetOrgMember adds the user to the organization with role, or changes their
+// role if they already belong to it.
+func (a *Auth) SetOrgMember(ctx context.Context, claims jwt.Claims, orgID int64, userID uuid.UUID, role string) error {
+	const op = "auth.SetOrgMember"
+
+	if !validOrgRole(role) {
+		return fmt.Errorf("%s: %w", op, ErrInvalidOrgRole)
+	}
+	caller, err := a.callerMembership(ctx, claims, orgID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if _, err := a.userProvider.UserByID(ctx, userID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	current, err := a.orgStorage.OrgMembership(ctx, orgID, userID)
+	if err != nil && !errors.Is(err, storage.ErrMembershipNotFound) {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if !canManageMember(caller.Role, current.Role, role) {
+		return fmt.Errorf("%s: %w", op, ErrOrgForbidden)
+	}
+
+	membership := models.OrgMembership{OrgID: orgID, UserID: userID, Role: role}
+	if err := a.orgStorage.SaveOrgMembership(ctx, membership); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	a.log.Info("organization member set",
+		slog.String("op", op),
+		slog.Int64("org_id", orgID),
+		slog.String("user_id", userID.String()),
+		slog.String("role", role),
+	)
+
+	return nil
+}
+
+// RemoveOrgMember takes the user out of the organization. Members may always
+// leave; removing others needs a role that can manage them.
+func (a *Auth) RemoveOrgMember(ctx context.Context, claims jwt.Claims, orgID int64, userID uuid.UUID) error {
+	const op = "auth.RemoveOrgMember"
+
+	caller, err := a.callerMembership(ctx, claims, orgID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if userID != claims.UserID {
+		current, err := a.orgStorage.OrgMembership(ctx, orgID, userID)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		if !canManageMember(caller.Role, current.Role, "") {
+			return fmt.Errorf("%s: %w", op, ErrOrgForbidden)
+		}
+	}
+
+	if err := a.orgStorage.DeleteOrgMembership(ctx, orgID, userID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	a.log.Info("organization member removed",
+		slog.String("op", op),
+		slog.Int64("org_id", orgID),
+		slog.String("user_id", userID.String()),
+	)
+
+	return nil
+}
+
+// callerMembership returns the caller's membership in the organization, or
+// ErrNotOrgMember. Unknown organizations look the same as foreign ones.
+func (a *Auth) callerMembership(ctx context.Context, claims jwt.Claims, orgID int64) (models.OrgMembership, error) {
+	membership, err := a.orgStorage.OrgMembership(ctx, orgID, claims.UserID)
+	if err != nil {
+		if errors.Is(err, storage.ErrMembershipNotFound) {
+			return models.OrgMembership{}, ErrNotOrgMember
+		}
+
+		return models.OrgMembership{}, err
+	}
+
+	return membership, nil
+}
+
+func validOrgRole(role string) bool {
+	return role == OrgRoleOwner || role == OrgRoleAdmin || role == OrgRoleMember
+}
+
+// canManageMember reports whether a member with role actor may move another
+// member from role current to role next. An empty current is someone who is
+// not a member yet, an empty next a removal.
+func canManageMember(actor, current, next string) bool {
+	switch actor {
+	case OrgRoleOwner:
+		return true
+	case OrgRoleAdmin:
+		return current != OrgRoleOwner && next != OrgRoleOwner
+	default:
+		return false
+	}
+}
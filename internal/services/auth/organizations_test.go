@@ -0,0 +1,39 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOrgSlugs(t *testing.T) {
+	for _, slug := range []string{"acme", "north-tower-2", strings.Repeat("o", 64)} {
+		assert.True(t, orgSlugRe.MatchString(slug), slug)
+	}
+	for _, slug := range []string{"", "a", "-acme", "Acme", "acme_inc", "acme inc", strings.Repeat("o", 65)} {
+		assert.False(t, orgSlugRe.MatchString(slug), slug)
+	}
+}
+
+func TestCanManageMember(t *testing.T) {
+	tests := []struct {
+		actor, current, next string
+		want                 bool
+	}{
+		{OrgRoleOwner, "", OrgRoleOwner, true},
+		{OrgRoleOwner, OrgRoleOwner, "", true},
+		{OrgRoleAdmin, "", OrgRoleMember, true},
+		{OrgRoleAdmin, OrgRoleMember, OrgRoleAdmin, true},
+		{OrgRoleAdmin, OrgRoleAdmin, "", true},
+		{OrgRoleAdmin, "", OrgRoleOwner, false},
+		{OrgRoleAdmin, OrgRoleOwner, OrgRoleMember, false},
+		{OrgRoleAdmin, OrgRoleOwner, "", false},
+		{OrgRoleMember, "", OrgRoleMember, false},
+		{OrgRoleMember, OrgRoleMember, "", false},
+	}
+	for _, tt := range tests {
+		got := canManageMember(tt.actor, tt.current, tt.next)
+		assert.Equal(t, tt.want, got, "%s: %q -> %q", tt.actor, tt.current, tt.next)
+	}
+}
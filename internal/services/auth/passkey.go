@@ -0,0 +1,346 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Novochenko/sso/domain/models"
+	"github.com/Novochenko/sso/internal/lib/jwt"
+	"github.com/Novochenko/sso/internal/lib/webauthn"
+	"github.com/Novochenko/sso/internal/storage"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultPasskeyName = "Passkey"
+	maxPasskeyNameLen  = 64
+)
+
+var (
+	ErrInvalidPasskeySession = errors.New("invalid passkey session")
+	ErrInvalidPasskey        = errors.New("invalid passkey response")
+	ErrPasskeyExists         = errors.New("passkey already registered")
+	ErrInvalidPasskeyName    = errors.New("invalid passkey name")
+)
+
+// BeginPasskeyRegistration returns the options for navigator.credentials
+// .create() that register a passkey for the user.
+func (a *Auth) BeginPasskeyRegistration(ctx context.Context, claims jwt.Claims) (models.PasskeyChallenge, error) {
+	const op = "auth.BeginPasskeyRegistration"
+
+	user, err := a.userProvider.UserByID(ctx, claims.UserID)
+	if err != nil {
+		return models.PasskeyChallenge{}, fmt.Errorf("%s: %w", op, err)
+	}
+	existing, err := a.mfaStorage.WebAuthnCredentials(ctx, user.ID)
+	if err != nil {
+		return models.PasskeyChallenge{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	challenge, err := webauthn.NewChallenge()
+	if err != nil {
+		return models.PasskeyChallenge{}, fmt.Errorf("%s: %w", op, err)
+	}
+	options := a.relyingParty.CreationOptions(challenge, webauthn.UserEntity{
+		ID:          userHandle(user.ID),
+		Name:        user.Email,
+		DisplayName: user.Email,
+	}, credentialIDs(existing), a.passkeyChallengeTTL)
+
+	passkeyChallenge, err := a.newPasskeyChallenge(
+		ctx, user.ID, user.Email, jwt.PurposePasskeyRegistration, 0, 0, challenge, "", a.passkeyChallengeTTL, options,
+	)
+	if err != nil {
+		return models.PasskeyChallenge{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return passkeyChallenge, nil
+}
+
+// FinishPasskeyRegistration verifies the authenticator's response to the
+// options from BeginPasskeyRegistration and stores the new passkey.
+func (a *Auth) FinishPasskeyRegistration(
+	ctx context.Context,
+	claims jwt.Claims,
+	session string,
+	clientDataJSON []byte,
+	attestationObject []byte,
+	name string,
+) (models.WebAuthnCredential, error) {
+	const op = "auth.FinishPasskeyRegistration"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.String("user_id", claims.UserID.String()),
+	)
+
+	if name == "" {
+		name = defaultPasskeyName
+	}
+	if !utf8.ValidString(name) || utf8.RuneCountInString(name) > maxPasskeyNameLen {
+		return models.WebAuthnCredential{}, fmt.Errorf("%s: %w", op, ErrInvalidPasskeyName)
+	}
+
+	ceremony, err := a.parsePasskeySession(ctx, session, jwt.PurposePasskeyRegistration)
+	if err != nil {
+		return models.WebAuthnCredential{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if ceremony.UserID != claims.UserID {
+		return models.WebAuthnCredential{}, fmt.Errorf("%s: %w", op, ErrInvalidPasskeySession)
+	}
+
+	credential, err := a.relyingParty.VerifyRegistration(ceremony.Challenge, clientDataJSON, attestationObject, false)
+	if err != nil {
+		log.Info("passkey registration rejected", slog.String("reason", err.Error()))
+		return models.WebAuthnCredential{}, fmt.Errorf("%s: %w", op, ErrInvalidPasskey)
+	}
+
+	if err := a.useActionToken(ctx, ceremony, ErrInvalidPasskeySession); err != nil {
+		return models.WebAuthnCredential{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	passkey := models.WebAuthnCredential{
+		ID:                credential.ID,
+		UserID:            claims.UserID,
+		Name:              name,
+		PublicKey:         credential.PublicKey,
+		SignCount:         credential.SignCount,
+		AAGUID:            credential.AAGUID,
+		AttestationFormat: credential.AttestationFormat,
+		CreatedAt:         time.Now(),
+	}
+	if err := a.mfaStorage.SaveWebAuthnCredential(ctx, passkey); err != nil {
+		if errors.Is(err, storage.ErrWebAuthnCredentialExists) {
+			return models.WebAuthnCredential{}, fmt.Errorf("%s: %w", op, ErrPasskeyExists)
+		}
+
+		return models.WebAuthnCredential{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("passkey registered", slog.String("format", passkey.AttestationFormat))
+
+	return passkey, nil
+}
+
+// BeginPasskeyLogin returns the options for navigator.credentials.get() that
+// log a user in to the app and, if orgID is not zero, the organization.
+// Without mfaToken the login is passwordless: any of the user's discoverable
+// passkeys will do, and it must verify the user. With the MFA challenge from
+// Login, the passkey is the second factor and must be one of that user's;
+// the app and organization are the ones the challenge was issued for.
+func (a *Auth) BeginPasskeyLogin(ctx context.Context, appID, orgID int64, mfaToken string) (models.PasskeyChallenge, error) {
+	const op = "auth.BeginPasskeyLogin"
+
+	challenge, err := webauthn.NewChallenge()
+	if err != nil {
+		return models.PasskeyChallenge{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if mfaToken == "" {
+		if _, err := a.appProvider.App(ctx, appID); err != nil {
+			return models.PasskeyChallenge{}, fmt.Errorf("%s: %w", op, err)
+		}
+
+		options := a.relyingParty.RequestOptions(challenge, nil, webauthn.UserVerificationRequired, a.passkeyChallengeTTL)
+		passkeyChallenge, err := a.newPasskeyChallenge(
+			ctx, uuid.Nil, "", jwt.PurposePasskeyLogin, appID, orgID, challenge, "", a.passkeyChallengeTTL, options,
+		)
+		if err != nil {
+			return models.PasskeyChallenge{}, fmt.Errorf("%s: %w", op, err)
+		}
+
+		return passkeyChallenge, nil
+	}
+
+	jwks, err := a.keyProvider.JWKS(ctx)
+	if err != nil {
+		return models.PasskeyChallenge{}, fmt.Errorf("%s: %w", op, err)
+	}
+	mfa, err := jwt.ParseActionToken(mfaToken, jwt.PurposeMFA, jwks)
+	if err != nil {
+		return models.PasskeyChallenge{}, fmt.Errorf("%s: %w", op, ErrInvalidMFAToken)
+	}
+
+	passkeys, err := a.mfaStorage.WebAuthnCredentials(ctx, mfa.UserID)
+	if err != nil {
+		return models.PasskeyChallenge{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if len(passkeys) == 0 {
+		return models.PasskeyChallenge{}, fmt.Errorf("%s: %w", op, ErrInvalidPasskey)
+	}
+
+	// The session lives as long as the MFA challenge it completes, so the
+	// challenge is remembered as used for as long as it could be replayed.
+	ttl := time.Until(mfa.ExpiresAt)
+	options := a.relyingParty.RequestOptions(challenge, credentialIDs(passkeys), webauthn.UserVerificationPreferred, ttl)
+	passkeyChallenge, err := a.newPasskeyChallenge(
+		ctx, mfa.UserID, mfa.Email, jwt.PurposePasskeyLogin, mfa.AppID, mfa.OrgID, challenge, mfa.ID, ttl, options,
+	)
+	if err != nil {
+		return models.PasskeyChallenge{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return passkeyChallenge, nil
+}
+
+// FinishPasskeyLogin verifies the authenticator's assertion for the options
+// from BeginPasskeyLogin and returns tokens for the passkey's owner.
+func (a *Auth) FinishPasskeyLogin(
+	ctx context.Context,
+	session string,
+	credentialID []byte,
+	clientDataJSON []byte,
+	authenticatorData []byte,
+	signature []byte,
+	handle []byte,
+) (models.TokenPair, error) {
+	const op = "auth.FinishPasskeyLogin"
+
+	log := a.log.With(slog.String("op", op))
+
+	ceremony, err := a.parsePasskeySession(ctx, session, jwt.PurposePasskeyLogin)
+	if err != nil {
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, err)
+	}
+	passwordless := ceremony.UserID == uuid.Nil
+
+	passkey, err := a.mfaStorage.WebAuthnCredential(ctx, credentialID)
+	if err != nil {
+		if errors.Is(err, storage.ErrWebAuthnCredentialNotFound) {
+			return models.TokenPair{}, fmt.Errorf("%s: %w", op, ErrInvalidPasskey)
+		}
+
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if !passwordless && passkey.UserID != ceremony.UserID {
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, ErrInvalidPasskey)
+	}
+	if len(handle) > 0 && !bytes.Equal(handle, userHandle(passkey.UserID)) {
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, ErrInvalidPasskey)
+	}
+
+	log = log.With(slog.String("user_id", passkey.UserID.String()))
+
+	signCount, err := a.relyingParty.VerifyAssertion(ceremony.Challenge, webauthn.Credential{
+		ID:        passkey.ID,
+		PublicKey: passkey.PublicKey,
+		SignCount: passkey.SignCount,
+	}, clientDataJSON, authenticatorData, signature, passwordless)
+	if err != nil {
+		if errors.Is(err, webauthn.ErrSignCountRegressed) {
+			log.Warn("passkey signature counter regressed, the authenticator may be cloned")
+		} else {
+			log.Info("passkey assertion rejected", slog.String("reason", err.Error()))
+		}
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, ErrInvalidPasskey)
+	}
+
+	if err := a.useActionToken(ctx, ceremony, ErrInvalidPasskeySession); err != nil {
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if ceremony.MFAID != "" {
+		mfa := jwt.ActionToken{ID: ceremony.MFAID, UserID: ceremony.UserID, Purpose: jwt.PurposeMFA, ExpiresAt: ceremony.ExpiresAt}
+		if err := a.useActionToken(ctx, mfa, ErrInvalidMFAToken); err != nil {
+			return models.TokenPair{}, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	if err := a.mfaStorage.UpdateWebAuthnSignCount(ctx, passkey.ID, signCount, time.Now()); err != nil {
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	user, err := a.userProvider.UserByID(ctx, passkey.UserID)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return models.TokenPair{}, fmt.Errorf("%s: %w", op, ErrInvalidPasskey)
+		}
+
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	tokens, err := a.IssueTokens(ctx, user, ceremony.AppID, ceremony.OrgID)
+	if err != nil {
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("user logged in with passkey", slog.Bool("passwordless", passwordless))
+
+	return tokens, nil
+}
+
+func (a *Auth) newPasskeyChallenge(
+	ctx context.Context,
+	userID uuid.UUID,
+	email string,
+	purpose string,
+	appID int64,
+	orgID int64,
+	challenge []byte,
+	mfaID string,
+	ttl time.Duration,
+	options any,
+) (models.PasskeyChallenge, error) {
+	optionsJSON, err := json.Marshal(options)
+	if err != nil {
+		return models.PasskeyChallenge{}, err
+	}
+
+	key, err := a.keyProvider.SigningKey(ctx)
+	if err != nil {
+		return models.PasskeyChallenge{}, err
+	}
+	session, err := jwt.NewPasskeyToken(userID, email, purpose, appID, orgID, challenge, mfaID, ttl, key)
+	if err != nil {
+		return models.PasskeyChallenge{}, err
+	}
+
+	return models.PasskeyChallenge{OptionsJSON: optionsJSON, Session: session}, nil
+}
+
+func (a *Auth) parsePasskeySession(ctx context.Context, session, purpose string) (jwt.ActionToken, error) {
+	jwks, err := a.keyProvider.JWKS(ctx)
+	if err != nil {
+		return jwt.ActionToken{}, err
+	}
+	ceremony, err := jwt.ParseActionToken(session, purpose, jwks)
+	if err != nil || len(ceremony.Challenge) == 0 {
+		return jwt.ActionToken{}, ErrInvalidPasskeySession
+	}
+
+	return ceremony, nil
+}
+
+// useActionToken marks token used, reporting reuse as invalid.
+func (a *Auth) useActionToken(ctx context.Context, token jwt.ActionToken, invalid error) error {
+	err := a.emailVerifier.UseActionToken(ctx, token.ID, token.UserID, token.Purpose, token.ExpiresAt)
+	if err != nil {
+		if errors.Is(err, storage.ErrActionTokenUsed) {
+			return invalid
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+// userHandle is the WebAuthn user handle of the user, which authenticators
+// return with assertions of discoverable credentials.
+func userHandle(userID uuid.UUID) []byte {
+	return userID[:]
+}
+
+func credentialIDs(passkeys []models.WebAuthnCredential) [][]byte {
+	ids := make([][]byte, 0, len(passkeys))
+	for _, passkey := range passkeys {
+		ids = append(ids, passkey.ID)
+	}
+
+	return ids
+}
@@ -0,0 +1,59 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/Novochenko/sso/domain/models"
+	"github.com/Novochenko/sso/internal/lib/password"
+)
+
+var (
+	ErrWeakPassword = errors.New("password does not meet the policy")
+)
+
+// PasswordPolicyError lists the rules of the password policy a new password
+// breaks. It matches ErrWeakPassword.
+type PasswordPolicyError struct {
+	Violations []password.Violation
+}
+
+func (e *PasswordPolicyError) Error() string {
+	rules := make([]string, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		rules = append(rules, v.Rule)
+	}
+
+	return ErrWeakPassword.Error() + ": " + strings.Join(rules, ", ")
+}
+
+func (e *PasswordPolicyError) Unwrap() error {
+	return ErrWeakPassword
+}
+
+// validatePassword checks a new password against the policy of the app it
+// is set through, or the default policy if appID is zero, and refuses
+// passwords known from breaches.
+func (a *Auth) validatePassword(ctx context.Context, appID int64, newPassword string, personalInfo ...string) error {
+	violations := a.passwordPolicies.For(appID).Check(newPassword, personalInfo...)
+	if a.breached(ctx, newPassword) {
+		violations = append(violations, breachedViolation)
+	}
+	if len(violations) > 0 {
+		return &PasswordPolicyError{Violations: violations}
+	}
+
+	return nil
+}
+
+// personalInfo is what the password policy keeps out of the user's
+// passwords.
+func (a *Auth) personalInfo(ctx context.Context, user models.User) ([]string, error) {
+	account, err := a.userFinder.UserAccountById(ctx, user.ID, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	return []string{user.Email, account.UserName}, nil
+}
@@ -0,0 +1,152 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"time"
+
+	"github.com/Novochenko/sso/domain/models"
+	"github.com/Novochenko/sso/internal/lib/logger/sl"
+	"github.com/Novochenko/sso/internal/lib/mail"
+	"github.com/Novochenko/sso/internal/lib/opaque"
+	"github.com/Novochenko/sso/internal/storage"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrInvalidResetToken = errors.New("invalid password reset token")
+)
+
+// RequestPasswordReset mails a reset token to the user with the given
+// email. It behaves the same whether or not the email is registered, and
+// the email is sent in the background so that response times don't tell
+// either.
+func (a *Auth) RequestPasswordReset(ctx context.Context, email string) error {
+	const op = "auth.RequestPasswordReset"
+
+	log := a.log.With(slog.String("op", op))
+
+	user, err := a.userProvider.User(ctx, email)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			log.Info("password reset requested for unknown email")
+			return nil
+		}
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	go func() {
+		ctx := context.WithoutCancel(ctx)
+		if err := a.sendPasswordReset(ctx, user); err != nil {
+			log.Error("failed to send password reset email", slog.String("user_id", user.ID.String()), sl.Err(err))
+		}
+	}()
+
+	return nil
+}
+
+// ResetPassword sets a new password with a token from RequestPasswordReset
+// and revokes every session of the user. The password has to satisfy the
+// policy of the app, or the default policy if appID is zero.
+func (a *Auth) ResetPassword(ctx context.Context, token, password string, appID int64) error {
+	const op = "auth.ResetPassword"
+
+	log := a.log.With(slog.String("op", op))
+
+	user, err := a.passwordResetUser(ctx, token)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	personalInfo, err := a.personalInfo(ctx, user)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if err := a.validatePassword(ctx, appID, password, personalInfo...); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	passHash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		log.Error("failed to generate password hash", sl.Err(err))
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	userID, err := a.passwordResetter.ResetPassword(ctx, opaque.Hash(token), passHash)
+	if err != nil {
+		if errors.Is(err, storage.ErrPasswordResetTokenNotFound) {
+			log.Info("invalid password reset token")
+			return fmt.Errorf("%s: %w", op, ErrInvalidResetToken)
+		}
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log = log.With(slog.String("user_id", userID.String()))
+
+	if err := a.tokenRevoker.RevokeUser(ctx, userID); err != nil {
+		log.Error("failed to revoke sessions after password reset", sl.Err(err))
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("password reset")
+
+	return nil
+}
+
+func (a *Auth) sendPasswordReset(ctx context.Context, user models.User) error {
+	link, err := a.passwordResetLink(ctx, user)
+	if err != nil {
+		return err
+	}
+
+	return a.mailer.Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: "Someone asked to reset the password of your account. To choose a new password, open the link below.\n\n" +
+			link + "\n\n" +
+			fmt.Sprintf("The link expires in %s. If you did not ask for it, you can ignore this email.\n", a.passwordResetTTL),
+	})
+}
+
+// passwordResetLink issues a reset token for the user and returns the link
+// that takes it.
+func (a *Auth) passwordResetLink(ctx context.Context, user models.User) (string, error) {
+	token, err := opaque.New()
+	if err != nil {
+		return "", err
+	}
+
+	expiresAt := time.Now().Add(a.passwordResetTTL)
+	if err := a.passwordResetter.SavePasswordResetToken(ctx, opaque.Hash(token), user.ID, expiresAt); err != nil {
+		return "", err
+	}
+
+	return a.links.ResetPassword + "?" + url.Values{"token": {token}}.Encode(), nil
+}
+
+// passwordResetUser returns the user a valid reset token was issued to.
+func (a *Auth) passwordResetUser(ctx context.Context, token string) (models.User, error) {
+	userID, err := a.passwordResetter.PasswordResetUser(ctx, opaque.Hash(token))
+	if err != nil {
+		if errors.Is(err, storage.ErrPasswordResetTokenNotFound) {
+			return models.User{}, ErrInvalidResetToken
+		}
+		return models.User{}, err
+	}
+
+	user, err := a.userProvider.UserByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return models.User{}, ErrInvalidResetToken
+		}
+		return models.User{}, err
+	}
+
+	return user, nil
+}
@@ -0,0 +1,113 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+
+	"github.com/Novochenko/sso/domain/models"
+	"github.com/Novochenko/sso/internal/lib/jwt"
+	"github.com/Novochenko/sso/internal/lib/logger/sl"
+	"github.com/google/uuid"
+)
+
+// MaxFindManyUsers caps the number of users a single FindUsers call may ask for.
+const MaxFindManyUsers = 100
+
+var (
+	ErrInvalidUsername = errors.New("invalid username")
+	ErrTooManyUsers    = errors.New("too many users requested")
+)
+
+var usernamePattern = regexp.MustCompile(`^[A-Za-z0-9_]{3,30}$`)
+
+// validateUsername checks that username is 3 to 30 latin letters, digits or
+// underscores.
+func validateUsername(username string) error {
+	if !usernamePattern.MatchString(username) {
+		return ErrInvalidUsername
+	}
+
+	return nil
+}
+
+// UpdateProfile sets the profile of the authenticated user and returns the
+// updated account.
+func (a *Auth) UpdateProfile(ctx context.Context, claims jwt.Claims, username string) (models.UserAccount, error) {
+	const op = "auth.UpdateProfile"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.String("user_id", claims.UserID.String()),
+	)
+
+	if err := validateUsername(username); err != nil {
+		return models.UserAccount{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := a.userFinder.UpdateUsername(ctx, claims.UserID, username); err != nil {
+		log.Warn("failed to update username", sl.Err(err))
+
+		return models.UserAccount{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	account, err := a.userFinder.UserAccountById(ctx, claims.UserID, 0)
+	if err != nil {
+		return models.UserAccount{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("profile updated")
+
+	return account, nil
+}
+
+// FindUserByUsername looks a user up by username. A non-zero orgID only
+// finds members of that organization.
+func (a *Auth) FindUserByUsername(ctx context.Context, username string, orgID int64) (models.UserAccount, error) {
+	const op = "auth.FindUserByUsername"
+
+	if err := validateUsername(username); err != nil {
+		return models.UserAccount{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	account, err := a.userFinder.UserAccountByUsername(ctx, username, orgID)
+	if err != nil {
+		return models.UserAccount{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return account, nil
+}
+
+// FindUsers returns the accounts of the given users. Unknown users, and for a
+// non-zero orgID those outside the organization, are left out of the result;
+// duplicates are looked up once.
+func (a *Auth) FindUsers(ctx context.Context, userIDs []string, orgID int64) ([]models.UserAccount, error) {
+	const op = "auth.FindUsers"
+
+	if len(userIDs) > MaxFindManyUsers {
+		return nil, fmt.Errorf("%s: %w", op, ErrTooManyUsers)
+	}
+
+	seen := make(map[uuid.UUID]struct{}, len(userIDs))
+	ids := make([]uuid.UUID, 0, len(userIDs))
+	for _, userID := range userIDs {
+		id, err := uuid.Parse(userID)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		if _, ok := seen[id]; ok {
+			continue
+		}
+		seen[id] = struct{}{}
+		ids = append(ids, id)
+	}
+
+	accounts, err := a.userFinder.UserAccountsByIDs(ctx, ids, orgID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return accounts, nil
+}
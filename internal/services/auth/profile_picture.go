@@ -0,0 +1,90 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/Novochenko/sso/domain/models"
+	"github.com/Novochenko/sso/internal/lib/jwt"
+	"github.com/Novochenko/sso/internal/lib/logger/sl"
+	"github.com/Novochenko/sso/internal/lib/picture"
+	"github.com/google/uuid"
+)
+
+// MaxProfilePictureBytes caps the size of an uploaded profile picture.
+const MaxProfilePictureBytes = 5 << 20
+
+var (
+	ErrProfilePictureTooLarge = errors.New("profile picture is too large")
+)
+
+// UploadProfilePicture re-encodes data, stores the picture with its
+// thumbnails and then switches the user's profile picture over to it. The
+// previous picture is deleted afterwards, so the account never points at a
+// missing one.
+func (a *Auth) UploadProfilePicture(ctx context.Context, claims jwt.Claims, data []byte) (models.UserAccount, error) {
+	const op = "auth.UploadProfilePicture"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.String("user_id", claims.UserID.String()),
+	)
+
+	if len(data) > MaxProfilePictureBytes {
+		return models.UserAccount{}, fmt.Errorf("%s: %w", op, ErrProfilePictureTooLarge)
+	}
+
+	variants, err := picture.Process(data)
+	if err != nil {
+		return models.UserAccount{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	// Every upload gets a fresh key, so cached copies of the old picture are
+	// never served under the new path.
+	path := "profile-pictures/" + claims.UserID.String() + "/" + uuid.NewString() + ".png"
+
+	stored := make([]string, 0, len(variants))
+	for i, v := range variants {
+		key := path
+		if i > 0 {
+			key = picture.ThumbnailPath(path, v.Size)
+		}
+		if err := a.pictureStore.Put(ctx, key, v.Data, picture.ContentType); err != nil {
+			a.deletePictures(ctx, log, stored...)
+
+			return models.UserAccount{}, fmt.Errorf("%s: %w", op, err)
+		}
+		stored = append(stored, key)
+	}
+
+	oldPath, err := a.userFinder.SetProfilePicturePath(ctx, claims.UserID, path)
+	if err != nil {
+		a.deletePictures(ctx, log, stored...)
+
+		return models.UserAccount{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if oldPath != "" {
+		a.deletePictures(ctx, log, picture.Paths(oldPath)...)
+	}
+
+	account, err := a.userFinder.UserAccountById(ctx, claims.UserID, 0)
+	if err != nil {
+		return models.UserAccount{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("profile picture updated")
+
+	return account, nil
+}
+
+// deletePictures is best effort: a failure only leaves an orphaned blob.
+func (a *Auth) deletePictures(ctx context.Context, log *slog.Logger, keys ...string) {
+	ctx = context.WithoutCancel(ctx)
+	for _, key := range keys {
+		if err := a.pictureStore.Delete(ctx, key); err != nil {
+			log.Warn("failed to delete profile picture", slog.String("key", key), sl.Err(err))
+		}
+	}
+}
@@ -0,0 +1,17 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateUsername(t *testing.T) {
+	for _, username := range []string{"bob", "Alice_1", strings.Repeat("a", 30)} {
+		assert.NoError(t, validateUsername(username), username)
+	}
+	for _, username := range []string{"", "ab", strings.Repeat("a", 31), "with space", "dot.ted", "юзер"} {
+		assert.ErrorIs(t, validateUsername(username), ErrInvalidUsername, username)
+	}
+}
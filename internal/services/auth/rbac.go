@@ -0,0 +1,195 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"slices"
+
+	"github.com/Novochenko/sso/domain/models"
+	"github.com/google/uuid"
+)
+
+// Permissions on the SSO service itself. They are global: they mean the
+// same whatever app a token was issued for.
+const (
+	PermissionRevokeTokens   = "sso.tokens.revoke"
+	PermissionManageRBAC     = "sso.rbac.manage"
+	PermissionManageSessions = "sso.sessions.manage"
+	PermissionUnlockAccounts = "sso.accounts.unlock"
+	PermissionReadUsers      = "sso.users.read"
+)
+
+const maxDescriptionLen = 255
+
+var (
+	ErrInvalidRoleName       = errors.New("invalid role name")
+	ErrInvalidPermissionName = errors.New("invalid permission name")
+	ErrInvalidDescription    = errors.New("description too long")
+	// ErrPermissionScope means a role was granted a permission of another
+	// app.
+	ErrPermissionScope = errors.New("permission belongs to another app")
+)
+
+var (
+	roleNameRe       = regexp.MustCompile(`^[a-z0-9][a-z0-9_.-]{0,63}$`)
+	permissionNameRe = regexp.MustCompile(`^[a-z0-9][a-z0-9_.:-]{0,127}$`)
+)
+
+// CheckPermission reports whether one of the user's roles, their own or
+// those of their groups, grants the permission in the app. Global roles and
+// permissions count in every app.
+func (a *Auth) CheckPermission(ctx context.Context, userID uuid.UUID, appID int64, permission string) (bool, error) {
+	const op = "auth.CheckPermission"
+
+	authz, err := a.authorization(ctx, userID, appID)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return slices.Contains(authz.Permissions, permission), nil
+}
+
+// authorization returns the roles the user holds in the app, directly or
+// through any of their groups, and the permissions those roles grant.
+func (a *Auth) authorization(ctx context.Context, userID uuid.UUID, appID int64) (models.Authorization, error) {
+	direct, err := a.groupStorage.UserGroupIDs(ctx, userID)
+	if err != nil {
+		return models.Authorization{}, err
+	}
+
+	return a.roleStorage.UserAuthorization(ctx, userID, a.groupResolver.Ancestors(direct), appID)
+}
+
+// CreateRole adds a role to the app, or a global one for app 0.
+func (a *Auth) CreateRole(ctx context.Context, appID int64, name, description string) (models.Role, error) {
+	const op = "auth.CreateRole"
+
+	if !roleNameRe.MatchString(name) {
+		return models.Role{}, fmt.Errorf("%s: %w", op, ErrInvalidRoleName)
+	}
+	if len(description) > maxDescriptionLen {
+		return models.Role{}, fmt.Errorf("%s: %w", op, ErrInvalidDescription)
+	}
+	if err := a.checkAppScope(ctx, appID); err != nil {
+		return models.Role{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	role := models.Role{AppID: appID, Name: name, Description: description}
+	id, err := a.roleStorage.SaveRole(ctx, role)
+	if err != nil {
+		return models.Role{}, fmt.Errorf("%s: %w", op, err)
+	}
+	role.ID = id
+
+	a.log.Info("role created", slog.String("op", op), slog.Int64("app_id", appID), slog.String("role", name))
+
+	return role, nil
+}
+
+// CreatePermission adds a permission to the app, or a global one for app 0.
+func (a *Auth) CreatePermission(ctx context.Context, appID int64, name, description string) (models.Permission, error) {
+	const op = "auth.CreatePermission"
+
+	if !permissionNameRe.MatchString(name) {
+		return models.Permission{}, fmt.Errorf("%s: %w", op, ErrInvalidPermissionName)
+	}
+	if len(description) > maxDescriptionLen {
+		return models.Permission{}, fmt.Errorf("%s: %w", op, ErrInvalidDescription)
+	}
+	if err := a.checkAppScope(ctx, appID); err != nil {
+		return models.Permission{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	permission := models.Permission{AppID: appID, Name: name, Description: description}
+	id, err := a.roleStorage.SavePermission(ctx, permission)
+	if err != nil {
+		return models.Permission{}, fmt.Errorf("%s: %w", op, err)
+	}
+	permission.ID = id
+
+	a.log.Info("permission created", slog.String("op", op), slog.Int64("app_id", appID), slog.String("permission", name))
+
+	return permission, nil
+}
+
+// GrantPermission adds the permission to the role. An app's roles may only
+// be granted the app's permissions and global ones.
+func (a *Auth) GrantPermission(ctx context.Context, roleID, permissionID int64) error {
+	const op = "auth.GrantPermission"
+
+	role, err := a.roleStorage.Role(ctx, roleID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	permission, err := a.roleStorage.Permission(ctx, permissionID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if permission.AppID != 0 && permission.AppID != role.AppID {
+		return fmt.Errorf("%s: %w", op, ErrPermissionScope)
+	}
+
+	if err := a.roleStorage.AddRolePermission(ctx, role.ID, permission.ID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	a.log.Info("permission granted", slog.String("op", op), slog.String("role", role.Name), slog.String("permission", permission.Name))
+
+	return nil
+}
+
+func (a *Auth) RevokePermission(ctx context.Context, roleID, permissionID int64) error {
+	const op = "auth.RevokePermission"
+
+	if err := a.roleStorage.RemoveRolePermission(ctx, roleID, permissionID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// AssignRole gives the role to the user. Tokens issued before keep the
+// roles they were issued with until they are refreshed.
+func (a *Auth) AssignRole(ctx context.Context, userID uuid.UUID, roleID int64) error {
+	const op = "auth.AssignRole"
+
+	if _, err := a.userProvider.UserByID(ctx, userID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	role, err := a.roleStorage.Role(ctx, roleID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := a.roleStorage.AssignRole(ctx, userID, role.ID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	a.log.Info("role assigned", slog.String("op", op), slog.String("user_id", userID.String()), slog.String("role", role.Name))
+
+	return nil
+}
+
+func (a *Auth) UnassignRole(ctx context.Context, userID uuid.UUID, roleID int64) error {
+	const op = "auth.UnassignRole"
+
+	if err := a.roleStorage.UnassignRole(ctx, userID, roleID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	a.log.Info("role unassigned", slog.String("op", op), slog.String("user_id", userID.String()), slog.Int64("role_id", roleID))
+
+	return nil
+}
+
+func (a *Auth) checkAppScope(ctx context.Context, appID int64) error {
+	if appID == 0 {
+		return nil
+	}
+	_, err := a.appProvider.App(ctx, appID)
+
+	return err
+}
@@ -0,0 +1,24 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRoleAndPermissionNames(t *testing.T) {
+	for _, name := range []string{"admin", "building-manager", "tenant.v2", strings.Repeat("r", 64)} {
+		assert.True(t, roleNameRe.MatchString(name), name)
+	}
+	for _, name := range []string{"", "Admin", "-admin", "with space", "a:b", strings.Repeat("r", 65)} {
+		assert.False(t, roleNameRe.MatchString(name), name)
+	}
+
+	for _, name := range []string{PermissionRevokeTokens, PermissionManageRBAC, "invoices:read", "a"} {
+		assert.True(t, permissionNameRe.MatchString(name), name)
+	}
+	for _, name := range []string{"", ".read", "Invoices:read", "read all", strings.Repeat("p", 129)} {
+		assert.False(t, permissionNameRe.MatchString(name), name)
+	}
+}
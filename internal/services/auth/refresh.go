@@ -0,0 +1,220 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/Novochenko/sso/domain/models"
+	"github.com/Novochenko/sso/internal/lib/clientinfo"
+	"github.com/Novochenko/sso/internal/lib/jwt"
+	"github.com/Novochenko/sso/internal/lib/logger/sl"
+	"github.com/Novochenko/sso/internal/lib/opaque"
+	"github.com/Novochenko/sso/internal/storage"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token reused")
+)
+
+// Refresh exchanges a refresh token for a new access/refresh token pair.
+// Every refresh token can be used exactly once: presenting an already used
+// token revokes its whole family, logging out every holder of a descendant.
+func (a *Auth) Refresh(ctx context.Context, refreshToken string) (models.TokenPair, error) {
+	return a.refresh(ctx, "auth.Refresh", refreshToken, 0)
+}
+
+// RefreshForApp is Refresh for a client that authenticated as the app:
+// refresh tokens issued to other apps are ErrInvalidRefreshToken, and are
+// left as they are.
+func (a *Auth) RefreshForApp(ctx context.Context, refreshToken string, appID int64) (models.TokenPair, error) {
+	return a.refresh(ctx, "auth.RefreshForApp", refreshToken, appID)
+}
+
+// refresh implements Refresh, and RefreshForApp if appID is not zero.
+func (a *Auth) refresh(ctx context.Context, op, refreshToken string, appID int64) (models.TokenPair, error) {
+	log := a.log.With(slog.String("op", op))
+
+	current, err := a.refreshTokenProvider.RefreshToken(ctx, opaque.Hash(refreshToken))
+	if err != nil {
+		if errors.Is(err, storage.ErrRefreshTokenNotFound) {
+			log.Warn("refresh token not found")
+			return models.TokenPair{}, fmt.Errorf("%s: %w", op, ErrInvalidRefreshToken)
+		}
+		log.Error("failed to get refresh token", sl.Err(err))
+
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log = log.With(
+		slog.String("user_id", current.UserID.String()),
+		slog.String("family_id", current.FamilyID.String()),
+	)
+
+	if appID != 0 && int64(current.AppID) != appID {
+		log.Warn("refresh token presented by another app", slog.Int64("app_id", appID))
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, ErrInvalidRefreshToken)
+	}
+
+	if current.RevokedAt != nil {
+		log.Warn("revoked refresh token presented")
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, ErrInvalidRefreshToken)
+	}
+	if current.UsedAt != nil {
+		return models.TokenPair{}, a.revokeReusedFamily(ctx, log, op, current.FamilyID)
+	}
+	if time.Now().After(current.ExpiresAt) {
+		log.Info("expired refresh token presented")
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, ErrInvalidRefreshToken)
+	}
+
+	user, err := a.userProvider.UserByID(ctx, current.UserID)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			log.Warn("user not found")
+			return models.TokenPair{}, fmt.Errorf("%s: %w", op, ErrInvalidRefreshToken)
+		}
+
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, err)
+	}
+	app, err := a.appProvider.App(ctx, int64(current.AppID))
+	if err != nil {
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, err)
+	}
+	// Leaving the organization ends its sessions at the next refresh.
+	membership, err := a.orgFor(ctx, user.ID, app, current.OrgID)
+	if err != nil {
+		if errors.Is(err, ErrNotOrgMember) {
+			log.Info("user is no longer a member of the organization", slog.Int64("org_id", current.OrgID))
+			return models.TokenPair{}, fmt.Errorf("%s: %w", op, ErrInvalidRefreshToken)
+		}
+
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	accessToken, err := a.newAccessToken(ctx, user, app, membership, current.FamilyID)
+	if err != nil {
+		log.Error("failed to generate token", sl.Err(err))
+
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, err)
+	}
+	rawRefresh, next, err := a.newRefreshToken(user, app, membership.OrgID, current.FamilyID)
+	if err != nil {
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := a.refreshTokenProvider.RotateRefreshToken(ctx, current.ID, next); err != nil {
+		if errors.Is(err, storage.ErrRefreshTokenUsed) {
+			// Lost a race against another request using the same token.
+			return models.TokenPair{}, a.revokeReusedFamily(ctx, log, op, current.FamilyID)
+		}
+		log.Error("failed to rotate refresh token", sl.Err(err))
+
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("refresh token rotated")
+
+	return models.TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: rawRefresh,
+	}, nil
+}
+
+func (a *Auth) revokeReusedFamily(ctx context.Context, log *slog.Logger, op string, familyID uuid.UUID) error {
+	log.Warn("refresh token reuse detected, revoking token family")
+
+	if err := a.tokenRevoker.RevokeSession(ctx, familyID); err != nil {
+		log.Error("failed to revoke refresh token family", sl.Err(err))
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return fmt.Errorf("%s: %w", op, ErrRefreshTokenReused)
+}
+
+// issueTokens starts a login session, recording the client of the request,
+// and returns its first access/refresh token pair. The session id is the
+// family id of its refresh tokens.
+func (a *Auth) issueTokens(
+	ctx context.Context,
+	user models.User,
+	app models.App,
+	membership models.OrgMembership,
+) (models.TokenPair, error) {
+	const op = "auth.issueTokens"
+
+	sessionID := uuid.New()
+	accessToken, err := a.newAccessToken(ctx, user, app, membership, sessionID)
+	if err != nil {
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	rawRefresh, refreshToken, err := a.newRefreshToken(user, app, membership.OrgID, sessionID)
+	if err != nil {
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	client := clientinfo.FromContext(ctx)
+	now := time.Now().UTC()
+	session := models.LoginSession{
+		ID:         sessionID,
+		UserID:     user.ID,
+		AppID:      app.ID,
+		OrgID:      membership.OrgID,
+		UserAgent:  client.UserAgent,
+		IP:         client.IP,
+		CreatedAt:  now,
+		LastSeenAt: now,
+		ExpiresAt:  refreshToken.ExpiresAt,
+	}
+	if err := a.refreshTokenProvider.SaveSession(ctx, session, refreshToken); err != nil {
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return models.TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: rawRefresh,
+	}, nil
+}
+
+func (a *Auth) newAccessToken(
+	ctx context.Context,
+	user models.User,
+	app models.App,
+	membership models.OrgMembership,
+	sessionID uuid.UUID,
+) (string, error) {
+	authz, err := a.authorization(ctx, user.ID, int64(app.ID))
+	if err != nil {
+		return "", err
+	}
+
+	key, err := a.keyProvider.SigningKey(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	return jwt.NewToken(user, app, membership, sessionID, authz, a.tokenTTL, key)
+}
+
+func (a *Auth) newRefreshToken(user models.User, app models.App, orgID int64, familyID uuid.UUID) (string, models.RefreshToken, error) {
+	raw, err := opaque.New()
+	if err != nil {
+		return "", models.RefreshToken{}, err
+	}
+
+	return raw, models.RefreshToken{
+		ID:        uuid.New(),
+		FamilyID:  familyID,
+		TokenHash: opaque.Hash(raw),
+		UserID:    user.ID,
+		AppID:     app.ID,
+		OrgID:     orgID,
+		ExpiresAt: time.Now().Add(a.refreshTokenTTL).UTC(),
+	}, nil
+}
@@ -0,0 +1,54 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/Novochenko/sso/domain/models"
+	"github.com/Novochenko/sso/internal/lib/logger/sl"
+	"github.com/Novochenko/sso/internal/storage"
+	"github.com/google/uuid"
+)
+
+// Sessions lists the devices the user is signed in on, most recently used
+// first.
+func (a *Auth) Sessions(ctx context.Context, userID uuid.UUID) ([]models.LoginSession, error) {
+	const op = "auth.Sessions"
+
+	sessions, err := a.refreshTokenProvider.ActiveSessions(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return sessions, nil
+}
+
+// RevokeSession signs the user out of one of their sessions: its refresh
+// token stops working and its access tokens are rejected. Sessions of other
+// users look the same as unknown ones.
+func (a *Auth) RevokeSession(ctx context.Context, userID, sessionID uuid.UUID) error {
+	const op = "auth.RevokeSession"
+
+	session, err := a.refreshTokenProvider.Session(ctx, sessionID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if session.UserID != userID {
+		return fmt.Errorf("%s: %w", op, storage.ErrSessionNotFound)
+	}
+
+	if err := a.tokenRevoker.RevokeSession(ctx, session.ID); err != nil {
+		a.log.Error("failed to revoke session", slog.String("op", op), sl.Err(err))
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	a.log.Info("session revoked",
+		slog.String("op", op),
+		slog.String("user_id", userID.String()),
+		slog.String("session_id", sessionID.String()),
+	)
+
+	return nil
+}
@@ -0,0 +1,56 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/Novochenko/sso/internal/lib/logger/sl"
+	"github.com/google/uuid"
+)
+
+// LoginThrottledError is returned while logins are refused after too many
+// failures for the account or from the client's address.
+type LoginThrottledError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LoginThrottledError) Error() string {
+	return fmt.Sprintf("too many failed logins, retry after %s", e.RetryAfter)
+}
+
+type LoginThrottler interface {
+	Wait(ctx context.Context, email, ip string) (time.Duration, error)
+	Failure(ctx context.Context, email, ip string) error
+	Reset(ctx context.Context, email string) error
+	SecondFactorWait(ctx context.Context, userID uuid.UUID) (time.Duration, error)
+	SecondFactorFailure(ctx context.Context, userID uuid.UUID) (int, error)
+	SecondFactorReset(ctx context.Context, userID uuid.UUID) error
+}
+
+// UnlockAccount lifts the login backoff or lockout of the user's account.
+// Throttling of the addresses the failures came from is left in place.
+func (a *Auth) UnlockAccount(ctx context.Context, userID uuid.UUID) error {
+	const op = "auth.UnlockAccount"
+
+	user, err := a.userProvider.UserByID(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if err := a.loginThrottler.Reset(ctx, user.Email); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	a.log.Info("account unlocked", slog.String("op", op), slog.String("user_id", userID.String()))
+
+	return nil
+}
+
+// loginFailed counts a failed login. Failing to count it does not fail the
+// login any further.
+func (a *Auth) loginFailed(ctx context.Context, email, ip string) {
+	if err := a.loginThrottler.Failure(ctx, email, ip); err != nil {
+		a.log.Error("failed to count login failure", sl.Err(err))
+	}
+}
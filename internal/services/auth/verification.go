@@ -0,0 +1,127 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+
+	"github.com/Novochenko/sso/internal/lib/jwt"
+	"github.com/Novochenko/sso/internal/lib/logger/sl"
+	"github.com/Novochenko/sso/internal/lib/mail"
+	"github.com/Novochenko/sso/internal/storage"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrEmailNotVerified         = errors.New("email not verified")
+	ErrInvalidVerificationToken = errors.New("invalid verification token")
+)
+
+// VerifyEmail marks the user's email as verified. Verification tokens are
+// single use and only valid for the address they were mailed to.
+func (a *Auth) VerifyEmail(ctx context.Context, token string) error {
+	const op = "auth.VerifyEmail"
+
+	log := a.log.With(slog.String("op", op))
+
+	jwks, err := a.keyProvider.JWKS(ctx)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	action, err := jwt.ParseActionToken(token, jwt.PurposeVerifyEmail, jwks)
+	if err != nil {
+		log.Info("invalid verification token", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, ErrInvalidVerificationToken)
+	}
+
+	log = log.With(slog.String("user_id", action.UserID.String()))
+
+	user, err := a.userProvider.UserByID(ctx, action.UserID)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return fmt.Errorf("%s: %w", op, ErrInvalidVerificationToken)
+		}
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if user.Email != action.Email {
+		log.Info("verification token for a previous email")
+		return fmt.Errorf("%s: %w", op, ErrInvalidVerificationToken)
+	}
+
+	err = a.emailVerifier.UseActionToken(ctx, action.ID, action.UserID, action.Purpose, action.ExpiresAt)
+	if err != nil {
+		if errors.Is(err, storage.ErrActionTokenUsed) {
+			log.Info("verification token reused")
+			return fmt.Errorf("%s: %w", op, ErrInvalidVerificationToken)
+		}
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if user.EmailVerified {
+		return nil
+	}
+	if err := a.emailVerifier.SetEmailVerified(ctx, user.ID, action.Email); err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return fmt.Errorf("%s: %w", op, ErrInvalidVerificationToken)
+		}
+		log.Error("failed to mark email verified", sl.Err(err))
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("email verified")
+
+	return nil
+}
+
+// ResendVerification mails a new verification token. It succeeds silently
+// for unknown and already verified addresses so that it cannot be used to
+// find out which emails are registered.
+func (a *Auth) ResendVerification(ctx context.Context, email string) error {
+	const op = "auth.ResendVerification"
+
+	user, err := a.userProvider.User(ctx, email)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return nil
+		}
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if user.EmailVerified {
+		return nil
+	}
+
+	if err := a.sendVerification(ctx, user.ID, user.Email); err != nil {
+		a.log.Error("failed to send verification email", slog.String("op", op), sl.Err(err))
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (a *Auth) sendVerification(ctx context.Context, userID uuid.UUID, email string) error {
+	key, err := a.keyProvider.SigningKey(ctx)
+	if err != nil {
+		return err
+	}
+	token, err := jwt.NewActionToken(userID, email, jwt.PurposeVerifyEmail, a.emailVerificationTTL, key)
+	if err != nil {
+		return err
+	}
+
+	link := a.links.VerifyEmail + "?" + url.Values{"token": {token}}.Encode()
+
+	return a.mailer.Send(ctx, mail.Message{
+		To:      email,
+		Subject: "Confirm your email address",
+		Body: "Please confirm your email address by opening the link below.\n\n" +
+			link + "\n\n" +
+			"If you did not create an account, you can ignore this email.\n",
+	})
+}
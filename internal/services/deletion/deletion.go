@@ -0,0 +1,144 @@
+package deletion
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/Novochenko/sso/domain/models"
+	"github.com/Novochenko/sso/internal/lib/logger/sl"
+	"github.com/Novochenko/sso/internal/lib/picture"
+	"github.com/Novochenko/sso/internal/storage"
+	"github.com/google/uuid"
+)
+
+// Deletion purges accounts whose deletion grace period has passed. Until
+// then a deleted account is only hidden, so support can still restore it.
+type Deletion struct {
+	log           *slog.Logger
+	storage       Storage
+	pictureStore  PictureStore
+	throttle      Throttle
+	gracePeriod   time.Duration
+	purgeInterval time.Duration
+
+	done chan struct{}
+}
+
+type Storage interface {
+	DeletedUsers(ctx context.Context, before time.Time) ([]models.DeletedUser, error)
+	PurgeUser(ctx context.Context, userID uuid.UUID) error
+}
+
+type PictureStore interface {
+	Delete(ctx context.Context, key string) error
+}
+
+// Throttle forgets the failed logins counted for a user.
+type Throttle interface {
+	Forget(ctx context.Context, userID uuid.UUID, email string) error
+}
+
+func New(
+	log *slog.Logger,
+	storage Storage,
+	pictureStore PictureStore,
+	throttle Throttle,
+	gracePeriod time.Duration,
+	purgeInterval time.Duration,
+) *Deletion {
+	return &Deletion{
+		log:           log,
+		storage:       storage,
+		pictureStore:  pictureStore,
+		throttle:      throttle,
+		gracePeriod:   gracePeriod,
+		purgeInterval: purgeInterval,
+		done:          make(chan struct{}),
+	}
+}
+
+// Run purges expired accounts every purge interval. It blocks until Stop is
+// called.
+func (d *Deletion) Run() {
+	const op = "deletion.Run"
+
+	log := d.log.With(slog.String("op", op))
+
+	ticker := time.NewTicker(d.purgeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-d.done:
+			return
+		case <-ticker.C:
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), d.purgeInterval)
+		purged, err := d.Purge(ctx)
+		if err != nil {
+			log.Error("failed to purge deleted accounts", sl.Err(err))
+		}
+		if purged > 0 {
+			log.Info("purged deleted accounts", slog.Int("count", purged))
+		}
+		cancel()
+	}
+}
+
+func (d *Deletion) Stop() {
+	const op = "deletion.Stop"
+
+	d.log.With(slog.String("op", op)).Info("stopping account purger")
+
+	close(d.done)
+}
+
+// Purge removes every account deleted longer than the grace period ago,
+// along with its profile pictures and failed login counts, and returns how
+// many it removed.
+func (d *Deletion) Purge(ctx context.Context) (int, error) {
+	const op = "deletion.Purge"
+
+	purged := 0
+	for {
+		users, err := d.storage.DeletedUsers(ctx, time.Now().Add(-d.gracePeriod))
+		if err != nil {
+			return purged, fmt.Errorf("%s: %w", op, err)
+		}
+		if len(users) == 0 {
+			return purged, nil
+		}
+
+		for _, user := range users {
+			if err := d.purge(ctx, user); err != nil {
+				return purged, fmt.Errorf("%s: %w", op, err)
+			}
+			purged++
+		}
+	}
+}
+
+// purge deletes the pictures and login counts before the user row, so a
+// failure leaves the row behind to retry with rather than orphaned data.
+func (d *Deletion) purge(ctx context.Context, user models.DeletedUser) error {
+	if user.ProfilePicturePath != "" {
+		for _, key := range picture.Paths(user.ProfilePicturePath) {
+			if err := d.pictureStore.Delete(ctx, key); err != nil {
+				return err
+			}
+		}
+	}
+	if err := d.throttle.Forget(ctx, user.ID, user.Email); err != nil {
+		return err
+	}
+
+	if err := d.storage.PurgeUser(ctx, user.ID); err != nil && !errors.Is(err, storage.ErrUserNotFound) {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,102 @@
+package deletion
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/Novochenko/sso/domain/models"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeStorage struct {
+	deletedAt map[uuid.UUID]time.Time
+	accounts  map[uuid.UUID]models.DeletedUser
+}
+
+func (s *fakeStorage) DeletedUsers(_ context.Context, before time.Time) ([]models.DeletedUser, error) {
+	var users []models.DeletedUser
+	for id, at := range s.deletedAt {
+		if !at.After(before) {
+			users = append(users, s.accounts[id])
+		}
+	}
+
+	return users, nil
+}
+
+func (s *fakeStorage) PurgeUser(_ context.Context, userID uuid.UUID) error {
+	delete(s.deletedAt, userID)
+	delete(s.accounts, userID)
+
+	return nil
+}
+
+type fakeThrottle struct {
+	forgotten []string
+}
+
+func (t *fakeThrottle) Forget(_ context.Context, userID uuid.UUID, email string) error {
+	t.forgotten = append(t.forgotten, email)
+
+	return nil
+}
+
+type fakePictureStore struct {
+	deleted []string
+	err     error
+}
+
+func (p *fakePictureStore) Delete(_ context.Context, key string) error {
+	if p.err != nil {
+		return p.err
+	}
+	p.deleted = append(p.deleted, key)
+
+	return nil
+}
+
+func TestPurge(t *testing.T) {
+	expired := models.DeletedUser{ID: uuid.New(), Email: "expired@example.com", ProfilePicturePath: "p/a.png"}
+	recent := models.DeletedUser{ID: uuid.New(), Email: "recent@example.com"}
+
+	st := &fakeStorage{
+		deletedAt: map[uuid.UUID]time.Time{
+			expired.ID: time.Now().Add(-48 * time.Hour),
+			recent.ID:  time.Now().Add(-time.Hour),
+		},
+		accounts: map[uuid.UUID]models.DeletedUser{
+			expired.ID: expired,
+			recent.ID:  recent,
+		},
+	}
+	pictures := &fakePictureStore{}
+	throttle := &fakeThrottle{}
+	d := New(slog.New(slog.NewTextHandler(io.Discard, nil)), st, pictures, throttle, 24*time.Hour, time.Hour)
+
+	purged, err := d.Purge(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, purged)
+	assert.NotContains(t, st.accounts, expired.ID)
+	assert.Contains(t, st.accounts, recent.ID)
+	assert.Equal(t, []string{"p/a.png", "p/a_128.png", "p/a_32.png"}, pictures.deleted)
+	assert.Equal(t, []string{expired.Email}, throttle.forgotten)
+}
+
+func TestPurge_KeepsUserWhenPicturesCannotBeDeleted(t *testing.T) {
+	account := models.DeletedUser{ID: uuid.New(), ProfilePicturePath: "p/a.png"}
+	st := &fakeStorage{
+		deletedAt: map[uuid.UUID]time.Time{account.ID: time.Now().Add(-48 * time.Hour)},
+		accounts:  map[uuid.UUID]models.DeletedUser{account.ID: account},
+	}
+	d := New(slog.New(slog.NewTextHandler(io.Discard, nil)), st, &fakePictureStore{err: errors.New("unavailable")}, &fakeThrottle{}, 24*time.Hour, time.Hour)
+
+	_, err := d.Purge(context.Background())
+	require.Error(t, err)
+	assert.Contains(t, st.accounts, account.ID)
+}
@@ -0,0 +1,202 @@
+package groups
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/Novochenko/sso/domain/models"
+	"github.com/Novochenko/sso/internal/lib/logger/sl"
+)
+
+// Groups resolves nested group membership. The subgroup edges are cached in
+// memory, so finding every group a user is in, however deep, costs no
+// queries. The cache is rebuilt from storage every refresh interval, which
+// is also how long it takes for an edge changed on another replica to be
+// seen; changes made through this replica are seen at once.
+type Groups struct {
+	log             *slog.Logger
+	storage         Storage
+	refreshInterval time.Duration
+
+	mu sync.RWMutex
+	// parents maps a group to the groups it is a direct subgroup of.
+	parents map[int64][]int64
+
+	done chan struct{}
+}
+
+type Storage interface {
+	Subgroups(ctx context.Context) ([]models.Subgroup, error)
+	AddSubgroup(ctx context.Context, parentID, childID int64) error
+	RemoveSubgroup(ctx context.Context, parentID, childID int64) error
+	DeleteGroup(ctx context.Context, id int64) error
+}
+
+func New(
+	log *slog.Logger,
+	storage Storage,
+	refreshInterval time.Duration,
+) *Groups {
+	return &Groups{
+		log:             log,
+		storage:         storage,
+		refreshInterval: refreshInterval,
+		parents:         make(map[int64][]int64),
+		done:            make(chan struct{}),
+	}
+}
+
+func (g *Groups) MustLoad(ctx context.Context) {
+	if err := g.Load(ctx); err != nil {
+		panic(err)
+	}
+}
+
+// Load rebuilds the in-memory cache from storage.
+func (g *Groups) Load(ctx context.Context) error {
+	const op = "groups.Load"
+
+	edges, err := g.storage.Subgroups(ctx)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	parents := make(map[int64][]int64)
+	for _, edge := range edges {
+		parents[edge.ChildID] = append(parents[edge.ChildID], edge.ParentID)
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.parents = parents
+
+	return nil
+}
+
+// Run reloads the cache every refresh interval. It blocks until Stop is
+// called.
+func (g *Groups) Run() {
+	const op = "groups.Run"
+
+	log := g.log.With(slog.String("op", op))
+
+	ticker := time.NewTicker(g.refreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-g.done:
+			return
+		case <-ticker.C:
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), g.refreshInterval)
+		if err := g.Load(ctx); err != nil {
+			log.Error("failed to reload group graph", sl.Err(err))
+		}
+		cancel()
+	}
+}
+
+func (g *Groups) Stop() {
+	const op = "groups.Stop"
+
+	g.log.With(slog.String("op", op)).Info("stopping group cache refresh")
+
+	close(g.done)
+}
+
+// Ancestors returns groupIDs together with every group they are nested in,
+// at any depth, each once. Storage refuses edges that close a cycle, but
+// the walk stops on one anyway.
+func (g *Groups) Ancestors(groupIDs []int64) []int64 {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	seen := make(map[int64]bool, len(groupIDs))
+	var all []int64
+	queue := append([]int64(nil), groupIDs...)
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		all = append(all, id)
+		queue = append(queue, g.parents[id]...)
+	}
+
+	return all
+}
+
+// AddSubgroup makes the members of childID members of parentID. It fails
+// with storage.ErrGroupCycle if parentID is nested in childID already.
+func (g *Groups) AddSubgroup(ctx context.Context, parentID, childID int64) error {
+	const op = "groups.AddSubgroup"
+
+	if err := g.storage.AddSubgroup(ctx, parentID, childID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for _, id := range g.parents[childID] {
+		if id == parentID {
+			return nil
+		}
+	}
+	g.parents[childID] = append(g.parents[childID], parentID)
+
+	return nil
+}
+
+func (g *Groups) RemoveSubgroup(ctx context.Context, parentID, childID int64) error {
+	const op = "groups.RemoveSubgroup"
+
+	if err := g.storage.RemoveSubgroup(ctx, parentID, childID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.parents[childID] = without(g.parents[childID], parentID)
+
+	return nil
+}
+
+// DeleteGroup removes the group and every edge it is part of.
+func (g *Groups) DeleteGroup(ctx context.Context, id int64) error {
+	const op = "groups.DeleteGroup"
+
+	if err := g.storage.DeleteGroup(ctx, id); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	delete(g.parents, id)
+	for child, parents := range g.parents {
+		g.parents[child] = without(parents, id)
+	}
+
+	return nil
+}
+
+func without(ids []int64, id int64) []int64 {
+	kept := make([]int64, 0, len(ids))
+	for _, other := range ids {
+		if other != id {
+			kept = append(kept, other)
+		}
+	}
+
+	return kept
+}
@@ -0,0 +1,176 @@
+package groups
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Novochenko/sso/domain/models"
+	"github.com/Novochenko/sso/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGroups_AncestorsAreTransitive(t *testing.T) {
+	ctx := context.Background()
+	g := newTestGroups(t, &memoryStorage{})
+
+	// 1 is in 2, 2 is in 3 and 4, 5 stands apart.
+	require.NoError(t, g.AddSubgroup(ctx, 2, 1))
+	require.NoError(t, g.AddSubgroup(ctx, 3, 2))
+	require.NoError(t, g.AddSubgroup(ctx, 4, 2))
+
+	assert.ElementsMatch(t, []int64{1, 2, 3, 4}, g.Ancestors([]int64{1}))
+	assert.ElementsMatch(t, []int64{2, 3, 4, 5}, g.Ancestors([]int64{2, 5}))
+	assert.Empty(t, g.Ancestors(nil))
+}
+
+func TestGroups_DiamondCountsOnce(t *testing.T) {
+	ctx := context.Background()
+	g := newTestGroups(t, &memoryStorage{})
+
+	require.NoError(t, g.AddSubgroup(ctx, 2, 1))
+	require.NoError(t, g.AddSubgroup(ctx, 3, 1))
+	require.NoError(t, g.AddSubgroup(ctx, 4, 2))
+	require.NoError(t, g.AddSubgroup(ctx, 4, 3))
+
+	assert.ElementsMatch(t, []int64{1, 2, 3, 4}, g.Ancestors([]int64{1}))
+}
+
+func TestGroups_RejectsCycles(t *testing.T) {
+	ctx := context.Background()
+	g := newTestGroups(t, &memoryStorage{})
+
+	require.NoError(t, g.AddSubgroup(ctx, 2, 1))
+	require.NoError(t, g.AddSubgroup(ctx, 3, 2))
+
+	assert.ErrorIs(t, g.AddSubgroup(ctx, 1, 3), storage.ErrGroupCycle)
+	assert.ErrorIs(t, g.AddSubgroup(ctx, 1, 1), storage.ErrGroupCycle)
+	assert.ElementsMatch(t, []int64{1, 2, 3}, g.Ancestors([]int64{1}))
+}
+
+func TestGroups_AncestorsStopOnStoredCycle(t *testing.T) {
+	st := &memoryStorage{edges: []models.Subgroup{
+		{ParentID: 2, ChildID: 1},
+		{ParentID: 1, ChildID: 2},
+	}}
+	g := newTestGroups(t, st)
+
+	assert.ElementsMatch(t, []int64{1, 2}, g.Ancestors([]int64{1}))
+}
+
+func TestGroups_RemoveAndDeleteDropEdges(t *testing.T) {
+	ctx := context.Background()
+	g := newTestGroups(t, &memoryStorage{})
+
+	require.NoError(t, g.AddSubgroup(ctx, 2, 1))
+	require.NoError(t, g.AddSubgroup(ctx, 3, 2))
+	require.NoError(t, g.AddSubgroup(ctx, 4, 1))
+
+	require.NoError(t, g.RemoveSubgroup(ctx, 4, 1))
+	assert.ElementsMatch(t, []int64{1, 2, 3}, g.Ancestors([]int64{1}))
+
+	require.NoError(t, g.DeleteGroup(ctx, 2))
+	assert.ElementsMatch(t, []int64{1}, g.Ancestors([]int64{1}))
+}
+
+func TestGroups_LoadSeesOtherReplicas(t *testing.T) {
+	ctx := context.Background()
+	st := &memoryStorage{}
+	a := newTestGroups(t, st)
+	b := newTestGroups(t, st)
+
+	require.NoError(t, a.AddSubgroup(ctx, 2, 1))
+	assert.ElementsMatch(t, []int64{1}, b.Ancestors([]int64{1}))
+
+	require.NoError(t, b.Load(ctx))
+	assert.ElementsMatch(t, []int64{1, 2}, b.Ancestors([]int64{1}))
+}
+
+func newTestGroups(t *testing.T, st Storage) *Groups {
+	t.Helper()
+
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	g := New(log, st, time.Minute)
+	require.NoError(t, g.Load(context.Background()))
+
+	return g
+}
+
+type memoryStorage struct {
+	mu    sync.Mutex
+	edges []models.Subgroup
+}
+
+func (m *memoryStorage) Subgroups(ctx context.Context) ([]models.Subgroup, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]models.Subgroup(nil), m.edges...), nil
+}
+
+func (m *memoryStorage) AddSubgroup(ctx context.Context, parentID, childID int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.reaches(childID, parentID) {
+		return storage.ErrGroupCycle
+	}
+	for _, edge := range m.edges {
+		if edge.ParentID == parentID && edge.ChildID == childID {
+			return nil
+		}
+	}
+	m.edges = append(m.edges, models.Subgroup{ParentID: parentID, ChildID: childID})
+
+	return nil
+}
+
+func (m *memoryStorage) RemoveSubgroup(ctx context.Context, parentID, childID int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.filter(func(edge models.Subgroup) bool {
+		return edge.ParentID != parentID || edge.ChildID != childID
+	})
+
+	return nil
+}
+
+func (m *memoryStorage) DeleteGroup(ctx context.Context, id int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.filter(func(edge models.Subgroup) bool {
+		return edge.ParentID != id && edge.ChildID != id
+	})
+
+	return nil
+}
+
+// reaches reports whether to is from or one of its subgroups.
+func (m *memoryStorage) reaches(from, to int64) bool {
+	if from == to {
+		return true
+	}
+	for _, edge := range m.edges {
+		if edge.ParentID == from && m.reaches(edge.ChildID, to) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (m *memoryStorage) filter(keep func(models.Subgroup) bool) {
+	var kept []models.Subgroup
+	for _, edge := range m.edges {
+		if keep(edge) {
+			kept = append(kept, edge)
+		}
+	}
+	m.edges = kept
+}
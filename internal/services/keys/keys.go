@@ -0,0 +1,335 @@
+package keys
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/Novochenko/sso/domain/models"
+	"github.com/Novochenko/sso/internal/lib/jwt"
+	"github.com/Novochenko/sso/internal/lib/logger/sl"
+	"github.com/Novochenko/sso/internal/storage"
+)
+
+var (
+	ErrNoActiveKey = errors.New("no active signing key")
+)
+
+// Keys manages versioned token signing keys. At any time there is one active
+// key that signs tokens and one next key that is already published so that
+// consumers can cache it before it becomes active. Retired keys stay
+// published until every token they signed has expired.
+type Keys struct {
+	log              *slog.Logger
+	keyStorage       KeyStorage
+	algorithm        string
+	rotationInterval time.Duration
+	refreshInterval  time.Duration
+	maxTokenTTL      time.Duration
+
+	mu        sync.RWMutex
+	active    jwt.SigningKey
+	activated time.Time
+	next      jwt.SigningKey
+	published []jwt.SigningKey
+
+	done chan struct{}
+}
+
+type KeyStorage interface {
+	SigningKeys(ctx context.Context) ([]models.SigningKey, error)
+	InitSigningKeys(ctx context.Context, active, next models.SigningKey) error
+	RotateSigningKeys(
+		ctx context.Context,
+		activeKID string,
+		nextKID string,
+		publishUntil time.Time,
+		newNext models.SigningKey,
+	) error
+	ResetSigningKeys(ctx context.Context, active, next models.SigningKey) error
+}
+
+// New returns a key manager. maxTokenTTL is the longest lifetime of anything
+// the keys sign, access tokens, emailed links and login sessions alike, and
+// defines how long a retired key is kept in the JWKS.
+func New(
+	log *slog.Logger,
+	keyStorage KeyStorage,
+	algorithm string,
+	rotationInterval time.Duration,
+	refreshInterval time.Duration,
+	maxTokenTTL time.Duration,
+) *Keys {
+	return &Keys{
+		log:              log,
+		keyStorage:       keyStorage,
+		algorithm:        algorithm,
+		rotationInterval: rotationInterval,
+		refreshInterval:  refreshInterval,
+		maxTokenTTL:      maxTokenTTL,
+		done:             make(chan struct{}),
+	}
+}
+
+// Load creates the initial keys if there are none and loads the current
+// key set into memory.
+func (k *Keys) Load(ctx context.Context) error {
+	const op = "keys.Load"
+
+	active, err := k.newKey(models.SigningKeyActive)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	next, err := k.newKey(models.SigningKeyNext)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if err := k.keyStorage.InitSigningKeys(ctx, active, next); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := k.reload(ctx); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (k *Keys) MustLoad(ctx context.Context) {
+	if err := k.Load(ctx); err != nil {
+		panic(err)
+	}
+}
+
+// Run periodically reloads the key set, which picks up rotations done by
+// other replicas, and rotates the keys once the active one is older than the
+// rotation interval. It blocks until Stop is called.
+func (k *Keys) Run() {
+	const op = "keys.Run"
+
+	log := k.log.With(slog.String("op", op))
+
+	ticker := time.NewTicker(k.refreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-k.done:
+			return
+		case <-ticker.C:
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), k.refreshInterval)
+		if err := k.reload(ctx); err != nil {
+			log.Error("failed to reload signing keys", sl.Err(err))
+		} else if k.rotationDue() {
+			if err := k.Rotate(ctx); err != nil {
+				log.Error("failed to rotate signing keys", sl.Err(err))
+			}
+		}
+		cancel()
+	}
+}
+
+func (k *Keys) Stop() {
+	const op = "keys.Stop"
+
+	k.log.With(slog.String("op", op)).Info("stopping signing key rotation")
+
+	close(k.done)
+}
+
+// Rotate retires the active key, activates the next one and generates a new
+// next key. The retired key stays published until the longest lived token
+// it could have signed has expired.
+func (k *Keys) Rotate(ctx context.Context) error {
+	const op = "keys.Rotate"
+
+	log := k.log.With(slog.String("op", op))
+
+	k.mu.RLock()
+	active, next := k.active, k.next
+	k.mu.RUnlock()
+
+	if active.ID == "" || next.ID == "" {
+		return fmt.Errorf("%s: %w", op, ErrNoActiveKey)
+	}
+
+	newNext, err := k.newKey(models.SigningKeyNext)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	publishUntil := time.Now().Add(k.maxTokenTTL).UTC()
+	err = k.keyStorage.RotateSigningKeys(ctx, active.ID, next.ID, publishUntil, newNext)
+	if err != nil && !errors.Is(err, storage.ErrSigningKeysRotated) {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if errors.Is(err, storage.ErrSigningKeysRotated) {
+		log.Info("signing keys were rotated by another replica")
+	} else {
+		log.Info("signing keys rotated",
+			slog.String("retired_kid", active.ID),
+			slog.String("active_kid", next.ID),
+		)
+	}
+
+	if err := k.reload(ctx); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// EmergencyRotate replaces both the active and the next key and stops
+// publishing the old ones at once, invalidating every token they signed.
+// It is meant for a suspected key compromise.
+func (k *Keys) EmergencyRotate(ctx context.Context) error {
+	const op = "keys.EmergencyRotate"
+
+	active, err := k.newKey(models.SigningKeyActive)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	next, err := k.newKey(models.SigningKeyNext)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := k.keyStorage.ResetSigningKeys(ctx, active, next); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	k.log.Warn("emergency signing key rotation done", slog.String("op", op), slog.String("active_kid", active.ID))
+
+	if err := k.reload(ctx); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (k *Keys) SigningKey(ctx context.Context) (jwt.SigningKey, error) {
+	const op = "keys.SigningKey"
+
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	if k.active.ID == "" {
+		return jwt.SigningKey{}, fmt.Errorf("%s: %w", op, ErrNoActiveKey)
+	}
+
+	return k.active, nil
+}
+
+func (k *Keys) JWKS(ctx context.Context) (jwt.JWKS, error) {
+	const op = "keys.JWKS"
+
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	set := jwt.JWKS{Keys: make([]jwt.JWK, 0, len(k.published))}
+	for _, key := range k.published {
+		jwk, err := jwt.NewJWK(key.ID, key.Algorithm, key.Public())
+		if err != nil {
+			return jwt.JWKS{}, fmt.Errorf("%s: %w", op, err)
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+
+	return set, nil
+}
+
+// ParseToken verifies a token against the published keys, so tokens signed
+// by a retired key remain valid until they expire.
+func (k *Keys) ParseToken(ctx context.Context, token string) (jwt.Claims, error) {
+	const op = "keys.ParseToken"
+
+	set, err := k.JWKS(ctx)
+	if err != nil {
+		return jwt.Claims{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	claims, err := jwt.Parse(token, set)
+	if err != nil {
+		return jwt.Claims{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return claims, nil
+}
+
+func (k *Keys) reload(ctx context.Context) error {
+	stored, err := k.keyStorage.SigningKeys(ctx)
+	if err != nil {
+		return err
+	}
+
+	var active, next jwt.SigningKey
+	var activated time.Time
+	published := make([]jwt.SigningKey, 0, len(stored))
+	for _, s := range stored {
+		key, err := jwt.ParseSigningKey(s.Algorithm, s.PrivateKey)
+		if err != nil {
+			return fmt.Errorf("signing key %d: %w", s.Version, err)
+		}
+
+		switch s.Status {
+		case models.SigningKeyActive:
+			active = key
+			if s.ActivatedAt != nil {
+				activated = *s.ActivatedAt
+			}
+		case models.SigningKeyNext:
+			next = key
+		}
+		published = append(published, key)
+	}
+	if active.ID == "" {
+		return ErrNoActiveKey
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.active = active
+	k.activated = activated
+	k.next = next
+	k.published = published
+
+	return nil
+}
+
+func (k *Keys) rotationDue() bool {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	return !k.activated.IsZero() && time.Since(k.activated) >= k.rotationInterval
+}
+
+func (k *Keys) newKey(status string) (models.SigningKey, error) {
+	key, err := jwt.GenerateSigningKey(k.algorithm)
+	if err != nil {
+		return models.SigningKey{}, err
+	}
+	pem, err := jwt.MarshalSigningKey(key)
+	if err != nil {
+		return models.SigningKey{}, err
+	}
+
+	now := time.Now().UTC()
+	stored := models.SigningKey{
+		ID:         key.ID,
+		Algorithm:  key.Algorithm,
+		PrivateKey: pem,
+		Status:     status,
+		CreatedAt:  now,
+	}
+	if status == models.SigningKeyActive {
+		stored.ActivatedAt = &now
+	}
+
+	return stored, nil
+}
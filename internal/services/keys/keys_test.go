@@ -0,0 +1,197 @@
+package keys
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Novochenko/sso/domain/models"
+	"github.com/Novochenko/sso/internal/lib/jwt"
+	"github.com/Novochenko/sso/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const tokenTTL = time.Hour
+
+func TestKeys_RotateKeepsRetiredKeyPublished(t *testing.T) {
+	ctx := context.Background()
+	k := newTestKeys(t, &memoryStorage{})
+
+	first, err := k.SigningKey(ctx)
+	require.NoError(t, err)
+	set, err := k.JWKS(ctx)
+	require.NoError(t, err)
+	require.Len(t, set.Keys, 2)
+	next := otherKID(set, first.ID)
+
+	require.NoError(t, k.Rotate(ctx))
+
+	second, err := k.SigningKey(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, next, second.ID)
+
+	set, err = k.JWKS(ctx)
+	require.NoError(t, err)
+	assert.Len(t, set.Keys, 3)
+	assert.Contains(t, kids(set), first.ID)
+}
+
+func TestKeys_EmergencyRotateUnpublishesOldKeys(t *testing.T) {
+	ctx := context.Background()
+	k := newTestKeys(t, &memoryStorage{})
+
+	before, err := k.JWKS(ctx)
+	require.NoError(t, err)
+
+	require.NoError(t, k.EmergencyRotate(ctx))
+
+	after, err := k.JWKS(ctx)
+	require.NoError(t, err)
+	assert.Len(t, after.Keys, 2)
+	for _, kid := range kids(before) {
+		assert.NotContains(t, kids(after), kid)
+	}
+}
+
+func TestKeys_ConcurrentReplicasRotateOnce(t *testing.T) {
+	ctx := context.Background()
+	st := &memoryStorage{}
+	a := newTestKeys(t, st)
+	b := newTestKeys(t, st)
+
+	require.NoError(t, a.Rotate(ctx))
+	// b still holds the old key set and loses the race.
+	require.NoError(t, b.Rotate(ctx))
+
+	ka, err := a.SigningKey(ctx)
+	require.NoError(t, err)
+	kb, err := b.SigningKey(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, ka.ID, kb.ID)
+
+	set, err := b.JWKS(ctx)
+	require.NoError(t, err)
+	assert.Len(t, set.Keys, 3)
+}
+
+func newTestKeys(t *testing.T, st KeyStorage) *Keys {
+	t.Helper()
+
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	k := New(log, st, jwt.AlgEdDSA, 24*time.Hour, time.Minute, tokenTTL)
+	require.NoError(t, k.Load(context.Background()))
+
+	return k
+}
+
+func kids(set jwt.JWKS) []string {
+	res := make([]string, 0, len(set.Keys))
+	for _, key := range set.Keys {
+		res = append(res, key.KeyID)
+	}
+	return res
+}
+
+func otherKID(set jwt.JWKS, kid string) string {
+	for _, key := range set.Keys {
+		if key.KeyID != kid {
+			return key.KeyID
+		}
+	}
+	return ""
+}
+
+type memoryStorage struct {
+	mu      sync.Mutex
+	version int
+	keys    []models.SigningKey
+}
+
+func (m *memoryStorage) SigningKeys(ctx context.Context) ([]models.SigningKey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	var res []models.SigningKey
+	for _, key := range m.keys {
+		if key.Status != models.SigningKeyRetired || key.PublishUntil.After(now) {
+			res = append(res, key)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Version > res[j].Version })
+
+	return res, nil
+}
+
+func (m *memoryStorage) InitSigningKeys(ctx context.Context, active, next models.SigningKey) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, key := range m.keys {
+		if key.Status == models.SigningKeyActive {
+			return nil
+		}
+	}
+	m.insert(active)
+	m.insert(next)
+
+	return nil
+}
+
+func (m *memoryStorage) RotateSigningKeys(
+	ctx context.Context,
+	activeKID string,
+	nextKID string,
+	publishUntil time.Time,
+	newNext models.SigningKey,
+) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	active, next := m.find(activeKID, models.SigningKeyActive), m.find(nextKID, models.SigningKeyNext)
+	if active == nil || next == nil {
+		return storage.ErrSigningKeysRotated
+	}
+	now := time.Now()
+	active.Status, active.RetiredAt, active.PublishUntil = models.SigningKeyRetired, &now, &publishUntil
+	next.Status, next.ActivatedAt = models.SigningKeyActive, &now
+	m.insert(newNext)
+
+	return nil
+}
+
+func (m *memoryStorage) ResetSigningKeys(ctx context.Context, active, next models.SigningKey) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	for i := range m.keys {
+		if m.keys[i].Status != models.SigningKeyRetired {
+			m.keys[i].Status, m.keys[i].RetiredAt, m.keys[i].PublishUntil = models.SigningKeyRetired, &now, &now
+		}
+	}
+	m.insert(active)
+	m.insert(next)
+
+	return nil
+}
+
+func (m *memoryStorage) insert(key models.SigningKey) {
+	m.version++
+	key.Version = m.version
+	m.keys = append(m.keys, key)
+}
+
+func (m *memoryStorage) find(kid, status string) *models.SigningKey {
+	for i := range m.keys {
+		if m.keys[i].ID == kid && m.keys[i].Status == status {
+			return &m.keys[i]
+		}
+	}
+	return nil
+}
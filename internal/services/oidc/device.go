@@ -0,0 +1,315 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Novochenko/sso/domain/models"
+	"github.com/Novochenko/sso/internal/lib/clientinfo"
+	"github.com/Novochenko/sso/internal/lib/jwt"
+	"github.com/Novochenko/sso/internal/lib/logger/sl"
+	"github.com/Novochenko/sso/internal/lib/opaque"
+	"github.com/Novochenko/sso/internal/services/auth"
+	"github.com/Novochenko/sso/internal/storage"
+)
+
+const (
+	// userCodeAlphabet has no vowels, so user codes never spell words, and
+	// no digits, so they are easy to type on a TV remote (RFC 8628 section
+	// 6.1).
+	userCodeAlphabet = "BCDFGHJKLMNPQRSTVWXZ"
+	userCodeLength   = 8
+
+	// slowDownStep is added to the poll interval of a client that polls too
+	// often.
+	slowDownStep = 5 * time.Second
+)
+
+var (
+	ErrUnknownUserCode  = errors.New("unknown or expired user code")
+	ErrDeviceCodeLocked = errors.New("too many failed sign-ins for the user code")
+)
+
+// DeviceAuthorization is a successful device authorization response.
+type DeviceAuthorization struct {
+	DeviceCode              string
+	UserCode                string
+	VerificationURI         string
+	VerificationURIComplete string
+	ExpiresIn               time.Duration
+	Interval                time.Duration
+}
+
+// AuthorizeDevice starts the device authorization grant for the client.
+func (o *OIDC) AuthorizeDevice(ctx context.Context, clientID, clientSecret, scope string) (DeviceAuthorization, error) {
+	const op = "oidc.AuthorizeDevice"
+
+	app, err := o.authenticateClient(ctx, clientID, clientSecret)
+	if err != nil {
+		return DeviceAuthorization{}, fmt.Errorf("%s: %w", op, err)
+	}
+	for _, s := range strings.Fields(scope) {
+		if !slices.Contains(SupportedScopes(), s) {
+			return DeviceAuthorization{}, newError(ErrCodeInvalidScope, "unsupported scope "+s)
+		}
+	}
+
+	deviceCode, err := opaque.New()
+	if err != nil {
+		return DeviceAuthorization{}, fmt.Errorf("%s: %w", op, err)
+	}
+	userCode, err := newUserCode()
+	if err != nil {
+		return DeviceAuthorization{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = o.deviceStorage.SaveDeviceCode(ctx, models.DeviceCode{
+		DeviceCodeHash: opaque.Hash(deviceCode),
+		UserCode:       userCode,
+		AppID:          app.ID,
+		Scope:          scope,
+		Status:         models.DeviceCodePending,
+		PollInterval:   o.pollInterval,
+		ExpiresAt:      time.Now().Add(o.deviceCodeTTL),
+	})
+	if err != nil {
+		return DeviceAuthorization{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	o.log.Info("device authorization started", slog.String("op", op), slog.Int("app_id", app.ID))
+
+	verificationURI := o.issuer + "/device"
+	return DeviceAuthorization{
+		DeviceCode:              deviceCode,
+		UserCode:                FormatUserCode(userCode),
+		VerificationURI:         verificationURI,
+		VerificationURIComplete: verificationURI + "?" + url.Values{"user_code": {FormatUserCode(userCode)}}.Encode(),
+		ExpiresIn:               o.deviceCodeTTL,
+		Interval:                o.pollInterval,
+	}, nil
+}
+
+// PendingDevice returns the app and scope of the pending device
+// authorization with the given user code, to be shown to the user. User
+// codes are short enough to guess, so wrong ones are counted against the
+// client's address and refused with auth.LoginThrottledError for a while
+// after too many (RFC 8628 section 5.1).
+func (o *OIDC) PendingDevice(ctx context.Context, userCode string) (models.App, models.DeviceCode, error) {
+	const op = "oidc.PendingDevice"
+
+	userCode = normalizeUserCode(userCode)
+	ip := clientinfo.FromContext(ctx).IP
+	wait, err := o.throttler.DeviceWait(ctx, ip, userCode)
+	if err != nil {
+		return models.App{}, models.DeviceCode{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if wait > 0 {
+		o.log.Warn("device verification throttled", slog.String("op", op), slog.String("ip", ip), slog.Duration("retry_after", wait))
+		return models.App{}, models.DeviceCode{}, fmt.Errorf("%s: %w", op, &auth.LoginThrottledError{RetryAfter: wait})
+	}
+
+	code, err := o.deviceStorage.DeviceCodeByUserCode(ctx, userCode)
+	if err != nil {
+		if errors.Is(err, storage.ErrDeviceCodeNotFound) {
+			if _, err := o.throttler.DeviceFailure(ctx, ip, ""); err != nil {
+				o.log.Error("failed to count wrong user code", slog.String("op", op), sl.Err(err))
+			}
+			return models.App{}, models.DeviceCode{}, fmt.Errorf("%s: %w", op, ErrUnknownUserCode)
+		}
+
+		return models.App{}, models.DeviceCode{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	app, err := o.appProvider.App(ctx, int64(code.AppID))
+	if err != nil {
+		return models.App{}, models.DeviceCode{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return app, code, nil
+}
+
+// DeviceLogin signs the user in from the device verification page to
+// decide on the pending device authorization with the given user code.
+// Wrong passwords and one-time codes are counted against the user code;
+// once there are too many, the authorization is denied and
+// ErrDeviceCodeLocked returned.
+func (o *OIDC) DeviceLogin(ctx context.Context, userCode, email, password, otp string) (string, error) {
+	const op = "oidc.DeviceLogin"
+
+	session, err := o.Login(ctx, email, password, otp)
+	if err == nil {
+		return session, nil
+	}
+	if !errors.Is(err, auth.ErrInvalidCredentials) && !errors.Is(err, auth.ErrInvalidMFACode) {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	userCode = normalizeUserCode(userCode)
+	failures, countErr := o.throttler.DeviceFailure(ctx, "", userCode)
+	if countErr != nil {
+		return "", fmt.Errorf("%s: %w", op, countErr)
+	}
+	if failures < o.deviceMaxAttempts {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := o.deviceStorage.LockDeviceCode(ctx, userCode); err != nil && !errors.Is(err, storage.ErrDeviceCodeNotFound) {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+	o.log.Warn("device code locked after failed sign-ins", slog.String("op", op), slog.Int("failures", failures))
+
+	return "", fmt.Errorf("%s: %w", op, ErrDeviceCodeLocked)
+}
+
+// DecideDevice records the signed-in user's approval or denial of a pending
+// device authorization.
+func (o *OIDC) DecideDevice(ctx context.Context, userCode string, session jwt.Claims, approve bool) error {
+	const op = "oidc.DecideDevice"
+
+	status := models.DeviceCodeDenied
+	if approve {
+		status = models.DeviceCodeApproved
+	}
+
+	err := o.deviceStorage.DecideDeviceCode(ctx, normalizeUserCode(userCode), session.UserID, status)
+	if err != nil {
+		if errors.Is(err, storage.ErrDeviceCodeNotFound) {
+			return fmt.Errorf("%s: %w", op, ErrUnknownUserCode)
+		}
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	o.log.Info("device authorization decided",
+		slog.String("op", op),
+		slog.String("user_id", session.UserID.String()),
+		slog.String("status", status),
+	)
+
+	return nil
+}
+
+// PollDevice implements the device_code grant of the token endpoint.
+func (o *OIDC) PollDevice(ctx context.Context, clientID, clientSecret, deviceCode string) (Tokens, error) {
+	const op = "oidc.PollDevice"
+
+	log := o.log.With(slog.String("op", op), slog.String("client_id", clientID))
+
+	app, err := o.authenticateClient(ctx, clientID, clientSecret)
+	if err != nil {
+		return Tokens{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	hash := opaque.Hash(deviceCode)
+	code, err := o.deviceStorage.PollDeviceCode(ctx, hash)
+	if err != nil {
+		if errors.Is(err, storage.ErrDeviceCodeNotFound) {
+			return Tokens{}, newError(ErrCodeInvalidGrant, "invalid device code")
+		}
+
+		return Tokens{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if code.AppID != app.ID {
+		return Tokens{}, newError(ErrCodeInvalidGrant, "invalid device code")
+	}
+
+	now := time.Now()
+	if now.After(code.ExpiresAt) {
+		return Tokens{}, newError(ErrCodeExpiredToken, "the device code has expired")
+	}
+
+	switch code.Status {
+	case models.DeviceCodePending:
+		if !code.LastPolledAt.IsZero() && now.Sub(code.LastPolledAt) < code.PollInterval {
+			if err := o.deviceStorage.SetDeviceCodePollInterval(ctx, hash, code.PollInterval+slowDownStep); err != nil {
+				return Tokens{}, fmt.Errorf("%s: %w", op, err)
+			}
+			return Tokens{}, newError(ErrCodeSlowDown, "")
+		}
+		return Tokens{}, newError(ErrCodeAuthorizationPending, "")
+	case models.DeviceCodeDenied:
+		return Tokens{}, newError(ErrCodeAccessDenied, "the user denied the request")
+	case models.DeviceCodeApproved:
+	default:
+		log.Warn("device code polled after tokens were issued")
+		return Tokens{}, newError(ErrCodeInvalidGrant, "invalid device code")
+	}
+
+	user, err := o.userProvider.UserByID(ctx, code.UserID)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return Tokens{}, newError(ErrCodeInvalidGrant, "invalid device code")
+		}
+
+		return Tokens{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	pair, err := o.authenticator.IssueTokens(ctx, user, int64(app.ID), 0)
+	if err != nil {
+		if errors.Is(err, auth.ErrEmailNotVerified) {
+			return Tokens{}, newError(ErrCodeAccessDenied, "the email address is not verified")
+		}
+		log.Error("failed to issue tokens", sl.Err(err))
+
+		return Tokens{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	tokens := Tokens{
+		AccessToken:  pair.AccessToken,
+		RefreshToken: pair.RefreshToken,
+		ExpiresIn:    o.tokenTTL,
+		Scope:        code.Scope,
+	}
+	if slices.Contains(strings.Fields(code.Scope), ScopeOpenID) {
+		tokens.IDToken, err = o.newIDToken(ctx, user, clientID, "", now)
+		if err != nil {
+			return Tokens{}, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	log.Info("device authorization completed", slog.String("user_id", user.ID.String()))
+
+	return tokens, nil
+}
+
+// FormatUserCode splits a user code in two halves for readability.
+func FormatUserCode(code string) string {
+	if len(code) != userCodeLength {
+		return code
+	}
+	return code[:userCodeLength/2] + "-" + code[userCodeLength/2:]
+}
+
+// normalizeUserCode undoes FormatUserCode and forgives the usual typing
+// mistakes: lower case letters, spaces and dashes.
+func normalizeUserCode(code string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, strings.ToUpper(code))
+}
+
+func newUserCode() (string, error) {
+	max := big.NewInt(int64(len(userCodeAlphabet)))
+
+	code := make([]byte, userCodeLength)
+	for i := range code {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		code[i] = userCodeAlphabet[n.Int64()]
+	}
+
+	return string(code), nil
+}
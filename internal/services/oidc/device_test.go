@@ -0,0 +1,23 @@
+package oidc
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUserCode(t *testing.T) {
+	code, err := newUserCode()
+	require.NoError(t, err)
+	require.Len(t, code, userCodeLength)
+	for _, r := range code {
+		assert.True(t, strings.ContainsRune(userCodeAlphabet, r), "unexpected rune %q", r)
+	}
+
+	formatted := FormatUserCode(code)
+	assert.Equal(t, code[:4]+"-"+code[4:], formatted)
+	assert.Equal(t, code, normalizeUserCode(formatted))
+	assert.Equal(t, code, normalizeUserCode(strings.ToLower(code[:4]+" "+code[4:])))
+}
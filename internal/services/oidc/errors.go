@@ -0,0 +1,35 @@
+package oidc
+
+// Error is an OAuth 2.0 error response as defined in RFC 6749 section 5.2.
+type Error struct {
+	Code        string
+	Description string
+}
+
+func (e *Error) Error() string {
+	if e.Description == "" {
+		return e.Code
+	}
+	return e.Code + ": " + e.Description
+}
+
+const (
+	ErrCodeInvalidRequest          = "invalid_request"
+	ErrCodeInvalidClient           = "invalid_client"
+	ErrCodeInvalidGrant            = "invalid_grant"
+	ErrCodeInvalidScope            = "invalid_scope"
+	ErrCodeUnauthorizedClient      = "unauthorized_client"
+	ErrCodeUnsupportedGrantType    = "unsupported_grant_type"
+	ErrCodeUnsupportedResponseType = "unsupported_response_type"
+	ErrCodeAccessDenied            = "access_denied"
+	ErrCodeInvalidToken            = "invalid_token"
+
+	// Device authorization grant errors, RFC 8628 section 3.5.
+	ErrCodeAuthorizationPending = "authorization_pending"
+	ErrCodeSlowDown             = "slow_down"
+	ErrCodeExpiredToken         = "expired_token"
+)
+
+func newError(code, description string) *Error {
+	return &Error{Code: code, Description: description}
+}
@@ -0,0 +1,514 @@
+package oidc
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Novochenko/sso/domain/models"
+	"github.com/Novochenko/sso/internal/lib/jwt"
+	"github.com/Novochenko/sso/internal/lib/logger/sl"
+	"github.com/Novochenko/sso/internal/lib/opaque"
+	"github.com/Novochenko/sso/internal/services/auth"
+	"github.com/Novochenko/sso/internal/storage"
+	"github.com/google/uuid"
+)
+
+const (
+	ScopeOpenID  = "openid"
+	ScopeEmail   = "email"
+	ScopeProfile = "profile"
+
+	ResponseTypeCode = "code"
+)
+
+var (
+	ErrInvalidSession = errors.New("invalid login session")
+)
+
+type OIDC struct {
+	log           *slog.Logger
+	authenticator Authenticator
+	userProvider  UserProvider
+	userFinder    UserFinder
+	appProvider   AppProvider
+	codeStorage   CodeStorage
+	deviceStorage DeviceStorage
+	keyProvider   KeyProvider
+	throttler     DeviceThrottler
+	issuer        string
+	codeTTL       time.Duration
+	tokenTTL      time.Duration
+	sessionTTL    time.Duration
+	deviceCodeTTL time.Duration
+	pollInterval  time.Duration
+	// deviceMaxAttempts is how many failed sign-ins to approve a user code
+	// lock it.
+	deviceMaxAttempts int
+}
+
+type Authenticator interface {
+	VerifyCredentials(ctx context.Context, email, password string) (models.User, error)
+	VerifySecondFactor(ctx context.Context, userID uuid.UUID, code string) error
+	IssueTokens(ctx context.Context, user models.User, appID, orgID int64) (models.TokenPair, error)
+	Authenticate(ctx context.Context, token string) (jwt.Claims, error)
+	AuthenticateSession(ctx context.Context, token string) (jwt.Claims, error)
+	RefreshForApp(ctx context.Context, refreshToken string, appID int64) (models.TokenPair, error)
+	ClientCredentials(ctx context.Context, appID int64, secret string, scopes []string) (models.ClientToken, error)
+}
+
+type UserProvider interface {
+	UserByID(ctx context.Context, userID uuid.UUID) (models.User, error)
+}
+
+type UserFinder interface {
+	UserAccountById(ctx context.Context, userID uuid.UUID, orgID int64) (models.UserAccount, error)
+}
+
+type AppProvider interface {
+	App(ctx context.Context, appID int64) (models.App, error)
+	AppRedirectURIs(ctx context.Context, appID int64) ([]string, error)
+}
+
+type CodeStorage interface {
+	SaveAuthorizationCode(ctx context.Context, code models.AuthorizationCode) error
+	ConsumeAuthorizationCode(ctx context.Context, codeHash string) (models.AuthorizationCode, error)
+}
+
+type DeviceStorage interface {
+	SaveDeviceCode(ctx context.Context, code models.DeviceCode) error
+	DeviceCodeByUserCode(ctx context.Context, userCode string) (models.DeviceCode, error)
+	DecideDeviceCode(ctx context.Context, userCode string, userID uuid.UUID, status string) error
+	PollDeviceCode(ctx context.Context, deviceCodeHash string) (models.DeviceCode, error)
+	SetDeviceCodePollInterval(ctx context.Context, deviceCodeHash string, interval time.Duration) error
+	LockDeviceCode(ctx context.Context, userCode string) error
+}
+
+// DeviceThrottler counts wrong user codes per address and failed sign-ins
+// per user code on the device verification page.
+type DeviceThrottler interface {
+	DeviceWait(ctx context.Context, ip, userCode string) (time.Duration, error)
+	DeviceFailure(ctx context.Context, ip, userCode string) (int, error)
+}
+
+type KeyProvider interface {
+	SigningKey(ctx context.Context) (jwt.SigningKey, error)
+}
+
+// AuthorizeRequest holds the parameters of an authorization request.
+type AuthorizeRequest struct {
+	ResponseType        string
+	ClientID            string
+	RedirectURI         string
+	Scope               string
+	State               string
+	Nonce               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+}
+
+// Tokens is a successful token endpoint response.
+type Tokens struct {
+	AccessToken  string
+	RefreshToken string
+	IDToken      string
+	ExpiresIn    time.Duration
+	Scope        string
+}
+
+// UserInfo holds the claims returned by the userinfo endpoint.
+type UserInfo struct {
+	Subject           string
+	Email             string
+	PreferredUsername string
+	Picture           string
+}
+
+func New(
+	log *slog.Logger,
+	authenticator Authenticator,
+	userProvider UserProvider,
+	userFinder UserFinder,
+	appProvider AppProvider,
+	codeStorage CodeStorage,
+	deviceStorage DeviceStorage,
+	keyProvider KeyProvider,
+	throttler DeviceThrottler,
+	issuer string,
+	codeTTL time.Duration,
+	tokenTTL time.Duration,
+	sessionTTL time.Duration,
+	deviceCodeTTL time.Duration,
+	pollInterval time.Duration,
+	deviceMaxAttempts int,
+) *OIDC {
+	return &OIDC{
+		log:               log,
+		authenticator:     authenticator,
+		userProvider:      userProvider,
+		userFinder:        userFinder,
+		appProvider:       appProvider,
+		codeStorage:       codeStorage,
+		deviceStorage:     deviceStorage,
+		keyProvider:       keyProvider,
+		throttler:         throttler,
+		issuer:            issuer,
+		codeTTL:           codeTTL,
+		tokenTTL:          tokenTTL,
+		sessionTTL:        sessionTTL,
+		deviceCodeTTL:     deviceCodeTTL,
+		pollInterval:      pollInterval,
+		deviceMaxAttempts: deviceMaxAttempts,
+	}
+}
+
+func (o *OIDC) Issuer() string {
+	return o.issuer
+}
+
+// ValidateRedirect checks the client and its redirect URI. Until it
+// succeeds, errors must be shown to the user instead of being sent to the
+// redirect URI.
+func (o *OIDC) ValidateRedirect(ctx context.Context, clientID, redirectURI string) (models.App, error) {
+	const op = "oidc.ValidateRedirect"
+
+	app, err := o.client(ctx, clientID)
+	if err != nil {
+		return models.App{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	uris, err := o.appProvider.AppRedirectURIs(ctx, int64(app.ID))
+	if err != nil {
+		return models.App{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if !slices.Contains(uris, redirectURI) {
+		return models.App{}, newError(ErrCodeInvalidRequest, "redirect_uri is not registered for the client")
+	}
+
+	return app, nil
+}
+
+// ValidateAuthorizeRequest checks the parameters that are reported back to
+// the client through the redirect URI.
+func (o *OIDC) ValidateAuthorizeRequest(req AuthorizeRequest) error {
+	if req.ResponseType != ResponseTypeCode {
+		return newError(ErrCodeUnsupportedResponseType, "only the code response type is supported")
+	}
+	if !slices.Contains(strings.Fields(req.Scope), ScopeOpenID) {
+		return newError(ErrCodeInvalidScope, "the openid scope is required")
+	}
+	for _, scope := range strings.Fields(req.Scope) {
+		if !slices.Contains(SupportedScopes(), scope) {
+			return newError(ErrCodeInvalidScope, "unsupported scope "+scope)
+		}
+	}
+	if req.CodeChallenge == "" {
+		return newError(ErrCodeInvalidRequest, "code_challenge is required")
+	}
+	if req.CodeChallengeMethod != CodeChallengeS256 {
+		return newError(ErrCodeInvalidRequest, "code_challenge_method must be S256")
+	}
+
+	return nil
+}
+
+// Login checks the user's credentials, and the one-time code of users with a
+// second factor, and returns a token for the login session cookie of the
+// authorization endpoint.
+func (o *OIDC) Login(ctx context.Context, email, password, code string) (string, error) {
+	const op = "oidc.Login"
+
+	user, err := o.authenticator.VerifyCredentials(ctx, email, password)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+	if err := o.authenticator.VerifySecondFactor(ctx, user.ID, code); err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	key, err := o.keyProvider.SigningKey(ctx)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+	session, err := jwt.NewActionToken(user.ID, user.Email, jwt.PurposeLoginSession, o.sessionTTL, key)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	return session, nil
+}
+
+// Session verifies a login session token.
+func (o *OIDC) Session(ctx context.Context, session string) (jwt.Claims, error) {
+	const op = "oidc.Session"
+
+	claims, err := o.authenticator.AuthenticateSession(ctx, session)
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidToken) {
+			return jwt.Claims{}, fmt.Errorf("%s: %w", op, ErrInvalidSession)
+		}
+
+		return jwt.Claims{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return claims, nil
+}
+
+func (o *OIDC) SessionTTL() time.Duration {
+	return o.sessionTTL
+}
+
+// IssueCode creates an authorization code for the validated request.
+func (o *OIDC) IssueCode(ctx context.Context, req AuthorizeRequest, session jwt.Claims) (string, error) {
+	const op = "oidc.IssueCode"
+
+	app, err := o.client(ctx, req.ClientID)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	code, err := opaque.New()
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = o.codeStorage.SaveAuthorizationCode(ctx, models.AuthorizationCode{
+		CodeHash:            opaque.Hash(code),
+		AppID:               app.ID,
+		UserID:              session.UserID,
+		RedirectURI:         req.RedirectURI,
+		Scope:               req.Scope,
+		Nonce:               req.Nonce,
+		CodeChallenge:       req.CodeChallenge,
+		CodeChallengeMethod: req.CodeChallengeMethod,
+		AuthTime:            session.IssuedAt,
+		ExpiresAt:           time.Now().Add(o.codeTTL),
+	})
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	o.log.Info("authorization code issued",
+		slog.String("op", op),
+		slog.String("user_id", session.UserID.String()),
+		slog.Int("app_id", app.ID),
+	)
+
+	return code, nil
+}
+
+// ExchangeCode redeems an authorization code at the token endpoint.
+func (o *OIDC) ExchangeCode(
+	ctx context.Context,
+	clientID string,
+	clientSecret string,
+	code string,
+	redirectURI string,
+	codeVerifier string,
+) (Tokens, error) {
+	const op = "oidc.ExchangeCode"
+
+	log := o.log.With(slog.String("op", op), slog.String("client_id", clientID))
+
+	app, err := o.authenticateClient(ctx, clientID, clientSecret)
+	if err != nil {
+		return Tokens{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	authCode, err := o.codeStorage.ConsumeAuthorizationCode(ctx, opaque.Hash(code))
+	if err != nil {
+		if errors.Is(err, storage.ErrAuthorizationCodeNotFound) {
+			log.Warn("unknown, expired or reused authorization code")
+			return Tokens{}, newError(ErrCodeInvalidGrant, "invalid authorization code")
+		}
+
+		return Tokens{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if authCode.AppID != app.ID || authCode.RedirectURI != redirectURI {
+		return Tokens{}, newError(ErrCodeInvalidGrant, "invalid authorization code")
+	}
+	if !verifyPKCE(authCode.CodeChallenge, codeVerifier) {
+		log.Warn("PKCE verification failed")
+		return Tokens{}, newError(ErrCodeInvalidGrant, "code_verifier does not match")
+	}
+
+	user, err := o.userProvider.UserByID(ctx, authCode.UserID)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return Tokens{}, newError(ErrCodeInvalidGrant, "invalid authorization code")
+		}
+
+		return Tokens{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	pair, err := o.authenticator.IssueTokens(ctx, user, int64(app.ID), 0)
+	if err != nil {
+		if errors.Is(err, auth.ErrEmailNotVerified) {
+			return Tokens{}, newError(ErrCodeAccessDenied, "the email address is not verified")
+		}
+		log.Error("failed to issue tokens", sl.Err(err))
+
+		return Tokens{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	idToken, err := o.newIDToken(ctx, user, clientID, authCode.Nonce, authCode.AuthTime)
+	if err != nil {
+		return Tokens{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("authorization code exchanged", slog.String("user_id", user.ID.String()))
+
+	return Tokens{
+		AccessToken:  pair.AccessToken,
+		RefreshToken: pair.RefreshToken,
+		IDToken:      idToken,
+		ExpiresIn:    o.tokenTTL,
+		Scope:        authCode.Scope,
+	}, nil
+}
+
+// RefreshTokens implements the refresh_token grant of the token endpoint.
+func (o *OIDC) RefreshTokens(ctx context.Context, clientID, clientSecret, refreshToken string) (Tokens, error) {
+	const op = "oidc.RefreshTokens"
+
+	app, err := o.authenticateClient(ctx, clientID, clientSecret)
+	if err != nil {
+		return Tokens{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	pair, err := o.authenticator.RefreshForApp(ctx, refreshToken, int64(app.ID))
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidRefreshToken) || errors.Is(err, auth.ErrRefreshTokenReused) {
+			return Tokens{}, newError(ErrCodeInvalidGrant, "invalid refresh token")
+		}
+
+		return Tokens{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return Tokens{
+		AccessToken:  pair.AccessToken,
+		RefreshToken: pair.RefreshToken,
+		ExpiresIn:    o.tokenTTL,
+	}, nil
+}
+
+// ClientCredentials implements the client_credentials grant of the token
+// endpoint. Only confidential clients can use it.
+func (o *OIDC) ClientCredentials(ctx context.Context, clientID, clientSecret, scope string) (Tokens, error) {
+	const op = "oidc.ClientCredentials"
+
+	appID, err := strconv.ParseInt(clientID, 10, 64)
+	if err != nil {
+		return Tokens{}, newError(ErrCodeInvalidClient, "unknown client")
+	}
+
+	token, err := o.authenticator.ClientCredentials(ctx, appID, clientSecret, strings.Fields(scope))
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidClient) {
+			return Tokens{}, newError(ErrCodeInvalidClient, "client authentication failed")
+		}
+		if errors.Is(err, auth.ErrInvalidScope) {
+			return Tokens{}, newError(ErrCodeInvalidScope, "scope not granted to client")
+		}
+
+		return Tokens{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return Tokens{
+		AccessToken: token.AccessToken,
+		ExpiresIn:   token.ExpiresIn,
+		Scope:       strings.Join(token.Scopes, " "),
+	}, nil
+}
+
+// UserInfo returns the claims about the owner of the access token.
+func (o *OIDC) UserInfo(ctx context.Context, accessToken string) (UserInfo, error) {
+	const op = "oidc.UserInfo"
+
+	claims, err := o.authenticator.Authenticate(ctx, accessToken)
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidToken) {
+			return UserInfo{}, newError(ErrCodeInvalidToken, "invalid access token")
+		}
+
+		return UserInfo{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if claims.IsClient() {
+		return UserInfo{}, newError(ErrCodeInvalidToken, "invalid access token")
+	}
+
+	account, err := o.userFinder.UserAccountById(ctx, claims.UserID, 0)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return UserInfo{}, newError(ErrCodeInvalidToken, "invalid access token")
+		}
+
+		return UserInfo{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return UserInfo{
+		Subject:           account.UserId.String(),
+		Email:             claims.Email,
+		PreferredUsername: account.UserName,
+		Picture:           account.ProfilePicturePath,
+	}, nil
+}
+
+func (o *OIDC) newIDToken(ctx context.Context, user models.User, clientID, nonce string, authTime time.Time) (string, error) {
+	key, err := o.keyProvider.SigningKey(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	return jwt.NewIDToken(jwt.IDToken{
+		Issuer:   o.issuer,
+		Subject:  user.ID.String(),
+		Audience: clientID,
+		Email:    user.Email,
+		Nonce:    nonce,
+		AuthTime: authTime,
+	}, o.tokenTTL, key)
+}
+
+func SupportedScopes() []string {
+	return []string{ScopeOpenID, ScopeEmail, ScopeProfile}
+}
+
+func (o *OIDC) client(ctx context.Context, clientID string) (models.App, error) {
+	appID, err := strconv.ParseInt(clientID, 10, 64)
+	if err != nil {
+		return models.App{}, newError(ErrCodeInvalidClient, "unknown client")
+	}
+
+	app, err := o.appProvider.App(ctx, appID)
+	if err != nil {
+		if errors.Is(err, storage.ErrAppNotFound) {
+			return models.App{}, newError(ErrCodeInvalidClient, "unknown client")
+		}
+
+		return models.App{}, err
+	}
+
+	return app, nil
+}
+
+// authenticateClient looks the client up and checks its secret. Confidential
+// clients, apps with a secret, must send it; public clients have none and are
+// bound by PKCE instead.
+func (o *OIDC) authenticateClient(ctx context.Context, clientID, clientSecret string) (models.App, error) {
+	app, err := o.client(ctx, clientID)
+	if err != nil {
+		return models.App{}, err
+	}
+	if (app.Secret != "" || clientSecret != "") && subtle.ConstantTimeCompare([]byte(clientSecret), []byte(app.Secret)) != 1 {
+		return models.App{}, newError(ErrCodeInvalidClient, "client authentication failed")
+	}
+
+	return app, nil
+}
@@ -0,0 +1,27 @@
+package oidc
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+)
+
+const (
+	CodeChallengeS256 = "S256"
+
+	minVerifierLen = 43
+	maxVerifierLen = 128
+)
+
+// verifyPKCE checks the code verifier against the S256 challenge sent to the
+// authorization endpoint (RFC 7636 section 4.6).
+func verifyPKCE(challenge, verifier string) bool {
+	if len(verifier) < minVerifierLen || len(verifier) > maxVerifierLen {
+		return false
+	}
+
+	sum := sha256.Sum256([]byte(verifier))
+	computed := base64.RawURLEncoding.EncodeToString(sum[:])
+
+	return subtle.ConstantTimeCompare([]byte(computed), []byte(challenge)) == 1
+}
@@ -0,0 +1,19 @@
+package oidc
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerifyPKCE(t *testing.T) {
+	// RFC 7636 appendix B.
+	const (
+		verifier  = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+		challenge = "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+	)
+
+	assert.True(t, verifyPKCE(challenge, verifier))
+	assert.False(t, verifyPKCE(challenge, verifier+"x"))
+	assert.False(t, verifyPKCE(challenge, "short"))
+}
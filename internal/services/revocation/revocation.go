@@ -0,0 +1,239 @@
+package revocation
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/Novochenko/sso/internal/lib/bloom"
+	"github.com/Novochenko/sso/internal/lib/jwt"
+	"github.com/Novochenko/sso/internal/lib/logger/sl"
+	"github.com/google/uuid"
+)
+
+const (
+	// minFilterSize keeps the false positive rate low while the filter
+	// fills up between two reloads.
+	minFilterSize     = 10000
+	falsePositiveRate = 0.001
+)
+
+// Revocation keeps track of revoked access tokens. Single tokens are revoked
+// by their jti; all tokens of a user are revoked by moving the user's
+// watermark, which invalidates every token issued at or before it; all
+// tokens of a login session by revoking the session, which is matched
+// against their sid.
+//
+// Revoked jtis are cached in a Bloom filter, so only tokens that may be
+// revoked hit the database. The cache is rebuilt from storage every refresh
+// interval, which is also how long it takes for a revocation made on another
+// replica to be seen.
+type Revocation struct {
+	log             *slog.Logger
+	storage         Storage
+	tokenTTL        time.Duration
+	refreshInterval time.Duration
+
+	mu         sync.RWMutex
+	filter     *bloom.Filter
+	watermarks map[uuid.UUID]time.Time
+	sessions   map[uuid.UUID]bool
+
+	done chan struct{}
+}
+
+type Storage interface {
+	RevokeToken(ctx context.Context, jti string, userID uuid.UUID, expiresAt time.Time) error
+	IsTokenRevoked(ctx context.Context, jti string) (bool, error)
+	RevokedTokens(ctx context.Context) ([]string, error)
+	DeleteExpiredRevokedTokens(ctx context.Context) error
+	DeleteExpiredActionTokens(ctx context.Context) error
+	DeleteExpiredCredentials(ctx context.Context, sessionsBefore time.Time) error
+	RevokeUserTokens(ctx context.Context, userID uuid.UUID, before time.Time) error
+	TokenWatermarks(ctx context.Context, since time.Time) (map[uuid.UUID]time.Time, error)
+	RevokeSession(ctx context.Context, id uuid.UUID, at time.Time) error
+	RevokedSessions(ctx context.Context, since time.Time) ([]uuid.UUID, error)
+}
+
+func New(
+	log *slog.Logger,
+	storage Storage,
+	tokenTTL time.Duration,
+	refreshInterval time.Duration,
+) *Revocation {
+	return &Revocation{
+		log:             log,
+		storage:         storage,
+		tokenTTL:        tokenTTL,
+		refreshInterval: refreshInterval,
+		filter:          bloom.New(minFilterSize, falsePositiveRate),
+		watermarks:      make(map[uuid.UUID]time.Time),
+		sessions:        make(map[uuid.UUID]bool),
+		done:            make(chan struct{}),
+	}
+}
+
+func (r *Revocation) MustLoad(ctx context.Context) {
+	if err := r.Load(ctx); err != nil {
+		panic(err)
+	}
+}
+
+// Load rebuilds the in-memory cache from storage.
+func (r *Revocation) Load(ctx context.Context) error {
+	const op = "revocation.Load"
+
+	jtis, err := r.storage.RevokedTokens(ctx)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	// Older watermarks and sessions cannot match any token that is still
+	// valid.
+	since := time.Now().Add(-r.tokenTTL)
+	watermarks, err := r.storage.TokenWatermarks(ctx, since)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	revokedSessions, err := r.storage.RevokedSessions(ctx, since)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	sessions := make(map[uuid.UUID]bool, len(revokedSessions))
+	for _, id := range revokedSessions {
+		sessions[id] = true
+	}
+
+	filter := bloom.New(max(minFilterSize, 2*len(jtis)), falsePositiveRate)
+	for _, jti := range jtis {
+		filter.Add(jti)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.filter = filter
+	r.watermarks = watermarks
+	r.sessions = sessions
+
+	return nil
+}
+
+// Run reloads the cache and purges expired revocations, used action tokens
+// and credentials every refresh interval. It blocks until Stop is called.
+func (r *Revocation) Run() {
+	const op = "revocation.Run"
+
+	log := r.log.With(slog.String("op", op))
+
+	ticker := time.NewTicker(r.refreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.done:
+			return
+		case <-ticker.C:
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), r.refreshInterval)
+		if err := r.storage.DeleteExpiredRevokedTokens(ctx); err != nil {
+			log.Error("failed to purge expired revoked tokens", sl.Err(err))
+		}
+		if err := r.storage.DeleteExpiredActionTokens(ctx); err != nil {
+			log.Error("failed to purge expired used action tokens", sl.Err(err))
+		}
+		// A revoked session must outlive its last access token.
+		if err := r.storage.DeleteExpiredCredentials(ctx, time.Now().Add(-r.tokenTTL)); err != nil {
+			log.Error("failed to purge expired credentials", sl.Err(err))
+		}
+		if err := r.Load(ctx); err != nil {
+			log.Error("failed to reload revoked tokens", sl.Err(err))
+		}
+		cancel()
+	}
+}
+
+func (r *Revocation) Stop() {
+	const op = "revocation.Stop"
+
+	r.log.With(slog.String("op", op)).Info("stopping revocation cache refresh")
+
+	close(r.done)
+}
+
+func (r *Revocation) RevokeToken(ctx context.Context, claims jwt.Claims) error {
+	const op = "revocation.RevokeToken"
+
+	if err := r.storage.RevokeToken(ctx, claims.TokenID, claims.UserID, claims.ExpiresAt); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	r.mu.Lock()
+	r.filter.Add(claims.TokenID)
+	r.mu.Unlock()
+
+	return nil
+}
+
+// RevokeUser revokes every token issued to the user so far.
+func (r *Revocation) RevokeUser(ctx context.Context, userID uuid.UUID) error {
+	const op = "revocation.RevokeUser"
+
+	// Access tokens carry their issue time to the millisecond, so a token
+	// issued right after the revocation is still accepted.
+	before := time.Now().Truncate(time.Millisecond)
+	if err := r.storage.RevokeUserTokens(ctx, userID, before); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	r.mu.Lock()
+	r.watermarks[userID] = before
+	r.mu.Unlock()
+
+	return nil
+}
+
+// RevokeSession ends the login session: its refresh tokens can no longer be
+// used and its access tokens are rejected.
+func (r *Revocation) RevokeSession(ctx context.Context, sessionID uuid.UUID) error {
+	const op = "revocation.RevokeSession"
+
+	if err := r.storage.RevokeSession(ctx, sessionID, time.Now()); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	r.mu.Lock()
+	r.sessions[sessionID] = true
+	r.mu.Unlock()
+
+	return nil
+}
+
+func (r *Revocation) IsRevoked(ctx context.Context, claims jwt.Claims) (bool, error) {
+	const op = "revocation.IsRevoked"
+
+	r.mu.RLock()
+	watermark, hasWatermark := r.watermarks[claims.UserID]
+	sessionRevoked := r.sessions[claims.SessionID]
+	maybeRevoked := r.filter.Test(claims.TokenID)
+	r.mu.RUnlock()
+
+	if hasWatermark && !claims.IssuedAt.After(watermark) {
+		return true, nil
+	}
+	if claims.SessionID != uuid.Nil && sessionRevoked {
+		return true, nil
+	}
+	if !maybeRevoked {
+		return false, nil
+	}
+
+	revoked, err := r.storage.IsTokenRevoked(ctx, claims.TokenID)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return revoked, nil
+}
@@ -0,0 +1,86 @@
+package revocation
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/Novochenko/sso/internal/lib/jwt"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeStorage struct {
+	watermarks map[uuid.UUID]time.Time
+}
+
+func (s *fakeStorage) RevokeToken(context.Context, string, uuid.UUID, time.Time) error { return nil }
+
+func (s *fakeStorage) IsTokenRevoked(context.Context, string) (bool, error) { return false, nil }
+
+func (s *fakeStorage) RevokedTokens(context.Context) ([]string, error) { return nil, nil }
+
+func (s *fakeStorage) DeleteExpiredRevokedTokens(context.Context) error { return nil }
+
+func (s *fakeStorage) DeleteExpiredActionTokens(context.Context) error { return nil }
+
+func (s *fakeStorage) DeleteExpiredCredentials(context.Context, time.Time) error { return nil }
+
+func (s *fakeStorage) RevokeUserTokens(_ context.Context, userID uuid.UUID, before time.Time) error {
+	s.watermarks[userID] = before
+
+	return nil
+}
+
+func (s *fakeStorage) TokenWatermarks(context.Context, time.Time) (map[uuid.UUID]time.Time, error) {
+	watermarks := make(map[uuid.UUID]time.Time, len(s.watermarks))
+	for userID, before := range s.watermarks {
+		watermarks[userID] = before
+	}
+
+	return watermarks, nil
+}
+
+func (s *fakeStorage) RevokeSession(context.Context, uuid.UUID, time.Time) error { return nil }
+
+func (s *fakeStorage) RevokedSessions(context.Context, time.Time) ([]uuid.UUID, error) {
+	return nil, nil
+}
+
+func TestRevocation_RevokeUser(t *testing.T) {
+	ctx := context.Background()
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	storage := &fakeStorage{watermarks: make(map[uuid.UUID]time.Time)}
+	r := New(log, storage, time.Hour, time.Minute)
+
+	userID := uuid.New()
+	old := jwt.Claims{TokenID: uuid.NewString(), UserID: userID, IssuedAt: time.Now().Truncate(time.Millisecond)}
+	time.Sleep(2 * time.Millisecond)
+	require.NoError(t, r.RevokeUser(ctx, userID))
+	// A re-login in the same second as the revocation.
+	time.Sleep(2 * time.Millisecond)
+	relogin := jwt.Claims{TokenID: uuid.NewString(), UserID: userID, IssuedAt: time.Now().Truncate(time.Millisecond)}
+
+	reloaded := New(log, storage, time.Hour, time.Minute)
+	require.NoError(t, reloaded.Load(ctx))
+
+	for name, r := range map[string]*Revocation{"cached": r, "reloaded": reloaded} {
+		t.Run(name, func(t *testing.T) {
+			revoked, err := r.IsRevoked(ctx, old)
+			require.NoError(t, err)
+			assert.True(t, revoked)
+
+			revoked, err = r.IsRevoked(ctx, relogin)
+			require.NoError(t, err)
+			assert.False(t, revoked)
+
+			other := jwt.Claims{TokenID: uuid.NewString(), UserID: uuid.New(), IssuedAt: old.IssuedAt}
+			revoked, err = r.IsRevoked(ctx, other)
+			require.NoError(t, err)
+			assert.False(t, revoked)
+		})
+	}
+}
@@ -0,0 +1,323 @@
+package throttle
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/Novochenko/sso/domain/models"
+	"github.com/Novochenko/sso/internal/lib/logger/sl"
+	"github.com/google/uuid"
+)
+
+// Policy decides how long logins are refused after a number of failures in
+// a row. The first FreeAttempts failures cost nothing; every further one
+// doubles the wait, starting at BaseDelay and capped at MaxDelay. From
+// LockoutThreshold failures on, if it is not zero, the wait is
+// LockoutDuration. The zero Policy never refuses a login.
+type Policy struct {
+	FreeAttempts     int
+	BaseDelay        time.Duration
+	MaxDelay         time.Duration
+	LockoutThreshold int
+	LockoutDuration  time.Duration
+}
+
+// Delay is how long after the last of the given number of failures the
+// next login is allowed.
+func (p Policy) Delay(failures int) time.Duration {
+	if p.LockoutThreshold > 0 && failures >= p.LockoutThreshold {
+		return p.LockoutDuration
+	}
+	if failures <= p.FreeAttempts {
+		return 0
+	}
+
+	delay := p.BaseDelay
+	for i := p.FreeAttempts + 1; i < failures && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+
+	return min(delay, p.MaxDelay)
+}
+
+// Throttle slows down password guessing. Failed logins are counted per
+// account and per source address, each with its own policy, and a login is
+// refused while either of them says to wait. The count of an account starts
+// over on a successful login; both start over once the last failure is
+// older than the window.
+type Throttle struct {
+	log     *slog.Logger
+	storage Storage
+	account Policy
+	ip      Policy
+	window  time.Duration
+
+	done chan struct{}
+}
+
+// Storage keeps the counts. A key without failures on record has a zero
+// count.
+type Storage interface {
+	LoginFailures(ctx context.Context, key string) (models.LoginFailures, error)
+	AddLoginFailure(ctx context.Context, key string, at, resetBefore time.Time) error
+	ClearLoginFailures(ctx context.Context, key string) error
+	DeleteLoginFailures(ctx context.Context, before time.Time) (int64, error)
+}
+
+func New(
+	log *slog.Logger,
+	storage Storage,
+	account Policy,
+	ip Policy,
+	window time.Duration,
+) *Throttle {
+	return &Throttle{
+		log:     log,
+		storage: storage,
+		account: account,
+		ip:      ip,
+		window:  window,
+		done:    make(chan struct{}),
+	}
+}
+
+// Wait returns how long logins to the account with the given email, or from
+// the given address, are still refused; zero if they are allowed. An empty
+// ip is not throttled.
+func (t *Throttle) Wait(ctx context.Context, email, ip string) (time.Duration, error) {
+	const op = "throttle.Wait"
+
+	now := time.Now()
+	wait, err := t.wait(ctx, accountKey(email), t.account, now)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	if ip != "" {
+		ipWait, err := t.wait(ctx, ipKey(ip), t.ip, now)
+		if err != nil {
+			return 0, fmt.Errorf("%s: %w", op, err)
+		}
+		wait = max(wait, ipWait)
+	}
+
+	return wait, nil
+}
+
+func (t *Throttle) wait(ctx context.Context, key string, policy Policy, now time.Time) (time.Duration, error) {
+	failures, err := t.storage.LoginFailures(ctx, key)
+	if err != nil {
+		return 0, err
+	}
+	if failures.Failures == 0 || failures.LastFailureAt.Before(now.Add(-t.window)) {
+		return 0, nil
+	}
+
+	return max(failures.LastFailureAt.Add(policy.Delay(failures.Failures)).Sub(now), 0), nil
+}
+
+// Failure counts a failed login to the account with the given email from
+// the given address.
+func (t *Throttle) Failure(ctx context.Context, email, ip string) error {
+	const op = "throttle.Failure"
+
+	now := time.Now()
+	keys := []string{accountKey(email)}
+	if ip != "" {
+		keys = append(keys, ipKey(ip))
+	}
+	for _, key := range keys {
+		if err := t.storage.AddLoginFailure(ctx, key, now, now.Add(-t.window)); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	return nil
+}
+
+// Reset starts the count of the account with the given email over, after a
+// successful login or to lift a lockout. The count of the address is left
+// alone, so that signing in to an account of one's own does not make up
+// for guesses at others.
+func (t *Throttle) Reset(ctx context.Context, email string) error {
+	const op = "throttle.Reset"
+
+	if err := t.storage.ClearLoginFailures(ctx, accountKey(email)); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// SecondFactorWait returns how long one-time codes of the user are still
+// refused. Wrong codes are counted apart from wrong passwords, under the
+// account policy, so that entering the right password again does not start
+// their count over.
+func (t *Throttle) SecondFactorWait(ctx context.Context, userID uuid.UUID) (time.Duration, error) {
+	const op = "throttle.SecondFactorWait"
+
+	wait, err := t.wait(ctx, secondFactorKey(userID), t.account, time.Now())
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return wait, nil
+}
+
+// SecondFactorFailure counts a wrong one-time code of the user and returns
+// how many there have been in a row.
+func (t *Throttle) SecondFactorFailure(ctx context.Context, userID uuid.UUID) (int, error) {
+	const op = "throttle.SecondFactorFailure"
+
+	now := time.Now()
+	key := secondFactorKey(userID)
+	if err := t.storage.AddLoginFailure(ctx, key, now, now.Add(-t.window)); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	failures, err := t.storage.LoginFailures(ctx, key)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return failures.Failures, nil
+}
+
+// SecondFactorReset starts the count of wrong one-time codes of the user
+// over once they pass their second factor.
+func (t *Throttle) SecondFactorReset(ctx context.Context, userID uuid.UUID) error {
+	const op = "throttle.SecondFactorReset"
+
+	if err := t.storage.ClearLoginFailures(ctx, secondFactorKey(userID)); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// DeviceWait returns how long the device verification page still refuses
+// user codes from the given address, or attempts at the given user code;
+// zero if they are allowed. User codes are short, so wrong ones count as
+// failed logins of the address. An empty ip or user code is not throttled.
+func (t *Throttle) DeviceWait(ctx context.Context, ip, userCode string) (time.Duration, error) {
+	const op = "throttle.DeviceWait"
+
+	now := time.Now()
+	var wait time.Duration
+	if ip != "" {
+		ipWait, err := t.wait(ctx, ipKey(ip), t.ip, now)
+		if err != nil {
+			return 0, fmt.Errorf("%s: %w", op, err)
+		}
+		wait = ipWait
+	}
+	if userCode != "" {
+		codeWait, err := t.wait(ctx, deviceKey(userCode), t.account, now)
+		if err != nil {
+			return 0, fmt.Errorf("%s: %w", op, err)
+		}
+		wait = max(wait, codeWait)
+	}
+
+	return wait, nil
+}
+
+// DeviceFailure counts a wrong user code from the given address, or a
+// failed sign-in to approve the given user code, and returns how many
+// failures there have been in a row for the user code. An empty ip or user
+// code is not counted.
+func (t *Throttle) DeviceFailure(ctx context.Context, ip, userCode string) (int, error) {
+	const op = "throttle.DeviceFailure"
+
+	now := time.Now()
+	if ip != "" {
+		if err := t.storage.AddLoginFailure(ctx, ipKey(ip), now, now.Add(-t.window)); err != nil {
+			return 0, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+	if userCode == "" {
+		return 0, nil
+	}
+
+	key := deviceKey(userCode)
+	if err := t.storage.AddLoginFailure(ctx, key, now, now.Add(-t.window)); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	failures, err := t.storage.LoginFailures(ctx, key)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return failures.Failures, nil
+}
+
+// Forget drops the counts kept for the user's account and second factor,
+// once the user is purged. The counts of the addresses they used are left
+// alone: they are not the user's alone.
+func (t *Throttle) Forget(ctx context.Context, userID uuid.UUID, email string) error {
+	const op = "throttle.Forget"
+
+	for _, key := range []string{accountKey(email), secondFactorKey(userID)} {
+		if err := t.storage.ClearLoginFailures(ctx, key); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	return nil
+}
+
+// Run forgets counts that have outlived the window, once every window. It
+// blocks until Stop is called.
+func (t *Throttle) Run() {
+	const op = "throttle.Run"
+
+	log := t.log.With(slog.String("op", op))
+
+	ticker := time.NewTicker(t.window)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-t.done:
+			return
+		case <-ticker.C:
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), t.window)
+		deleted, err := t.storage.DeleteLoginFailures(ctx, time.Now().Add(-t.window))
+		if err != nil {
+			log.Error("failed to delete stale login failures", sl.Err(err))
+		}
+		if deleted > 0 {
+			log.Debug("deleted stale login failures", slog.Int64("count", deleted))
+		}
+		cancel()
+	}
+}
+
+func (t *Throttle) Stop() {
+	const op = "throttle.Stop"
+
+	t.log.With(slog.String("op", op)).Info("stopping login throttle")
+
+	close(t.done)
+}
+
+// accountKey ignores case and surrounding spaces, so that variants of an
+// email share a count.
+func accountKey(email string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
+
+func secondFactorKey(userID uuid.UUID) string {
+	return "mfa:" + userID.String()
+}
+
+func deviceKey(userCode string) string {
+	return "device:" + userCode
+}
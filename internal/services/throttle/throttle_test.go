@@ -0,0 +1,188 @@
+package throttle
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/Novochenko/sso/internal/storage/memory"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPolicy_Delay(t *testing.T) {
+	policy := Policy{
+		FreeAttempts:     3,
+		BaseDelay:        time.Second,
+		MaxDelay:         10 * time.Second,
+		LockoutThreshold: 10,
+		LockoutDuration:  15 * time.Minute,
+	}
+
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{failures: 0, want: 0},
+		{failures: 3, want: 0},
+		{failures: 4, want: time.Second},
+		{failures: 5, want: 2 * time.Second},
+		{failures: 7, want: 8 * time.Second},
+		{failures: 8, want: 10 * time.Second},
+		{failures: 9, want: 10 * time.Second},
+		{failures: 10, want: 15 * time.Minute},
+		{failures: 1000, want: 15 * time.Minute},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, policy.Delay(tt.failures), "failures: %d", tt.failures)
+	}
+
+	assert.Zero(t, Policy{}.Delay(1000))
+}
+
+func TestThrottle(t *testing.T) {
+	ctx := context.Background()
+	throttle := New(
+		slog.New(slog.NewTextHandler(io.Discard, nil)),
+		memory.NewLoginFailures(),
+		Policy{FreeAttempts: 2, BaseDelay: time.Minute, MaxDelay: time.Hour},
+		Policy{FreeAttempts: 4, BaseDelay: time.Minute, MaxDelay: time.Hour},
+		time.Hour,
+	)
+
+	for range 2 {
+		require.NoError(t, throttle.Failure(ctx, "user@example.com", "192.0.2.1"))
+	}
+	wait, err := throttle.Wait(ctx, "user@example.com", "192.0.2.1")
+	require.NoError(t, err)
+	assert.Zero(t, wait)
+
+	require.NoError(t, throttle.Failure(ctx, " User@Example.com", "192.0.2.1"))
+	wait, err = throttle.Wait(ctx, "user@example.com", "198.51.100.1")
+	require.NoError(t, err)
+	assert.InDelta(t, time.Minute, wait, float64(time.Second))
+
+	// Another account from the same address is not throttled yet, but the
+	// address is after two more failures.
+	wait, err = throttle.Wait(ctx, "other@example.com", "192.0.2.1")
+	require.NoError(t, err)
+	assert.Zero(t, wait)
+	for range 2 {
+		require.NoError(t, throttle.Failure(ctx, "other@example.com", "192.0.2.1"))
+	}
+	wait, err = throttle.Wait(ctx, "other@example.com", "192.0.2.1")
+	require.NoError(t, err)
+	assert.InDelta(t, time.Minute, wait, float64(time.Second))
+
+	require.NoError(t, throttle.Reset(ctx, "user@example.com"))
+	wait, err = throttle.Wait(ctx, "user@example.com", "198.51.100.1")
+	require.NoError(t, err)
+	assert.Zero(t, wait)
+	wait, err = throttle.Wait(ctx, "user@example.com", "192.0.2.1")
+	require.NoError(t, err)
+	assert.NotZero(t, wait)
+}
+
+func TestThrottle_SecondFactor(t *testing.T) {
+	ctx := context.Background()
+	throttle := New(
+		slog.New(slog.NewTextHandler(io.Discard, nil)),
+		memory.NewLoginFailures(),
+		Policy{FreeAttempts: 2, BaseDelay: time.Minute, MaxDelay: time.Hour},
+		Policy{},
+		time.Hour,
+	)
+	userID := uuid.New()
+
+	for want := 1; want <= 3; want++ {
+		failures, err := throttle.SecondFactorFailure(ctx, userID)
+		require.NoError(t, err)
+		assert.Equal(t, want, failures)
+	}
+	wait, err := throttle.SecondFactorWait(ctx, userID)
+	require.NoError(t, err)
+	assert.InDelta(t, time.Minute, wait, float64(time.Second))
+
+	// A right password does not make up for wrong codes.
+	require.NoError(t, throttle.Reset(ctx, "user@example.com"))
+	wait, err = throttle.SecondFactorWait(ctx, userID)
+	require.NoError(t, err)
+	assert.NotZero(t, wait)
+
+	require.NoError(t, throttle.SecondFactorReset(ctx, userID))
+	wait, err = throttle.SecondFactorWait(ctx, userID)
+	require.NoError(t, err)
+	assert.Zero(t, wait)
+}
+
+func TestThrottle_Device(t *testing.T) {
+	ctx := context.Background()
+	throttle := New(
+		slog.New(slog.NewTextHandler(io.Discard, nil)),
+		memory.NewLoginFailures(),
+		Policy{FreeAttempts: 1, BaseDelay: time.Minute, MaxDelay: time.Hour},
+		Policy{FreeAttempts: 2, BaseDelay: time.Minute, MaxDelay: time.Hour},
+		time.Hour,
+	)
+
+	// Wrong user codes are counted against the address.
+	for range 3 {
+		failures, err := throttle.DeviceFailure(ctx, "10.0.0.1", "")
+		require.NoError(t, err)
+		assert.Zero(t, failures)
+	}
+	wait, err := throttle.DeviceWait(ctx, "10.0.0.1", "")
+	require.NoError(t, err)
+	assert.InDelta(t, time.Minute, wait, float64(time.Second))
+	wait, err = throttle.Wait(ctx, "user@example.com", "10.0.0.1")
+	require.NoError(t, err)
+	assert.NotZero(t, wait)
+	wait, err = throttle.DeviceWait(ctx, "10.0.0.2", "BCDFGHJK")
+	require.NoError(t, err)
+	assert.Zero(t, wait)
+
+	// Failed sign-ins to approve a user code are counted against it.
+	for want := 1; want <= 2; want++ {
+		failures, err := throttle.DeviceFailure(ctx, "", "BCDFGHJK")
+		require.NoError(t, err)
+		assert.Equal(t, want, failures)
+	}
+	wait, err = throttle.DeviceWait(ctx, "10.0.0.2", "BCDFGHJK")
+	require.NoError(t, err)
+	assert.InDelta(t, time.Minute, wait, float64(time.Second))
+	wait, err = throttle.DeviceWait(ctx, "10.0.0.2", "LMNPQRST")
+	require.NoError(t, err)
+	assert.Zero(t, wait)
+}
+
+func TestThrottle_Forget(t *testing.T) {
+	ctx := context.Background()
+	throttle := New(
+		slog.New(slog.NewTextHandler(io.Discard, nil)),
+		memory.NewLoginFailures(),
+		Policy{LockoutThreshold: 1, LockoutDuration: time.Hour},
+		Policy{LockoutThreshold: 1, LockoutDuration: time.Hour},
+		time.Hour,
+	)
+	userID := uuid.New()
+
+	require.NoError(t, throttle.Failure(ctx, " User@Example.com", "192.0.2.1"))
+	_, err := throttle.SecondFactorFailure(ctx, userID)
+	require.NoError(t, err)
+
+	require.NoError(t, throttle.Forget(ctx, userID, "user@example.com"))
+
+	wait, err := throttle.Wait(ctx, "user@example.com", "")
+	require.NoError(t, err)
+	assert.Zero(t, wait)
+	wait, err = throttle.SecondFactorWait(ctx, userID)
+	require.NoError(t, err)
+	assert.Zero(t, wait)
+	// The address is not the user's to forget.
+	wait, err = throttle.Wait(ctx, "other@example.com", "192.0.2.1")
+	require.NoError(t, err)
+	assert.NotZero(t, wait)
+}
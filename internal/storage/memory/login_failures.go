@@ -0,0 +1,73 @@
+// Package memory keeps the state that a single replica may hold in process
+// instead of in MySQL.
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/Novochenko/sso/domain/models"
+)
+
+// LoginFailures counts failed logins in memory. The counts are neither
+// shared between replicas nor kept across restarts.
+type LoginFailures struct {
+	mu       sync.Mutex
+	failures map[string]models.LoginFailures
+}
+
+func NewLoginFailures() *LoginFailures {
+	return &LoginFailures{failures: make(map[string]models.LoginFailures)}
+}
+
+func (s *LoginFailures) LoginFailures(_ context.Context, key string) (models.LoginFailures, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	failures, ok := s.failures[key]
+	if !ok {
+		return models.LoginFailures{Key: key}, nil
+	}
+
+	return failures, nil
+}
+
+func (s *LoginFailures) AddLoginFailure(_ context.Context, key string, at, resetBefore time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	failures, ok := s.failures[key]
+	if !ok || failures.LastFailureAt.Before(resetBefore) {
+		failures = models.LoginFailures{Key: key}
+	}
+	failures.Failures++
+	failures.LastFailureAt = at
+	s.failures[key] = failures
+
+	return nil
+}
+
+func (s *LoginFailures) ClearLoginFailures(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.failures, key)
+
+	return nil
+}
+
+func (s *LoginFailures) DeleteLoginFailures(_ context.Context, before time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var deleted int64
+	for key, failures := range s.failures {
+		if failures.LastFailureAt.Before(before) {
+			delete(s.failures, key)
+			deleted++
+		}
+	}
+
+	return deleted, nil
+}
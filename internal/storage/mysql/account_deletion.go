@@ -0,0 +1,125 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/Novochenko/sso/domain/models"
+	"github.com/Novochenko/sso/internal/storage"
+	"github.com/google/uuid"
+)
+
+// purgeBatchSize bounds how many deleted users one DeletedUsers call returns.
+const purgeBatchSize = 100
+
+// MarkUserDeleted soft deletes the user. From then on the user is invisible
+// to every lookup, but the email address stays taken until the user is
+// purged.
+func (s *Storage) MarkUserDeleted(ctx context.Context, userID uuid.UUID, at time.Time) error {
+	const op = "storage.mysql.MarkUserDeleted"
+
+	res, err := s.db.ExecContext(ctx,
+		"UPDATE users SET deleted_at = ? WHERE id = ? AND deleted_at IS NULL",
+		at.UTC(), userID,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+	}
+
+	return nil
+}
+
+// DeletedUsers returns up to purgeBatchSize users soft deleted at or before
+// before.
+func (s *Storage) DeletedUsers(ctx context.Context, before time.Time) ([]models.DeletedUser, error) {
+	const op = "storage.mysql.DeletedUsers"
+
+	rows, err := s.db.QueryContext(ctx,
+		"SELECT id, email, pfp_path FROM users WHERE deleted_at <= ? ORDER BY deleted_at LIMIT ?",
+		before.UTC(), purgeBatchSize,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var users []models.DeletedUser
+	for rows.Next() {
+		var user models.DeletedUser
+		var pfpPath sql.NullString
+		if err := rows.Scan(&user.ID, &user.Email, &pfpPath); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		user.ProfilePicturePath = pfpPath.String
+		users = append(users, user)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return users, nil
+}
+
+// userDataTables lists every table that references users(id) through a
+// user_id column. PurgeUser clears them all.
+var userDataTables = []string{
+	"refresh_tokens",
+	"revoked_tokens",
+	"authorization_codes",
+	"device_codes",
+	"used_action_tokens",
+	"password_reset_tokens",
+	"email_changes",
+	"user_totp",
+	"webauthn_credentials",
+	"backup_codes",
+	"user_roles",
+	"org_memberships",
+	"group_members",
+	"sessions",
+}
+
+// PurgeUser removes a soft deleted user and everything stored about them.
+// Users that have not been soft deleted are left alone.
+func (s *Storage) PurgeUser(ctx context.Context, userID uuid.UUID) error {
+	const op = "storage.mysql.PurgeUser"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, "DELETE FROM users WHERE id = ? AND deleted_at IS NOT NULL", userID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+	}
+
+	for _, table := range userDataTables {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM "+table+" WHERE user_id = ?", userID); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
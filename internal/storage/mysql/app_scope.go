@@ -0,0 +1,36 @@
+package mysql
+
+import (
+	"context"
+	"fmt"
+)
+
+// AppScopes returns the scopes the app has been granted for machine tokens.
+func (s *Storage) AppScopes(ctx context.Context, appID int64) ([]string, error) {
+	const op = "storage.mysql.AppScopes"
+
+	stmt, err := s.db.Prepare("SELECT scope FROM app_scopes WHERE app_id = ?")
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	rows, err := stmt.QueryContext(ctx, appID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var scopes []string
+	for rows.Next() {
+		var scope string
+		if err := rows.Scan(&scope); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		scopes = append(scopes, scope)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return scopes, nil
+}
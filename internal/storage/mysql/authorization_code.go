@@ -0,0 +1,123 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Novochenko/sso/domain/models"
+	"github.com/Novochenko/sso/internal/storage"
+)
+
+func (s *Storage) AppRedirectURIs(ctx context.Context, appID int64) ([]string, error) {
+	const op = "storage.mysql.AppRedirectURIs"
+
+	stmt, err := s.db.Prepare("SELECT redirect_uri FROM app_redirect_uris WHERE app_id = ?")
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	rows, err := stmt.QueryContext(ctx, appID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var uris []string
+	for rows.Next() {
+		var uri string
+		if err := rows.Scan(&uri); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		uris = append(uris, uri)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return uris, nil
+}
+
+func (s *Storage) SaveAuthorizationCode(ctx context.Context, code models.AuthorizationCode) error {
+	const op = "storage.mysql.SaveAuthorizationCode"
+
+	stmt, err := s.db.Prepare(`INSERT INTO authorization_codes(code_hash, app_id, user_id, redirect_uri, scope, nonce,
+		code_challenge, code_challenge_method, auth_time, expires_at)
+		VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = stmt.ExecContext(ctx,
+		code.CodeHash,
+		code.AppID,
+		code.UserID,
+		code.RedirectURI,
+		code.Scope,
+		code.Nonce,
+		code.CodeChallenge,
+		code.CodeChallengeMethod,
+		code.AuthTime.UTC(),
+		code.ExpiresAt.UTC(),
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// ConsumeAuthorizationCode marks the code as used and returns it. A code can
+// be consumed only once; storage.ErrAuthorizationCodeNotFound is returned for
+// unknown, used and expired codes alike.
+func (s *Storage) ConsumeAuthorizationCode(ctx context.Context, codeHash string) (models.AuthorizationCode, error) {
+	const op = "storage.mysql.ConsumeAuthorizationCode"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.AuthorizationCode{}, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+
+	row := tx.QueryRowContext(ctx, `SELECT code_hash, app_id, user_id, redirect_uri, scope, nonce,
+		code_challenge, code_challenge_method, auth_time, expires_at
+		FROM authorization_codes
+		WHERE code_hash = ? AND used_at IS NULL AND expires_at > ?
+		FOR UPDATE`, codeHash, now)
+
+	var code models.AuthorizationCode
+	err = row.Scan(
+		&code.CodeHash,
+		&code.AppID,
+		&code.UserID,
+		&code.RedirectURI,
+		&code.Scope,
+		&code.Nonce,
+		&code.CodeChallenge,
+		&code.CodeChallengeMethod,
+		&code.AuthTime,
+		&code.ExpiresAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.AuthorizationCode{}, fmt.Errorf("%s: %w", op, storage.ErrAuthorizationCodeNotFound)
+		}
+
+		return models.AuthorizationCode{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = tx.ExecContext(ctx, "UPDATE authorization_codes SET used_at = ? WHERE code_hash = ?", now, codeHash)
+	if err != nil {
+		return models.AuthorizationCode{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return models.AuthorizationCode{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return code, nil
+}
@@ -0,0 +1,94 @@
+package mysql
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Novochenko/sso/internal/storage"
+	"github.com/google/uuid"
+)
+
+// ReplaceBackupCodes revokes the user's unused backup codes and stores a new
+// set. Used and revoked codes are kept for the audit trail.
+func (s *Storage) ReplaceBackupCodes(ctx context.Context, userID uuid.UUID, codeHashes []string, at time.Time) error {
+	const op = "storage.mysql.ReplaceBackupCodes"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx,
+		"UPDATE backup_codes SET revoked_at = ? WHERE user_id = ? AND used_at IS NULL AND revoked_at IS NULL",
+		at.UTC(), userID,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if len(codeHashes) > 0 {
+		args := make([]any, 0, 3*len(codeHashes))
+		for _, hash := range codeHashes {
+			args = append(args, userID, hash, at.UTC())
+		}
+		values := strings.TrimSuffix(strings.Repeat("(?, ?, ?), ", len(codeHashes)), ", ")
+		_, err = tx.ExecContext(ctx, "INSERT INTO backup_codes (user_id, code_hash, created_at) VALUES "+values, args...)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// UseBackupCode consumes one of the user's backup codes and returns how many
+// are left. storage.ErrBackupCodeNotFound is returned for codes that are
+// unknown, used or revoked.
+func (s *Storage) UseBackupCode(ctx context.Context, userID uuid.UUID, codeHash string, at time.Time) (int, error) {
+	const op = "storage.mysql.UseBackupCode"
+
+	res, err := s.db.ExecContext(ctx,
+		`UPDATE backup_codes SET used_at = ?
+		WHERE user_id = ? AND code_hash = ? AND used_at IS NULL AND revoked_at IS NULL`,
+		at.UTC(), userID, codeHash,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	if affected == 0 {
+		return 0, fmt.Errorf("%s: %w", op, storage.ErrBackupCodeNotFound)
+	}
+
+	remaining, err := s.BackupCodesRemaining(ctx, userID)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return remaining, nil
+}
+
+func (s *Storage) BackupCodesRemaining(ctx context.Context, userID uuid.UUID) (int, error) {
+	const op = "storage.mysql.BackupCodesRemaining"
+
+	var remaining int
+	err := s.db.QueryRowContext(ctx,
+		"SELECT COUNT(*) FROM backup_codes WHERE user_id = ? AND used_at IS NULL AND revoked_at IS NULL",
+		userID,
+	).Scan(&remaining)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return remaining, nil
+}
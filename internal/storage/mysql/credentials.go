@@ -0,0 +1,214 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Novochenko/sso/domain/models"
+	"github.com/Novochenko/sso/internal/storage"
+	mysqlDriver "github.com/go-sql-driver/mysql"
+	"github.com/google/uuid"
+)
+
+const emailChangeColumns = `id, user_id, old_email, new_email, confirm_token_hash, undo_token_hash,
+	confirm_expires_at, undo_expires_at, confirmed_at`
+
+// UpdatePassword sets the user's password hash and consumes their
+// outstanding password reset tokens.
+func (s *Storage) UpdatePassword(ctx context.Context, userID uuid.UUID, passHash []byte) error {
+	const op = "storage.mysql.UpdatePassword"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, "UPDATE users SET pass_hash = ?, password_reset_required = FALSE WHERE id = ?", passHash, userID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+	}
+
+	_, err = tx.ExecContext(ctx,
+		"UPDATE password_reset_tokens SET used_at = ? WHERE user_id = ? AND used_at IS NULL",
+		time.Now().UTC(), userID,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) SaveEmailChange(ctx context.Context, change models.EmailChange) error {
+	const op = "storage.mysql.SaveEmailChange"
+
+	stmt, err := s.db.Prepare(`INSERT INTO email_changes(id, user_id, old_email, new_email, confirm_token_hash,
+		undo_token_hash, confirm_expires_at, undo_expires_at)
+		VALUES(?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = stmt.ExecContext(ctx,
+		change.ID,
+		change.UserID,
+		change.OldEmail,
+		change.NewEmail,
+		change.ConfirmTokenHash,
+		change.UndoTokenHash,
+		change.ConfirmExpiresAt.UTC(),
+		change.UndoExpiresAt.UTC(),
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// ConfirmEmailChange applies a pending email change. The change is dropped
+// with storage.ErrEmailChangeNotFound if the user's email changed since it
+// was requested, and fails with storage.ErrUserExists if the new address was
+// taken in the meantime.
+func (s *Storage) ConfirmEmailChange(ctx context.Context, confirmTokenHash string) (models.EmailChange, error) {
+	const op = "storage.mysql.ConfirmEmailChange"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.EmailChange{}, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+
+	change, err := scanEmailChange(tx.QueryRowContext(ctx, `SELECT `+emailChangeColumns+` FROM email_changes
+		WHERE confirm_token_hash = ? AND confirmed_at IS NULL AND undone_at IS NULL AND confirm_expires_at > ?
+		FOR UPDATE`, confirmTokenHash, now))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.EmailChange{}, fmt.Errorf("%s: %w", op, storage.ErrEmailChangeNotFound)
+		}
+
+		return models.EmailChange{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	res, err := tx.ExecContext(ctx,
+		"UPDATE users SET email = ?, email_verified = TRUE WHERE id = ? AND email = ?",
+		change.NewEmail, change.UserID, change.OldEmail,
+	)
+	if err != nil {
+		var mysqlErr *mysqlDriver.MySQLError
+		if errors.As(err, &mysqlErr) && mysqlErr.Number == 1062 {
+			return models.EmailChange{}, fmt.Errorf("%s: %w", op, storage.ErrUserExists)
+		}
+
+		return models.EmailChange{}, fmt.Errorf("%s: %w", op, err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return models.EmailChange{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if affected == 0 {
+		return models.EmailChange{}, fmt.Errorf("%s: %w", op, storage.ErrEmailChangeNotFound)
+	}
+
+	_, err = tx.ExecContext(ctx, "UPDATE email_changes SET confirmed_at = ? WHERE id = ?", now, change.ID)
+	if err != nil {
+		return models.EmailChange{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return models.EmailChange{}, fmt.Errorf("%s: %w", op, err)
+	}
+	change.ConfirmedAt = now
+
+	return change, nil
+}
+
+// UndoEmailChange cancels an email change. If it was already confirmed, the
+// old email is restored.
+func (s *Storage) UndoEmailChange(ctx context.Context, undoTokenHash string) (models.EmailChange, error) {
+	const op = "storage.mysql.UndoEmailChange"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.EmailChange{}, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+
+	change, err := scanEmailChange(tx.QueryRowContext(ctx, `SELECT `+emailChangeColumns+` FROM email_changes
+		WHERE undo_token_hash = ? AND undone_at IS NULL AND undo_expires_at > ?
+		FOR UPDATE`, undoTokenHash, now))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.EmailChange{}, fmt.Errorf("%s: %w", op, storage.ErrEmailChangeNotFound)
+		}
+
+		return models.EmailChange{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if !change.ConfirmedAt.IsZero() {
+		_, err = tx.ExecContext(ctx,
+			"UPDATE users SET email = ?, email_verified = TRUE WHERE id = ? AND email = ?",
+			change.OldEmail, change.UserID, change.NewEmail,
+		)
+		if err != nil {
+			var mysqlErr *mysqlDriver.MySQLError
+			if errors.As(err, &mysqlErr) && mysqlErr.Number == 1062 {
+				return models.EmailChange{}, fmt.Errorf("%s: %w", op, storage.ErrUserExists)
+			}
+
+			return models.EmailChange{}, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, "UPDATE email_changes SET undone_at = ? WHERE id = ?", now, change.ID)
+	if err != nil {
+		return models.EmailChange{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return models.EmailChange{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return change, nil
+}
+
+func scanEmailChange(row *sql.Row) (models.EmailChange, error) {
+	var change models.EmailChange
+	var confirmedAt sql.NullTime
+	err := row.Scan(
+		&change.ID,
+		&change.UserID,
+		&change.OldEmail,
+		&change.NewEmail,
+		&change.ConfirmTokenHash,
+		&change.UndoTokenHash,
+		&change.ConfirmExpiresAt,
+		&change.UndoExpiresAt,
+		&confirmedAt,
+	)
+	if err != nil {
+		return models.EmailChange{}, err
+	}
+	change.ConfirmedAt = confirmedAt.Time
+
+	return change, nil
+}
@@ -0,0 +1,198 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Novochenko/sso/domain/models"
+	"github.com/Novochenko/sso/internal/storage"
+	"github.com/google/uuid"
+)
+
+const deviceCodeColumns = `device_code_hash, user_code, app_id, scope, user_id, status,
+	poll_interval, last_polled_at, expires_at`
+
+func (s *Storage) SaveDeviceCode(ctx context.Context, code models.DeviceCode) error {
+	const op = "storage.mysql.SaveDeviceCode"
+
+	stmt, err := s.db.Prepare(`INSERT INTO device_codes(device_code_hash, user_code, app_id, scope, status,
+		poll_interval, expires_at)
+		VALUES(?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = stmt.ExecContext(ctx,
+		code.DeviceCodeHash,
+		code.UserCode,
+		code.AppID,
+		code.Scope,
+		code.Status,
+		int(code.PollInterval.Seconds()),
+		code.ExpiresAt.UTC(),
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// DeviceCodeByUserCode returns the pending, unexpired device authorization
+// with the given user code.
+func (s *Storage) DeviceCodeByUserCode(ctx context.Context, userCode string) (models.DeviceCode, error) {
+	const op = "storage.mysql.DeviceCodeByUserCode"
+
+	stmt, err := s.db.Prepare(`SELECT ` + deviceCodeColumns + ` FROM device_codes
+		WHERE user_code = ? AND status = ? AND expires_at > ?`)
+	if err != nil {
+		return models.DeviceCode{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	code, err := scanDeviceCode(stmt.QueryRowContext(ctx, userCode, models.DeviceCodePending, time.Now().UTC()))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.DeviceCode{}, fmt.Errorf("%s: %w", op, storage.ErrDeviceCodeNotFound)
+		}
+
+		return models.DeviceCode{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return code, nil
+}
+
+// DecideDeviceCode records the user's approval or denial of a pending device
+// authorization.
+func (s *Storage) DecideDeviceCode(ctx context.Context, userCode string, userID uuid.UUID, status string) error {
+	const op = "storage.mysql.DecideDeviceCode"
+
+	stmt, err := s.db.Prepare(`UPDATE device_codes SET user_id = ?, status = ?
+		WHERE user_code = ? AND status = ? AND expires_at > ?`)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	res, err := stmt.ExecContext(ctx, userID, status, userCode, models.DeviceCodePending, time.Now().UTC())
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrDeviceCodeNotFound)
+	}
+
+	return nil
+}
+
+// LockDeviceCode denies a pending device authorization that nobody
+// approved, after too many failed attempts at it.
+func (s *Storage) LockDeviceCode(ctx context.Context, userCode string) error {
+	const op = "storage.mysql.LockDeviceCode"
+
+	stmt, err := s.db.Prepare("UPDATE device_codes SET status = ? WHERE user_code = ? AND status = ?")
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	res, err := stmt.ExecContext(ctx, models.DeviceCodeDenied, userCode, models.DeviceCodePending)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrDeviceCodeNotFound)
+	}
+
+	return nil
+}
+
+// PollDeviceCode records a poll of the token endpoint and returns the device
+// authorization as it was before the poll. An approved authorization is
+// consumed by the poll, so tokens are issued for it only once.
+func (s *Storage) PollDeviceCode(ctx context.Context, deviceCodeHash string) (models.DeviceCode, error) {
+	const op = "storage.mysql.PollDeviceCode"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.DeviceCode{}, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	row := tx.QueryRowContext(ctx, `SELECT `+deviceCodeColumns+` FROM device_codes
+		WHERE device_code_hash = ?
+		FOR UPDATE`, deviceCodeHash)
+	code, err := scanDeviceCode(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.DeviceCode{}, fmt.Errorf("%s: %w", op, storage.ErrDeviceCodeNotFound)
+		}
+
+		return models.DeviceCode{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	status := code.Status
+	if status == models.DeviceCodeApproved {
+		status = models.DeviceCodeConsumed
+	}
+	_, err = tx.ExecContext(ctx,
+		"UPDATE device_codes SET status = ?, last_polled_at = ? WHERE device_code_hash = ?",
+		status, time.Now().UTC(), deviceCodeHash,
+	)
+	if err != nil {
+		return models.DeviceCode{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return models.DeviceCode{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return code, nil
+}
+
+func (s *Storage) SetDeviceCodePollInterval(ctx context.Context, deviceCodeHash string, interval time.Duration) error {
+	const op = "storage.mysql.SetDeviceCodePollInterval"
+
+	stmt, err := s.db.Prepare("UPDATE device_codes SET poll_interval = ? WHERE device_code_hash = ?")
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if _, err := stmt.ExecContext(ctx, int(interval.Seconds()), deviceCodeHash); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func scanDeviceCode(row *sql.Row) (models.DeviceCode, error) {
+	var code models.DeviceCode
+	var interval int
+	var lastPolledAt sql.NullTime
+	err := row.Scan(
+		&code.DeviceCodeHash,
+		&code.UserCode,
+		&code.AppID,
+		&code.Scope,
+		&code.UserID,
+		&code.Status,
+		&interval,
+		&lastPolledAt,
+		&code.ExpiresAt,
+	)
+	if err != nil {
+		return models.DeviceCode{}, err
+	}
+	code.PollInterval = time.Duration(interval) * time.Second
+	code.LastPolledAt = lastPolledAt.Time
+
+	return code, nil
+}
@@ -0,0 +1,95 @@
+package mysql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Novochenko/sso/internal/storage"
+	mysqlDriver "github.com/go-sql-driver/mysql"
+	"github.com/google/uuid"
+)
+
+// UseActionToken records that the action token was used. Each token can be
+// used once: storage.ErrActionTokenUsed is returned for the second use.
+func (s *Storage) UseActionToken(ctx context.Context, jti string, userID uuid.UUID, purpose string, expiresAt time.Time) error {
+	const op = "storage.mysql.UseActionToken"
+
+	stmt, err := s.db.Prepare("INSERT INTO used_action_tokens(jti, user_id, purpose, expires_at) VALUES(?, ?, ?, ?)")
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = stmt.ExecContext(ctx, jti, userID, purpose, expiresAt.UTC())
+	if err != nil {
+		var mysqlErr *mysqlDriver.MySQLError
+		if errors.As(err, &mysqlErr) && mysqlErr.Number == 1062 {
+			return fmt.Errorf("%s: %w", op, storage.ErrActionTokenUsed)
+		}
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// ActionTokenUsed reports whether UseActionToken has recorded the action
+// token as used.
+func (s *Storage) ActionTokenUsed(ctx context.Context, jti string) (bool, error) {
+	const op = "storage.mysql.ActionTokenUsed"
+
+	stmt, err := s.db.Prepare("SELECT EXISTS(SELECT 1 FROM used_action_tokens WHERE jti = ?)")
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var used bool
+	if err := stmt.QueryRowContext(ctx, jti).Scan(&used); err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return used, nil
+}
+
+// DeleteExpiredActionTokens forgets the action tokens that have expired:
+// they are refused as expired before their use is looked up.
+func (s *Storage) DeleteExpiredActionTokens(ctx context.Context) error {
+	const op = "storage.mysql.DeleteExpiredActionTokens"
+
+	stmt, err := s.db.Prepare("DELETE FROM used_action_tokens WHERE expires_at <= ?")
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if _, err := stmt.ExecContext(ctx, time.Now().UTC()); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) SetEmailVerified(ctx context.Context, userID uuid.UUID, email string) error {
+	const op = "storage.mysql.SetEmailVerified"
+
+	// The email must still match: a token mailed to an old address must not
+	// verify a new one.
+	stmt, err := s.db.Prepare("UPDATE users SET email_verified = TRUE WHERE id = ? AND email = ?")
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	res, err := stmt.ExecContext(ctx, userID, email)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+	}
+
+	return nil
+}
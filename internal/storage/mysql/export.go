@@ -0,0 +1,166 @@
+package mysql
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/Novochenko/sso/domain/models"
+	"github.com/google/uuid"
+)
+
+// UserData collects everything stored about the user for a data export.
+func (s *Storage) UserData(ctx context.Context, userID uuid.UUID) (models.UserData, error) {
+	const op = "storage.mysql.UserData"
+
+	var data models.UserData
+	var err error
+
+	if data.User, err = s.UserByID(ctx, userID); err != nil {
+		return models.UserData{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if data.Account, err = s.UserAccountById(ctx, userID, 0); err != nil {
+		return models.UserData{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if data.Sessions, err = s.sessions(ctx, userID); err != nil {
+		return models.UserData{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if data.AuditEvents, err = s.auditEvents(ctx, userID); err != nil {
+		return models.UserData{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if data.AppGrants, err = s.appGrants(ctx, userID); err != nil {
+		return models.UserData{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if data.Orgs, err = s.UserOrganizations(ctx, userID); err != nil {
+		return models.UserData{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if data.Groups, err = s.userGroups(ctx, userID); err != nil {
+		return models.UserData{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return data, nil
+}
+
+// userGroups returns the groups the user was put in directly.
+func (s *Storage) userGroups(ctx context.Context, userID uuid.UUID) ([]models.Group, error) {
+	ids, err := s.int64s(ctx, "SELECT group_id FROM group_members WHERE user_id = ?", userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GroupsByIDs(ctx, ids)
+}
+
+// sessions lists every login session of the user, revoked and expired ones
+// included.
+func (s *Storage) sessions(ctx context.Context, userID uuid.UUID) ([]models.LoginSession, error) {
+	rows, err := s.db.QueryContext(ctx,
+		"SELECT "+sessionColumns+" FROM sessions WHERE user_id = ? ORDER BY created_at, id",
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []models.LoginSession
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+
+	return sessions, rows.Err()
+}
+
+// auditEventsQuery turns the rows kept for tokens, password resets and email
+// changes into one timeline. Every "?" is the user id.
+const auditEventsQuery = `
+SELECT type, app_id, detail, occurred_at FROM (
+	SELECT 'email_change_requested' AS type, 0 AS app_id, new_email AS detail, created_at AS occurred_at
+		FROM email_changes WHERE user_id = ?
+	UNION ALL SELECT 'email_change_confirmed', 0, new_email, confirmed_at
+		FROM email_changes WHERE user_id = ? AND confirmed_at IS NOT NULL
+	UNION ALL SELECT 'email_change_undone', 0, old_email, undone_at
+		FROM email_changes WHERE user_id = ? AND undone_at IS NOT NULL
+	UNION ALL SELECT 'password_reset_requested', 0, '', created_at
+		FROM password_reset_tokens WHERE user_id = ?
+	UNION ALL SELECT 'password_reset_token_used', 0, '', used_at
+		FROM password_reset_tokens WHERE user_id = ? AND used_at IS NOT NULL
+	UNION ALL SELECT 'action_token_used', 0, purpose, used_at
+		FROM used_action_tokens WHERE user_id = ?
+	UNION ALL SELECT 'authorization_code_issued', app_id, scope, auth_time
+		FROM authorization_codes WHERE user_id = ?
+	UNION ALL SELECT 'device_authorization', app_id, status, created_at
+		FROM device_codes WHERE user_id = ?
+	UNION ALL SELECT 'token_revoked', 0, jti, revoked_at
+		FROM revoked_tokens WHERE user_id = ?
+	UNION ALL SELECT 'all_tokens_revoked', 0, '', tokens_revoked_before
+		FROM users WHERE id = ? AND tokens_revoked_before IS NOT NULL
+	UNION ALL SELECT 'totp_enabled', 0, '', confirmed_at
+		FROM user_totp WHERE user_id = ? AND confirmed_at IS NOT NULL
+	UNION ALL SELECT 'passkey_registered', 0, name, created_at
+		FROM webauthn_credentials WHERE user_id = ?
+	UNION ALL SELECT DISTINCT 'backup_codes_generated', 0, '', created_at
+		FROM backup_codes WHERE user_id = ?
+	UNION ALL SELECT 'backup_code_used', 0, '', used_at
+		FROM backup_codes WHERE user_id = ? AND used_at IS NOT NULL
+) events
+ORDER BY occurred_at`
+
+func (s *Storage) auditEvents(ctx context.Context, userID uuid.UUID) ([]models.AuditEvent, error) {
+	args := make([]any, strings.Count(auditEventsQuery, "?"))
+	for i := range args {
+		args[i] = userID
+	}
+
+	rows, err := s.db.QueryContext(ctx, auditEventsQuery, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []models.AuditEvent
+	for rows.Next() {
+		var event models.AuditEvent
+		if err := rows.Scan(&event.Type, &event.AppID, &event.Detail, &event.OccurredAt); err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+
+	return events, rows.Err()
+}
+
+// appGrants lists the apps the user got tokens or authorization codes for.
+func (s *Storage) appGrants(ctx context.Context, userID uuid.UUID) ([]models.AppGrant, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT g.app_id, a.name, MIN(g.granted_at), MAX(g.granted_at) FROM (
+			SELECT app_id, created_at AS granted_at FROM refresh_tokens WHERE user_id = ?
+			UNION ALL SELECT app_id, auth_time FROM authorization_codes WHERE user_id = ?
+			UNION ALL SELECT app_id, created_at FROM device_codes
+				WHERE user_id = ? AND status IN ('approved', 'consumed')
+		) g
+		JOIN apps a ON a.id = g.app_id
+		GROUP BY g.app_id, a.name
+		ORDER BY g.app_id`,
+		userID, userID, userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var grants []models.AppGrant
+	for rows.Next() {
+		var grant models.AppGrant
+		if err := rows.Scan(&grant.AppID, &grant.AppName, &grant.FirstGrantedAt, &grant.LastGrantedAt); err != nil {
+			return nil, err
+		}
+		grants = append(grants, grant)
+	}
+
+	return grants, rows.Err()
+}
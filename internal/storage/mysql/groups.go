@@ -0,0 +1,400 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Novochenko/sso/domain/models"
+	"github.com/Novochenko/sso/internal/storage"
+	mysqlDriver "github.com/go-sql-driver/mysql"
+	"github.com/google/uuid"
+)
+
+const groupColumns = "id, org_id, name, description, created_at"
+
+func (s *Storage) SaveGroup(ctx context.Context, group models.Group) (int64, error) {
+	const op = "storage.mysql.SaveGroup"
+
+	res, err := s.db.ExecContext(ctx,
+		"INSERT INTO user_groups (org_id, name, description) VALUES (?, ?, ?)",
+		group.OrgID, group.Name, group.Description,
+	)
+	if err != nil {
+		var mysqlErr *mysqlDriver.MySQLError
+		if errors.As(err, &mysqlErr) && mysqlErr.Number == 1062 {
+			return 0, fmt.Errorf("%s: %w", op, storage.ErrGroupExists)
+		}
+
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return id, nil
+}
+
+func (s *Storage) Group(ctx context.Context, id int64) (models.Group, error) {
+	const op = "storage.mysql.Group"
+
+	var group models.Group
+	err := s.db.QueryRowContext(ctx,
+		"SELECT "+groupColumns+" FROM user_groups WHERE id = ?",
+		id,
+	).Scan(&group.ID, &group.OrgID, &group.Name, &group.Description, &group.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.Group{}, fmt.Errorf("%s: %w", op, storage.ErrGroupNotFound)
+		}
+
+		return models.Group{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return group, nil
+}
+
+// GroupsByIDs returns the groups with the given ids, ordered by name. Ids
+// that do not exist are skipped.
+func (s *Storage) GroupsByIDs(ctx context.Context, ids []int64) ([]models.Group, error) {
+	const op = "storage.mysql.GroupsByIDs"
+
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	placeholders, args := int64List(ids)
+	rows, err := s.db.QueryContext(ctx,
+		"SELECT "+groupColumns+" FROM user_groups WHERE id IN ("+placeholders+") ORDER BY name, id",
+		args...,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var groups []models.Group
+	for rows.Next() {
+		var group models.Group
+		if err := rows.Scan(&group.ID, &group.OrgID, &group.Name, &group.Description, &group.CreatedAt); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		groups = append(groups, group)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return groups, nil
+}
+
+// UpdateGroup changes the name and description of the group.
+func (s *Storage) UpdateGroup(ctx context.Context, group models.Group) error {
+	const op = "storage.mysql.UpdateGroup"
+
+	_, err := s.db.ExecContext(ctx,
+		"UPDATE user_groups SET name = ?, description = ? WHERE id = ?",
+		group.Name, group.Description, group.ID,
+	)
+	if err != nil {
+		var mysqlErr *mysqlDriver.MySQLError
+		if errors.As(err, &mysqlErr) && mysqlErr.Number == 1062 {
+			return fmt.Errorf("%s: %w", op, storage.ErrGroupExists)
+		}
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// DeleteGroup removes the group together with its members, its roles and
+// its edges to parent groups and subgroups.
+func (s *Storage) DeleteGroup(ctx context.Context, id int64) error {
+	const op = "storage.mysql.DeleteGroup"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, "DELETE FROM user_groups WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrGroupNotFound)
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM group_members WHERE group_id = ?", id); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM group_roles WHERE group_id = ?", id); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	_, err = tx.ExecContext(ctx, "DELETE FROM group_subgroups WHERE parent_id = ? OR child_id = ?", id, id)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// AddGroupMember puts the user in the group. Adding them twice is not an
+// error.
+func (s *Storage) AddGroupMember(ctx context.Context, groupID int64, userID uuid.UUID) error {
+	const op = "storage.mysql.AddGroupMember"
+
+	_, err := s.db.ExecContext(ctx,
+		"INSERT IGNORE INTO group_members (group_id, user_id) VALUES (?, ?)",
+		groupID, userID,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) RemoveGroupMember(ctx context.Context, groupID int64, userID uuid.UUID) error {
+	const op = "storage.mysql.RemoveGroupMember"
+
+	_, err := s.db.ExecContext(ctx,
+		"DELETE FROM group_members WHERE group_id = ? AND user_id = ?",
+		groupID, userID,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// AddSubgroup makes the members of childID members of parentID. Edges that
+// would close a cycle fail with storage.ErrGroupCycle; adding an edge twice
+// is not an error.
+func (s *Storage) AddSubgroup(ctx context.Context, parentID, childID int64) error {
+	const op = "storage.mysql.AddSubgroup"
+
+	if parentID == childID {
+		return fmt.Errorf("%s: %w", op, storage.ErrGroupCycle)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	// Locking every edge serializes concurrent additions, which could
+	// otherwise close a cycle between them without either seeing it.
+	if _, err := tx.ExecContext(ctx, "SELECT COUNT(*) FROM group_subgroups FOR UPDATE"); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	// UNION drops rows already seen, so the walk ends even on a graph that
+	// somehow has a cycle.
+	var cycle bool
+	err = tx.QueryRowContext(ctx,
+		`WITH RECURSIVE descendants (id) AS (
+			SELECT ?
+			UNION
+			SELECT gs.child_id FROM group_subgroups gs JOIN descendants d ON gs.parent_id = d.id
+		)
+		SELECT EXISTS(SELECT 1 FROM descendants WHERE id = ?)`,
+		childID, parentID,
+	).Scan(&cycle)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if cycle {
+		return fmt.Errorf("%s: %w", op, storage.ErrGroupCycle)
+	}
+
+	_, err = tx.ExecContext(ctx,
+		"INSERT IGNORE INTO group_subgroups (parent_id, child_id) VALUES (?, ?)",
+		parentID, childID,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) RemoveSubgroup(ctx context.Context, parentID, childID int64) error {
+	const op = "storage.mysql.RemoveSubgroup"
+
+	_, err := s.db.ExecContext(ctx,
+		"DELETE FROM group_subgroups WHERE parent_id = ? AND child_id = ?",
+		parentID, childID,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// Subgroups returns every edge of the group graph.
+func (s *Storage) Subgroups(ctx context.Context) ([]models.Subgroup, error) {
+	const op = "storage.mysql.Subgroups"
+
+	rows, err := s.db.QueryContext(ctx, "SELECT parent_id, child_id FROM group_subgroups")
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var edges []models.Subgroup
+	for rows.Next() {
+		var edge models.Subgroup
+		if err := rows.Scan(&edge.ParentID, &edge.ChildID); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		edges = append(edges, edge)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return edges, nil
+}
+
+// GroupMembers returns the users and subgroups placed directly in the
+// group. Deleted users are left out.
+func (s *Storage) GroupMembers(ctx context.Context, groupID int64) (models.GroupMembers, error) {
+	const op = "storage.mysql.GroupMembers"
+
+	var members models.GroupMembers
+
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT gm.user_id FROM group_members gm
+		JOIN users u ON u.id = gm.user_id
+		WHERE gm.group_id = ? AND u.deleted_at IS NULL
+		ORDER BY gm.created_at, gm.user_id`,
+		groupID,
+	)
+	if err != nil {
+		return models.GroupMembers{}, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var userID uuid.UUID
+		if err := rows.Scan(&userID); err != nil {
+			return models.GroupMembers{}, fmt.Errorf("%s: %w", op, err)
+		}
+		members.UserIDs = append(members.UserIDs, userID)
+	}
+	if err := rows.Err(); err != nil {
+		return models.GroupMembers{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	members.SubgroupIDs, err = s.int64s(ctx,
+		"SELECT child_id FROM group_subgroups WHERE parent_id = ? ORDER BY child_id",
+		groupID,
+	)
+	if err != nil {
+		return models.GroupMembers{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return members, nil
+}
+
+// UserGroupIDs returns the ids of the groups the user was put in directly.
+// Groups of organizations the user has left are skipped.
+func (s *Storage) UserGroupIDs(ctx context.Context, userID uuid.UUID) ([]int64, error) {
+	const op = "storage.mysql.UserGroupIDs"
+
+	ids, err := s.int64s(ctx,
+		`SELECT gm.group_id FROM group_members gm
+		JOIN user_groups g ON g.id = gm.group_id
+		WHERE gm.user_id = ? AND (g.org_id = 0 OR EXISTS (
+			SELECT 1 FROM org_memberships om WHERE om.org_id = g.org_id AND om.user_id = gm.user_id
+		))
+		ORDER BY gm.group_id`,
+		userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return ids, nil
+}
+
+// AssignGroupRole gives the role to the group. Assigning it twice is not an
+// error.
+func (s *Storage) AssignGroupRole(ctx context.Context, groupID, roleID int64) error {
+	const op = "storage.mysql.AssignGroupRole"
+
+	_, err := s.db.ExecContext(ctx,
+		"INSERT IGNORE INTO group_roles (group_id, role_id) VALUES (?, ?)",
+		groupID, roleID,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) UnassignGroupRole(ctx context.Context, groupID, roleID int64) error {
+	const op = "storage.mysql.UnassignGroupRole"
+
+	_, err := s.db.ExecContext(ctx,
+		"DELETE FROM group_roles WHERE group_id = ? AND role_id = ?",
+		groupID, roleID,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) int64s(ctx context.Context, query string, args ...any) ([]int64, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var values []int64
+	for rows.Next() {
+		var value int64
+		if err := rows.Scan(&value); err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+
+	return values, rows.Err()
+}
+
+// int64List returns the placeholders and arguments of an IN list.
+func int64List(values []int64) (string, []any) {
+	args := make([]any, 0, len(values))
+	for _, value := range values {
+		args = append(args, value)
+	}
+
+	return strings.TrimSuffix(strings.Repeat("?, ", len(values)), ", "), args
+}
@@ -0,0 +1,91 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Novochenko/sso/domain/models"
+)
+
+// LoginFailures returns the failures counted for key, none if there are no
+// failures on record.
+func (s *Storage) LoginFailures(ctx context.Context, key string) (models.LoginFailures, error) {
+	const op = "storage.mysql.LoginFailures"
+
+	stmt, err := s.db.Prepare("SELECT failures, last_failure_at FROM login_failures WHERE throttle_key = ?")
+	if err != nil {
+		return models.LoginFailures{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	failures := models.LoginFailures{Key: key}
+	err = stmt.QueryRowContext(ctx, key).Scan(&failures.Failures, &failures.LastFailureAt)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return models.LoginFailures{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return failures, nil
+}
+
+// AddLoginFailure counts a failure for key at the given time. A count whose
+// last failure is before resetBefore starts over.
+func (s *Storage) AddLoginFailure(ctx context.Context, key string, at, resetBefore time.Time) error {
+	const op = "storage.mysql.AddLoginFailure"
+
+	// The assignments run left to right, so failures still sees the previous
+	// last_failure_at.
+	stmt, err := s.db.Prepare(
+		`INSERT INTO login_failures (throttle_key, failures, last_failure_at) VALUES (?, 1, ?)
+		ON DUPLICATE KEY UPDATE
+			failures = IF(last_failure_at < ?, 1, failures + 1),
+			last_failure_at = ?`,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if _, err := stmt.ExecContext(ctx, key, at.UTC(), resetBefore.UTC(), at.UTC()); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) ClearLoginFailures(ctx context.Context, key string) error {
+	const op = "storage.mysql.ClearLoginFailures"
+
+	stmt, err := s.db.Prepare("DELETE FROM login_failures WHERE throttle_key = ?")
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if _, err := stmt.ExecContext(ctx, key); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// DeleteLoginFailures forgets the counts whose last failure is before the
+// given time and returns how many it removed.
+func (s *Storage) DeleteLoginFailures(ctx context.Context, before time.Time) (int64, error) {
+	const op = "storage.mysql.DeleteLoginFailures"
+
+	stmt, err := s.db.Prepare("DELETE FROM login_failures WHERE last_failure_at < ?")
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	res, err := stmt.ExecContext(ctx, before.UTC())
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	deleted, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return deleted, nil
+}
@@ -46,14 +46,36 @@ func (s *Storage) SaveUser(ctx context.Context, email string, passHash []byte) (
 func (s *Storage) User(ctx context.Context, email string) (models.User, error) {
 	const op = "storage.mysql.User"
 
-	stmt, err := s.db.Prepare("SELECT id, email, pass_hash FROM users WHERE email = ?")
+	stmt, err := s.db.Prepare("SELECT id, email, pass_hash, email_verified, password_reset_required FROM users WHERE email = ? AND deleted_at IS NULL")
 	if err != nil {
 		return models.User{}, fmt.Errorf("%s: %w", op, err)
 	}
 
 	row := stmt.QueryRowContext(ctx, email)
 	var user models.User
-	err = row.Scan(&user.ID, &user.Email, &user.HashPassword)
+	err = row.Scan(&user.ID, &user.Email, &user.HashPassword, &user.EmailVerified, &user.PasswordResetRequired)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.User{}, fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+		}
+
+		return models.User{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return user, nil
+}
+
+func (s *Storage) UserByID(ctx context.Context, userID uuid.UUID) (models.User, error) {
+	const op = "storage.mysql.UserByID"
+
+	stmt, err := s.db.Prepare("SELECT id, email, pass_hash, email_verified, password_reset_required FROM users WHERE id = ? AND deleted_at IS NULL")
+	if err != nil {
+		return models.User{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	row := stmt.QueryRowContext(ctx, userID)
+	var user models.User
+	err = row.Scan(&user.ID, &user.Email, &user.HashPassword, &user.EmailVerified, &user.PasswordResetRequired)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return models.User{}, fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
@@ -68,7 +90,7 @@ func (s *Storage) User(ctx context.Context, email string) (models.User, error) {
 func (s *Storage) App(ctx context.Context, id int64) (models.App, error) {
 	const op = "storage.mysql.App"
 
-	stmt, err := s.db.Prepare("SELECT id, name, secret FROM apps WHERE id = ?")
+	stmt, err := s.db.Prepare("SELECT id, name, secret, require_verified_email, org_id FROM apps WHERE id = ?")
 	if err != nil {
 		return models.App{}, fmt.Errorf("%s: %w", op, err)
 	}
@@ -76,7 +98,7 @@ func (s *Storage) App(ctx context.Context, id int64) (models.App, error) {
 	row := stmt.QueryRowContext(ctx, id)
 
 	var app models.App
-	err = row.Scan(&app.ID, &app.Name, &app.Secret)
+	err = row.Scan(&app.ID, &app.Name, &app.Secret, &app.RequireVerifiedEmail, &app.OrgID)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return models.App{}, fmt.Errorf("%s: %w", op, storage.ErrAppNotFound)
@@ -88,10 +110,14 @@ func (s *Storage) App(ctx context.Context, id int64) (models.App, error) {
 	return app, nil
 }
 
+// IsAdmin reports whether the user holds the global admin role.
 func (s *Storage) IsAdmin(ctx context.Context, userID string) (bool, error) {
 	const op = "storage.mysql.IsAdmin"
 
-	stmt, err := s.db.Prepare("SELECT is_admin FROM users WHERE id = ?")
+	stmt, err := s.db.Prepare(`SELECT EXISTS(
+		SELECT 1 FROM user_roles ur JOIN roles r ON r.id = ur.role_id
+		WHERE ur.user_id = users.id AND r.app_id = 0 AND r.name = 'admin'
+	) FROM users WHERE id = ?`)
 	if err != nil {
 		return false, fmt.Errorf("%s: %w", op, err)
 	}
@@ -112,16 +138,16 @@ func (s *Storage) IsAdmin(ctx context.Context, userID string) (bool, error) {
 	return isAdmin, nil
 }
 
-func (s *Storage) UserAccountById(ctx context.Context, userID uuid.UUID) (models.UserAccount, error) {
+// UserAccountById looks a user up by id. A non-zero orgID only finds members
+// of that organization, see inOrg.
+func (s *Storage) UserAccountById(ctx context.Context, userID uuid.UUID, orgID int64) (models.UserAccount, error) {
 	const op = "storage.mysql.UserByID"
-	stmt, err := s.db.Prepare("SELECT id, username, pfp_path FROM users WHERE id = ?")
+	stmt, err := s.db.Prepare("SELECT " + userAccountColumns + " FROM users u WHERE id = ? AND deleted_at IS NULL" + inOrg)
 	if err != nil {
 		return models.UserAccount{}, fmt.Errorf("%s: %w", op, err)
 	}
 
-	row := stmt.QueryRowContext(ctx, userID)
-	var userAccount models.UserAccount
-	err = row.Scan(&userAccount.UserId, &userAccount.UserName, &userAccount.ProfilePicturePath)
+	userAccount, err := scanUserAccount(stmt.QueryRowContext(ctx, userID, orgID, orgID))
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return models.UserAccount{}, fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
@@ -0,0 +1,276 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/Novochenko/sso/domain/models"
+	"github.com/Novochenko/sso/internal/storage"
+	mysqlDriver "github.com/go-sql-driver/mysql"
+	"github.com/google/uuid"
+)
+
+// orgOwner is the membership role that may not disappear from an
+// organization.
+const orgOwner = "owner"
+
+// SaveOrganization creates the organization with owner as its first owner.
+func (s *Storage) SaveOrganization(ctx context.Context, org models.Organization, owner uuid.UUID) (int64, error) {
+	const op = "storage.mysql.SaveOrganization"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx,
+		"INSERT INTO organizations (slug, name) VALUES (?, ?)",
+		org.Slug, org.Name,
+	)
+	if err != nil {
+		var mysqlErr *mysqlDriver.MySQLError
+		if errors.As(err, &mysqlErr) && mysqlErr.Number == 1062 {
+			return 0, fmt.Errorf("%s: %w", op, storage.ErrOrganizationExists)
+		}
+
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = tx.ExecContext(ctx,
+		"INSERT INTO org_memberships (org_id, user_id, role) VALUES (?, ?, ?)",
+		id, owner, orgOwner,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return id, nil
+}
+
+func (s *Storage) Organization(ctx context.Context, id int64) (models.Organization, error) {
+	const op = "storage.mysql.Organization"
+
+	var org models.Organization
+	err := s.db.QueryRowContext(ctx,
+		"SELECT id, slug, name, created_at FROM organizations WHERE id = ?",
+		id,
+	).Scan(&org.ID, &org.Slug, &org.Name, &org.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.Organization{}, fmt.Errorf("%s: %w", op, storage.ErrOrganizationNotFound)
+		}
+
+		return models.Organization{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return org, nil
+}
+
+func (s *Storage) OrgMembership(ctx context.Context, orgID int64, userID uuid.UUID) (models.OrgMembership, error) {
+	const op = "storage.mysql.OrgMembership"
+
+	var membership models.OrgMembership
+	err := s.db.QueryRowContext(ctx,
+		"SELECT org_id, user_id, role, created_at FROM org_memberships WHERE org_id = ? AND user_id = ?",
+		orgID, userID,
+	).Scan(&membership.OrgID, &membership.UserID, &membership.Role, &membership.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.OrgMembership{}, fmt.Errorf("%s: %w", op, storage.ErrMembershipNotFound)
+		}
+
+		return models.OrgMembership{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return membership, nil
+}
+
+// SaveOrgMembership adds the user to the organization or changes their role
+// there. Demoting the last owner fails with storage.ErrLastOrgOwner.
+func (s *Storage) SaveOrgMembership(ctx context.Context, membership models.OrgMembership) error {
+	const op = "storage.mysql.SaveOrgMembership"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	if membership.Role != orgOwner {
+		if err := keepOwner(ctx, tx, membership.OrgID, membership.UserID); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO org_memberships (org_id, user_id, role) VALUES (?, ?, ?)
+		ON DUPLICATE KEY UPDATE role = VALUES(role)`,
+		membership.OrgID, membership.UserID, membership.Role,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// DeleteOrgMembership removes the user from the organization. Removing the
+// last owner fails with storage.ErrLastOrgOwner.
+func (s *Storage) DeleteOrgMembership(ctx context.Context, orgID int64, userID uuid.UUID) error {
+	const op = "storage.mysql.DeleteOrgMembership"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	if err := keepOwner(ctx, tx, orgID, userID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	res, err := tx.ExecContext(ctx,
+		"DELETE FROM org_memberships WHERE org_id = ? AND user_id = ?",
+		orgID, userID,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrMembershipNotFound)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// keepOwner fails with storage.ErrLastOrgOwner if userID is the only owner
+// of the organization. The owners stay locked until tx ends, so two owners
+// cannot step down at the same time.
+func keepOwner(ctx context.Context, tx *sql.Tx, orgID int64, userID uuid.UUID) error {
+	rows, err := tx.QueryContext(ctx,
+		"SELECT user_id FROM org_memberships WHERE org_id = ? AND role = ? FOR UPDATE",
+		orgID, orgOwner,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var owners []uuid.UUID
+	for rows.Next() {
+		var owner uuid.UUID
+		if err := rows.Scan(&owner); err != nil {
+			return err
+		}
+		owners = append(owners, owner)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if len(owners) == 1 && owners[0] == userID {
+		return storage.ErrLastOrgOwner
+	}
+
+	return nil
+}
+
+// UserOrganizations lists the organizations the user belongs to.
+func (s *Storage) UserOrganizations(ctx context.Context, userID uuid.UUID) ([]models.UserOrganization, error) {
+	const op = "storage.mysql.UserOrganizations"
+
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT o.id, o.slug, o.name, o.created_at, m.role FROM org_memberships m
+		JOIN organizations o ON o.id = m.org_id
+		WHERE m.user_id = ?
+		ORDER BY o.slug`,
+		userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var orgs []models.UserOrganization
+	for rows.Next() {
+		var org models.UserOrganization
+		err := rows.Scan(
+			&org.Organization.ID,
+			&org.Organization.Slug,
+			&org.Organization.Name,
+			&org.Organization.CreatedAt,
+			&org.Role,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		orgs = append(orgs, org)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return orgs, nil
+}
+
+// OrgMembers lists the members of the organization, oldest first.
+func (s *Storage) OrgMembers(ctx context.Context, orgID int64) ([]models.OrgMembership, error) {
+	const op = "storage.mysql.OrgMembers"
+
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT m.org_id, m.user_id, m.role, m.created_at FROM org_memberships m
+		JOIN users u ON u.id = m.user_id
+		WHERE m.org_id = ? AND u.deleted_at IS NULL
+		ORDER BY m.created_at, m.user_id`,
+		orgID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var members []models.OrgMembership
+	for rows.Next() {
+		var member models.OrgMembership
+		if err := rows.Scan(&member.OrgID, &member.UserID, &member.Role, &member.CreatedAt); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		members = append(members, member)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return members, nil
+}
+
+// inOrg restricts a query on users aliased u to the members of the
+// organization bound to its placeholders; orgID 0 lets every user through and
+// models.NoOrg only those outside of every organization.
+const inOrg = " AND CASE SIGN(?)" +
+	" WHEN 0 THEN TRUE" +
+	" WHEN -1 THEN NOT EXISTS (SELECT 1 FROM org_memberships om WHERE om.user_id = u.id)" +
+	" ELSE EXISTS (SELECT 1 FROM org_memberships om WHERE om.org_id = ? AND om.user_id = u.id) END"
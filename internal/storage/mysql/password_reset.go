@@ -0,0 +1,118 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Novochenko/sso/internal/storage"
+	"github.com/google/uuid"
+)
+
+func (s *Storage) SavePasswordResetToken(ctx context.Context, tokenHash string, userID uuid.UUID, expiresAt time.Time) error {
+	const op = "storage.mysql.SavePasswordResetToken"
+
+	stmt, err := s.db.Prepare("INSERT INTO password_reset_tokens(token_hash, user_id, expires_at) VALUES(?, ?, ?)")
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if _, err := stmt.ExecContext(ctx, tokenHash, userID, expiresAt.UTC()); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// PasswordResetUser returns the user of an unused and unexpired reset
+// token, and storage.ErrPasswordResetTokenNotFound for any other token.
+func (s *Storage) PasswordResetUser(ctx context.Context, tokenHash string) (uuid.UUID, error) {
+	const op = "storage.mysql.PasswordResetUser"
+
+	var userID uuid.UUID
+	err := s.db.QueryRowContext(ctx, `SELECT user_id FROM password_reset_tokens
+		WHERE token_hash = ? AND used_at IS NULL AND expires_at > ?`,
+		tokenHash, time.Now().UTC(),
+	).Scan(&userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return uuid.Nil, fmt.Errorf("%s: %w", op, storage.ErrPasswordResetTokenNotFound)
+		}
+
+		return uuid.Nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return userID, nil
+}
+
+// ResetPassword consumes the reset token and sets the user's password hash.
+// Every other outstanding reset token of the user is consumed too.
+// storage.ErrPasswordResetTokenNotFound is returned for unknown, used and
+// expired tokens alike.
+func (s *Storage) ResetPassword(ctx context.Context, tokenHash string, passHash []byte) (uuid.UUID, error) {
+	const op = "storage.mysql.ResetPassword"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+
+	var userID uuid.UUID
+	err = tx.QueryRowContext(ctx, `SELECT user_id FROM password_reset_tokens
+		WHERE token_hash = ? AND used_at IS NULL AND expires_at > ?
+		FOR UPDATE`, tokenHash, now).Scan(&userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return uuid.Nil, fmt.Errorf("%s: %w", op, storage.ErrPasswordResetTokenNotFound)
+		}
+
+		return uuid.Nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = tx.ExecContext(ctx,
+		"UPDATE password_reset_tokens SET used_at = ? WHERE user_id = ? AND used_at IS NULL",
+		now, userID,
+	)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	res, err := tx.ExecContext(ctx, "UPDATE users SET pass_hash = ?, password_reset_required = FALSE WHERE id = ?", passHash, userID)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("%s: %w", op, err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if affected == 0 {
+		return uuid.Nil, fmt.Errorf("%s: %w", op, storage.ErrPasswordResetTokenNotFound)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return uuid.Nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return userID, nil
+}
+
+// RequirePasswordReset keeps the user from logging in until their password
+// is changed.
+func (s *Storage) RequirePasswordReset(ctx context.Context, userID uuid.UUID) error {
+	const op = "storage.mysql.RequirePasswordReset"
+
+	_, err := s.db.ExecContext(ctx,
+		"UPDATE users SET password_reset_required = TRUE WHERE id = ? AND deleted_at IS NULL",
+		userID,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
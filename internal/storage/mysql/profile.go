@@ -0,0 +1,148 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Novochenko/sso/domain/models"
+	"github.com/Novochenko/sso/internal/storage"
+	mysqlDriver "github.com/go-sql-driver/mysql"
+	"github.com/google/uuid"
+)
+
+const userAccountColumns = "id, username, pfp_path"
+
+func (s *Storage) UpdateUsername(ctx context.Context, userID uuid.UUID, username string) error {
+	const op = "storage.mysql.UpdateUsername"
+
+	stmt, err := s.db.Prepare("UPDATE users SET username = ? WHERE id = ?")
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if _, err := stmt.ExecContext(ctx, username, userID); err != nil {
+		var mysqlErr *mysqlDriver.MySQLError
+		if errors.As(err, &mysqlErr) && mysqlErr.Number == 1062 {
+			return fmt.Errorf("%s: %w", op, storage.ErrUsernameTaken)
+		}
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// SetProfilePicturePath points the user's profile picture at path and
+// returns the path it replaced, empty if there was none.
+func (s *Storage) SetProfilePicturePath(ctx context.Context, userID uuid.UUID, path string) (string, error) {
+	const op = "storage.mysql.SetProfilePicturePath"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	var oldPath sql.NullString
+	err = tx.QueryRowContext(ctx, "SELECT pfp_path FROM users WHERE id = ? FOR UPDATE", userID).Scan(&oldPath)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+		}
+
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	if _, err := tx.ExecContext(ctx, "UPDATE users SET pfp_path = ? WHERE id = ?", path, userID); err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	return oldPath.String, nil
+}
+
+// UserAccountByUsername looks a user up by username. Usernames are compared
+// case-insensitively. A non-zero orgID only finds members of that
+// organization, see inOrg.
+func (s *Storage) UserAccountByUsername(ctx context.Context, username string, orgID int64) (models.UserAccount, error) {
+	const op = "storage.mysql.UserAccountByUsername"
+
+	stmt, err := s.db.Prepare("SELECT " + userAccountColumns + " FROM users u WHERE username = ? AND deleted_at IS NULL" + inOrg)
+	if err != nil {
+		return models.UserAccount{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	userAccount, err := scanUserAccount(stmt.QueryRowContext(ctx, username, orgID, orgID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.UserAccount{}, fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+		}
+
+		return models.UserAccount{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return userAccount, nil
+}
+
+// UserAccountsByIDs returns the accounts of the users that exist among
+// userIDs, in no particular order. A non-zero orgID leaves out those who are
+// not members of that organization, see inOrg.
+func (s *Storage) UserAccountsByIDs(ctx context.Context, userIDs []uuid.UUID, orgID int64) ([]models.UserAccount, error) {
+	const op = "storage.mysql.UserAccountsByIDs"
+
+	if len(userIDs) == 0 {
+		return nil, nil
+	}
+
+	args := make([]any, len(userIDs))
+	for i, id := range userIDs {
+		args[i] = id
+	}
+	args = append(args, orgID, orgID)
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(userIDs)), ", ")
+
+	rows, err := s.db.QueryContext(ctx,
+		"SELECT "+userAccountColumns+" FROM users u WHERE id IN ("+placeholders+") AND deleted_at IS NULL"+inOrg,
+		args...,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var accounts []models.UserAccount
+	for rows.Next() {
+		account, err := scanUserAccount(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		accounts = append(accounts, account)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return accounts, nil
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanUserAccount(row scanner) (models.UserAccount, error) {
+	var account models.UserAccount
+	var username, pfpPath sql.NullString
+	if err := row.Scan(&account.UserId, &username, &pfpPath); err != nil {
+		return models.UserAccount{}, err
+	}
+	account.UserName = username.String
+	account.ProfilePicturePath = pfpPath.String
+
+	return account, nil
+}
@@ -0,0 +1,240 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/Novochenko/sso/domain/models"
+	"github.com/Novochenko/sso/internal/storage"
+	mysqlDriver "github.com/go-sql-driver/mysql"
+	"github.com/google/uuid"
+)
+
+func (s *Storage) SaveRole(ctx context.Context, role models.Role) (int64, error) {
+	const op = "storage.mysql.SaveRole"
+
+	res, err := s.db.ExecContext(ctx,
+		"INSERT INTO roles (app_id, name, description) VALUES (?, ?, ?)",
+		role.AppID, role.Name, role.Description,
+	)
+	if err != nil {
+		var mysqlErr *mysqlDriver.MySQLError
+		if errors.As(err, &mysqlErr) && mysqlErr.Number == 1062 {
+			return 0, fmt.Errorf("%s: %w", op, storage.ErrRoleExists)
+		}
+
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return id, nil
+}
+
+func (s *Storage) Role(ctx context.Context, id int64) (models.Role, error) {
+	const op = "storage.mysql.Role"
+
+	var role models.Role
+	err := s.db.QueryRowContext(ctx,
+		"SELECT id, app_id, name, description FROM roles WHERE id = ?",
+		id,
+	).Scan(&role.ID, &role.AppID, &role.Name, &role.Description)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.Role{}, fmt.Errorf("%s: %w", op, storage.ErrRoleNotFound)
+		}
+
+		return models.Role{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return role, nil
+}
+
+func (s *Storage) SavePermission(ctx context.Context, permission models.Permission) (int64, error) {
+	const op = "storage.mysql.SavePermission"
+
+	res, err := s.db.ExecContext(ctx,
+		"INSERT INTO permissions (app_id, name, description) VALUES (?, ?, ?)",
+		permission.AppID, permission.Name, permission.Description,
+	)
+	if err != nil {
+		var mysqlErr *mysqlDriver.MySQLError
+		if errors.As(err, &mysqlErr) && mysqlErr.Number == 1062 {
+			return 0, fmt.Errorf("%s: %w", op, storage.ErrPermissionExists)
+		}
+
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return id, nil
+}
+
+func (s *Storage) Permission(ctx context.Context, id int64) (models.Permission, error) {
+	const op = "storage.mysql.Permission"
+
+	var permission models.Permission
+	err := s.db.QueryRowContext(ctx,
+		"SELECT id, app_id, name, description FROM permissions WHERE id = ?",
+		id,
+	).Scan(&permission.ID, &permission.AppID, &permission.Name, &permission.Description)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.Permission{}, fmt.Errorf("%s: %w", op, storage.ErrPermissionNotFound)
+		}
+
+		return models.Permission{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return permission, nil
+}
+
+// AddRolePermission grants the permission to the role. Granting it twice is
+// not an error.
+func (s *Storage) AddRolePermission(ctx context.Context, roleID, permissionID int64) error {
+	const op = "storage.mysql.AddRolePermission"
+
+	_, err := s.db.ExecContext(ctx,
+		"INSERT IGNORE INTO role_permissions (role_id, permission_id) VALUES (?, ?)",
+		roleID, permissionID,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) RemoveRolePermission(ctx context.Context, roleID, permissionID int64) error {
+	const op = "storage.mysql.RemoveRolePermission"
+
+	_, err := s.db.ExecContext(ctx,
+		"DELETE FROM role_permissions WHERE role_id = ? AND permission_id = ?",
+		roleID, permissionID,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// AssignRole gives the role to the user. Assigning it twice is not an error.
+func (s *Storage) AssignRole(ctx context.Context, userID uuid.UUID, roleID int64) error {
+	const op = "storage.mysql.AssignRole"
+
+	_, err := s.db.ExecContext(ctx,
+		"INSERT IGNORE INTO user_roles (user_id, role_id) VALUES (?, ?)",
+		userID, roleID,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) UnassignRole(ctx context.Context, userID uuid.UUID, roleID int64) error {
+	const op = "storage.mysql.UnassignRole"
+
+	_, err := s.db.ExecContext(ctx,
+		"DELETE FROM user_roles WHERE user_id = ? AND role_id = ?",
+		userID, roleID,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// heldRoles is the condition on roles aliased r that the user holds in the
+// app, directly or through one of groupIDs, and its arguments. Roles of apps
+// that belong to an organization the user is not a member of are dropped,
+// so leaving an organization takes its roles away.
+func heldRoles(userID uuid.UUID, groupIDs []int64, appID int64) (string, []any) {
+	query := "r.app_id IN (0, ?) AND (r.id IN (SELECT role_id FROM user_roles WHERE user_id = ?)"
+	args := []any{appID, userID}
+	if len(groupIDs) > 0 {
+		placeholders, groupArgs := int64List(groupIDs)
+		query += " OR r.id IN (SELECT role_id FROM group_roles WHERE group_id IN (" + placeholders + "))"
+		args = append(args, groupArgs...)
+	}
+	query += `)
+		AND NOT EXISTS (
+			SELECT 1 FROM apps a WHERE a.id = r.app_id AND a.org_id <> 0 AND NOT EXISTS (
+				SELECT 1 FROM org_memberships om WHERE om.org_id = a.org_id AND om.user_id = ?
+			)
+		)`
+	args = append(args, userID)
+
+	return query, args
+}
+
+// UserAuthorization returns the roles the user holds in the app, global
+// ones included, and the permissions they grant there. groupIDs are the
+// groups the user belongs to, directly or not; their roles count as the
+// user's own.
+func (s *Storage) UserAuthorization(
+	ctx context.Context,
+	userID uuid.UUID,
+	groupIDs []int64,
+	appID int64,
+) (models.Authorization, error) {
+	const op = "storage.mysql.UserAuthorization"
+
+	var authz models.Authorization
+	var err error
+
+	held, args := heldRoles(userID, groupIDs, appID)
+
+	authz.Roles, err = s.names(ctx,
+		"SELECT r.name FROM roles r WHERE "+held+" ORDER BY r.name",
+		args...,
+	)
+	if err != nil {
+		return models.Authorization{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	authz.Permissions, err = s.names(ctx,
+		`SELECT DISTINCT p.name FROM roles r
+		JOIN role_permissions rp ON rp.role_id = r.id
+		JOIN permissions p ON p.id = rp.permission_id
+		WHERE p.app_id IN (0, ?) AND `+held+`
+		ORDER BY p.name`,
+		append([]any{appID}, args...)...,
+	)
+	if err != nil {
+		return models.Authorization{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return authz, nil
+}
+
+func (s *Storage) names(ctx context.Context, query string, args ...any) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+
+	return names, rows.Err()
+}
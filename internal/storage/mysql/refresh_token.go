@@ -0,0 +1,146 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Novochenko/sso/domain/models"
+	"github.com/Novochenko/sso/internal/storage"
+	"github.com/google/uuid"
+)
+
+func (s *Storage) RefreshToken(ctx context.Context, tokenHash string) (models.RefreshToken, error) {
+	const op = "storage.mysql.RefreshToken"
+
+	stmt, err := s.db.Prepare(`SELECT id, family_id, token_hash, user_id, app_id, org_id, expires_at, used_at, revoked_at
+		FROM refresh_tokens WHERE token_hash = ?`)
+	if err != nil {
+		return models.RefreshToken{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	row := stmt.QueryRowContext(ctx, tokenHash)
+
+	var token models.RefreshToken
+	var usedAt, revokedAt sql.NullTime
+	err = row.Scan(
+		&token.ID,
+		&token.FamilyID,
+		&token.TokenHash,
+		&token.UserID,
+		&token.AppID,
+		&token.OrgID,
+		&token.ExpiresAt,
+		&usedAt,
+		&revokedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.RefreshToken{}, fmt.Errorf("%s: %w", op, storage.ErrRefreshTokenNotFound)
+		}
+
+		return models.RefreshToken{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if usedAt.Valid {
+		token.UsedAt = &usedAt.Time
+	}
+	if revokedAt.Valid {
+		token.RevokedAt = &revokedAt.Time
+	}
+
+	return token, nil
+}
+
+// RotateRefreshToken marks the token with usedID as used, stores next and
+// extends the session of its family in a single transaction. If the token
+// has already been used or revoked, storage.ErrRefreshTokenUsed is returned
+// and nothing is written.
+func (s *Storage) RotateRefreshToken(ctx context.Context, usedID uuid.UUID, next models.RefreshToken) error {
+	const op = "storage.mysql.RotateRefreshToken"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx,
+		"UPDATE refresh_tokens SET used_at = ? WHERE id = ? AND used_at IS NULL AND revoked_at IS NULL",
+		time.Now().UTC(), usedID,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrRefreshTokenUsed)
+	}
+
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO refresh_tokens(id, family_id, token_hash, user_id, app_id, org_id, expires_at)
+		VALUES(?, ?, ?, ?, ?, ?, ?)`,
+		next.ID, next.FamilyID, next.TokenHash, next.UserID, next.AppID, next.OrgID, next.ExpiresAt,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = tx.ExecContext(ctx,
+		"UPDATE sessions SET last_seen_at = ?, expires_at = ? WHERE id = ?",
+		time.Now().UTC(), next.ExpiresAt, next.FamilyID,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// expiringTables lists the tables of credentials that are useless once their
+// expires_at has passed. DeleteExpiredCredentials clears them.
+var expiringTables = []string{
+	"refresh_tokens",
+	"authorization_codes",
+	"device_codes",
+	"password_reset_tokens",
+}
+
+// DeleteExpiredCredentials removes the expired rows of every expiring table,
+// and the sessions that expired before sessionsBefore. Sessions are kept
+// longer so that the access tokens of a revoked session stay rejected
+// until they expire too.
+func (s *Storage) DeleteExpiredCredentials(ctx context.Context, sessionsBefore time.Time) error {
+	const op = "storage.mysql.DeleteExpiredCredentials"
+
+	now := time.Now().UTC()
+	for _, table := range expiringTables {
+		if err := s.deleteExpired(ctx, table, now); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+	if err := s.deleteExpired(ctx, "sessions", sessionsBefore.UTC()); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) deleteExpired(ctx context.Context, table string, before time.Time) error {
+	stmt, err := s.db.Prepare("DELETE FROM " + table + " WHERE expires_at <= ?")
+	if err != nil {
+		return err
+	}
+
+	_, err = stmt.ExecContext(ctx, before)
+
+	return err
+}
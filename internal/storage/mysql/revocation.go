@@ -0,0 +1,168 @@
+package mysql
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Novochenko/sso/internal/storage"
+	"github.com/google/uuid"
+)
+
+func (s *Storage) RevokeToken(ctx context.Context, jti string, userID uuid.UUID, expiresAt time.Time) error {
+	const op = "storage.mysql.RevokeToken"
+
+	stmt, err := s.db.Prepare("INSERT IGNORE INTO revoked_tokens(jti, user_id, expires_at) VALUES(?, ?, ?)")
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = stmt.ExecContext(ctx, jti, userID, expiresAt.UTC())
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) IsTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	const op = "storage.mysql.IsTokenRevoked"
+
+	stmt, err := s.db.Prepare("SELECT EXISTS(SELECT 1 FROM revoked_tokens WHERE jti = ?)")
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var revoked bool
+	if err := stmt.QueryRowContext(ctx, jti).Scan(&revoked); err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return revoked, nil
+}
+
+// RevokedTokens returns the ids of revoked tokens that have not expired yet.
+func (s *Storage) RevokedTokens(ctx context.Context) ([]string, error) {
+	const op = "storage.mysql.RevokedTokens"
+
+	stmt, err := s.db.Prepare("SELECT jti FROM revoked_tokens WHERE expires_at > ?")
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	rows, err := stmt.QueryContext(ctx, time.Now().UTC())
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var jtis []string
+	for rows.Next() {
+		var jti string
+		if err := rows.Scan(&jti); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		jtis = append(jtis, jti)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return jtis, nil
+}
+
+func (s *Storage) DeleteExpiredRevokedTokens(ctx context.Context) error {
+	const op = "storage.mysql.DeleteExpiredRevokedTokens"
+
+	stmt, err := s.db.Prepare("DELETE FROM revoked_tokens WHERE expires_at <= ?")
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if _, err := stmt.ExecContext(ctx, time.Now().UTC()); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// RevokeUserTokens moves the user's watermark to before, which invalidates
+// every access token issued until then, and revokes all the user's refresh
+// tokens and sessions.
+func (s *Storage) RevokeUserTokens(ctx context.Context, userID uuid.UUID, before time.Time) error {
+	const op = "storage.mysql.RevokeUserTokens"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx,
+		"UPDATE users SET tokens_revoked_before = ? WHERE id = ?",
+		before.UTC(), userID,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+	}
+
+	_, err = tx.ExecContext(ctx,
+		"UPDATE refresh_tokens SET revoked_at = ? WHERE user_id = ? AND revoked_at IS NULL",
+		before.UTC(), userID,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = tx.ExecContext(ctx,
+		"UPDATE sessions SET revoked_at = ? WHERE user_id = ? AND revoked_at IS NULL",
+		before.UTC(), userID,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// TokenWatermarks returns the watermarks set after since, keyed by user.
+func (s *Storage) TokenWatermarks(ctx context.Context, since time.Time) (map[uuid.UUID]time.Time, error) {
+	const op = "storage.mysql.TokenWatermarks"
+
+	stmt, err := s.db.Prepare("SELECT id, tokens_revoked_before FROM users WHERE tokens_revoked_before > ?")
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	rows, err := stmt.QueryContext(ctx, since.UTC())
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	watermarks := make(map[uuid.UUID]time.Time)
+	for rows.Next() {
+		var userID uuid.UUID
+		var before time.Time
+		if err := rows.Scan(&userID, &before); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		watermarks[userID] = before
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return watermarks, nil
+}
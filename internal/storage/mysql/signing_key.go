@@ -0,0 +1,213 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/Novochenko/sso/domain/models"
+	"github.com/Novochenko/sso/internal/storage"
+)
+
+// SigningKeys returns the next and active keys and every retired key that is
+// still published, newest first.
+func (s *Storage) SigningKeys(ctx context.Context) ([]models.SigningKey, error) {
+	const op = "storage.mysql.SigningKeys"
+
+	stmt, err := s.db.Prepare(`SELECT version, kid, algorithm, private_key, status, created_at, activated_at, retired_at, publish_until
+		FROM signing_keys
+		WHERE status <> ? OR publish_until > ?
+		ORDER BY version DESC`)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	rows, err := stmt.QueryContext(ctx, models.SigningKeyRetired, time.Now().UTC())
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var keys []models.SigningKey
+	for rows.Next() {
+		var key models.SigningKey
+		var activatedAt, retiredAt, publishUntil sql.NullTime
+		err := rows.Scan(
+			&key.Version,
+			&key.ID,
+			&key.Algorithm,
+			&key.PrivateKey,
+			&key.Status,
+			&key.CreatedAt,
+			&activatedAt,
+			&retiredAt,
+			&publishUntil,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		if activatedAt.Valid {
+			key.ActivatedAt = &activatedAt.Time
+		}
+		if retiredAt.Valid {
+			key.RetiredAt = &retiredAt.Time
+		}
+		if publishUntil.Valid {
+			key.PublishUntil = &publishUntil.Time
+		}
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return keys, nil
+}
+
+// InitSigningKeys stores the first active and next keys unless an active key
+// already exists, in which case nothing is written.
+func (s *Storage) InitSigningKeys(ctx context.Context, active, next models.SigningKey) error {
+	const op = "storage.mysql.InitSigningKeys"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	var count int
+	err = tx.QueryRowContext(ctx,
+		"SELECT COUNT(*) FROM signing_keys WHERE status = ? FOR UPDATE",
+		models.SigningKeyActive,
+	).Scan(&count)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if count > 0 {
+		return nil
+	}
+
+	if err := insertSigningKey(ctx, tx, active); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if err := insertSigningKey(ctx, tx, next); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// RotateSigningKeys retires the active key, promotes the next key and stores
+// newNext as the following one. storage.ErrSigningKeysRotated is returned if
+// another replica rotated the keys first.
+func (s *Storage) RotateSigningKeys(
+	ctx context.Context,
+	activeKID string,
+	nextKID string,
+	publishUntil time.Time,
+	newNext models.SigningKey,
+) error {
+	const op = "storage.mysql.RotateSigningKeys"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+
+	res, err := tx.ExecContext(ctx,
+		"UPDATE signing_keys SET status = ?, retired_at = ?, publish_until = ? WHERE kid = ? AND status = ?",
+		models.SigningKeyRetired, now, publishUntil, activeKID, models.SigningKeyActive,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if err := expectOneRow(res); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	res, err = tx.ExecContext(ctx,
+		"UPDATE signing_keys SET status = ?, activated_at = ? WHERE kid = ? AND status = ?",
+		models.SigningKeyActive, now, nextKID, models.SigningKeyNext,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if err := expectOneRow(res); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := insertSigningKey(ctx, tx, newNext); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// ResetSigningKeys immediately retires and unpublishes every key that is not
+// retired yet and stores a fresh active and next key.
+func (s *Storage) ResetSigningKeys(ctx context.Context, active, next models.SigningKey) error {
+	const op = "storage.mysql.ResetSigningKeys"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+
+	_, err = tx.ExecContext(ctx,
+		"UPDATE signing_keys SET status = ?, retired_at = ?, publish_until = ? WHERE status <> ?",
+		models.SigningKeyRetired, now, now, models.SigningKeyRetired,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := insertSigningKey(ctx, tx, active); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if err := insertSigningKey(ctx, tx, next); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func insertSigningKey(ctx context.Context, tx *sql.Tx, key models.SigningKey) error {
+	_, err := tx.ExecContext(ctx,
+		`INSERT INTO signing_keys(kid, algorithm, private_key, status, created_at, activated_at)
+		VALUES(?, ?, ?, ?, ?, ?)`,
+		key.ID, key.Algorithm, key.PrivateKey, key.Status, key.CreatedAt, key.ActivatedAt,
+	)
+
+	return err
+}
+
+func expectOneRow(res sql.Result) error {
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected != 1 {
+		return storage.ErrSigningKeysRotated
+	}
+
+	return nil
+}
@@ -0,0 +1,120 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/Novochenko/sso/domain/models"
+	"github.com/Novochenko/sso/internal/storage"
+	"github.com/google/uuid"
+)
+
+// SaveTOTP starts, or restarts, the enrollment of the user with a new sealed
+// secret. Confirmed enrollments are never replaced.
+func (s *Storage) SaveTOTP(ctx context.Context, userID uuid.UUID, secret []byte) error {
+	const op = "storage.mysql.SaveTOTP"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	var confirmedAt sql.NullTime
+	err = tx.QueryRowContext(ctx,
+		"SELECT confirmed_at FROM user_totp WHERE user_id = ? FOR UPDATE",
+		userID,
+	).Scan(&confirmedAt)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if confirmedAt.Valid {
+		return fmt.Errorf("%s: %w", op, storage.ErrTOTPAlreadyEnabled)
+	}
+
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO user_totp (user_id, secret) VALUES (?, ?)
+		ON DUPLICATE KEY UPDATE secret = VALUES(secret), created_at = CURRENT_TIMESTAMP`,
+		userID, secret,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) TOTP(ctx context.Context, userID uuid.UUID) (models.TOTP, error) {
+	const op = "storage.mysql.TOTP"
+
+	var totp models.TOTP
+	var confirmedAt sql.NullTime
+	err := s.db.QueryRowContext(ctx,
+		"SELECT user_id, secret, confirmed_at, last_used_step FROM user_totp WHERE user_id = ?",
+		userID,
+	).Scan(&totp.UserID, &totp.Secret, &confirmedAt, &totp.LastUsedStep)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.TOTP{}, fmt.Errorf("%s: %w", op, storage.ErrTOTPNotFound)
+		}
+
+		return models.TOTP{}, fmt.Errorf("%s: %w", op, err)
+	}
+	totp.ConfirmedAt = confirmedAt.Time
+
+	return totp, nil
+}
+
+// ConfirmTOTP enables a pending enrollment. step is the time step of the
+// code it was confirmed with.
+func (s *Storage) ConfirmTOTP(ctx context.Context, userID uuid.UUID, step int64) error {
+	const op = "storage.mysql.ConfirmTOTP"
+
+	res, err := s.db.ExecContext(ctx,
+		`UPDATE user_totp SET confirmed_at = CURRENT_TIMESTAMP, last_used_step = ?
+		WHERE user_id = ? AND confirmed_at IS NULL`,
+		step, userID,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrTOTPNotFound)
+	}
+
+	return nil
+}
+
+// UseTOTPStep records that the code of step was used. Steps only move
+// forward, so a code, or an older one, cannot be replayed.
+func (s *Storage) UseTOTPStep(ctx context.Context, userID uuid.UUID, step int64) error {
+	const op = "storage.mysql.UseTOTPStep"
+
+	res, err := s.db.ExecContext(ctx,
+		`UPDATE user_totp SET last_used_step = ?
+		WHERE user_id = ? AND confirmed_at IS NOT NULL AND last_used_step < ?`,
+		step, userID, step,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrTOTPStepUsed)
+	}
+
+	return nil
+}
@@ -0,0 +1,127 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Novochenko/sso/domain/models"
+	"github.com/Novochenko/sso/internal/storage"
+	mysqlDriver "github.com/go-sql-driver/mysql"
+	"github.com/google/uuid"
+)
+
+const webAuthnCredentialColumns = "id, user_id, name, public_key, sign_count, aaguid, attestation_format, created_at, last_used_at"
+
+func (s *Storage) SaveWebAuthnCredential(ctx context.Context, cred models.WebAuthnCredential) error {
+	const op = "storage.mysql.SaveWebAuthnCredential"
+
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO webauthn_credentials (id, user_id, name, public_key, sign_count, aaguid, attestation_format)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		cred.ID, cred.UserID, cred.Name, cred.PublicKey, cred.SignCount, cred.AAGUID, cred.AttestationFormat,
+	)
+	if err != nil {
+		var mysqlErr *mysqlDriver.MySQLError
+		if errors.As(err, &mysqlErr) && mysqlErr.Number == 1062 {
+			return fmt.Errorf("%s: %w", op, storage.ErrWebAuthnCredentialExists)
+		}
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) WebAuthnCredential(ctx context.Context, id []byte) (models.WebAuthnCredential, error) {
+	const op = "storage.mysql.WebAuthnCredential"
+
+	cred, err := scanWebAuthnCredential(s.db.QueryRowContext(ctx,
+		"SELECT "+webAuthnCredentialColumns+" FROM webauthn_credentials WHERE id = ?",
+		id,
+	))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.WebAuthnCredential{}, fmt.Errorf("%s: %w", op, storage.ErrWebAuthnCredentialNotFound)
+		}
+
+		return models.WebAuthnCredential{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return cred, nil
+}
+
+func (s *Storage) WebAuthnCredentials(ctx context.Context, userID uuid.UUID) ([]models.WebAuthnCredential, error) {
+	const op = "storage.mysql.WebAuthnCredentials"
+
+	rows, err := s.db.QueryContext(ctx,
+		"SELECT "+webAuthnCredentialColumns+" FROM webauthn_credentials WHERE user_id = ? ORDER BY created_at",
+		userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var creds []models.WebAuthnCredential
+	for rows.Next() {
+		cred, err := scanWebAuthnCredential(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		creds = append(creds, cred)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return creds, nil
+}
+
+// UpdateWebAuthnSignCount records a successful assertion with the credential.
+func (s *Storage) UpdateWebAuthnSignCount(ctx context.Context, id []byte, signCount uint32, usedAt time.Time) error {
+	const op = "storage.mysql.UpdateWebAuthnSignCount"
+
+	res, err := s.db.ExecContext(ctx,
+		"UPDATE webauthn_credentials SET sign_count = ?, last_used_at = ? WHERE id = ?",
+		signCount, usedAt.UTC(), id,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrWebAuthnCredentialNotFound)
+	}
+
+	return nil
+}
+
+func scanWebAuthnCredential(row scanner) (models.WebAuthnCredential, error) {
+	var cred models.WebAuthnCredential
+	var lastUsedAt sql.NullTime
+	err := row.Scan(
+		&cred.ID,
+		&cred.UserID,
+		&cred.Name,
+		&cred.PublicKey,
+		&cred.SignCount,
+		&cred.AAGUID,
+		&cred.AttestationFormat,
+		&cred.CreatedAt,
+		&lastUsedAt,
+	)
+	if err != nil {
+		return models.WebAuthnCredential{}, err
+	}
+	if lastUsedAt.Valid {
+		cred.LastUsedAt = &lastUsedAt.Time
+	}
+
+	return cred, nil
+}
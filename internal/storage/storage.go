@@ -3,7 +3,46 @@ package storage
 import "errors"
 
 var (
-	ErrUserExists   = errors.New("user already exists")
-	ErrUserNotFound = errors.New("user not found")
-	ErrAppNotFound  = errors.New("app not found")
+	ErrUserExists    = errors.New("user already exists")
+	ErrUserNotFound  = errors.New("user not found")
+	ErrUsernameTaken = errors.New("username already taken")
+	ErrAppNotFound   = errors.New("app not found")
+
+	ErrRefreshTokenNotFound = errors.New("refresh token not found")
+	ErrRefreshTokenUsed     = errors.New("refresh token already used")
+	ErrSessionNotFound      = errors.New("session not found")
+
+	ErrSigningKeysRotated = errors.New("signing keys already rotated")
+
+	ErrAuthorizationCodeNotFound = errors.New("authorization code not found")
+	ErrDeviceCodeNotFound        = errors.New("device code not found")
+
+	ErrActionTokenUsed = errors.New("action token already used")
+
+	ErrPasswordResetTokenNotFound = errors.New("password reset token not found")
+
+	ErrEmailChangeNotFound = errors.New("email change not found")
+
+	ErrTOTPNotFound       = errors.New("totp not found")
+	ErrTOTPAlreadyEnabled = errors.New("totp already enabled")
+	ErrTOTPStepUsed       = errors.New("totp code already used")
+
+	ErrWebAuthnCredentialNotFound = errors.New("webauthn credential not found")
+	ErrWebAuthnCredentialExists   = errors.New("webauthn credential already registered")
+
+	ErrBackupCodeNotFound = errors.New("backup code not found")
+
+	ErrRoleNotFound       = errors.New("role not found")
+	ErrRoleExists         = errors.New("role already exists")
+	ErrPermissionNotFound = errors.New("permission not found")
+	ErrPermissionExists   = errors.New("permission already exists")
+
+	ErrOrganizationNotFound = errors.New("organization not found")
+	ErrOrganizationExists   = errors.New("organization already exists")
+	ErrMembershipNotFound   = errors.New("organization membership not found")
+	ErrLastOrgOwner         = errors.New("organization must keep an owner")
+
+	ErrGroupNotFound = errors.New("group not found")
+	ErrGroupExists   = errors.New("group already exists")
+	ErrGroupCycle    = errors.New("subgroup would create a cycle")
 )
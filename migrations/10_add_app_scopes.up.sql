@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS app_scopes
+(
+    app_id INT NOT NULL,
+    scope  VARCHAR(100) NOT NULL,
+    PRIMARY KEY (app_id, scope)
+);
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS device_codes
+(
+    device_code_hash CHAR(64) PRIMARY KEY,
+    user_code        CHAR(8) NOT NULL UNIQUE,
+    app_id           INT NOT NULL,
+    scope            VARCHAR(255) NOT NULL,
+    user_id          BINARY(36) NULL,
+    status           VARCHAR(10) NOT NULL,
+    poll_interval    INT NOT NULL,
+    last_polled_at   DATETIME NULL,
+    expires_at       DATETIME NOT NULL,
+    created_at       DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX idx_device_codes_expires_at ON device_codes(expires_at);
@@ -0,0 +1,17 @@
+ALTER TABLE users
+    ADD COLUMN email_verified BOOLEAN NOT NULL DEFAULT FALSE;
+-- Accounts created before verification existed keep working everywhere.
+UPDATE users SET email_verified = TRUE;
+
+ALTER TABLE apps
+    ADD COLUMN require_verified_email BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE TABLE IF NOT EXISTS used_action_tokens
+(
+    jti        CHAR(36) PRIMARY KEY,
+    user_id    BINARY(36) NOT NULL,
+    purpose    VARCHAR(20) NOT NULL,
+    expires_at DATETIME NOT NULL,
+    used_at    DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX idx_used_action_tokens_expires_at ON used_action_tokens(expires_at);
@@ -0,0 +1,6 @@
+-- Usernames used to default to FALSE, i.e. '0'; unset is NULL from now on so
+-- that the unique index only covers usernames users actually chose.
+ALTER TABLE users
+    MODIFY COLUMN username VARCHAR(30) NULL DEFAULT NULL;
+UPDATE users SET username = NULL WHERE username = '0';
+CREATE UNIQUE INDEX idx_users_username ON users(username);
@@ -0,0 +1,3 @@
+UPDATE users SET pfp_path = '0' WHERE pfp_path IS NULL OR CHAR_LENGTH(pfp_path) > 30;
+ALTER TABLE users
+    MODIFY COLUMN pfp_path VARCHAR(30) NOT NULL DEFAULT FALSE;
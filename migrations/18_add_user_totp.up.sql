@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS user_totp
+(
+    user_id        BINARY(36) PRIMARY KEY,
+    -- Sealed with the MFA encryption key, never stored in the clear.
+    secret         VARBINARY(255) NOT NULL,
+    confirmed_at   DATETIME NULL,
+    last_used_step BIGINT NOT NULL DEFAULT 0,
+    created_at     DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,8 @@
+ALTER TABLE refresh_tokens
+    DROP COLUMN org_id;
+
+ALTER TABLE apps
+    DROP COLUMN org_id;
+
+DROP TABLE IF EXISTS org_memberships;
+DROP TABLE IF EXISTS organizations;
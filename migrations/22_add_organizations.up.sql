@@ -0,0 +1,26 @@
+CREATE TABLE IF NOT EXISTS organizations
+(
+    id         BIGINT AUTO_INCREMENT PRIMARY KEY,
+    slug       VARCHAR(64) NOT NULL UNIQUE,
+    name       VARCHAR(128) NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS org_memberships
+(
+    org_id     BIGINT NOT NULL,
+    user_id    BINARY(36) NOT NULL,
+    -- owner, admin or member.
+    role       VARCHAR(16) NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (org_id, user_id)
+);
+CREATE INDEX idx_org_memberships_user_id ON org_memberships(user_id);
+
+-- Apps with an org_id only admit the members of that organization; 0 keeps
+-- an app open to every user.
+ALTER TABLE apps
+    ADD COLUMN org_id BIGINT NOT NULL DEFAULT 0;
+
+ALTER TABLE refresh_tokens
+    ADD COLUMN org_id BIGINT NOT NULL DEFAULT 0;
@@ -0,0 +1,27 @@
+-- A session is everything issued from one login. Its id is the family_id of
+-- its refresh tokens and the sid claim of its access tokens.
+CREATE TABLE IF NOT EXISTS sessions
+(
+    id           BINARY(36) PRIMARY KEY,
+    user_id      BINARY(36) NOT NULL,
+    app_id       INT NOT NULL,
+    org_id       BIGINT NOT NULL DEFAULT 0,
+    user_agent   VARCHAR(255) NOT NULL DEFAULT '',
+    ip           VARCHAR(45) NOT NULL DEFAULT '',
+    created_at   DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_seen_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at   DATETIME NOT NULL,
+    revoked_at   DATETIME NULL
+);
+CREATE INDEX idx_sessions_user_id ON sessions(user_id);
+CREATE INDEX idx_sessions_revoked_at ON sessions(revoked_at);
+
+INSERT INTO permissions (app_id, name, description)
+VALUES (0, 'sso.sessions.manage', 'List and revoke the sessions of any user');
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id
+FROM roles r
+         JOIN permissions p ON p.app_id = 0 AND p.name = 'sso.sessions.manage'
+WHERE r.app_id = 0
+  AND r.name = 'admin';
@@ -0,0 +1,12 @@
+DELETE rp
+FROM role_permissions rp
+         JOIN permissions p ON p.id = rp.permission_id
+WHERE p.app_id = 0
+  AND p.name = 'sso.accounts.unlock';
+
+DELETE
+FROM permissions
+WHERE app_id = 0
+  AND name = 'sso.accounts.unlock';
+
+DROP TABLE IF EXISTS login_failures;
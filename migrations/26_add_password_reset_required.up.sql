@@ -0,0 +1,4 @@
+-- Set when a user's password turns up in a breach corpus; they cannot log in
+-- until they choose a new password.
+ALTER TABLE users
+    ADD COLUMN password_reset_required BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,12 @@
+-- Lets a user without an organization look up the users of every
+-- organization. Everyone else only sees their own organization, or users
+-- outside of any organization.
+INSERT INTO permissions (app_id, name, description)
+VALUES (0, 'sso.users.read', 'Look up the users of every organization');
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id
+FROM roles r
+         JOIN permissions p ON p.app_id = 0 AND p.name = 'sso.users.read'
+WHERE r.app_id = 0
+  AND r.name = 'admin';
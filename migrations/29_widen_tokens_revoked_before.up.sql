@@ -0,0 +1,4 @@
+-- Access tokens carry their issue time to the millisecond; the watermark
+-- they are compared with needs the same precision.
+ALTER TABLE users
+    MODIFY COLUMN tokens_revoked_before DATETIME(3) NULL;
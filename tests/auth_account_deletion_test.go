@@ -0,0 +1,133 @@
+package tests
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/Novochenko/protos/gen/go/sso"
+	"github.com/Novochenko/sso/tests/suite"
+	"github.com/brianvoe/gofakeit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestDeleteAccount(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	email := gofakeit.Email()
+	password := randomFakePassword()
+	_, err := st.AuthClient.Register(ctx, &sso.RegisterRequest{Email: email, Password: password})
+	require.NoError(t, err)
+	respLogin, err := st.AuthClient.Login(ctx, &sso.LoginRequest{Email: email, Password: password, AppId: appID})
+	require.NoError(t, err)
+	authCtx := withBearer(ctx, respLogin.GetToken())
+	userID := userIDOf(ctx, t, st, respLogin.GetToken())
+
+	_, err = st.AuthClient.DeleteAccount(authCtx, &sso.DeleteAccountRequest{Password: "wrong-password"})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	_, err = st.AuthClient.DeleteAccount(authCtx, &sso.DeleteAccountRequest{Password: password})
+	require.NoError(t, err)
+
+	respIntrospect, err := st.AuthClient.Introspect(ctx, &sso.IntrospectRequest{Token: respLogin.GetToken()})
+	require.NoError(t, err)
+	assert.False(t, respIntrospect.GetActive())
+
+	_, err = st.AuthClient.Refresh(ctx, &sso.RefreshRequest{RefreshToken: respLogin.GetRefreshToken()})
+	assert.Error(t, err)
+
+	_, err = st.AuthClient.Login(ctx, &sso.LoginRequest{Email: email, Password: password, AppId: appID})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = st.AuthClient.Find(ctx, &sso.FindRequest{UserId: userID})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	// The address stays taken until the account is purged.
+	_, err = st.AuthClient.Register(ctx, &sso.RegisterRequest{Email: email, Password: password})
+	assert.Equal(t, codes.AlreadyExists, status.Code(err))
+}
+
+func TestExportMyData(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	_, err := st.AuthClient.ExportMyData(ctx, &sso.ExportMyDataRequest{})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	email := gofakeit.Email()
+	password := randomFakePassword()
+	_, err = st.AuthClient.Register(ctx, &sso.RegisterRequest{Email: email, Password: password})
+	require.NoError(t, err)
+	respLogin, err := st.AuthClient.Login(ctx, &sso.LoginRequest{Email: email, Password: password, AppId: appID})
+	require.NoError(t, err)
+	authCtx := withBearer(ctx, respLogin.GetToken())
+
+	username := randomUsername()
+	_, err = st.AuthClient.UpdateProfile(authCtx, &sso.UpdateProfileRequest{UserName: username})
+	require.NoError(t, err)
+
+	respExport, err := st.AuthClient.ExportMyData(authCtx, &sso.ExportMyDataRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, "application/zip", respExport.GetContentType())
+
+	archive, err := zip.NewReader(bytes.NewReader(respExport.GetArchive()), int64(len(respExport.GetArchive())))
+	require.NoError(t, err)
+
+	var account struct {
+		ID       string `json:"id"`
+		Email    string `json:"email"`
+		Username string `json:"username"`
+	}
+	readArchiveJSON(t, archive, "account.json", &account)
+	assert.Equal(t, email, account.Email)
+	assert.Equal(t, username, account.Username)
+
+	var sessions []struct {
+		ID         string    `json:"id"`
+		AppID      int64     `json:"app_id"`
+		UserAgent  string    `json:"user_agent"`
+		IP         string    `json:"ip"`
+		CreatedAt  time.Time `json:"created_at"`
+		LastSeenAt time.Time `json:"last_seen_at"`
+	}
+	readArchiveJSON(t, archive, "sessions.json", &sessions)
+	require.Len(t, sessions, 1)
+	assert.Equal(t, int64(appID), sessions[0].AppID)
+	respIntrospect, err := st.AuthClient.Introspect(ctx, &sso.IntrospectRequest{Token: respLogin.GetToken()})
+	require.NoError(t, err)
+	assert.Equal(t, respIntrospect.GetSessionId(), sessions[0].ID)
+	assert.Contains(t, sessions[0].UserAgent, "grpc-go")
+	assert.NotEmpty(t, sessions[0].IP)
+	assert.False(t, sessions[0].CreatedAt.IsZero())
+	assert.False(t, sessions[0].LastSeenAt.Before(sessions[0].CreatedAt))
+
+	var grants []struct {
+		AppID int64 `json:"app_id"`
+	}
+	readArchiveJSON(t, archive, "app_grants.json", &grants)
+	require.Len(t, grants, 1)
+	assert.Equal(t, int64(appID), grants[0].AppID)
+
+	var events []struct {
+		Type string `json:"type"`
+	}
+	readArchiveJSON(t, archive, "audit_events.json", &events)
+	assert.NotNil(t, events)
+}
+
+func readArchiveJSON(t *testing.T, archive *zip.Reader, name string, v any) {
+	t.Helper()
+
+	f, err := archive.Open(name)
+	require.NoError(t, err)
+	defer f.Close()
+
+	data, err := io.ReadAll(f)
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(data, v))
+}
@@ -0,0 +1,132 @@
+package tests
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Novochenko/protos/gen/go/sso"
+	"github.com/Novochenko/sso/internal/lib/totp"
+	"github.com/Novochenko/sso/tests/suite"
+	"github.com/brianvoe/gofakeit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestBackupCodes_SecondFactorAndRecovery(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	email := gofakeit.Email()
+	password := randomFakePassword()
+	_, err := st.AuthClient.Register(ctx, &sso.RegisterRequest{Email: email, Password: password})
+	require.NoError(t, err)
+	respLogin, err := st.AuthClient.Login(ctx, &sso.LoginRequest{Email: email, Password: password, AppId: appID})
+	require.NoError(t, err)
+	authCtx := withBearer(ctx, respLogin.GetToken())
+
+	_, err = st.AuthClient.GenerateBackupCodes(authCtx, &sso.GenerateBackupCodesRequest{Password: "wrong password"})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	respCodes, err := st.AuthClient.GenerateBackupCodes(authCtx, &sso.GenerateBackupCodesRequest{Password: password})
+	require.NoError(t, err)
+	backupCodes := respCodes.GetCodes()
+	require.Len(t, backupCodes, 10)
+
+	// Backup codes alone do not turn on a second factor.
+	respLogin, err = st.AuthClient.Login(ctx, &sso.LoginRequest{Email: email, Password: password, AppId: appID})
+	require.NoError(t, err)
+	assert.False(t, respLogin.GetMfaRequired())
+
+	respEnroll, err := st.AuthClient.EnrollTOTP(authCtx, &sso.EnrollTOTPRequest{})
+	require.NoError(t, err)
+	code, err := totp.Code(respEnroll.GetSecret(), time.Now())
+	require.NoError(t, err)
+	_, err = st.AuthClient.ConfirmTOTP(authCtx, &sso.ConfirmTOTPRequest{Code: code})
+	require.NoError(t, err)
+
+	respLogin, err = st.AuthClient.Login(ctx, &sso.LoginRequest{Email: email, Password: password, AppId: appID})
+	require.NoError(t, err)
+	require.True(t, respLogin.GetMfaRequired())
+	assert.Equal(t, []string{"totp", "backup_code"}, respLogin.GetMfaMethods())
+
+	respVerify, err := st.AuthClient.VerifyMFA(ctx, &sso.VerifyMFARequest{MfaToken: respLogin.GetMfaToken(), Code: backupCodes[0]})
+	require.NoError(t, err)
+	assert.NotEmpty(t, respVerify.GetToken())
+	assert.Contains(t, lastMail(t, st, email, "A backup code was used"), "9 unused backup codes left")
+
+	// Each code works once.
+	respLogin, err = st.AuthClient.Login(ctx, &sso.LoginRequest{Email: email, Password: password, AppId: appID})
+	require.NoError(t, err)
+	_, err = st.AuthClient.VerifyMFA(ctx, &sso.VerifyMFARequest{MfaToken: respLogin.GetMfaToken(), Code: backupCodes[0]})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	// A new set replaces the old one.
+	respCodes, err = st.AuthClient.GenerateBackupCodes(authCtx, &sso.GenerateBackupCodesRequest{Password: password})
+	require.NoError(t, err)
+	_, err = st.AuthClient.VerifyMFA(ctx, &sso.VerifyMFARequest{MfaToken: respLogin.GetMfaToken(), Code: backupCodes[1]})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	oldCodes := backupCodes
+	backupCodes = respCodes.GetCodes()
+
+	newPassword := randomFakePassword()
+	_, err = st.AuthClient.RecoverAccount(ctx, &sso.RecoverAccountRequest{
+		Email:       email,
+		BackupCode:  oldCodes[2],
+		NewPassword: newPassword,
+	})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = st.AuthClient.RecoverAccount(ctx, &sso.RecoverAccountRequest{
+		Email:       email,
+		BackupCode:  backupCodes[0],
+		NewPassword: newPassword,
+	})
+	require.NoError(t, err)
+
+	_, err = st.AuthClient.Login(ctx, &sso.LoginRequest{Email: email, Password: password, AppId: appID})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	respLogin, err = st.AuthClient.Login(ctx, &sso.LoginRequest{Email: email, Password: newPassword, AppId: appID})
+	require.NoError(t, err)
+	assert.True(t, respLogin.GetMfaRequired())
+}
+
+func TestVerifyMFA_ReusedChallengeKeepsBackupCode(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	email := gofakeit.Email()
+	password := randomFakePassword()
+	_, err := st.AuthClient.Register(ctx, &sso.RegisterRequest{Email: email, Password: password})
+	require.NoError(t, err)
+	respLogin, err := st.AuthClient.Login(ctx, &sso.LoginRequest{Email: email, Password: password, AppId: appID})
+	require.NoError(t, err)
+	authCtx := withBearer(ctx, respLogin.GetToken())
+
+	respCodes, err := st.AuthClient.GenerateBackupCodes(authCtx, &sso.GenerateBackupCodesRequest{Password: password})
+	require.NoError(t, err)
+	backupCodes := respCodes.GetCodes()
+	respEnroll, err := st.AuthClient.EnrollTOTP(authCtx, &sso.EnrollTOTPRequest{})
+	require.NoError(t, err)
+	code, err := totp.Code(respEnroll.GetSecret(), time.Now())
+	require.NoError(t, err)
+	_, err = st.AuthClient.ConfirmTOTP(authCtx, &sso.ConfirmTOTPRequest{Code: code})
+	require.NoError(t, err)
+
+	respLogin, err = st.AuthClient.Login(ctx, &sso.LoginRequest{Email: email, Password: password, AppId: appID})
+	require.NoError(t, err)
+	challenge := respLogin.GetMfaToken()
+	_, err = st.AuthClient.VerifyMFA(ctx, &sso.VerifyMFARequest{MfaToken: challenge, Code: backupCodes[0]})
+	require.NoError(t, err)
+
+	// Replaying the completed challenge is refused before the code is
+	// looked at.
+	_, err = st.AuthClient.VerifyMFA(ctx, &sso.VerifyMFARequest{MfaToken: challenge, Code: backupCodes[1]})
+	require.Error(t, err)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	respLogin, err = st.AuthClient.Login(ctx, &sso.LoginRequest{Email: email, Password: password, AppId: appID})
+	require.NoError(t, err)
+	respVerify, err := st.AuthClient.VerifyMFA(ctx, &sso.VerifyMFARequest{MfaToken: respLogin.GetMfaToken(), Code: backupCodes[1]})
+	require.NoError(t, err)
+	assert.NotEmpty(t, respVerify.GetToken())
+}
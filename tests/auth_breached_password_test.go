@@ -0,0 +1,65 @@
+package tests
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Novochenko/protos/gen/go/sso"
+	"github.com/Novochenko/sso/tests/suite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Passwords in the test breach corpus, tests/testdata/breached_passwords.txt.
+// The seeded breached@sso.test user has breachedUserPassword.
+const (
+	breachedPassword     = "Leaked-Horse-Battery-17"
+	breachedUserEmail    = "breached@sso.test"
+	breachedUserPassword = "Pwned-But-Long-Enough-42"
+)
+
+func TestLogin_BreachedPasswordRequiresReset(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	// The first login flags the account; later ones find it flagged.
+	for range 2 {
+		_, err := st.AuthClient.Login(ctx, &sso.LoginRequest{
+			Email:    breachedUserEmail,
+			Password: breachedUserPassword,
+			AppId:    appID,
+		})
+		require.Error(t, err)
+		assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+	}
+
+	// Without the password nothing tells the account apart.
+	_, err := st.AuthClient.Login(ctx, &sso.LoginRequest{
+		Email:    breachedUserEmail,
+		Password: randomFakePassword(),
+		AppId:    appID,
+	})
+	require.Error(t, err)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	// The reset cannot bring a breached password back.
+	_, err = st.AuthClient.RequestPasswordReset(ctx, &sso.RequestPasswordResetRequest{Email: breachedUserEmail})
+	require.NoError(t, err)
+	token := lastMailToken(t, st, breachedUserEmail, resetPasswordSubject)
+
+	_, err = st.AuthClient.ResetPassword(ctx, &sso.ResetPasswordRequest{Token: token, NewPassword: breachedPassword})
+	require.Error(t, err)
+	statusErr, ok := status.FromError(err)
+	require.True(t, ok)
+	assert.Equal(t, codes.InvalidArgument, statusErr.Code())
+	var info *errdetails.ErrorInfo
+	for _, detail := range statusErr.Details() {
+		if d, ok := detail.(*errdetails.ErrorInfo); ok {
+			info = d
+		}
+	}
+	require.NotNil(t, info)
+	assert.Equal(t, []string{"breached"}, strings.Split(info.GetMetadata()["rules"], ","))
+}
@@ -0,0 +1,121 @@
+package tests
+
+import (
+	"testing"
+
+	"github.com/Novochenko/protos/gen/go/sso"
+	"github.com/Novochenko/sso/tests/suite"
+	"github.com/brianvoe/gofakeit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	confirmEmailChangeSubject = "Confirm your new email address"
+	emailChangeNoticeSubject  = "Your email address is being changed"
+)
+
+func TestChangePassword(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	email := gofakeit.Email()
+	password := randomFakePassword()
+	_, err := st.AuthClient.Register(ctx, &sso.RegisterRequest{Email: email, Password: password})
+	require.NoError(t, err)
+	respLogin, err := st.AuthClient.Login(ctx, &sso.LoginRequest{Email: email, Password: password, AppId: appID})
+	require.NoError(t, err)
+	authCtx := withBearer(ctx, respLogin.GetToken())
+
+	_, err = st.AuthClient.ChangePassword(authCtx, &sso.ChangePasswordRequest{
+		CurrentPassword: "wrong-password",
+		NewPassword:     randomFakePassword(),
+	})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	_, err = st.AuthClient.ChangePassword(authCtx, &sso.ChangePasswordRequest{
+		CurrentPassword: password,
+		NewPassword:     "short",
+	})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	newPassword := randomFakePassword()
+	respChange, err := st.AuthClient.ChangePassword(authCtx, &sso.ChangePasswordRequest{
+		CurrentPassword: password,
+		NewPassword:     newPassword,
+	})
+	require.NoError(t, err)
+
+	// Other sessions are gone, the one the change was made from continues.
+	_, err = st.AuthClient.Refresh(ctx, &sso.RefreshRequest{RefreshToken: respLogin.GetRefreshToken()})
+	require.Error(t, err)
+	respIntrospect, err := st.AuthClient.Introspect(ctx, &sso.IntrospectRequest{Token: respChange.GetToken()})
+	require.NoError(t, err)
+	assert.True(t, respIntrospect.GetActive())
+
+	_, err = st.AuthClient.Login(ctx, &sso.LoginRequest{Email: email, Password: newPassword, AppId: appID})
+	require.NoError(t, err)
+}
+
+func TestChangeEmail_ConfirmThenUndo(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	email := gofakeit.Email()
+	password := randomFakePassword()
+	_, err := st.AuthClient.Register(ctx, &sso.RegisterRequest{Email: email, Password: password})
+	require.NoError(t, err)
+	respLogin, err := st.AuthClient.Login(ctx, &sso.LoginRequest{Email: email, Password: password, AppId: appID})
+	require.NoError(t, err)
+
+	newEmail := gofakeit.Email()
+	_, err = st.AuthClient.ChangeEmail(withBearer(ctx, respLogin.GetToken()), &sso.ChangeEmailRequest{
+		Password: password,
+		NewEmail: newEmail,
+	})
+	require.NoError(t, err)
+
+	confirmToken := lastMailToken(t, st, newEmail, confirmEmailChangeSubject)
+	undoToken := lastMailToken(t, st, email, emailChangeNoticeSubject)
+
+	// Nothing changes until the new address is confirmed.
+	_, err = st.AuthClient.Login(ctx, &sso.LoginRequest{Email: email, Password: password, AppId: appID})
+	require.NoError(t, err)
+
+	_, err = st.AuthClient.ConfirmEmailChange(ctx, &sso.ConfirmEmailChangeRequest{Token: confirmToken})
+	require.NoError(t, err)
+	_, err = st.AuthClient.Login(ctx, &sso.LoginRequest{Email: newEmail, Password: password, AppId: appID})
+	require.NoError(t, err)
+	_, err = st.AuthClient.Login(ctx, &sso.LoginRequest{Email: email, Password: password, AppId: appID})
+	require.Error(t, err)
+
+	_, err = st.AuthClient.UndoEmailChange(ctx, &sso.UndoEmailChangeRequest{Token: undoToken})
+	require.NoError(t, err)
+	_, err = st.AuthClient.Login(ctx, &sso.LoginRequest{Email: email, Password: password, AppId: appID})
+	require.NoError(t, err)
+
+	// Undo links are single use.
+	_, err = st.AuthClient.UndoEmailChange(ctx, &sso.UndoEmailChangeRequest{Token: undoToken})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestChangeEmail_Taken(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	email := gofakeit.Email()
+	password := randomFakePassword()
+	_, err := st.AuthClient.Register(ctx, &sso.RegisterRequest{Email: email, Password: password})
+	require.NoError(t, err)
+	respLogin, err := st.AuthClient.Login(ctx, &sso.LoginRequest{Email: email, Password: password, AppId: appID})
+	require.NoError(t, err)
+
+	taken := gofakeit.Email()
+	_, err = st.AuthClient.Register(ctx, &sso.RegisterRequest{Email: taken, Password: randomFakePassword()})
+	require.NoError(t, err)
+
+	_, err = st.AuthClient.ChangeEmail(withBearer(ctx, respLogin.GetToken()), &sso.ChangeEmailRequest{
+		Password: password,
+		NewEmail: taken,
+	})
+	assert.Equal(t, codes.AlreadyExists, status.Code(err))
+}
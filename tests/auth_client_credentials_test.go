@@ -0,0 +1,117 @@
+package tests
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/Novochenko/protos/gen/go/sso"
+	"github.com/Novochenko/sso/tests/suite"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const appSecret = "test-secret"
+
+func TestClientCredentials_HappyPath(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	resp, err := st.AuthClient.ClientCredentials(ctx, &sso.ClientCredentialsRequest{
+		AppId:        appID,
+		ClientSecret: appSecret,
+		Scopes:       []string{"users.read"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"users.read"}, resp.GetScopes())
+	assert.Positive(t, resp.GetExpiresIn())
+
+	token, err := jwt.Parse(resp.GetToken(), jwksKeyfunc(ctx, t, st))
+	require.NoError(t, err)
+	claims := token.Claims.(jwt.MapClaims)
+	assert.Equal(t, strconv.Itoa(appID), claims["sub"])
+	assert.Equal(t, "users.read", claims["scope"])
+	assert.NotContains(t, claims, "uid")
+
+	respIntrospect, err := st.AuthClient.Introspect(ctx, &sso.IntrospectRequest{Token: resp.GetToken()})
+	require.NoError(t, err)
+	assert.True(t, respIntrospect.GetActive())
+	assert.Equal(t, int64(appID), respIntrospect.GetClientId())
+	assert.Empty(t, respIntrospect.GetUserId())
+}
+
+func TestClientCredentials_Fails(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	tests := []struct {
+		name string
+		req  *sso.ClientCredentialsRequest
+		code codes.Code
+	}{
+		{
+			name: "Wrong secret",
+			req:  &sso.ClientCredentialsRequest{AppId: appID, ClientSecret: "wrong"},
+			code: codes.Unauthenticated,
+		},
+		{
+			name: "Unknown app",
+			req:  &sso.ClientCredentialsRequest{AppId: 100500, ClientSecret: appSecret},
+			code: codes.Unauthenticated,
+		},
+		{
+			name: "Scope not granted",
+			req:  &sso.ClientCredentialsRequest{AppId: appID, ClientSecret: appSecret, Scopes: []string{"admin"}},
+			code: codes.PermissionDenied,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := st.AuthClient.ClientCredentials(ctx, tt.req)
+			require.Error(t, err)
+			assert.Equal(t, tt.code, status.Code(err))
+		})
+	}
+}
+
+func TestClientCredentials_TokenEndpoint(t *testing.T) {
+	_, st := suite.New(t)
+
+	base := "http://" + net.JoinHostPort("localhost", strconv.Itoa(st.Cfg.HTTP.Port))
+	form := url.Values{
+		"grant_type": {"client_credentials"},
+		"client_id":  {strconv.Itoa(appID)},
+		"scope":      {"users.read users.write"},
+	}
+
+	// Public clients cannot use the grant.
+	resp, err := http.PostForm(base+"/token", form)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	req, err := http.NewRequest(http.MethodPost, base+"/token", strings.NewReader(form.Encode()))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(strconv.Itoa(appID), appSecret)
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var tokens struct {
+		AccessToken  string `json:"access_token"`
+		RefreshToken string `json:"refresh_token"`
+		Scope        string `json:"scope"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&tokens))
+	assert.NotEmpty(t, tokens.AccessToken)
+	assert.Empty(t, tokens.RefreshToken)
+	assert.Equal(t, "users.read users.write", tokens.Scope)
+}
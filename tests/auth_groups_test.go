@@ -0,0 +1,192 @@
+package tests
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/Novochenko/protos/gen/go/sso"
+	"github.com/Novochenko/sso/tests/suite"
+	"github.com/brianvoe/gofakeit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func createGroup(ctx context.Context, t *testing.T, st *suite.Suite, orgID int64) *sso.Group {
+	t.Helper()
+
+	resp, err := st.AuthClient.CreateGroup(ctx, &sso.CreateGroupRequest{
+		OrgId: orgID,
+		Name:  "staff-" + strings.ToLower(gofakeit.Password(true, false, false, false, false, 8)),
+	})
+	require.NoError(t, err)
+
+	return resp.GetGroup()
+}
+
+func TestGroups_NestedRolesGrantPermissions(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	adminCtx := withBearer(ctx, adminLogin(ctx, t, st))
+
+	respRole, err := st.AuthClient.CreateRole(adminCtx, &sso.CreateRoleRequest{
+		AppId: appID,
+		Name:  "caretaker-" + strings.ToLower(gofakeit.Password(true, false, false, false, false, 8)),
+	})
+	require.NoError(t, err)
+	permissionName := "boilers." + strings.ToLower(gofakeit.Password(true, false, false, false, false, 8)) + ".service"
+	respPermission, err := st.AuthClient.CreatePermission(adminCtx, &sso.CreatePermissionRequest{
+		AppId: appID,
+		Name:  permissionName,
+	})
+	require.NoError(t, err)
+	_, err = st.AuthClient.GrantPermission(adminCtx, &sso.GrantPermissionRequest{
+		RoleId:       respRole.GetRole().GetId(),
+		PermissionId: respPermission.GetPermission().GetId(),
+	})
+	require.NoError(t, err)
+
+	// The user is in night shift, which is in staff, which holds the role.
+	staff := createGroup(adminCtx, t, st, 0)
+	nightShift := createGroup(adminCtx, t, st, 0)
+	_, err = st.AuthClient.AddSubgroup(adminCtx, &sso.AddSubgroupRequest{
+		GroupId: staff.GetId(),
+		ChildId: nightShift.GetId(),
+	})
+	require.NoError(t, err)
+	_, err = st.AuthClient.GrantGroupRole(adminCtx, &sso.GrantGroupRoleRequest{
+		GroupId: staff.GetId(),
+		RoleId:  respRole.GetRole().GetId(),
+	})
+	require.NoError(t, err)
+
+	email := gofakeit.Email()
+	password := randomFakePassword()
+	respRegister, err := st.AuthClient.Register(ctx, &sso.RegisterRequest{Email: email, Password: password})
+	require.NoError(t, err)
+	userID := respRegister.GetUserId()
+
+	checkPermission := func() bool {
+		respCheck, err := st.AuthClient.CheckPermission(adminCtx, &sso.CheckPermissionRequest{
+			UserId:     userID,
+			AppId:      appID,
+			Permission: permissionName,
+		})
+		require.NoError(t, err)
+		return respCheck.GetAllowed()
+	}
+	assert.False(t, checkPermission())
+
+	_, err = st.AuthClient.AddGroupMember(adminCtx, &sso.AddGroupMemberRequest{
+		GroupId: nightShift.GetId(),
+		UserId:  userID,
+	})
+	require.NoError(t, err)
+	assert.True(t, checkPermission())
+
+	respLogin, err := st.AuthClient.Login(ctx, &sso.LoginRequest{Email: email, Password: password, AppId: appID})
+	require.NoError(t, err)
+	respIntrospect, err := st.AuthClient.Introspect(ctx, &sso.IntrospectRequest{Token: respLogin.GetToken()})
+	require.NoError(t, err)
+	assert.Equal(t, []string{respRole.GetRole().GetName()}, respIntrospect.GetRoles())
+	assert.Equal(t, []string{permissionName}, respIntrospect.GetPermissions())
+
+	// Users may list their own groups.
+	respGroups, err := st.AuthClient.ListUserGroups(withBearer(ctx, respLogin.GetToken()), &sso.ListUserGroupsRequest{
+		UserId: userID,
+	})
+	require.NoError(t, err)
+	direct := make(map[int64]bool)
+	for _, group := range respGroups.GetGroups() {
+		direct[group.GetGroup().GetId()] = group.GetDirect()
+	}
+	assert.Equal(t, map[int64]bool{staff.GetId(): false, nightShift.GetId(): true}, direct)
+
+	respGroup, err := st.AuthClient.GetGroup(adminCtx, &sso.GetGroupRequest{GroupId: staff.GetId()})
+	require.NoError(t, err)
+	assert.Empty(t, respGroup.GetUserIds())
+	assert.Equal(t, []int64{nightShift.GetId()}, respGroup.GetSubgroupIds())
+
+	_, err = st.AuthClient.RemoveSubgroup(adminCtx, &sso.RemoveSubgroupRequest{
+		GroupId: staff.GetId(),
+		ChildId: nightShift.GetId(),
+	})
+	require.NoError(t, err)
+	assert.False(t, checkPermission())
+}
+
+func TestGroups_RejectsCycles(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	adminCtx := withBearer(ctx, adminLogin(ctx, t, st))
+
+	a := createGroup(adminCtx, t, st, 0)
+	b := createGroup(adminCtx, t, st, 0)
+	c := createGroup(adminCtx, t, st, 0)
+	_, err := st.AuthClient.AddSubgroup(adminCtx, &sso.AddSubgroupRequest{GroupId: a.GetId(), ChildId: b.GetId()})
+	require.NoError(t, err)
+	_, err = st.AuthClient.AddSubgroup(adminCtx, &sso.AddSubgroupRequest{GroupId: b.GetId(), ChildId: c.GetId()})
+	require.NoError(t, err)
+
+	_, err = st.AuthClient.AddSubgroup(adminCtx, &sso.AddSubgroupRequest{GroupId: c.GetId(), ChildId: a.GetId()})
+	require.Error(t, err)
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	_, err = st.AuthClient.AddSubgroup(adminCtx, &sso.AddSubgroupRequest{GroupId: a.GetId(), ChildId: a.GetId()})
+	require.Error(t, err)
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	_, err = st.AuthClient.DeleteGroup(adminCtx, &sso.DeleteGroupRequest{GroupId: b.GetId()})
+	require.NoError(t, err)
+	// With b gone a and c are no longer related.
+	_, err = st.AuthClient.AddSubgroup(adminCtx, &sso.AddSubgroupRequest{GroupId: c.GetId(), ChildId: a.GetId()})
+	require.NoError(t, err)
+}
+
+func TestGroups_Fails(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	login := registerAndLogin(ctx, t, st)
+	userCtx := withBearer(ctx, login.GetToken())
+
+	_, err := st.AuthClient.CreateGroup(userCtx, &sso.CreateGroupRequest{Name: "nope"})
+	require.Error(t, err)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	_, err = st.AuthClient.ListUserGroups(userCtx, &sso.ListUserGroupsRequest{UserId: gofakeit.UUID()})
+	require.Error(t, err)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	adminCtx := withBearer(ctx, adminLogin(ctx, t, st))
+
+	_, err = st.AuthClient.CreateGroup(adminCtx, &sso.CreateGroupRequest{Name: "Not A Name"})
+	require.Error(t, err)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	group := createGroup(adminCtx, t, st, 0)
+	_, err = st.AuthClient.CreateGroup(adminCtx, &sso.CreateGroupRequest{Name: group.GetName()})
+	require.Error(t, err)
+	assert.Equal(t, codes.AlreadyExists, status.Code(err))
+
+	_, err = st.AuthClient.GetGroup(adminCtx, &sso.GetGroupRequest{GroupId: -1})
+	require.Error(t, err)
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	// Groups of an organization take neither outsiders nor foreign groups.
+	orgGroup := createGroup(adminCtx, t, st, seededOrgID)
+	_, err = st.AuthClient.AddGroupMember(adminCtx, &sso.AddGroupMemberRequest{
+		GroupId: orgGroup.GetId(),
+		UserId:  userIDOf(ctx, t, st, login.GetToken()),
+	})
+	require.Error(t, err)
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	_, err = st.AuthClient.AddSubgroup(adminCtx, &sso.AddSubgroupRequest{
+		GroupId: orgGroup.GetId(),
+		ChildId: group.GetId(),
+	})
+	require.Error(t, err)
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+}
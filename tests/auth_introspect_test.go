@@ -0,0 +1,46 @@
+package tests
+
+import (
+	"testing"
+
+	"github.com/Novochenko/protos/gen/go/sso"
+	"github.com/Novochenko/sso/tests/suite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIntrospect_ActiveThenRevoked(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	respLogin := registerAndLogin(ctx, t, st)
+
+	respIntrospect, err := st.AuthClient.Introspect(ctx, &sso.IntrospectRequest{
+		Token: respLogin.GetToken(),
+	})
+	require.NoError(t, err)
+	assert.True(t, respIntrospect.GetActive())
+	assert.NotEmpty(t, respIntrospect.GetUserId())
+	assert.NotEmpty(t, respIntrospect.GetEmail())
+	assert.Equal(t, int64(appID), respIntrospect.GetAppId())
+	assert.NotZero(t, respIntrospect.GetExp())
+
+	_, err = st.AuthClient.Logout(withBearer(ctx, respLogin.GetToken()), &sso.LogoutRequest{})
+	require.NoError(t, err)
+
+	respIntrospect, err = st.AuthClient.Introspect(ctx, &sso.IntrospectRequest{
+		Token: respLogin.GetToken(),
+	})
+	require.NoError(t, err)
+	assert.False(t, respIntrospect.GetActive())
+	assert.Empty(t, respIntrospect.GetUserId())
+}
+
+func TestIntrospect_MalformedToken(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	respIntrospect, err := st.AuthClient.Introspect(ctx, &sso.IntrospectRequest{
+		Token: "not-a-token",
+	})
+	require.NoError(t, err)
+	assert.False(t, respIntrospect.GetActive())
+}
@@ -0,0 +1,89 @@
+package tests
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Novochenko/protos/gen/go/sso"
+	"github.com/Novochenko/sso/tests/suite"
+	"github.com/brianvoe/gofakeit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestLogout_RevokesAccessAndRefreshToken(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	respLogin := registerAndLogin(ctx, t, st)
+	authCtx := withBearer(ctx, respLogin.GetToken())
+
+	_, err := st.AuthClient.Logout(authCtx, &sso.LogoutRequest{
+		RefreshToken: respLogin.GetRefreshToken(),
+	})
+	require.NoError(t, err)
+
+	_, err = st.AuthClient.Logout(authCtx, &sso.LogoutRequest{})
+	require.Error(t, err)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	_, err = st.AuthClient.Refresh(ctx, &sso.RefreshRequest{
+		RefreshToken: respLogin.GetRefreshToken(),
+	})
+	require.Error(t, err)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+func TestLogout_WithoutToken(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	_, err := st.AuthClient.Logout(ctx, &sso.LogoutRequest{})
+	require.Error(t, err)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+func TestRevokeTokens_RequiresAdmin(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	respLogin := registerAndLogin(ctx, t, st)
+
+	_, err := st.AuthClient.RevokeTokens(withBearer(ctx, respLogin.GetToken()), &sso.RevokeTokensRequest{
+		UserId: gofakeit.UUID(),
+	})
+	require.Error(t, err)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+}
+
+func TestRevokeTokens_ReloginRightAfter(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	email := gofakeit.Email()
+	password := randomFakePassword()
+	_, err := st.AuthClient.Register(ctx, &sso.RegisterRequest{Email: email, Password: password})
+	require.NoError(t, err)
+	respLogin, err := st.AuthClient.Login(ctx, &sso.LoginRequest{Email: email, Password: password, AppId: appID})
+	require.NoError(t, err)
+
+	_, err = st.AuthClient.RevokeTokens(withBearer(ctx, adminLogin(ctx, t, st)), &sso.RevokeTokensRequest{
+		UserId: userIDOf(ctx, t, st, respLogin.GetToken()),
+	})
+	require.NoError(t, err)
+
+	// Logging in again within the same second must not be caught by the
+	// revocation.
+	respRelogin, err := st.AuthClient.Login(ctx, &sso.LoginRequest{Email: email, Password: password, AppId: appID})
+	require.NoError(t, err)
+
+	respIntrospect, err := st.AuthClient.Introspect(ctx, &sso.IntrospectRequest{Token: respLogin.GetToken()})
+	require.NoError(t, err)
+	assert.False(t, respIntrospect.GetActive())
+	respIntrospect, err = st.AuthClient.Introspect(ctx, &sso.IntrospectRequest{Token: respRelogin.GetToken()})
+	require.NoError(t, err)
+	assert.True(t, respIntrospect.GetActive())
+}
+
+func withBearer(ctx context.Context, token string) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+token)
+}
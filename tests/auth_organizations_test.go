@@ -0,0 +1,195 @@
+package tests
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/Novochenko/protos/gen/go/sso"
+	"github.com/Novochenko/sso/tests/suite"
+	"github.com/brianvoe/gofakeit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// The test migrations seed an organization without members and orgAppID,
+// which belongs to it.
+const (
+	seededOrgID = 1
+	orgAppID    = 3
+)
+
+func createOrganization(ctx context.Context, t *testing.T, st *suite.Suite, token string) *sso.Organization {
+	t.Helper()
+
+	slug := "org-" + strings.ToLower(gofakeit.Password(true, false, false, false, false, 12))
+	resp, err := st.AuthClient.CreateOrganization(withBearer(ctx, token), &sso.CreateOrganizationRequest{
+		Slug: slug,
+		Name: gofakeit.Company(),
+	})
+	require.NoError(t, err)
+	require.Equal(t, slug, resp.GetOrganization().GetSlug())
+
+	return resp.GetOrganization()
+}
+
+func TestOrganizations_MembershipAndLogin(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	ownerToken := registerAndLogin(ctx, t, st).GetToken()
+	ownerCtx := withBearer(ctx, ownerToken)
+	org := createOrganization(ctx, t, st, ownerToken)
+
+	respOrgs, err := st.AuthClient.ListOrganizations(ownerCtx, &sso.ListOrganizationsRequest{})
+	require.NoError(t, err)
+	require.Len(t, respOrgs.GetOrganizations(), 1)
+	assert.Equal(t, org.GetId(), respOrgs.GetOrganizations()[0].GetOrganization().GetId())
+	assert.Equal(t, "owner", respOrgs.GetOrganizations()[0].GetRole())
+
+	email := gofakeit.Email()
+	password := randomFakePassword()
+	respRegister, err := st.AuthClient.Register(ctx, &sso.RegisterRequest{Email: email, Password: password})
+	require.NoError(t, err)
+	memberID := respRegister.GetUserId()
+
+	login := &sso.LoginRequest{Email: email, Password: password, AppId: appID, OrgId: org.GetId()}
+	_, err = st.AuthClient.Login(ctx, login)
+	require.Error(t, err)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	_, err = st.AuthClient.SetOrganizationMember(ownerCtx, &sso.SetOrganizationMemberRequest{
+		OrgId:  org.GetId(),
+		UserId: memberID,
+		Role:   "member",
+	})
+	require.NoError(t, err)
+
+	respLogin, err := st.AuthClient.Login(ctx, login)
+	require.NoError(t, err)
+	respIntrospect, err := st.AuthClient.Introspect(ctx, &sso.IntrospectRequest{Token: respLogin.GetToken()})
+	require.NoError(t, err)
+	assert.Equal(t, org.GetId(), respIntrospect.GetOrgId())
+	assert.Equal(t, "member", respIntrospect.GetOrgRole())
+
+	respRefresh, err := st.AuthClient.Refresh(ctx, &sso.RefreshRequest{RefreshToken: respLogin.GetRefreshToken()})
+	require.NoError(t, err)
+	respIntrospect, err = st.AuthClient.Introspect(ctx, &sso.IntrospectRequest{Token: respRefresh.GetToken()})
+	require.NoError(t, err)
+	assert.Equal(t, org.GetId(), respIntrospect.GetOrgId())
+
+	respMembers, err := st.AuthClient.ListOrganizationMembers(ownerCtx, &sso.ListOrganizationMembersRequest{OrgId: org.GetId()})
+	require.NoError(t, err)
+	assert.Len(t, respMembers.GetMembers(), 2)
+
+	// Members cannot manage the organization.
+	memberCtx := withBearer(ctx, respRefresh.GetToken())
+	_, err = st.AuthClient.SetOrganizationMember(memberCtx, &sso.SetOrganizationMemberRequest{
+		OrgId:  org.GetId(),
+		UserId: memberID,
+		Role:   "owner",
+	})
+	require.Error(t, err)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	_, err = st.AuthClient.RemoveOrganizationMember(ownerCtx, &sso.RemoveOrganizationMemberRequest{
+		OrgId:  org.GetId(),
+		UserId: userIDOf(ctx, t, st, ownerToken),
+	})
+	require.Error(t, err)
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	_, err = st.AuthClient.RemoveOrganizationMember(ownerCtx, &sso.RemoveOrganizationMemberRequest{
+		OrgId:  org.GetId(),
+		UserId: memberID,
+	})
+	require.NoError(t, err)
+
+	_, err = st.AuthClient.Refresh(ctx, &sso.RefreshRequest{RefreshToken: respRefresh.GetRefreshToken()})
+	require.Error(t, err)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+func TestOrganizations_OrgAppRequiresMembership(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	email := gofakeit.Email()
+	password := randomFakePassword()
+	_, err := st.AuthClient.Register(ctx, &sso.RegisterRequest{Email: email, Password: password})
+	require.NoError(t, err)
+
+	_, err = st.AuthClient.Login(ctx, &sso.LoginRequest{Email: email, Password: password, AppId: orgAppID})
+	require.Error(t, err)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+}
+
+func TestOrganizations_FindStaysInTenant(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	ownerToken := registerAndLogin(ctx, t, st).GetToken()
+	org := createOrganization(ctx, t, st, ownerToken)
+	ownerID := userIDOf(ctx, t, st, ownerToken)
+	outsiderID := userIDOf(ctx, t, st, registerAndLogin(ctx, t, st).GetToken())
+
+	email := gofakeit.Email()
+	password := randomFakePassword()
+	respRegister, err := st.AuthClient.Register(ctx, &sso.RegisterRequest{Email: email, Password: password})
+	require.NoError(t, err)
+	_, err = st.AuthClient.SetOrganizationMember(withBearer(ctx, ownerToken), &sso.SetOrganizationMemberRequest{
+		OrgId:  org.GetId(),
+		UserId: respRegister.GetUserId(),
+		Role:   "admin",
+	})
+	require.NoError(t, err)
+	respLogin, err := st.AuthClient.Login(ctx, &sso.LoginRequest{
+		Email:    email,
+		Password: password,
+		AppId:    appID,
+		OrgId:    org.GetId(),
+	})
+	require.NoError(t, err)
+	orgCtx := withBearer(ctx, respLogin.GetToken())
+
+	respFind, err := st.AuthClient.Find(orgCtx, &sso.FindRequest{UserId: ownerID})
+	require.NoError(t, err)
+	assert.Equal(t, ownerID, respFind.GetUserAccount().GetUserId())
+
+	_, err = st.AuthClient.Find(orgCtx, &sso.FindRequest{UserId: outsiderID})
+	require.Error(t, err)
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	respFindMany, err := st.AuthClient.FindMany(orgCtx, &sso.FindManyRequest{UserIds: []string{ownerID, outsiderID}})
+	require.NoError(t, err)
+	require.Len(t, respFindMany.GetUserAccounts(), 1)
+	assert.Equal(t, ownerID, respFindMany.GetUserAccounts()[0].GetUserId())
+
+	// Without a token only users outside of every organization can be found.
+	_, err = st.AuthClient.Find(ctx, &sso.FindRequest{UserId: outsiderID})
+	require.NoError(t, err)
+
+	_, err = st.AuthClient.Find(ctx, &sso.FindRequest{UserId: ownerID})
+	require.Error(t, err)
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	respFindMany, err = st.AuthClient.FindMany(ctx, &sso.FindManyRequest{UserIds: []string{ownerID, outsiderID}})
+	require.NoError(t, err)
+	require.Len(t, respFindMany.GetUserAccounts(), 1)
+	assert.Equal(t, outsiderID, respFindMany.GetUserAccounts()[0].GetUserId())
+
+	// Nor can a signed-in user whose token has no organization.
+	outsiderCtx := withBearer(ctx, registerAndLogin(ctx, t, st).GetToken())
+	_, err = st.AuthClient.Find(outsiderCtx, &sso.FindRequest{UserId: ownerID})
+	require.Error(t, err)
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	respFindMany, err = st.AuthClient.FindMany(outsiderCtx, &sso.FindManyRequest{UserIds: []string{ownerID, outsiderID}})
+	require.NoError(t, err)
+	require.Len(t, respFindMany.GetUserAccounts(), 1)
+	assert.Equal(t, outsiderID, respFindMany.GetUserAccounts()[0].GetUserId())
+
+	// Admins are granted every organization.
+	respFind, err = st.AuthClient.Find(withBearer(ctx, adminLogin(ctx, t, st)), &sso.FindRequest{UserId: ownerID})
+	require.NoError(t, err)
+	assert.Equal(t, ownerID, respFind.GetUserAccount().GetUserId())
+}
@@ -0,0 +1,161 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/Novochenko/protos/gen/go/sso"
+	"github.com/Novochenko/sso/internal/lib/webauthn"
+	"github.com/Novochenko/sso/internal/lib/webauthn/softauthn"
+	"github.com/Novochenko/sso/tests/suite"
+	"github.com/brianvoe/gofakeit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func registerPasskey(ctx context.Context, t *testing.T, st *suite.Suite, authenticator *softauthn.Authenticator, format string) []byte {
+	t.Helper()
+
+	respBegin, err := st.AuthClient.BeginPasskeyRegistration(ctx, &sso.BeginPasskeyRegistrationRequest{})
+	require.NoError(t, err)
+	var options webauthn.CreationOptions
+	require.NoError(t, json.Unmarshal([]byte(respBegin.GetOptionsJson()), &options))
+
+	att, err := authenticator.Create(st.Cfg.WebAuthn.Origins[0], options, format)
+	require.NoError(t, err)
+
+	respFinish, err := st.AuthClient.FinishPasskeyRegistration(ctx, &sso.FinishPasskeyRegistrationRequest{
+		Session:           respBegin.GetSession(),
+		ClientDataJson:    att.ClientDataJSON,
+		AttestationObject: att.AttestationObject,
+		Name:              "laptop",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, att.CredentialID, respFinish.GetCredentialId())
+
+	// A registration session is single-use.
+	_, err = st.AuthClient.FinishPasskeyRegistration(ctx, &sso.FinishPasskeyRegistrationRequest{
+		Session:           respBegin.GetSession(),
+		ClientDataJson:    att.ClientDataJSON,
+		AttestationObject: att.AttestationObject,
+	})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	return respFinish.GetCredentialId()
+}
+
+func passkeyLogin(
+	ctx context.Context,
+	t *testing.T,
+	st *suite.Suite,
+	authenticator *softauthn.Authenticator,
+	mfaToken string,
+) (*sso.FinishPasskeyLoginRequest, error) {
+	t.Helper()
+
+	respBegin, err := st.AuthClient.BeginPasskeyLogin(ctx, &sso.BeginPasskeyLoginRequest{AppId: appID, MfaToken: mfaToken})
+	if err != nil {
+		return nil, err
+	}
+	var options webauthn.RequestOptions
+	require.NoError(t, json.Unmarshal([]byte(respBegin.GetOptionsJson()), &options))
+
+	assertion, err := authenticator.Get(st.Cfg.WebAuthn.Origins[0], options)
+	require.NoError(t, err)
+
+	return &sso.FinishPasskeyLoginRequest{
+		Session:           respBegin.GetSession(),
+		CredentialId:      assertion.CredentialID,
+		ClientDataJson:    assertion.ClientDataJSON,
+		AuthenticatorData: assertion.AuthenticatorData,
+		Signature:         assertion.Signature,
+		UserHandle:        assertion.UserHandle,
+	}, nil
+}
+
+func TestPasskey_Passwordless(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	token := registerAndLogin(ctx, t, st).GetToken()
+	userID := userIDOf(ctx, t, st, token)
+	authenticator := softauthn.New()
+	registerPasskey(withBearer(ctx, token), t, st, authenticator, "packed")
+
+	req, err := passkeyLogin(ctx, t, st, authenticator, "")
+	require.NoError(t, err)
+	respFinish, err := st.AuthClient.FinishPasskeyLogin(ctx, req)
+	require.NoError(t, err)
+
+	assert.Equal(t, userID, userIDOf(ctx, t, st, respFinish.GetToken()))
+
+	// Replaying the assertion fails: the session is used up.
+	_, err = st.AuthClient.FinishPasskeyLogin(ctx, req)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	// Passwordless logins need an authenticator that verifies the user.
+	authenticator.UserVerification = false
+	req, err = passkeyLogin(ctx, t, st, authenticator, "")
+	require.NoError(t, err)
+	_, err = st.AuthClient.FinishPasskeyLogin(ctx, req)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+func TestPasskey_SecondFactor(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	email := gofakeit.Email()
+	password := randomFakePassword()
+	_, err := st.AuthClient.Register(ctx, &sso.RegisterRequest{Email: email, Password: password})
+	require.NoError(t, err)
+	respLogin, err := st.AuthClient.Login(ctx, &sso.LoginRequest{Email: email, Password: password, AppId: appID})
+	require.NoError(t, err)
+	authenticator := softauthn.New()
+	registerPasskey(withBearer(ctx, respLogin.GetToken()), t, st, authenticator, "none")
+
+	respLogin, err = st.AuthClient.Login(ctx, &sso.LoginRequest{Email: email, Password: password, AppId: appID})
+	require.NoError(t, err)
+	require.True(t, respLogin.GetMfaRequired())
+	assert.Equal(t, []string{"webauthn"}, respLogin.GetMfaMethods())
+	challenge := respLogin.GetMfaToken()
+
+	// A one-time code cannot stand in for the passkey.
+	_, err = st.AuthClient.VerifyMFA(ctx, &sso.VerifyMFARequest{MfaToken: challenge, Code: "123456"})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	// Another user's passkey is not accepted for this login.
+	other := softauthn.New()
+	registerPasskey(withBearer(ctx, registerAndLogin(ctx, t, st).GetToken()), t, st, other, "none")
+	respBegin, err := st.AuthClient.BeginPasskeyLogin(ctx, &sso.BeginPasskeyLoginRequest{MfaToken: challenge})
+	require.NoError(t, err)
+	var options webauthn.RequestOptions
+	require.NoError(t, json.Unmarshal([]byte(respBegin.GetOptionsJson()), &options))
+	options.AllowCredentials = nil
+	assertion, err := other.Get(st.Cfg.WebAuthn.Origins[0], options)
+	require.NoError(t, err)
+	_, err = st.AuthClient.FinishPasskeyLogin(ctx, &sso.FinishPasskeyLoginRequest{
+		Session:           respBegin.GetSession(),
+		CredentialId:      assertion.CredentialID,
+		ClientDataJson:    assertion.ClientDataJSON,
+		AuthenticatorData: assertion.AuthenticatorData,
+		Signature:         assertion.Signature,
+	})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	// As a second factor, user verification is not required.
+	authenticator.UserVerification = false
+	req, err := passkeyLogin(ctx, t, st, authenticator, challenge)
+	require.NoError(t, err)
+	respFinish, err := st.AuthClient.FinishPasskeyLogin(ctx, req)
+	require.NoError(t, err)
+	assert.NotEmpty(t, respFinish.GetToken())
+	assert.NotEmpty(t, respFinish.GetRefreshToken())
+
+	// The MFA challenge completed one login only.
+	req, err = passkeyLogin(ctx, t, st, authenticator, challenge)
+	require.NoError(t, err)
+	_, err = st.AuthClient.FinishPasskeyLogin(ctx, req)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
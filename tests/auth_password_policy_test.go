@@ -0,0 +1,63 @@
+package tests
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Novochenko/protos/gen/go/sso"
+	"github.com/Novochenko/sso/tests/suite"
+	"github.com/brianvoe/gofakeit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestRegister_PasswordPolicy(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	email := gofakeit.Email()
+	local, _, _ := strings.Cut(email, "@")
+
+	tests := []struct {
+		name     string
+		password string
+		rule     string
+	}{
+		{name: "too short", password: "x7#Qa", rule: "min_length"},
+		{name: "too long", password: strings.Repeat("x7#Q", 19), rule: "max_length"},
+		{name: "common", password: "password123", rule: "strength"},
+		{name: "contains the email", password: "Q7!" + local + "#x9", rule: "personal_info"},
+		{name: "breached", password: breachedPassword, rule: "breached"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := st.AuthClient.Register(ctx, &sso.RegisterRequest{Email: email, Password: tt.password})
+			require.Error(t, err)
+			statusErr, ok := status.FromError(err)
+			require.True(t, ok)
+			assert.Equal(t, codes.InvalidArgument, statusErr.Code())
+
+			var badRequest *errdetails.BadRequest
+			var info *errdetails.ErrorInfo
+			for _, detail := range statusErr.Details() {
+				switch d := detail.(type) {
+				case *errdetails.BadRequest:
+					badRequest = d
+				case *errdetails.ErrorInfo:
+					info = d
+				}
+			}
+			require.NotNil(t, badRequest)
+			require.NotEmpty(t, badRequest.GetFieldViolations())
+			assert.Equal(t, "password", badRequest.GetFieldViolations()[0].GetField())
+			require.NotNil(t, info)
+			assert.Equal(t, "WEAK_PASSWORD", info.GetReason())
+			assert.Contains(t, strings.Split(info.GetMetadata()["rules"], ","), tt.rule)
+		})
+	}
+
+	_, err := st.AuthClient.Register(ctx, &sso.RegisterRequest{Email: email, Password: randomFakePassword()})
+	require.NoError(t, err)
+}
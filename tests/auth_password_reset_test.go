@@ -0,0 +1,67 @@
+package tests
+
+import (
+	"testing"
+
+	"github.com/Novochenko/protos/gen/go/sso"
+	"github.com/Novochenko/sso/tests/suite"
+	"github.com/brianvoe/gofakeit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestPasswordReset_HappyPath(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	email := gofakeit.Email()
+	password := randomFakePassword()
+	_, err := st.AuthClient.Register(ctx, &sso.RegisterRequest{Email: email, Password: password})
+	require.NoError(t, err)
+	respLogin, err := st.AuthClient.Login(ctx, &sso.LoginRequest{Email: email, Password: password, AppId: appID})
+	require.NoError(t, err)
+
+	_, err = st.AuthClient.RequestPasswordReset(ctx, &sso.RequestPasswordResetRequest{Email: email})
+	require.NoError(t, err)
+	token := lastMailToken(t, st, email, resetPasswordSubject)
+
+	newPassword := randomFakePassword()
+	_, err = st.AuthClient.ResetPassword(ctx, &sso.ResetPasswordRequest{Token: token, NewPassword: newPassword})
+	require.NoError(t, err)
+
+	// Reset tokens are single use.
+	_, err = st.AuthClient.ResetPassword(ctx, &sso.ResetPasswordRequest{Token: token, NewPassword: randomFakePassword()})
+	require.Error(t, err)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = st.AuthClient.Login(ctx, &sso.LoginRequest{Email: email, Password: password, AppId: appID})
+	require.Error(t, err)
+	_, err = st.AuthClient.Login(ctx, &sso.LoginRequest{Email: email, Password: newPassword, AppId: appID})
+	require.NoError(t, err)
+
+	// Sessions from before the reset are gone.
+	_, err = st.AuthClient.Refresh(ctx, &sso.RefreshRequest{RefreshToken: respLogin.GetRefreshToken()})
+	require.Error(t, err)
+	respIntrospect, err := st.AuthClient.Introspect(ctx, &sso.IntrospectRequest{Token: respLogin.GetToken()})
+	require.NoError(t, err)
+	assert.False(t, respIntrospect.GetActive())
+}
+
+func TestPasswordReset_UnknownEmail(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	_, err := st.AuthClient.RequestPasswordReset(ctx, &sso.RequestPasswordResetRequest{Email: gofakeit.Email()})
+	require.NoError(t, err)
+}
+
+func TestPasswordReset_InvalidToken(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	_, err := st.AuthClient.ResetPassword(ctx, &sso.ResetPasswordRequest{
+		Token:       "not-a-token",
+		NewPassword: randomFakePassword(),
+	})
+	require.Error(t, err)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
@@ -0,0 +1,107 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Novochenko/protos/gen/go/sso"
+	"github.com/Novochenko/sso/tests/suite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const pictureChunkSize = 32 << 10
+
+func TestUploadProfilePicture(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	respLogin := registerAndLogin(ctx, t, st)
+	authCtx := withBearer(ctx, respLogin.GetToken())
+	userID := userIDOf(ctx, t, st, respLogin.GetToken())
+
+	var src bytes.Buffer
+	require.NoError(t, jpeg.Encode(&src, image.NewRGBA(image.Rect(0, 0, 1200, 800)), nil))
+
+	first, err := uploadProfilePicture(authCtx, st.AuthClient, src.Bytes())
+	require.NoError(t, err)
+	path := first.GetProfilePicturePath()
+	require.NotEmpty(t, path)
+
+	respFind, err := st.AuthClient.Find(ctx, &sso.FindRequest{UserId: userID})
+	require.NoError(t, err)
+	assert.Equal(t, path, respFind.GetUserAccount().GetProfilePicturePath())
+
+	stored, err := os.ReadFile(filepath.Join(st.Cfg.Blob.Dir, path))
+	require.NoError(t, err)
+	img, err := png.Decode(bytes.NewReader(stored))
+	require.NoError(t, err)
+	assert.Equal(t, image.Rect(0, 0, 512, 512), img.Bounds())
+	thumbnail := strings.TrimSuffix(path, ".png") + "_128.png"
+	assert.FileExists(t, filepath.Join(st.Cfg.Blob.Dir, thumbnail))
+
+	// A new upload replaces the old picture and its thumbnails.
+	second, err := uploadProfilePicture(authCtx, st.AuthClient, src.Bytes())
+	require.NoError(t, err)
+	assert.NotEqual(t, path, second.GetProfilePicturePath())
+	assert.NoFileExists(t, filepath.Join(st.Cfg.Blob.Dir, path))
+	assert.NoFileExists(t, filepath.Join(st.Cfg.Blob.Dir, thumbnail))
+}
+
+func TestUploadProfilePicture_Fails(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	_, err := uploadProfilePicture(ctx, st.AuthClient, []byte("whatever"))
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	authCtx := withBearer(ctx, registerAndLogin(ctx, t, st).GetToken())
+
+	var huge bytes.Buffer
+	require.NoError(t, png.Encode(&huge, image.NewGray(image.Rect(0, 0, 5000, 10))))
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{name: "Empty", data: nil},
+		{name: "Not an image", data: []byte("<svg xmlns=\"http://www.w3.org/2000/svg\"></svg>")},
+		{name: "Too many pixels", data: huge.Bytes()},
+		{name: "Too many bytes", data: make([]byte, 5<<20+1)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := uploadProfilePicture(authCtx, st.AuthClient, tt.data)
+			assert.Equal(t, codes.InvalidArgument, status.Code(err))
+		})
+	}
+}
+
+func uploadProfilePicture(ctx context.Context, client sso.AuthClient, data []byte) (*sso.UserAccount, error) {
+	stream, err := client.UploadProfilePicture(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for len(data) > 0 {
+		n := min(len(data), pictureChunkSize)
+		if err := stream.Send(&sso.UploadProfilePictureRequest{Chunk: data[:n]}); err != nil {
+			break
+		}
+		data = data[n:]
+	}
+
+	resp, err := stream.CloseAndRecv()
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.GetUserAccount(), nil
+}
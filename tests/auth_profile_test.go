@@ -0,0 +1,119 @@
+package tests
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/Novochenko/protos/gen/go/sso"
+	"github.com/Novochenko/sso/tests/suite"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestUpdateProfile(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	respLogin := registerAndLogin(ctx, t, st)
+	authCtx := withBearer(ctx, respLogin.GetToken())
+	userID := userIDOf(ctx, t, st, respLogin.GetToken())
+
+	username := randomUsername()
+	respUpdate, err := st.AuthClient.UpdateProfile(authCtx, &sso.UpdateProfileRequest{UserName: username})
+	require.NoError(t, err)
+	assert.Equal(t, userID, respUpdate.GetUserAccount().GetUserId())
+	assert.Equal(t, username, respUpdate.GetUserAccount().GetUserName())
+
+	respFind, err := st.AuthClient.FindByUsername(ctx, &sso.FindByUsernameRequest{UserName: strings.ToUpper(username)})
+	require.NoError(t, err)
+	assert.Equal(t, userID, respFind.GetUserAccount().GetUserId())
+
+	// Saving the same username again is not a conflict with oneself.
+	_, err = st.AuthClient.UpdateProfile(authCtx, &sso.UpdateProfileRequest{UserName: username})
+	require.NoError(t, err)
+}
+
+func TestUpdateProfile_Fails(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	_, err := st.AuthClient.UpdateProfile(ctx, &sso.UpdateProfileRequest{UserName: randomUsername()})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	taken := randomUsername()
+	owner := registerAndLogin(ctx, t, st)
+	_, err = st.AuthClient.UpdateProfile(withBearer(ctx, owner.GetToken()), &sso.UpdateProfileRequest{UserName: taken})
+	require.NoError(t, err)
+
+	authCtx := withBearer(ctx, registerAndLogin(ctx, t, st).GetToken())
+
+	tests := []struct {
+		name     string
+		username string
+		code     codes.Code
+	}{
+		{name: "Too short", username: "ab", code: codes.InvalidArgument},
+		{name: "Too long", username: strings.Repeat("a", 31), code: codes.InvalidArgument},
+		{name: "Invalid characters", username: "no spaces", code: codes.InvalidArgument},
+		{name: "Taken", username: taken, code: codes.AlreadyExists},
+		{name: "Taken in another case", username: strings.ToUpper(taken), code: codes.AlreadyExists},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := st.AuthClient.UpdateProfile(authCtx, &sso.UpdateProfileRequest{UserName: tt.username})
+			assert.Equal(t, tt.code, status.Code(err))
+		})
+	}
+}
+
+func TestFindByUsername_NotFound(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	_, err := st.AuthClient.FindByUsername(ctx, &sso.FindByUsernameRequest{UserName: randomUsername()})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestFindMany(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	first := userIDOf(ctx, t, st, registerAndLogin(ctx, t, st).GetToken())
+	second := userIDOf(ctx, t, st, registerAndLogin(ctx, t, st).GetToken())
+
+	respFind, err := st.AuthClient.FindMany(ctx, &sso.FindManyRequest{
+		UserIds: []string{first, second, first, uuid.NewString()},
+	})
+	require.NoError(t, err)
+
+	var found []string
+	for _, account := range respFind.GetUserAccounts() {
+		found = append(found, account.GetUserId())
+	}
+	assert.ElementsMatch(t, []string{first, second}, found)
+
+	_, err = st.AuthClient.FindMany(ctx, &sso.FindManyRequest{UserIds: []string{"not-a-uuid"}})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	tooMany := make([]string, 101)
+	for i := range tooMany {
+		tooMany[i] = uuid.NewString()
+	}
+	_, err = st.AuthClient.FindMany(ctx, &sso.FindManyRequest{UserIds: tooMany})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func userIDOf(ctx context.Context, t *testing.T, st *suite.Suite, token string) string {
+	t.Helper()
+
+	respIntrospect, err := st.AuthClient.Introspect(ctx, &sso.IntrospectRequest{Token: token})
+	require.NoError(t, err)
+	require.True(t, respIntrospect.GetActive())
+
+	return respIntrospect.GetUserId()
+}
+
+func randomUsername() string {
+	return "user_" + strings.ReplaceAll(uuid.NewString(), "-", "")[:12]
+}
@@ -0,0 +1,149 @@
+package tests
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/Novochenko/protos/gen/go/sso"
+	"github.com/Novochenko/sso/tests/suite"
+	"github.com/brianvoe/gofakeit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// The admin is seeded by the test migrations.
+const (
+	adminEmail    = "admin@sso.test"
+	adminPassword = "admin-test-password"
+)
+
+func adminLogin(ctx context.Context, t *testing.T, st *suite.Suite) string {
+	t.Helper()
+
+	respLogin, err := st.AuthClient.Login(ctx, &sso.LoginRequest{
+		Email:    adminEmail,
+		Password: adminPassword,
+		AppId:    appID,
+	})
+	require.NoError(t, err)
+
+	return respLogin.GetToken()
+}
+
+func TestRBAC_AdminToken(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	respIntrospect, err := st.AuthClient.Introspect(ctx, &sso.IntrospectRequest{
+		Token: adminLogin(ctx, t, st),
+	})
+	require.NoError(t, err)
+	assert.True(t, respIntrospect.GetActive())
+	assert.Contains(t, respIntrospect.GetRoles(), "admin")
+	assert.ElementsMatch(t, []string{"sso.accounts.unlock", "sso.rbac.manage", "sso.sessions.manage", "sso.tokens.revoke", "sso.users.read"}, respIntrospect.GetPermissions())
+}
+
+func TestRBAC_GrantAndCheck(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	adminCtx := withBearer(ctx, adminLogin(ctx, t, st))
+
+	respRole, err := st.AuthClient.CreateRole(adminCtx, &sso.CreateRoleRequest{
+		AppId: appID,
+		Name:  "editor-" + strings.ToLower(gofakeit.Password(true, false, false, false, false, 8)),
+	})
+	require.NoError(t, err)
+	permissionName := "articles." + strings.ToLower(gofakeit.Password(true, false, false, false, false, 8)) + ".edit"
+	respPermission, err := st.AuthClient.CreatePermission(adminCtx, &sso.CreatePermissionRequest{
+		AppId: appID,
+		Name:  permissionName,
+	})
+	require.NoError(t, err)
+
+	_, err = st.AuthClient.GrantPermission(adminCtx, &sso.GrantPermissionRequest{
+		RoleId:       respRole.GetRole().GetId(),
+		PermissionId: respPermission.GetPermission().GetId(),
+	})
+	require.NoError(t, err)
+
+	email := gofakeit.Email()
+	password := randomFakePassword()
+	respRegister, err := st.AuthClient.Register(ctx, &sso.RegisterRequest{Email: email, Password: password})
+	require.NoError(t, err)
+	userID := respRegister.GetUserId()
+
+	checkPermission := func() bool {
+		respCheck, err := st.AuthClient.CheckPermission(adminCtx, &sso.CheckPermissionRequest{
+			UserId:     userID,
+			AppId:      appID,
+			Permission: permissionName,
+		})
+		require.NoError(t, err)
+		return respCheck.GetAllowed()
+	}
+	assert.False(t, checkPermission())
+
+	_, err = st.AuthClient.AssignRole(adminCtx, &sso.AssignRoleRequest{
+		UserId: userID,
+		RoleId: respRole.GetRole().GetId(),
+	})
+	require.NoError(t, err)
+	assert.True(t, checkPermission())
+
+	respLogin, err := st.AuthClient.Login(ctx, &sso.LoginRequest{Email: email, Password: password, AppId: appID})
+	require.NoError(t, err)
+	respIntrospect, err := st.AuthClient.Introspect(ctx, &sso.IntrospectRequest{Token: respLogin.GetToken()})
+	require.NoError(t, err)
+	assert.Equal(t, []string{respRole.GetRole().GetName()}, respIntrospect.GetRoles())
+	assert.Equal(t, []string{permissionName}, respIntrospect.GetPermissions())
+
+	// Users may check their own permissions.
+	respCheck, err := st.AuthClient.CheckPermission(withBearer(ctx, respLogin.GetToken()), &sso.CheckPermissionRequest{
+		UserId:     userID,
+		AppId:      appID,
+		Permission: permissionName,
+	})
+	require.NoError(t, err)
+	assert.True(t, respCheck.GetAllowed())
+
+	_, err = st.AuthClient.UnassignRole(adminCtx, &sso.UnassignRoleRequest{
+		UserId: userID,
+		RoleId: respRole.GetRole().GetId(),
+	})
+	require.NoError(t, err)
+	assert.False(t, checkPermission())
+}
+
+func TestRBAC_Fails(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	userCtx := withBearer(ctx, registerAndLogin(ctx, t, st).GetToken())
+
+	_, err := st.AuthClient.CreateRole(userCtx, &sso.CreateRoleRequest{AppId: appID, Name: "nope"})
+	require.Error(t, err)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	_, err = st.AuthClient.CheckPermission(userCtx, &sso.CheckPermissionRequest{
+		UserId:     gofakeit.UUID(),
+		AppId:      appID,
+		Permission: "sso.rbac.manage",
+	})
+	require.Error(t, err)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	adminCtx := withBearer(ctx, adminLogin(ctx, t, st))
+
+	_, err = st.AuthClient.CreateRole(adminCtx, &sso.CreateRoleRequest{AppId: appID, Name: "Not A Name"})
+	require.Error(t, err)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = st.AuthClient.CreateRole(adminCtx, &sso.CreateRoleRequest{AppId: 0, Name: "admin"})
+	require.Error(t, err)
+	assert.Equal(t, codes.AlreadyExists, status.Code(err))
+
+	_, err = st.AuthClient.AssignRole(adminCtx, &sso.AssignRoleRequest{UserId: gofakeit.UUID(), RoleId: 1})
+	require.Error(t, err)
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
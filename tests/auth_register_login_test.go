@@ -17,7 +17,6 @@ import (
 const (
 	emptyAppID = 0
 	appID      = 1
-	appSecret  = "test-secret"
 
 	passDefaultLen = 10
 )
@@ -44,9 +43,7 @@ func TestRegisteLogin_login_HappyPath(t *testing.T) {
 	token := respLogin.Token
 	require.NotEmpty(t, token)
 
-	tokenParsed, err := jwt.Parse(token, func(token *jwt.Token) (interface{}, error) {
-		return []byte(appSecret), nil
-	})
+	tokenParsed, err := jwt.Parse(token, jwksKeyfunc(ctx, t, st))
 	require.NoError(t, err)
 
 	claims, ok := tokenParsed.Claims.(jwt.MapClaims)
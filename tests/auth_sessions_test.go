@@ -0,0 +1,117 @@
+package tests
+
+import (
+	"testing"
+
+	"github.com/Novochenko/protos/gen/go/sso"
+	"github.com/Novochenko/sso/tests/suite"
+	"github.com/brianvoe/gofakeit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestSessions_ListAndRevoke(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	respLogin := registerAndLogin(ctx, t, st)
+	authCtx := withBearer(ctx, respLogin.GetToken())
+
+	respIntrospect, err := st.AuthClient.Introspect(ctx, &sso.IntrospectRequest{Token: respLogin.GetToken()})
+	require.NoError(t, err)
+	sessionID := respIntrospect.GetSessionId()
+	require.NotEmpty(t, sessionID)
+
+	respSessions, err := st.AuthClient.ListSessions(authCtx, &sso.ListSessionsRequest{})
+	require.NoError(t, err)
+	require.Len(t, respSessions.GetSessions(), 1)
+	session := respSessions.GetSessions()[0]
+	assert.Equal(t, sessionID, session.GetSessionId())
+	assert.Equal(t, int64(appID), session.GetAppId())
+	assert.True(t, session.GetCurrent())
+	assert.Contains(t, session.GetUserAgent(), "grpc-go")
+	assert.NotEmpty(t, session.GetIp())
+	assert.Greater(t, session.GetExpiresAt(), session.GetCreatedAt())
+
+	// A refresh stays in the same session.
+	respRefresh, err := st.AuthClient.Refresh(ctx, &sso.RefreshRequest{RefreshToken: respLogin.GetRefreshToken()})
+	require.NoError(t, err)
+	respIntrospect, err = st.AuthClient.Introspect(ctx, &sso.IntrospectRequest{Token: respRefresh.GetToken()})
+	require.NoError(t, err)
+	assert.Equal(t, sessionID, respIntrospect.GetSessionId())
+
+	_, err = st.AuthClient.RevokeSession(authCtx, &sso.RevokeSessionRequest{SessionId: sessionID})
+	require.NoError(t, err)
+
+	_, err = st.AuthClient.ListSessions(withBearer(ctx, respRefresh.GetToken()), &sso.ListSessionsRequest{})
+	require.Error(t, err)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	_, err = st.AuthClient.Refresh(ctx, &sso.RefreshRequest{RefreshToken: respRefresh.GetRefreshToken()})
+	require.Error(t, err)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+func TestSessions_AdminRevokesUserSession(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	respLogin := registerAndLogin(ctx, t, st)
+	userID := userIDOf(ctx, t, st, respLogin.GetToken())
+
+	adminCtx := withBearer(ctx, adminLogin(ctx, t, st))
+
+	respSessions, err := st.AuthClient.ListUserSessions(adminCtx, &sso.ListUserSessionsRequest{UserId: userID})
+	require.NoError(t, err)
+	require.Len(t, respSessions.GetSessions(), 1)
+	assert.False(t, respSessions.GetSessions()[0].GetCurrent())
+
+	_, err = st.AuthClient.RevokeUserSession(adminCtx, &sso.RevokeUserSessionRequest{
+		UserId:    userID,
+		SessionId: respSessions.GetSessions()[0].GetSessionId(),
+	})
+	require.NoError(t, err)
+
+	respSessions, err = st.AuthClient.ListUserSessions(adminCtx, &sso.ListUserSessionsRequest{UserId: userID})
+	require.NoError(t, err)
+	assert.Empty(t, respSessions.GetSessions())
+
+	_, err = st.AuthClient.Refresh(ctx, &sso.RefreshRequest{RefreshToken: respLogin.GetRefreshToken()})
+	require.Error(t, err)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+func TestSessions_Fails(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	victim := registerAndLogin(ctx, t, st)
+	respIntrospect, err := st.AuthClient.Introspect(ctx, &sso.IntrospectRequest{Token: victim.GetToken()})
+	require.NoError(t, err)
+
+	respLogin := registerAndLogin(ctx, t, st)
+	userCtx := withBearer(ctx, respLogin.GetToken())
+
+	_, err = st.AuthClient.ListSessions(ctx, &sso.ListSessionsRequest{})
+	require.Error(t, err)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	// Sessions of other users look like unknown ones.
+	_, err = st.AuthClient.RevokeSession(userCtx, &sso.RevokeSessionRequest{SessionId: respIntrospect.GetSessionId()})
+	require.Error(t, err)
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	_, err = st.AuthClient.RevokeSession(userCtx, &sso.RevokeSessionRequest{SessionId: "not-a-session"})
+	require.Error(t, err)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = st.AuthClient.ListUserSessions(userCtx, &sso.ListUserSessionsRequest{UserId: gofakeit.UUID()})
+	require.Error(t, err)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	_, err = st.AuthClient.RevokeUserSession(userCtx, &sso.RevokeUserSessionRequest{
+		UserId:    gofakeit.UUID(),
+		SessionId: respIntrospect.GetSessionId(),
+	})
+	require.Error(t, err)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+}
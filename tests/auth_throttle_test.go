@@ -0,0 +1,102 @@
+package tests
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/Novochenko/protos/gen/go/sso"
+	"github.com/Novochenko/sso/tests/suite"
+	"github.com/brianvoe/gofakeit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestLogin_ThrottledAfterFailures(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	email := gofakeit.Email()
+	password := randomFakePassword()
+	respRegister, err := st.AuthClient.Register(ctx, &sso.RegisterRequest{Email: email, Password: password})
+	require.NoError(t, err)
+
+	for range st.Cfg.LoginThrottle.Account.FreeAttempts + 1 {
+		_, err := st.AuthClient.Login(ctx, &sso.LoginRequest{Email: email, Password: randomFakePassword(), AppId: appID})
+		require.Error(t, err)
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	}
+
+	// Even the right password is refused until the backoff has passed.
+	var header metadata.MD
+	_, err = st.AuthClient.Login(ctx, &sso.LoginRequest{Email: email, Password: password, AppId: appID}, grpc.Header(&header))
+	require.Error(t, err)
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	require.Len(t, header.Get("retry-after"), 1)
+	retryAfter, err := strconv.Atoi(header.Get("retry-after")[0])
+	require.NoError(t, err)
+	assert.Positive(t, retryAfter)
+
+	_, err = st.AuthClient.UnlockAccount(withBearer(ctx, adminLogin(ctx, t, st)), &sso.UnlockAccountRequest{
+		UserId: respRegister.GetUserId(),
+	})
+	require.NoError(t, err)
+
+	respLogin, err := st.AuthClient.Login(ctx, &sso.LoginRequest{Email: email, Password: password, AppId: appID})
+	require.NoError(t, err)
+	assert.NotEmpty(t, respLogin.GetToken())
+}
+
+func TestReauthentication_ThrottledAfterFailures(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	email := gofakeit.Email()
+	password := randomFakePassword()
+	_, err := st.AuthClient.Register(ctx, &sso.RegisterRequest{Email: email, Password: password})
+	require.NoError(t, err)
+	respLogin, err := st.AuthClient.Login(ctx, &sso.LoginRequest{Email: email, Password: password, AppId: appID})
+	require.NoError(t, err)
+	authCtx := withBearer(ctx, respLogin.GetToken())
+
+	for range st.Cfg.LoginThrottle.Account.FreeAttempts + 1 {
+		_, err := st.AuthClient.DeleteAccount(authCtx, &sso.DeleteAccountRequest{Password: randomFakePassword()})
+		require.Error(t, err)
+		assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	}
+
+	// Password checks of signed-in users share the backoff of logins.
+	_, err = st.AuthClient.ChangePassword(authCtx, &sso.ChangePasswordRequest{
+		CurrentPassword: password,
+		NewPassword:     randomFakePassword(),
+	})
+	require.Error(t, err)
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+
+	_, err = st.AuthClient.Login(ctx, &sso.LoginRequest{Email: email, Password: password, AppId: appID})
+	require.Error(t, err)
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+}
+
+func TestUnlockAccount_Fails(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	respLogin := registerAndLogin(ctx, t, st)
+
+	_, err := st.AuthClient.UnlockAccount(withBearer(ctx, respLogin.GetToken()), &sso.UnlockAccountRequest{
+		UserId: gofakeit.UUID(),
+	})
+	require.Error(t, err)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	adminCtx := withBearer(ctx, adminLogin(ctx, t, st))
+
+	_, err = st.AuthClient.UnlockAccount(adminCtx, &sso.UnlockAccountRequest{UserId: "not-a-user"})
+	require.Error(t, err)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = st.AuthClient.UnlockAccount(adminCtx, &sso.UnlockAccountRequest{UserId: gofakeit.UUID()})
+	require.Error(t, err)
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
@@ -0,0 +1,129 @@
+package tests
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Novochenko/protos/gen/go/sso"
+	"github.com/Novochenko/sso/internal/lib/totp"
+	"github.com/Novochenko/sso/tests/suite"
+	"github.com/brianvoe/gofakeit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestTOTP_EnrollAndLogin(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	email := gofakeit.Email()
+	password := randomFakePassword()
+	_, err := st.AuthClient.Register(ctx, &sso.RegisterRequest{Email: email, Password: password})
+	require.NoError(t, err)
+	respLogin, err := st.AuthClient.Login(ctx, &sso.LoginRequest{Email: email, Password: password, AppId: appID})
+	require.NoError(t, err)
+	require.False(t, respLogin.GetMfaRequired())
+	authCtx := withBearer(ctx, respLogin.GetToken())
+
+	_, err = st.AuthClient.ConfirmTOTP(authCtx, &sso.ConfirmTOTPRequest{Code: "123456"})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	respEnroll, err := st.AuthClient.EnrollTOTP(authCtx, &sso.EnrollTOTPRequest{})
+	require.NoError(t, err)
+	require.NotEmpty(t, respEnroll.GetSecret())
+	assert.Contains(t, respEnroll.GetUri(), "otpauth://totp/")
+
+	// Enrolling is not enabling: logins still go straight through.
+	respLogin, err = st.AuthClient.Login(ctx, &sso.LoginRequest{Email: email, Password: password, AppId: appID})
+	require.NoError(t, err)
+	assert.False(t, respLogin.GetMfaRequired())
+
+	_, err = st.AuthClient.ConfirmTOTP(authCtx, &sso.ConfirmTOTPRequest{Code: "000000"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	now := time.Now()
+	code, err := totp.Code(respEnroll.GetSecret(), now)
+	require.NoError(t, err)
+	_, err = st.AuthClient.ConfirmTOTP(authCtx, &sso.ConfirmTOTPRequest{Code: code})
+	require.NoError(t, err)
+
+	_, err = st.AuthClient.EnrollTOTP(authCtx, &sso.EnrollTOTPRequest{})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	respLogin, err = st.AuthClient.Login(ctx, &sso.LoginRequest{Email: email, Password: password, AppId: appID})
+	require.NoError(t, err)
+	require.True(t, respLogin.GetMfaRequired())
+	assert.Empty(t, respLogin.GetToken())
+	assert.Empty(t, respLogin.GetRefreshToken())
+	challenge := respLogin.GetMfaToken()
+
+	// The code used for confirmation cannot be used again.
+	_, err = st.AuthClient.VerifyMFA(ctx, &sso.VerifyMFARequest{MfaToken: challenge, Code: code})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	next, err := totp.Code(respEnroll.GetSecret(), now.Add(totp.Period))
+	require.NoError(t, err)
+	respVerify, err := st.AuthClient.VerifyMFA(ctx, &sso.VerifyMFARequest{MfaToken: challenge, Code: next})
+	require.NoError(t, err)
+
+	respIntrospect, err := st.AuthClient.Introspect(ctx, &sso.IntrospectRequest{Token: respVerify.GetToken()})
+	require.NoError(t, err)
+	assert.True(t, respIntrospect.GetActive())
+	assert.Equal(t, email, respIntrospect.GetEmail())
+	assert.Equal(t, int64(appID), respIntrospect.GetAppId())
+
+	// A challenge completes one login only.
+	_, err = st.AuthClient.VerifyMFA(ctx, &sso.VerifyMFARequest{MfaToken: challenge, Code: next})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+func TestVerifyMFA_InvalidToken(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	respLogin := registerAndLogin(ctx, t, st)
+
+	// Access tokens are not MFA challenges.
+	_, err := st.AuthClient.VerifyMFA(ctx, &sso.VerifyMFARequest{MfaToken: respLogin.GetToken(), Code: "123456"})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+func TestVerifyMFA_ChallengeBurnedByWrongCodes(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	email := gofakeit.Email()
+	password := randomFakePassword()
+	_, err := st.AuthClient.Register(ctx, &sso.RegisterRequest{Email: email, Password: password})
+	require.NoError(t, err)
+	respLogin, err := st.AuthClient.Login(ctx, &sso.LoginRequest{Email: email, Password: password, AppId: appID})
+	require.NoError(t, err)
+	authCtx := withBearer(ctx, respLogin.GetToken())
+
+	respEnroll, err := st.AuthClient.EnrollTOTP(authCtx, &sso.EnrollTOTPRequest{})
+	require.NoError(t, err)
+	now := time.Now()
+	code, err := totp.Code(respEnroll.GetSecret(), now)
+	require.NoError(t, err)
+	_, err = st.AuthClient.ConfirmTOTP(authCtx, &sso.ConfirmTOTPRequest{Code: code})
+	require.NoError(t, err)
+
+	respLogin, err = st.AuthClient.Login(ctx, &sso.LoginRequest{Email: email, Password: password, AppId: appID})
+	require.NoError(t, err)
+	challenge := respLogin.GetMfaToken()
+
+	next, err := totp.Code(respEnroll.GetSecret(), now.Add(totp.Period))
+	require.NoError(t, err)
+	wrong := []byte(next)
+	wrong[0] = '0' + (wrong[0]-'0'+5)%10
+	for range 3 {
+		_, err = st.AuthClient.VerifyMFA(ctx, &sso.VerifyMFARequest{MfaToken: challenge, Code: string(wrong)})
+		require.Error(t, err)
+		assert.Equal(t, "invalid code", status.Convert(err).Message())
+	}
+
+	// The right code no longer completes the burned challenge.
+	_, err = st.AuthClient.VerifyMFA(ctx, &sso.VerifyMFARequest{MfaToken: challenge, Code: next})
+	require.Error(t, err)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	assert.Equal(t, "invalid or expired mfa_token", status.Convert(err).Message())
+}
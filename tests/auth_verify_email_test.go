@@ -0,0 +1,126 @@
+package tests
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Novochenko/protos/gen/go/sso"
+	"github.com/Novochenko/sso/tests/suite"
+	"github.com/brianvoe/gofakeit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// verifiedAppID requires a verified email to log in.
+	verifiedAppID     = 2
+	verifiedAppSecret = "test-verified-secret"
+
+	verifyEmailSubject   = "Confirm your email address"
+	resetPasswordSubject = "Reset your password"
+)
+
+func TestVerifyEmail_HappyPath(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	email := gofakeit.Email()
+	password := randomFakePassword()
+	_, err := st.AuthClient.Register(ctx, &sso.RegisterRequest{Email: email, Password: password})
+	require.NoError(t, err)
+
+	// Apps that don't require verification let the user in right away.
+	_, err = st.AuthClient.Login(ctx, &sso.LoginRequest{Email: email, Password: password, AppId: appID})
+	require.NoError(t, err)
+
+	_, err = st.AuthClient.Login(ctx, &sso.LoginRequest{Email: email, Password: password, AppId: verifiedAppID})
+	require.Error(t, err)
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	token := lastMailToken(t, st, email, verifyEmailSubject)
+
+	_, err = st.AuthClient.VerifyEmail(ctx, &sso.VerifyEmailRequest{Token: token})
+	require.NoError(t, err)
+
+	// Verification tokens are single use.
+	_, err = st.AuthClient.VerifyEmail(ctx, &sso.VerifyEmailRequest{Token: token})
+	require.Error(t, err)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = st.AuthClient.Login(ctx, &sso.LoginRequest{Email: email, Password: password, AppId: verifiedAppID})
+	require.NoError(t, err)
+}
+
+func TestResendVerification(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	email := gofakeit.Email()
+	_, err := st.AuthClient.Register(ctx, &sso.RegisterRequest{Email: email, Password: randomFakePassword()})
+	require.NoError(t, err)
+	first := lastMailToken(t, st, email, verifyEmailSubject)
+
+	_, err = st.AuthClient.ResendVerification(ctx, &sso.ResendVerificationRequest{Email: email})
+	require.NoError(t, err)
+	second := lastMailToken(t, st, email, verifyEmailSubject)
+	assert.NotEqual(t, first, second)
+
+	// Unknown addresses look the same as known ones.
+	_, err = st.AuthClient.ResendVerification(ctx, &sso.ResendVerificationRequest{Email: gofakeit.Email()})
+	require.NoError(t, err)
+}
+
+func TestVerifyEmail_InvalidToken(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	respLogin := registerAndLogin(ctx, t, st)
+
+	// An access token is not a verification token.
+	_, err := st.AuthClient.VerifyEmail(ctx, &sso.VerifyEmailRequest{Token: respLogin.GetToken()})
+	require.Error(t, err)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+var mailTokenRe = regexp.MustCompile(`\?token=(\S+)`)
+
+// lastMailToken waits for the file mailer to write an email with the subject
+// to the address and returns its token.
+func lastMailToken(t *testing.T, st *suite.Suite, email, subject string) string {
+	t.Helper()
+
+	body := lastMail(t, st, email, subject)
+	match := mailTokenRe.FindStringSubmatch(body)
+	require.NotNil(t, match, "no token in mail")
+	token, err := url.QueryUnescape(strings.TrimSpace(match[1]))
+	require.NoError(t, err)
+
+	return token
+}
+
+// lastMail waits for the file mailer to write an email with the subject to
+// the address and returns it.
+func lastMail(t *testing.T, st *suite.Suite, email, subject string) string {
+	t.Helper()
+
+	var body string
+	require.Eventually(t, func() bool {
+		files, err := filepath.Glob(filepath.Join(st.Cfg.Mail.Dir, "*-"+email+".eml"))
+		if err != nil || len(files) == 0 {
+			return false
+		}
+		// File names start with the send time, so the last one is the newest.
+		data, err := os.ReadFile(files[len(files)-1])
+		if err != nil {
+			return false
+		}
+		body = string(data)
+		return strings.Contains(body, "Subject: "+subject+"\r\n")
+	}, 5*time.Second, 50*time.Millisecond, "no %q mail sent to %s", subject, email)
+
+	return body
+}
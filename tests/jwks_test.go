@@ -0,0 +1,78 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/Novochenko/protos/gen/go/sso"
+	ssojwt "github.com/Novochenko/sso/internal/lib/jwt"
+	"github.com/Novochenko/sso/tests/suite"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJWKS_GRPCAndHTTPMatch(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	respJWKS, err := st.AuthClient.JWKS(ctx, &sso.JWKSRequest{})
+	require.NoError(t, err)
+	require.NotEmpty(t, respJWKS.GetKeys())
+
+	url := fmt.Sprintf("http://%s/.well-known/jwks.json", net.JoinHostPort("localhost", strconv.Itoa(st.Cfg.HTTP.Port)))
+	resp, err := http.Get(url)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var set ssojwt.JWKS
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&set))
+	require.Len(t, set.Keys, len(respJWKS.GetKeys()))
+
+	for i, key := range respJWKS.GetKeys() {
+		assert.Equal(t, key.GetKid(), set.Keys[i].KeyID)
+		assert.Equal(t, key.GetKty(), set.Keys[i].KeyType)
+		assert.Equal(t, key.GetAlg(), set.Keys[i].Algorithm)
+	}
+}
+
+func TestJWKS_TokenHasKnownKid(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	respLogin := registerAndLogin(ctx, t, st)
+
+	tokenParsed, err := jwt.Parse(respLogin.GetToken(), jwksKeyfunc(ctx, t, st))
+	require.NoError(t, err)
+	assert.NotEmpty(t, tokenParsed.Header["kid"])
+}
+
+// jwksKeyfunc resolves the verification key of a token by its kid header
+// using the JWKS published over gRPC.
+func jwksKeyfunc(ctx context.Context, t *testing.T, st *suite.Suite) jwt.Keyfunc {
+	t.Helper()
+
+	respJWKS, err := st.AuthClient.JWKS(ctx, &sso.JWKSRequest{})
+	require.NoError(t, err)
+
+	return func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		for _, key := range respJWKS.GetKeys() {
+			if key.GetKid() != kid {
+				continue
+			}
+			return ssojwt.JWK{
+				KeyType: key.GetKty(),
+				N:       key.GetN(),
+				E:       key.GetE(),
+				Curve:   key.GetCrv(),
+				X:       key.GetX(),
+			}.PublicKey()
+		}
+		return nil, fmt.Errorf("unknown kid %q", kid)
+	}
+}
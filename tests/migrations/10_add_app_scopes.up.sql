@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS app_scopes
+(
+    app_id INT NOT NULL,
+    scope  VARCHAR(100) NOT NULL,
+    PRIMARY KEY (app_id, scope)
+);
+
+INSERT IGNORE app_scopes (app_id, scope)
+VALUES (1, 'users.read'),
+       (1, 'users.write');
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS password_reset_tokens
+(
+    token_hash CHAR(64) PRIMARY KEY,
+    user_id    BINARY(36) NOT NULL,
+    expires_at DATETIME NOT NULL,
+    used_at    DATETIME NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX idx_password_reset_tokens_user ON password_reset_tokens(user_id);
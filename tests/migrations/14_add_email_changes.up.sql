@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS email_changes
+(
+    id                 BINARY(36) PRIMARY KEY,
+    user_id            BINARY(36) NOT NULL,
+    old_email          VARCHAR(60) NOT NULL,
+    new_email          VARCHAR(60) NOT NULL,
+    confirm_token_hash CHAR(64) NOT NULL UNIQUE,
+    undo_token_hash    CHAR(64) NOT NULL UNIQUE,
+    confirm_expires_at DATETIME NOT NULL,
+    undo_expires_at    DATETIME NOT NULL,
+    confirmed_at       DATETIME NULL,
+    undone_at          DATETIME NULL,
+    created_at         DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX idx_email_changes_user ON email_changes(user_id);
@@ -0,0 +1,4 @@
+DROP INDEX idx_users_username ON users;
+UPDATE users SET username = '0' WHERE username IS NULL;
+ALTER TABLE users
+    MODIFY COLUMN username VARCHAR(30) NOT NULL DEFAULT FALSE;
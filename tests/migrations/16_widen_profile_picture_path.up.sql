@@ -0,0 +1,4 @@
+-- pfp_path holds blob store keys now, which do not fit in 30 characters.
+ALTER TABLE users
+    MODIFY COLUMN pfp_path VARCHAR(255) NULL DEFAULT NULL;
+UPDATE users SET pfp_path = NULL WHERE pfp_path = '0';
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS webauthn_credentials
+(
+    id                 VARBINARY(255) PRIMARY KEY,
+    user_id            BINARY(36) NOT NULL,
+    name               VARCHAR(64) NOT NULL DEFAULT '',
+    -- COSE encoded, as sent by the authenticator.
+    public_key         VARBINARY(1024) NOT NULL,
+    sign_count         INT UNSIGNED NOT NULL DEFAULT 0,
+    aaguid             BINARY(16) NOT NULL,
+    attestation_format VARCHAR(32) NOT NULL,
+    created_at         DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_used_at       DATETIME NULL
+);
+CREATE INDEX idx_webauthn_credentials_user_id ON webauthn_credentials(user_id);
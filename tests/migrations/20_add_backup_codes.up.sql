@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS backup_codes
+(
+    id         BIGINT AUTO_INCREMENT PRIMARY KEY,
+    user_id    BINARY(36) NOT NULL,
+    code_hash  CHAR(64) NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    used_at    DATETIME NULL,
+    -- Set on the unused codes of a set when a new set is generated.
+    revoked_at DATETIME NULL,
+    UNIQUE KEY uq_backup_codes_user_code (user_id, code_hash)
+);
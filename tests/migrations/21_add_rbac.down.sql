@@ -0,0 +1,15 @@
+ALTER TABLE users
+    ADD COLUMN is_admin BOOLEAN NOT NULL DEFAULT FALSE;
+
+UPDATE users
+SET is_admin = TRUE
+WHERE id IN (SELECT ur.user_id
+             FROM user_roles ur
+                      JOIN roles r ON r.id = ur.role_id
+             WHERE r.app_id = 0
+               AND r.name = 'admin');
+
+DROP TABLE IF EXISTS user_roles;
+DROP TABLE IF EXISTS role_permissions;
+DROP TABLE IF EXISTS permissions;
+DROP TABLE IF EXISTS roles;
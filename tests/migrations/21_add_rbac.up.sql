@@ -0,0 +1,68 @@
+-- Roles and permissions with app_id 0 apply in every app.
+CREATE TABLE IF NOT EXISTS roles
+(
+    id          BIGINT AUTO_INCREMENT PRIMARY KEY,
+    app_id      INT NOT NULL DEFAULT 0,
+    name        VARCHAR(64) NOT NULL,
+    description VARCHAR(255) NOT NULL DEFAULT '',
+    UNIQUE KEY uq_roles_app_name (app_id, name)
+);
+
+CREATE TABLE IF NOT EXISTS permissions
+(
+    id          BIGINT AUTO_INCREMENT PRIMARY KEY,
+    app_id      INT NOT NULL DEFAULT 0,
+    name        VARCHAR(128) NOT NULL,
+    description VARCHAR(255) NOT NULL DEFAULT '',
+    UNIQUE KEY uq_permissions_app_name (app_id, name)
+);
+
+CREATE TABLE IF NOT EXISTS role_permissions
+(
+    role_id       BIGINT NOT NULL,
+    permission_id BIGINT NOT NULL,
+    PRIMARY KEY (role_id, permission_id)
+);
+
+CREATE TABLE IF NOT EXISTS user_roles
+(
+    user_id    BINARY(36) NOT NULL,
+    role_id    BIGINT NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, role_id)
+);
+CREATE INDEX idx_user_roles_role_id ON user_roles(role_id);
+
+INSERT INTO roles (app_id, name, description)
+VALUES (0, 'admin', 'Administers the SSO service');
+
+INSERT INTO permissions (app_id, name, description)
+VALUES (0, 'sso.tokens.revoke', 'Revoke the tokens of any user'),
+       (0, 'sso.rbac.manage', 'Manage roles, permissions and role assignments');
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id
+FROM roles r
+         JOIN permissions p ON p.app_id = 0
+WHERE r.app_id = 0
+  AND r.name = 'admin';
+
+INSERT INTO user_roles (user_id, role_id)
+SELECT u.id, r.id
+FROM users u
+         JOIN roles r ON r.app_id = 0 AND r.name = 'admin'
+WHERE u.is_admin;
+
+ALTER TABLE users
+    DROP COLUMN is_admin;
+
+-- An admin for the tests; the password is "admin-test-password".
+INSERT IGNORE users (id, email, pass_hash, email_verified)
+VALUES ('00000000-0000-0000-0000-00000000a001', 'admin@sso.test',
+        '$2a$10$6DmI/2ZCrE/hZ3BhwKdJpuTsuETrWksX0rmoT3mvtZ5WdR17E0u0e', TRUE);
+
+INSERT IGNORE user_roles (user_id, role_id)
+SELECT '00000000-0000-0000-0000-00000000a001', r.id
+FROM roles r
+WHERE r.app_id = 0
+  AND r.name = 'admin';
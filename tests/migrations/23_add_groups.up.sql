@@ -0,0 +1,38 @@
+-- GROUPS is a reserved word, hence user_groups. Groups with an org_id only
+-- hold members of that organization.
+CREATE TABLE IF NOT EXISTS user_groups
+(
+    id          BIGINT AUTO_INCREMENT PRIMARY KEY,
+    org_id      BIGINT NOT NULL DEFAULT 0,
+    name        VARCHAR(64) NOT NULL,
+    description VARCHAR(255) NOT NULL DEFAULT '',
+    created_at  DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE KEY uq_user_groups_org_name (org_id, name)
+);
+
+CREATE TABLE IF NOT EXISTS group_members
+(
+    group_id   BIGINT NOT NULL,
+    user_id    BINARY(36) NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (group_id, user_id)
+);
+CREATE INDEX idx_group_members_user_id ON group_members(user_id);
+
+-- The members of child_id are members of parent_id too.
+CREATE TABLE IF NOT EXISTS group_subgroups
+(
+    parent_id BIGINT NOT NULL,
+    child_id  BIGINT NOT NULL,
+    PRIMARY KEY (parent_id, child_id)
+);
+CREATE INDEX idx_group_subgroups_child_id ON group_subgroups(child_id);
+
+CREATE TABLE IF NOT EXISTS group_roles
+(
+    group_id   BIGINT NOT NULL,
+    role_id    BIGINT NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (group_id, role_id)
+);
+CREATE INDEX idx_group_roles_role_id ON group_roles(role_id);
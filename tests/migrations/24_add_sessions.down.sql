@@ -0,0 +1,12 @@
+DELETE rp
+FROM role_permissions rp
+         JOIN permissions p ON p.id = rp.permission_id
+WHERE p.app_id = 0
+  AND p.name = 'sso.sessions.manage';
+
+DELETE
+FROM permissions
+WHERE app_id = 0
+  AND name = 'sso.sessions.manage';
+
+DROP TABLE IF EXISTS sessions;
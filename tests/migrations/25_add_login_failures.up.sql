@@ -0,0 +1,20 @@
+-- Failed logins are counted per throttle key, "account:<email>" or
+-- "ip:<address>". The count starts over once the last failure is older than
+-- the throttle window.
+CREATE TABLE IF NOT EXISTS login_failures
+(
+    throttle_key    VARCHAR(320) PRIMARY KEY,
+    failures        INT NOT NULL,
+    last_failure_at DATETIME NOT NULL
+);
+CREATE INDEX idx_login_failures_last_failure_at ON login_failures(last_failure_at);
+
+INSERT INTO permissions (app_id, name, description)
+VALUES (0, 'sso.accounts.unlock', 'Lift the login lockout of any user');
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id
+FROM roles r
+         JOIN permissions p ON p.app_id = 0 AND p.name = 'sso.accounts.unlock'
+WHERE r.app_id = 0
+  AND r.name = 'admin';
@@ -0,0 +1,10 @@
+-- Set when a user's password turns up in a breach corpus; they cannot log in
+-- until they choose a new password.
+ALTER TABLE users
+    ADD COLUMN password_reset_required BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- A user whose password, "Pwned-But-Long-Enough-42", is in the test breach
+-- corpus, tests/testdata/breached_passwords.txt.
+INSERT IGNORE users (id, email, pass_hash, email_verified)
+VALUES ('00000000-0000-0000-0000-00000000b001', 'breached@sso.test',
+        '$2a$10$W4a1oSDCi1qakAAV/HCR5e98wFMo/ghEUEy8NQceNrw2ONOcCiVeW', TRUE);
@@ -0,0 +1,4 @@
+DROP INDEX idx_sessions_expires_at ON sessions;
+DROP INDEX idx_password_reset_tokens_expires_at ON password_reset_tokens;
+DROP INDEX idx_authorization_codes_expires_at ON authorization_codes;
+DROP INDEX idx_refresh_tokens_expires_at ON refresh_tokens;
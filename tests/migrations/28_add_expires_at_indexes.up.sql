@@ -0,0 +1,4 @@
+CREATE INDEX idx_refresh_tokens_expires_at ON refresh_tokens(expires_at);
+CREATE INDEX idx_authorization_codes_expires_at ON authorization_codes(expires_at);
+CREATE INDEX idx_password_reset_tokens_expires_at ON password_reset_tokens(expires_at);
+CREATE INDEX idx_sessions_expires_at ON sessions(expires_at);
@@ -0,0 +1,2 @@
+ALTER TABLE users
+    MODIFY COLUMN tokens_revoked_before DATETIME NULL;
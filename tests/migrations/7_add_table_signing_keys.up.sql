@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS signing_keys
+(
+    version       INT AUTO_INCREMENT PRIMARY KEY,
+    kid           VARCHAR(64) NOT NULL UNIQUE,
+    algorithm     VARCHAR(10) NOT NULL,
+    private_key   BLOB NOT NULL,
+    status        VARCHAR(10) NOT NULL,
+    created_at    DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    activated_at  DATETIME NULL,
+    retired_at    DATETIME NULL,
+    publish_until DATETIME NULL
+);
+CREATE INDEX idx_signing_keys_status ON signing_keys(status);
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS revoked_tokens
+(
+    jti        CHAR(36) PRIMARY KEY,
+    user_id    BINARY(36) NOT NULL,
+    expires_at DATETIME NOT NULL,
+    revoked_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX idx_revoked_tokens_expires_at ON revoked_tokens(expires_at);
+
+ALTER TABLE users
+    ADD COLUMN tokens_revoked_before DATETIME NULL;
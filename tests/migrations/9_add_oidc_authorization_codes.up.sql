@@ -0,0 +1,24 @@
+CREATE TABLE IF NOT EXISTS app_redirect_uris
+(
+    app_id       INT NOT NULL,
+    redirect_uri VARCHAR(255) NOT NULL,
+    PRIMARY KEY (app_id, redirect_uri)
+);
+
+CREATE TABLE IF NOT EXISTS authorization_codes
+(
+    code_hash             CHAR(64) PRIMARY KEY,
+    app_id                INT NOT NULL,
+    user_id               BINARY(36) NOT NULL,
+    redirect_uri          VARCHAR(255) NOT NULL,
+    scope                 VARCHAR(255) NOT NULL,
+    nonce                 VARCHAR(255) NOT NULL DEFAULT '',
+    code_challenge        VARCHAR(128) NOT NULL,
+    code_challenge_method VARCHAR(10) NOT NULL,
+    auth_time             DATETIME NOT NULL,
+    expires_at            DATETIME NOT NULL,
+    used_at               DATETIME NULL
+);
+
+INSERT IGNORE app_redirect_uris (app_id, redirect_uri)
+VALUES (1, 'http://localhost:3000/callback');
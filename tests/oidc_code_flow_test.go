@@ -0,0 +1,219 @@
+package tests
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/Novochenko/protos/gen/go/sso"
+	"github.com/Novochenko/sso/internal/lib/opaque"
+	"github.com/Novochenko/sso/tests/suite"
+	"github.com/brianvoe/gofakeit"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const redirectURI = "http://localhost:3000/callback"
+
+func TestOIDC_AuthorizationCodeFlowWithPKCE(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	email := gofakeit.Email()
+	password := randomFakePassword()
+	_, err := st.AuthClient.Register(ctx, &sso.RegisterRequest{Email: email, Password: password})
+	require.NoError(t, err)
+
+	base := "http://" + net.JoinHostPort("localhost", strconv.Itoa(st.Cfg.HTTP.Port))
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	verifier, err := opaque.New()
+	require.NoError(t, err)
+	sum := sha256.Sum256([]byte(verifier))
+	challenge := base64.RawURLEncoding.EncodeToString(sum[:])
+
+	resp, err := client.PostForm(base+"/authorize", url.Values{
+		"response_type":         {"code"},
+		"client_id":             {strconv.Itoa(appID)},
+		"redirect_uri":          {redirectURI},
+		"scope":                 {"openid email"},
+		"state":                 {"xyz"},
+		"nonce":                 {"n-0S6_WzA2Mj"},
+		"code_challenge":        {challenge},
+		"code_challenge_method": {"S256"},
+		"email":                 {email},
+		"password":              {password},
+		"action":                {"allow"},
+	})
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusFound, resp.StatusCode)
+
+	location, err := url.Parse(resp.Header.Get("Location"))
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(location.String(), redirectURI))
+	assert.Equal(t, "xyz", location.Query().Get("state"))
+	code := location.Query().Get("code")
+	require.NotEmpty(t, code)
+
+	tokenForm := url.Values{
+		"grant_type":    {"authorization_code"},
+		"client_id":     {strconv.Itoa(appID)},
+		"code":          {code},
+		"redirect_uri":  {redirectURI},
+		"code_verifier": {verifier},
+	}
+	// A confidential client cannot leave out its secret.
+	resp, err = client.PostForm(base+"/token", tokenForm)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	tokenForm.Set("client_secret", appSecret)
+	resp, err = client.PostForm(base+"/token", tokenForm)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var tokens struct {
+		AccessToken  string `json:"access_token"`
+		RefreshToken string `json:"refresh_token"`
+		IDToken      string `json:"id_token"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&tokens))
+	require.NotEmpty(t, tokens.AccessToken)
+	require.NotEmpty(t, tokens.RefreshToken)
+
+	idToken, err := jwt.Parse(tokens.IDToken, jwksKeyfunc(ctx, t, st))
+	require.NoError(t, err)
+	claims := idToken.Claims.(jwt.MapClaims)
+	assert.Equal(t, email, claims["email"])
+	assert.Equal(t, "n-0S6_WzA2Mj", claims["nonce"])
+	assert.Equal(t, strconv.Itoa(appID), claims["aud"])
+
+	// Codes are single use.
+	resp, err = client.PostForm(base+"/token", tokenForm)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	req, err := http.NewRequest(http.MethodGet, base+"/userinfo", nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer "+tokens.AccessToken)
+	resp, err = client.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var info map[string]any
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&info))
+	assert.Equal(t, claims["sub"], info["sub"])
+
+	// Refresh tokens are bound to the client they were issued to.
+	refreshForm := url.Values{
+		"grant_type":    {"refresh_token"},
+		"client_id":     {strconv.Itoa(verifiedAppID)},
+		"client_secret": {verifiedAppSecret},
+		"refresh_token": {tokens.RefreshToken},
+	}
+	resp, err = client.PostForm(base+"/token", refreshForm)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	refreshForm.Set("client_id", strconv.Itoa(appID))
+	refreshForm.Del("client_secret")
+	resp, err = client.PostForm(base+"/token", refreshForm)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	refreshForm.Set("client_secret", appSecret)
+	resp, err = client.PostForm(base+"/token", refreshForm)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestOIDC_SessionCookieIsNotAnAccessToken(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	email := gofakeit.Email()
+	password := randomFakePassword()
+	_, err := st.AuthClient.Register(ctx, &sso.RegisterRequest{Email: email, Password: password})
+	require.NoError(t, err)
+
+	base := "http://" + net.JoinHostPort("localhost", strconv.Itoa(st.Cfg.HTTP.Port))
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	verifier, err := opaque.New()
+	require.NoError(t, err)
+	sum := sha256.Sum256([]byte(verifier))
+
+	resp, err := client.PostForm(base+"/authorize", url.Values{
+		"response_type":         {"code"},
+		"client_id":             {strconv.Itoa(appID)},
+		"redirect_uri":          {redirectURI},
+		"scope":                 {"openid"},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(sum[:])},
+		"code_challenge_method": {"S256"},
+		"email":                 {email},
+		"password":              {password},
+		"action":                {"allow"},
+	})
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusFound, resp.StatusCode)
+
+	var session string
+	for _, cookie := range resp.Cookies() {
+		if cookie.Name == "sso_session" {
+			session = cookie.Value
+		}
+	}
+	require.NotEmpty(t, session)
+
+	_, err = st.AuthClient.ListSessions(withBearer(ctx, session), &sso.ListSessionsRequest{})
+	require.Error(t, err)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	req, err := http.NewRequest(http.MethodGet, base+"/userinfo", nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer "+session)
+	resp, err = client.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
+
+func TestOIDC_Discovery(t *testing.T) {
+	_, st := suite.New(t)
+
+	base := "http://" + net.JoinHostPort("localhost", strconv.Itoa(st.Cfg.HTTP.Port))
+	resp, err := http.Get(base + "/.well-known/openid-configuration")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var doc map[string]any
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&doc))
+	assert.Equal(t, st.Cfg.OIDC.Issuer, doc["issuer"])
+	assert.Equal(t, st.Cfg.OIDC.Issuer+"/.well-known/jwks.json", doc["jwks_uri"])
+	assert.Contains(t, doc["code_challenge_methods_supported"], "S256")
+}
@@ -0,0 +1,234 @@
+package tests
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Novochenko/protos/gen/go/sso"
+	"github.com/Novochenko/sso/tests/suite"
+	"github.com/brianvoe/gofakeit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const grantTypeDeviceCode = "urn:ietf:params:oauth:grant-type:device_code"
+
+func TestOIDC_DeviceFlow(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	email := gofakeit.Email()
+	password := randomFakePassword()
+	_, err := st.AuthClient.Register(ctx, &sso.RegisterRequest{Email: email, Password: password})
+	require.NoError(t, err)
+
+	base := "http://" + net.JoinHostPort("localhost", strconv.Itoa(st.Cfg.HTTP.Port))
+
+	resp, err := http.PostForm(base+"/device_authorization", url.Values{
+		"client_id":     {strconv.Itoa(appID)},
+		"client_secret": {appSecret},
+		"scope":         {"openid email"},
+	})
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var device struct {
+		DeviceCode      string `json:"device_code"`
+		UserCode        string `json:"user_code"`
+		VerificationURI string `json:"verification_uri"`
+		Interval        int64  `json:"interval"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&device))
+	require.NotEmpty(t, device.DeviceCode)
+	require.NotEmpty(t, device.UserCode)
+	assert.Equal(t, st.Cfg.OIDC.Issuer+"/device", device.VerificationURI)
+	assert.Positive(t, device.Interval)
+
+	poll := url.Values{
+		"grant_type":    {grantTypeDeviceCode},
+		"client_id":     {strconv.Itoa(appID)},
+		"client_secret": {appSecret},
+		"device_code":   {device.DeviceCode},
+	}
+	assert.Equal(t, "authorization_pending", pollDeviceError(t, base, poll))
+	// Polling again right away is too fast.
+	assert.Equal(t, "slow_down", pollDeviceError(t, base, poll))
+
+	resp, err = http.PostForm(base+"/device", url.Values{
+		"user_code": {device.UserCode},
+		"email":     {email},
+		"password":  {password},
+		"action":    {"allow"},
+	})
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp, err = http.PostForm(base+"/token", poll)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var tokens struct {
+		AccessToken  string `json:"access_token"`
+		RefreshToken string `json:"refresh_token"`
+		IDToken      string `json:"id_token"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&tokens))
+	assert.NotEmpty(t, tokens.AccessToken)
+	assert.NotEmpty(t, tokens.RefreshToken)
+	assert.NotEmpty(t, tokens.IDToken)
+
+	// Tokens are issued only once per device code.
+	assert.Equal(t, "invalid_grant", pollDeviceError(t, base, poll))
+}
+
+func TestOIDC_DeviceFlowDenied(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	email := gofakeit.Email()
+	password := randomFakePassword()
+	_, err := st.AuthClient.Register(ctx, &sso.RegisterRequest{Email: email, Password: password})
+	require.NoError(t, err)
+
+	base := "http://" + net.JoinHostPort("localhost", strconv.Itoa(st.Cfg.HTTP.Port))
+
+	resp, err := http.PostForm(base+"/device_authorization", url.Values{
+		"client_id":     {strconv.Itoa(appID)},
+		"client_secret": {appSecret},
+	})
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var device struct {
+		DeviceCode string `json:"device_code"`
+		UserCode   string `json:"user_code"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&device))
+
+	poll := url.Values{
+		"grant_type":    {grantTypeDeviceCode},
+		"client_id":     {strconv.Itoa(appID)},
+		"client_secret": {appSecret},
+		"device_code":   {device.DeviceCode},
+	}
+
+	// Knowing the user code is not enough to deny the request.
+	resp, err = http.PostForm(base+"/device", url.Values{
+		"user_code": {device.UserCode},
+		"action":    {"deny"},
+	})
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	assert.Equal(t, "authorization_pending", pollDeviceError(t, base, poll))
+
+	resp, err = http.PostForm(base+"/device", url.Values{
+		"user_code": {device.UserCode},
+		"email":     {email},
+		"password":  {password},
+		"action":    {"deny"},
+	})
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	assert.Equal(t, "access_denied", pollDeviceError(t, base, poll))
+}
+
+func TestOIDC_DeviceCodeLockedAfterFailedSignIns(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	email := gofakeit.Email()
+	password := randomFakePassword()
+	_, err := st.AuthClient.Register(ctx, &sso.RegisterRequest{Email: email, Password: password})
+	require.NoError(t, err)
+
+	base := "http://" + net.JoinHostPort("localhost", strconv.Itoa(st.Cfg.HTTP.Port))
+
+	resp, err := http.PostForm(base+"/device_authorization", url.Values{
+		"client_id":     {strconv.Itoa(appID)},
+		"client_secret": {appSecret},
+	})
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var device struct {
+		DeviceCode string `json:"device_code"`
+		UserCode   string `json:"user_code"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&device))
+
+	// Each guess is at another account, so only the user code adds up.
+	for i := 1; i <= st.Cfg.OIDC.DeviceMaxAttempts; i++ {
+		status := postDeviceRetrying(t, base, url.Values{
+			"user_code": {device.UserCode},
+			"email":     {gofakeit.Email()},
+			"password":  {randomFakePassword()},
+			"action":    {"allow"},
+		})
+		if i < st.Cfg.OIDC.DeviceMaxAttempts {
+			require.Equal(t, http.StatusUnauthorized, status)
+		} else {
+			require.Equal(t, http.StatusForbidden, status)
+		}
+	}
+
+	// The right password comes too late.
+	status := postDeviceRetrying(t, base, url.Values{
+		"user_code": {device.UserCode},
+		"email":     {email},
+		"password":  {password},
+		"action":    {"allow"},
+	})
+	assert.Equal(t, http.StatusNotFound, status)
+
+	assert.Equal(t, "access_denied", pollDeviceError(t, base, url.Values{
+		"grant_type":    {grantTypeDeviceCode},
+		"client_id":     {strconv.Itoa(appID)},
+		"client_secret": {appSecret},
+		"device_code":   {device.DeviceCode},
+	}))
+}
+
+// postDeviceRetrying submits the device verification form, waiting out
+// throttling, and returns the status of the answer.
+func postDeviceRetrying(t *testing.T, base string, form url.Values) int {
+	t.Helper()
+
+	for {
+		resp, err := http.PostForm(base+"/device", form)
+		require.NoError(t, err)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusTooManyRequests {
+			return resp.StatusCode
+		}
+
+		retryAfter, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+		require.NoError(t, err)
+		time.Sleep(time.Duration(retryAfter) * time.Second)
+	}
+}
+
+func pollDeviceError(t *testing.T, base string, form url.Values) string {
+	t.Helper()
+
+	resp, err := http.PostForm(base+"/token", form)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	var body struct {
+		Error string `json:"error"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+
+	return body.Error
+}